@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The records are accounted twice: attempted when a result is sent to the writer or an error is reported,
+// recorded once the record was written without error, by the writer for the results. TearDown reconciles
+// them with the handler counters, a record lost on its way or failing to be written is a discrepancy
+// printed on DebugOut, failing the run with -strict-accounting.
+
+type recordClass int
+
+const (
+	recordResult recordClass = iota // the CRC records of the output
+	recordError                     // the error records of the error output
+	recordClassCount
+)
+
+var recordClassNames = [recordClassCount]string{"result", "error"}
+
+type accounting struct {
+	attempted     [recordClassCount]atomic.Uint64
+	recorded      [recordClassCount]atomic.Uint64
+	remote        bool // the results are sent to a coordinator, not to the writer
+	discrepancies int  // set by TearDown
+}
+
+// sendResult hands res to the writer, accounting its record as attempted
+func (mc *MassCRC32C) sendResult(res fileResult) {
+	if res.item.priority {
+		mc.echoPriority(res)
+	}
+	if res.err != nil {
+		mc.accounting.attempted[recordError].Add(1)
+	} else {
+		mc.accounting.attempted[recordResult].Add(1)
+	}
+	mc.results <- res
+}
+
+// reconcileAccounting compares the records attempted, recorded and counted by the handlers once the writer
+// is done, printing the discrepancies
+func (mc *MassCRC32C) reconcileAccounting() {
+	acc := &mc.accounting
+	acc.discrepancies = 0
+	counted := mc.fileCount.Load() + mc.carriedForwardCount.Load()
+	if attempted := acc.attempted[recordResult].Load(); counted != attempted && !acc.remote {
+		fmt.Fprintf(mc.DebugOut, "ACCOUNTING ERROR: %d files computed or carried forward but %d result records sent to the writer\n", counted, attempted)
+		acc.discrepancies++
+	}
+	for class := recordClass(0); class < recordClassCount; class++ {
+		attempted, recorded := acc.attempted[class].Load(), acc.recorded[class].Load()
+		if attempted != recorded {
+			fmt.Fprintf(
+				mc.DebugOut,
+				"ACCOUNTING ERROR: %d %s records attempted but %d written, %d lost or failing to be written\n",
+				attempted, recordClassNames[class], recorded, int64(attempted)-int64(recorded),
+			)
+			acc.discrepancies++
+		}
+	}
+}
+
+// AccountingDiscrepancies returns the count of the discrepancies between the records attempted, written
+// and counted found by TearDown, 0 when every record is accounted for
+func (mc *MassCRC32C) AccountingDiscrepancies() int {
+	return mc.accounting.discrepancies
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// flakyWriter fails every Nth write, writing nothing
+type flakyWriter struct {
+	w      io.Writer
+	every  int
+	writes int
+}
+
+func (fw *flakyWriter) Write(p []byte) (int, error) {
+	fw.writes++
+	if fw.every > 0 && fw.writes%fw.every == 0 {
+		return 0, errors.New("disk full")
+	}
+	return fw.w.Write(p)
+}
+
+func accountedRun(t *testing.T, out io.Writer, errOut io.Writer) (*MassCRC32C, string) {
+	fo := &fakeOpener{objects: make(map[string]string)}
+	var paths []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("object%d", i)
+		fo.objects[name] = name
+		paths = append(paths, "fake://"+name)
+	}
+	debugOut := &bytes.Buffer{}
+	mc := runPaths(t, 2, append(paths, "fake://missing1", "fake://missing2", "fake://missing3"), func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.DebugOut = debugOut
+		mc.RegisterOpener("fake", fo)
+	})
+	return mc, debugOut.String()
+}
+
+func TestAccounting(t *testing.T) {
+	out := &bytes.Buffer{}
+	mc, debugOut := accountedRun(t, out, io.Discard)
+	if mc.AccountingDiscrepancies() != 0 || strings.Contains(debugOut, "ACCOUNTING") || strings.Count(out.String(), "\n") != 30 {
+		t.Errorf("got %d discrepancies, %q", mc.AccountingDiscrepancies(), debugOut)
+	}
+
+	// every 3rd record failing to be written
+	out.Reset()
+	mc, debugOut = accountedRun(t, &flakyWriter{w: out, every: 3}, io.Discard)
+	if lines := strings.Count(out.String(), "\n"); lines != 20 {
+		t.Fatalf("got %d records written, expected 20", lines)
+	}
+	if mc.AccountingDiscrepancies() != 1 || !strings.Contains(debugOut, "ACCOUNTING ERROR: 30 result records attempted but 20 written, 10 lost") {
+		t.Errorf("got %d discrepancies, %q", mc.AccountingDiscrepancies(), debugOut)
+	}
+
+	// the error records failing too
+	mc, debugOut = accountedRun(t, io.Discard, &flakyWriter{w: io.Discard, every: 1})
+	if mc.AccountingDiscrepancies() != 1 || !strings.Contains(debugOut, "ACCOUNTING ERROR: 3 error records attempted but 0 written") {
+		t.Errorf("got %d discrepancies, %q", mc.AccountingDiscrepancies(), debugOut)
+	}
+}
+
+// Test a result counted by a handler but never sent to the writer is a discrepancy
+func TestAccountingLostResult(t *testing.T) {
+	debugOut := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"a", "lost", "b"}, func(mc *MassCRC32C) {
+		mc.DebugOut = debugOut
+		mc.HandlerFunc = func(item QueueItem) error {
+			mc.countComputed(item, 1)
+			if item.Path != "lost" {
+				mc.sendResult(fileResult{item: item, crc: "AAAAAA==", size: 1})
+			}
+			return nil
+		}
+	})
+	if mc.AccountingDiscrepancies() != 1 || !strings.Contains(debugOut.String(), "3 files computed or carried forward but 2 result records") {
+		t.Errorf("got %d discrepancies, %q", mc.AccountingDiscrepancies(), debugOut)
+	}
+}
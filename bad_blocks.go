@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The bad ranges of a record read with -skip-bad-blocks follow its path after a tab, like the stat fields:
+//
+//	badblocks=count ":" offset "+" length *("," offset "+" length)
+//
+// The record is partial, its CRC covers zeros, or nothing with -bad-block-fill skip, in place of the ranges.
+
+// badBlockConfig is how -skip-bad-blocks steps over the unreadable ranges
+type badBlockConfig struct {
+	blockSize int64 // a failed read resumes at the next multiple of blockSize
+	skip      bool  // leave the unreadable ranges out of the CRC instead of hashing zeros
+}
+
+func (c badBlockConfig) String() string {
+	fill := "zeros"
+	if c.skip {
+		fill = "skip"
+	}
+	return fmt.Sprintf("block size %dB, fill %s", c.blockSize, fill)
+}
+
+func parseBadBlockFill(fill string) (bool, error) {
+	switch fill {
+	case "zeros":
+		return false, nil
+	case "skip":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown bad block fill %q, expected zeros or skip", fill)
+}
+
+// BadRange is a byte range of a file that could not be read
+type BadRange struct {
+	Offset int64
+	Length int64
+}
+
+// badBlocks is the error of a file read with unreadable ranges, reported on ErrOut along the partial record
+type badBlocks struct {
+	ranges []BadRange
+	skip   bool
+	err    error // the first failed read
+}
+
+// add records an unreadable range, merged with the previous one when adjacent
+func (bb *badBlocks) add(offset int64, length int64) {
+	if n := len(bb.ranges); n > 0 && bb.ranges[n-1].Offset+bb.ranges[n-1].Length == offset {
+		bb.ranges[n-1].Length += length
+		return
+	}
+	bb.ranges = append(bb.ranges, BadRange{Offset: offset, Length: length})
+}
+
+func (bb *badBlocks) bytes() int64 {
+	var n int64
+	for _, r := range bb.ranges {
+		n += r.Length
+	}
+	return n
+}
+
+func (bb *badBlocks) String() string {
+	return formatBadRanges(bb.ranges)
+}
+
+// formatBadRanges is the value of the badblocks field of the records
+func formatBadRanges(ranges []BadRange) string {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(len(ranges)))
+	sb.WriteByte(':')
+	for i, r := range ranges {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatInt(r.Offset, 10))
+		sb.WriteByte('+')
+		sb.WriteString(strconv.FormatInt(r.Length, 10))
+	}
+	return sb.String()
+}
+
+func (bb *badBlocks) Error() string {
+	fill := "zero filled"
+	if bb.skip {
+		fill = "skipped"
+	}
+	return fmt.Sprintf("partial checksum, %dB in unreadable ranges %s %s: %v", bb.bytes(), bb.String(), fill, bb.err)
+}
+
+func (bb *badBlocks) Unwrap() error {
+	return bb.err
+}
+
+// validBadBlocks checks the value of a badblocks field
+func validBadBlocks(value string) bool {
+	count, ranges, ok := strings.Cut(value, ":")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return false
+	}
+	parts := strings.Split(ranges, ",")
+	if len(parts) != n {
+		return false
+	}
+	for _, part := range parts {
+		offset, length, ok := strings.Cut(part, "+")
+		if !ok {
+			return false
+		}
+		if _, err := strconv.ParseUint(offset, 10, 63); err != nil {
+			return false
+		}
+		if _, err := strconv.ParseUint(length, 10, 63); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// badBlockReader reads a file of size bytes stepping over the ranges failing with EIO,
+// any other error or an EIO past size is returned as is
+type badBlockReader struct {
+	r      io.ReadSeeker
+	size   int64
+	cfg    badBlockConfig
+	offset int64 // in the file
+	zeros  int64 // left to return in place of the last unreadable range
+	bad    *badBlocks
+}
+
+func newBadBlockReader(r io.ReadSeeker, size int64, cfg badBlockConfig) *badBlockReader {
+	return &badBlockReader{r: r, size: size, cfg: cfg}
+}
+
+func (br *badBlockReader) Read(p []byte) (int, error) {
+	if br.zeros > 0 {
+		if int64(len(p)) > br.zeros {
+			p = p[:br.zeros]
+		}
+		for i := range p {
+			p[i] = 0
+		}
+		br.zeros -= int64(len(p))
+		return len(p), nil
+	}
+	n, err := br.r.Read(p)
+	br.offset += int64(n)
+	if err == nil || !errors.Is(err, syscall.EIO) || br.offset >= br.size {
+		return n, err
+	}
+	next := (br.offset/br.cfg.blockSize + 1) * br.cfg.blockSize
+	if next > br.size {
+		next = br.size
+	}
+	if _, seekErr := br.r.Seek(next, io.SeekStart); seekErr != nil {
+		return n, err
+	}
+	if br.bad == nil {
+		br.bad = &badBlocks{skip: br.cfg.skip, err: err}
+	}
+	br.bad.add(br.offset, next-br.offset)
+	if !br.cfg.skip {
+		br.zeros = next - br.offset
+	}
+	br.offset = next
+	return n, nil
+}
+
+// skipped is the count of bytes of the file left out of the data read
+func (br *badBlockReader) skipped() uint64 {
+	if br.bad == nil || !br.cfg.skip {
+		return 0
+	}
+	return uint64(br.bad.bytes())
+}
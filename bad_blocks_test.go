@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingDisk reads data failing with EIO in the bad ranges
+type failingDisk struct {
+	data   []byte
+	bad    []BadRange
+	offset int64
+}
+
+func (d *failingDisk) Read(p []byte) (int, error) {
+	if d.offset >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	end := d.offset + int64(len(p))
+	for _, r := range d.bad {
+		if d.offset >= r.Offset && d.offset < r.Offset+r.Length {
+			return 0, &fs.PathError{Op: "read", Path: "disk", Err: syscall.EIO}
+		}
+		if r.Offset > d.offset && r.Offset < end {
+			end = r.Offset
+		}
+	}
+	n := copy(p, d.data[d.offset:end])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *failingDisk) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return 0, fmt.Errorf("unexpected whence %d", whence)
+	}
+	d.offset = offset
+	return offset, nil
+}
+
+func crcOf(data []byte) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestBadBlockReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000) // 16000 bytes
+	bad := []BadRange{{Offset: 4100, Length: 10}, {Offset: 8192, Length: 4096}, {Offset: 15990, Length: 10}}
+	tests := []struct {
+		skip   bool
+		ranges string
+		size   uint64
+		data   func() []byte
+	}{
+		{false, "2:4100+8188,15990+10", 16000, func() []byte {
+			filled := append([]byte(nil), data...)
+			copy(filled[4100:12288], make([]byte, 8188))
+			copy(filled[15990:], make([]byte, 10))
+			return filled
+		}},
+		{true, "2:4100+8188,15990+10", 7802, func() []byte {
+			return append(append([]byte(nil), data[:4100]...), data[12288:15990]...)
+		}},
+	}
+	for _, test := range tests {
+		mc := InitMassCRC32C(1, 1)
+		br := newBadBlockReader(&failingDisk{data: data, bad: bad}, int64(len(data)), badBlockConfig{blockSize: 4096, skip: test.skip})
+		crc, size, err := mc.CRCReader(br)
+		if err != nil || size != test.size || crc != crcOf(test.data()) {
+			t.Errorf("skip %t: got %s %d %v, expected %s %d", test.skip, crc, size, err, crcOf(test.data()), test.size)
+		}
+		if br.bad == nil || br.bad.String() != test.ranges {
+			t.Fatalf("skip %t: got ranges %v, expected %s", test.skip, br.bad, test.ranges)
+		}
+		if size+br.skipped() != uint64(len(data)) {
+			t.Errorf("skip %t: %d bytes read and %d skipped, expected %d", test.skip, size, br.skipped(), len(data))
+		}
+		if !strings.Contains(br.bad.Error(), "8198B in unreadable ranges") || !strings.Contains(br.bad.Error(), "input/output error") {
+			t.Errorf("skip %t: error %q", test.skip, br.bad.Error())
+		}
+	}
+
+	// any other error is returned
+	br := newBadBlockReader(&failingDisk{data: data, bad: bad}, 4000, badBlockConfig{blockSize: 4096})
+	if _, _, err := InitMassCRC32C(1, 1).CRCReader(br); err == nil || br.bad != nil {
+		t.Errorf("an EIO past the size at open was stepped over: %v %v", err, br.bad)
+	}
+}
+
+func TestBadBlocksRecord(t *testing.T) {
+	bb := &badBlocks{}
+	bb.add(0, 512)
+	bb.add(512, 512)
+	bb.add(4096, 4096)
+	res := Result{Path: "a b", CRC: "AAAAAA==", Size: 3, BadBlocks: bb.ranges}
+	out := &bytes.Buffer{}
+	statFields{}.recordWriter()(out, res)
+	statFields{nlink: true}.recordWriter()(out, res)
+	res.BadBlocks = nil
+	statFields{}.recordWriter()(out, res)
+	expected := "AAAAAA== 3 a b\tbadblocks=2:0+1024,4096+4096\n" +
+		"AAAAAA== 3 a b\tnlink=0 badblocks=2:0+1024,4096+4096\n" +
+		"AAAAAA== 3 a b\n"
+	if out.String() != expected {
+		t.Fatalf("got %q, expected %q", out.String(), expected)
+	}
+
+	tests := []struct {
+		line    string
+		path    string
+		partial bool
+	}{
+		{"AAAAAA== 3 a b\tbadblocks=2:0+1024,4096+4096", "a b", true},
+		{"AAAAAA== 3 a\tnlink=1 badblocks=1:0+1", "a", true},
+		{"AAAAAA== 3 a\tbadblocks=2:0+1", "a\tbadblocks=2:0+1", false},
+		{"AAAAAA== 3 a\tbadblocks=1:x+1", "a\tbadblocks=1:x+1", false},
+		{`{"crc32c":"AAAAAA==","size":3,"path":"a","bad_blocks":[{"offset":0,"length":1}]}`, "a", true},
+		{`{"crc32c":"AAAAAA==","size":3,"path":"a"}`, "a", false},
+	}
+	for _, test := range tests {
+		record, err := parseManifestLine(test.line)
+		if err != nil || record.Path != test.path || record.Partial != test.partial {
+			t.Errorf("%q: got %+v %v, expected path %q partial %t", test.line, record, err, test.path, test.partial)
+		}
+	}
+}
+
+func TestSinceSkipsPartialRecords(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	manifest := &bytes.Buffer{}
+	fmt.Fprintf(manifest, "# mass-crc32c started=%s\n", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	past := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"whole", "partial"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	fmt.Fprintf(manifest, "AAAAAA== 5 %s\n", paths[0])
+	fmt.Fprintf(manifest, "AAAAAA== 7 %s\tbadblocks=1:0+7\n", paths[1])
+	manifestPath := filepath.Join(dir, "old.txt")
+	if err := os.WriteFile(manifestPath, manifest.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, mc := runSince(t, manifestPath, paths, time.Time{})
+	if !strings.Contains(out, "AAAAAA== 5 "+paths[0]+"\n") || !strings.Contains(out, crcOf([]byte("partial"))+" 7 "+paths[1]+"\n") {
+		t.Errorf("partial record carried forward: %q", out)
+	}
+	if mc.carriedForwardCount.Load() != 1 || mc.fileCount.Load() != 1 {
+		t.Errorf("got %d carried forward %d computed", mc.carriedForwardCount.Load(), mc.fileCount.Load())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Binary manifest format, written by -format binary and read by the manifest parser, gzipped or not:
+//
+//	header  the 8 bytes "MCRCBIN\x00" then a version byte, 1
+//	record  uvarint path length, path bytes, 4 bytes big endian CRC32C, uvarint size
+//
+// Records follow the header up to EOF, there are no comments and the list ordinals are not kept.
+const (
+	binaryManifestMagic   = "MCRCBIN\x00"
+	binaryManifestVersion = 1
+)
+
+var errBinaryManifestVersion = errors.New("unsupported binary manifest version")
+
+func writeBinaryManifestHeader(w io.Writer) error {
+	_, err := w.Write(append([]byte(binaryManifestMagic), binaryManifestVersion))
+	return err
+}
+
+func appendBinaryRecord(buf []byte, path string, crc uint32, size uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(path)))
+	buf = append(buf, path...)
+	buf = binary.BigEndian.AppendUint32(buf, crc)
+	return binary.AppendUvarint(buf, size)
+}
+
+// readBinaryRecord returns io.EOF at the end of the records and io.ErrUnexpectedEOF in a cut one
+func readBinaryRecord(r *bufio.Reader) (manifestRecord, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return manifestRecord{}, err
+	}
+	if n > manifestMaxLine {
+		return manifestRecord{}, fmt.Errorf("path length %d too long", n)
+	}
+	buf := make([]byte, n+4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return manifestRecord{}, noEOF(err)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return manifestRecord{}, noEOF(err)
+	}
+	rec := manifestRecord{Path: string(buf[:n]), CRC: encodeCRC(binary.BigEndian.Uint32(buf[n:])), Size: size}
+	if rec.Path == "" {
+		return rec, errors.New("empty path")
+	}
+	return rec, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// recordWriter writes a result record to an output
+type recordWriter func(w io.Writer, res Result)
+
+func writeTextRecord(w io.Writer, res Result) {
+	if res.Ordinal != "" {
+		fmt.Fprintf(w, "%s\t%s %d %s\n", res.Ordinal, res.CRC, res.Size, res.Path)
+	} else {
+		fmt.Fprintf(w, "%s %d %s\n", res.CRC, res.Size, res.Path)
+	}
+}
+
+// newBinaryRecordWriter reuses its buffer, its records must be written by a single goroutine
+func newBinaryRecordWriter() recordWriter {
+	var buf []byte
+	return func(w io.Writer, res Result) {
+		crc, _ := decodeCRC(res.CRC)
+		buf = appendBinaryRecord(buf[:0], res.Path, crc, res.Size)
+		w.Write(buf)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the binary output parses to the records of the text output, gzipped or not
+func TestBinaryManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file %02d", i))
+		if err := os.WriteFile(path, bytes.Repeat([]byte{byte(i)}, i*100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	run := func(binary bool) []byte {
+		out := &bytes.Buffer{}
+		runPaths(t, 4, paths, func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.EnableOrderedOutput(defaultOrderedWindow)
+			if binary {
+				mc.EnableBinaryOutput()
+			}
+		})
+		return out.Bytes()
+	}
+	text := run(false)
+	binary := run(true)
+	if !bytes.HasPrefix(binary, []byte(binaryManifestMagic)) || len(binary) >= len(text) {
+		t.Errorf("got %d binary bytes for %d text bytes", len(binary), len(text))
+	}
+	expected, _, _, err := parseAll(t, text, true)
+	if err != nil || len(expected) != 20 {
+		t.Fatalf("got %d text records: %v", len(expected), err)
+	}
+	gzipped := &bytes.Buffer{}
+	gzWriter := gzip.NewWriter(gzipped)
+	gzWriter.Write(binary)
+	gzWriter.Close()
+	for name, data := range map[string][]byte{"plain": binary, "gzip": gzipped.Bytes()} {
+		got, _, _, err := parseAll(t, data, true)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: got %v %v, expected %v", name, got, err, expected)
+		}
+	}
+}
+
+func TestBinaryManifestCorrupted(t *testing.T) {
+	header := append([]byte(binaryManifestMagic), binaryManifestVersion)
+	good := appendBinaryRecord(nil, "/a", 0x01020304, 5)
+	emptyPath := appendBinaryRecord(nil, "", 0x01020304, 5)
+	tests := []struct {
+		name    string
+		data    []byte
+		records int
+		warning string
+	}{
+		{"cut record", append(append(append([]byte{}, header...), good...), good[:4]...), 1, "skipping the rest of m.txt: m.txt: record 2: unexpected EOF"},
+		{"empty path", append(append(append(append([]byte{}, header...), emptyPath...), good...), good...), 2, "skipping m.txt: record 1: empty path"},
+		{"huge length", append(append([]byte{}, header...), 0xff, 0xff, 0xff, 0xff, 0x0f), 0, "too long"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, _, diag, err := parseAll(t, test.data, false)
+			if err != nil || len(records) != test.records || !strings.Contains(diag, test.warning) {
+				t.Errorf("got %d records %v %q, expected %d and %q", len(records), err, diag, test.records, test.warning)
+			}
+			if _, _, _, err := parseAll(t, test.data, true); err == nil {
+				t.Errorf("expected an error in strict mode")
+			}
+		})
+	}
+	if _, err := newManifestParser("manifest", bytes.NewReader(append([]byte(binaryManifestMagic), 2)), false, io.Discard); !errors.Is(err, errBinaryManifestVersion) {
+		t.Errorf("got %v, expected an unsupported version", err)
+	}
+}
+
+// Test a binary manifest is a -since manifest like a text one
+func TestSinceBinaryManifest(t *testing.T) {
+	dir, paths := sinceFixture(t)
+	manifest := append([]byte(binaryManifestMagic), binaryManifestVersion)
+	for _, path := range paths {
+		manifest = appendBinaryRecord(manifest, path, 0, uint64(len(filepath.Base(path))))
+	}
+	path := filepath.Join(dir, "old.bin")
+	if err := os.WriteFile(path, manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, mc := runSince(t, path, paths, time.Now().Add(-time.Hour))
+	if !strings.Contains(out, "AAAAAA== 9 "+paths[0]+"\n") || mc.carriedForwardCount.Load() != 1 {
+		t.Errorf("unchanged file not carried forward: %q", out)
+	}
+}
+
+func benchmarkManifest(binary bool, count int) []byte {
+	buf := &bytes.Buffer{}
+	if binary {
+		writeBinaryManifestHeader(buf)
+	}
+	write := writeTextRecord
+	if binary {
+		write = newBinaryRecordWriter()
+	}
+	for i := 0; i < count; i++ {
+		write(buf, Result{Path: fmt.Sprintf("/data/project/%d/file%d.dat", i%1000, i), CRC: "WaIfQg==", Size: uint64(i) * 4096})
+	}
+	return buf.Bytes()
+}
+
+func benchmarkParse(b *testing.B, binary bool) {
+	data := benchmarkManifest(binary, 100000)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if records, _, _, err := parseAll(b, data, true); err != nil || len(records) != 100000 {
+			b.Fatalf("got %d records: %v", len(records), err)
+		}
+	}
+}
+
+func BenchmarkParseTextManifest(b *testing.B) {
+	benchmarkParse(b, false)
+}
+
+func BenchmarkParseBinaryManifest(b *testing.B) {
+	benchmarkParse(b, true)
+}
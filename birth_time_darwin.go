@@ -0,0 +1,23 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTimeProbe is always true, the stat of darwin has the birth time
+func birthTimeProbe() bool {
+	return true
+}
+
+// birthTime is the birth time of the file from its info, zero when its filesystem has none
+func birthTime(path string, info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || (st.Birthtimespec.Sec == 0 && st.Birthtimespec.Nsec == 0) {
+		return time.Time{}
+	}
+	return time.Unix(st.Birthtimespec.Unix())
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// birthTimeProbe tells whether statx works here, missing before Linux 4.11 and denied by some seccomp
+// profiles, the filesystems not recording the birth times leave it out of the statx mask
+func birthTimeProbe() bool {
+	var stx unix.Statx_t
+	return unix.Statx(unix.AT_FDCWD, ".", unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME, &stx) == nil
+}
+
+// birthTime is the birth time of the file at path from statx, zero when its filesystem has none
+func birthTime(path string, info os.FileInfo) time.Time {
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME, &stx); err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func birthTimeProbe() bool {
+	return false
+}
+
+func birthTime(path string, info os.FileInfo) time.Time {
+	return time.Time{}
+}
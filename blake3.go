@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// blake3 is the unkeyed 32 byte BLAKE3 of -algo blake3, for the content-addressed stores. The input is
+// split in chunks of 16 blocks of 64 bytes whose chaining values are merged in a binary tree as soon
+// as a subtree is complete, so the stack holds at most one value per level. A block or a chunk is only
+// compressed once more input follows, the last ones are flagged as the root in Sum.
+type blake3 struct {
+	chunk     blake3Chunk
+	stack     [54][8]uint32 // the chaining values of the complete subtrees, 2^54 chunks is past 2^64 bytes
+	stackSize int
+}
+
+type blake3Chunk struct {
+	cv         [8]uint32
+	counter    uint64 // index of the chunk
+	block      [64]byte
+	blockLen   int
+	compressed int // blocks compressed
+}
+
+const (
+	blake3BlockLen = 64
+	blake3ChunkLen = 1024
+
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+)
+
+var blake3IV = [8]uint32{0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19}
+
+var blake3Schedule = func() (schedule [7][16]uint8) {
+	permutation := [16]uint8{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+	for i := range schedule[0] {
+		schedule[0][i] = uint8(i)
+	}
+	for r := 1; r < 7; r++ {
+		for i := range schedule[r] {
+			schedule[r][i] = schedule[r-1][permutation[i]]
+		}
+	}
+	return schedule
+}()
+
+func newBLAKE3() *blake3 {
+	h := &blake3{}
+	h.Reset()
+	return h
+}
+
+func (h *blake3) Reset() {
+	h.chunk = blake3Chunk{cv: blake3IV}
+	h.stackSize = 0
+}
+
+func (h *blake3) Size() int      { return 32 }
+func (h *blake3) BlockSize() int { return blake3BlockLen }
+
+func blake3G(s *[16]uint32, a, b, c, d int, x, y uint32) {
+	s[a] += s[b] + x
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + y
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+// blake3Compress returns the first 8 words of the compression of block, the chaining value
+func blake3Compress(cv *[8]uint32, block *[64]byte, counter uint64, blockLen int, flags uint32) [8]uint32 {
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3],
+		uint32(counter), uint32(counter >> 32), uint32(blockLen), flags,
+	}
+	for r := range blake3Schedule {
+		k := &blake3Schedule[r]
+		blake3G(&s, 0, 4, 8, 12, m[k[0]], m[k[1]])
+		blake3G(&s, 1, 5, 9, 13, m[k[2]], m[k[3]])
+		blake3G(&s, 2, 6, 10, 14, m[k[4]], m[k[5]])
+		blake3G(&s, 3, 7, 11, 15, m[k[6]], m[k[7]])
+		blake3G(&s, 0, 5, 10, 15, m[k[8]], m[k[9]])
+		blake3G(&s, 1, 6, 11, 12, m[k[10]], m[k[11]])
+		blake3G(&s, 2, 7, 8, 13, m[k[12]], m[k[13]])
+		blake3G(&s, 3, 4, 9, 14, m[k[14]], m[k[15]])
+	}
+	var out [8]uint32
+	for i := range out {
+		out[i] = s[i] ^ s[i+8]
+	}
+	return out
+}
+
+// startFlag is the flag of the next block compressed in the chunk
+func (c *blake3Chunk) startFlag() uint32 {
+	if c.compressed == 0 {
+		return blake3ChunkStart
+	}
+	return 0
+}
+
+// len is the count of the bytes of the chunk written so far
+func (c *blake3Chunk) len() int {
+	return c.compressed*blake3BlockLen + c.blockLen
+}
+
+func (c *blake3Chunk) write(p []byte) []byte {
+	for len(p) > 0 && c.len() < blake3ChunkLen {
+		if c.blockLen == blake3BlockLen {
+			c.cv = blake3Compress(&c.cv, &c.block, c.counter, blake3BlockLen, c.startFlag())
+			c.compressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+	return p
+}
+
+// output returns the compression input of the last block of the chunk, its flags without the root one
+func (c *blake3Chunk) output() blake3Output {
+	out := blake3Output{cv: c.cv, counter: c.counter, blockLen: c.blockLen, flags: c.startFlag() | blake3ChunkEnd}
+	copy(out.block[:], c.block[:c.blockLen])
+	return out
+}
+
+// blake3Output is a compression kept pending, the last one is done with the root flag
+type blake3Output struct {
+	cv       [8]uint32
+	block    [64]byte
+	counter  uint64
+	blockLen int
+	flags    uint32
+}
+
+func (o *blake3Output) chainingValue() [8]uint32 {
+	return blake3Compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags)
+}
+
+func blake3ParentOutput(left, right *[8]uint32) blake3Output {
+	out := blake3Output{cv: blake3IV, blockLen: blake3BlockLen, flags: blake3Parent}
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(out.block[4*i:], left[i])
+		binary.LittleEndian.PutUint32(out.block[32+4*i:], right[i])
+	}
+	return out
+}
+
+// addChunk pushes the chaining value of a complete chunk, merging the subtrees it completes,
+// one per trailing zero bit of the count of chunks
+func (h *blake3) addChunk(cv [8]uint32, chunks uint64) {
+	for ; chunks&1 == 0; chunks >>= 1 {
+		h.stackSize--
+		parent := blake3ParentOutput(&h.stack[h.stackSize], &cv)
+		cv = parent.chainingValue()
+	}
+	h.stack[h.stackSize] = cv
+	h.stackSize++
+}
+
+func (h *blake3) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if h.chunk.len() == blake3ChunkLen {
+			out := h.chunk.output()
+			chunks := h.chunk.counter + 1
+			h.addChunk(out.chainingValue(), chunks)
+			h.chunk = blake3Chunk{cv: blake3IV, counter: chunks}
+		}
+		p = h.chunk.write(p)
+	}
+	return written, nil
+}
+
+// Sum appends the 32 byte hash, merging the pending subtrees with the last chunk up to the root
+func (h *blake3) Sum(b []byte) []byte {
+	out := h.chunk.output()
+	for i := h.stackSize - 1; i >= 0; i-- {
+		cv := out.chainingValue()
+		out = blake3ParentOutput(&h.stack[i], &cv)
+	}
+	root := blake3Compress(&out.cv, &out.block, 0, out.blockLen, out.flags|blake3Root)
+	for _, word := range root {
+		b = binary.LittleEndian.AppendUint32(b, word)
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Test the vectors of the BLAKE3 reference, the inputs are the byte sequence 0..250 repeated,
+// written whole and by writes splitting the blocks and the chunks
+func TestBLAKE3(t *testing.T) {
+	tests := []struct {
+		len  int
+		hash string
+	}{
+		{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+		{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+		{3073, "7124b49501012f81cc7f11ca069ec9226cecb8a2c850cfe644e327d22d3e1cd3"},
+		{8193, "bab6c09cb8ce8cf459261398d2e7aef35700bf488116ceb94a36d0f5f1b7bc3b"},
+		{31744, "62b6960e1a44bcc1eb1a611a8d6235b6b4b78f32e7abc4fb4c6cdcce94895c47"},
+		{102400, "bc3e3d41a1146b069abffad3c0d44860cf664390afce4d9661f7902e7943e085"},
+	}
+	for _, test := range tests {
+		data := make([]byte, test.len)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		for _, size := range []int{test.len + 1, 1, 63, 64, 65, 1024, 1500} {
+			h := newBLAKE3()
+			h.Write([]byte("garbage"))
+			h.Reset()
+			for p := data; len(p) > 0; {
+				n := size
+				if n > len(p) {
+					n = len(p)
+				}
+				h.Write(p[:n])
+				p = p[n:]
+			}
+			if got := fmt.Sprintf("%x", h.Sum(nil)); got != test.hash {
+				t.Errorf("%d bytes by writes of %d: got %s, expected %s", test.len, size, got, test.hash)
+			}
+		}
+	}
+	h := newBLAKE3()
+	h.Write([]byte("abc"))
+	if got := fmt.Sprintf("%x", h.Sum(nil)); got != "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85" {
+		t.Errorf("abc: got %s", got)
+	}
+}
+
+// Test a -algo blake3 run with larger reads writes the hex digest and still accounts the data
+// computed for the summary speeds
+func TestBLAKE3Run(t *testing.T) {
+	out := &bytes.Buffer{}
+	summary := &bytes.Buffer{}
+	mc := runPaths(t, 2, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.readSizeG = 64
+		mc.StdOut = out
+		mc.DebugOut = summary
+		mc.SetAlgos(algoBLAKE3)
+	})
+	mc.PrintSummary()
+
+	expected := "c19812c987cb4f81a2febbcd7d00db14f38d88ed40acb76496b0a2e1f70e925d 3538 test_data.txt\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+	if stats := mc.Stats(); stats.Files != 1 || stats.BytesComputed != 3538 || stats.ByteRate() <= 0 {
+		t.Errorf("got %d files, %dB, %f B/s", stats.Files, stats.BytesComputed, stats.ByteRate())
+	}
+	for _, line := range []string{"Computed data: 3538B\n", "Algorithm: BLAKE3\n"} {
+		if !strings.Contains(summary.String(), line) {
+			t.Errorf("missing %q in %q", line, summary.String())
+		}
+	}
+}
+
+// BenchmarkBLAKE3ReadSize measures -algo blake3 by -s read size, the hash compresses one block at a
+// time so larger reads than the CRC ones only save the read calls
+func BenchmarkBLAKE3ReadSize(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1MiB
+	for _, readSize := range []int{1, 16, 64, 256, 1024} {
+		b.Run(fmt.Sprintf("%dK", readSize), func(b *testing.B) {
+			mc := InitMassCRC32C(readSize, 1)
+			mc.SetAlgos(algoBLAKE3)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := mc.CRCReader(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
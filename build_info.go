@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildHeaderPrefix starts the build header line of the text outputs, a comment for the manifest readers
+const buildHeaderPrefix = "# mass-crc32c build "
+
+// startedHeaderPrefix starts the header line of the run start time, the changes -since must not trust
+// the manifest of the run for are those made after it
+const startedHeaderPrefix = "# mass-crc32c started="
+
+// buildInfo identifies the build of the binary. A go install of a release has its module version, a go build
+// of a checkout has its VCS commit and commit date instead: go stamps no build date, the commit date keeps
+// the builds reproducible.
+type buildInfo struct {
+	Version   string // module version, devel for a go build of a checkout
+	Commit    string // VCS revision, unknown when not built from a checkout
+	Modified  bool   // the checkout had uncommitted changes
+	Date      string // VCS commit time in RFC3339, unknown when not built from a checkout
+	GoVersion string
+}
+
+var (
+	buildOnce sync.Once
+	build     buildInfo
+)
+
+// toolBuild is the build of the binary, the single source of the version written by every output
+func toolBuild() buildInfo {
+	buildOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		build = buildInfoOf(info, ok)
+	})
+	return build
+}
+
+func buildInfoOf(info *debug.BuildInfo, ok bool) buildInfo {
+	bi := buildInfo{Version: "unknown", Commit: "unknown", Date: "unknown", GoVersion: runtime.Version()}
+	if !ok {
+		return bi
+	}
+	bi.Version = info.Main.Version
+	if bi.Version == "" || bi.Version == "(devel)" {
+		bi.Version = "devel"
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			bi.Commit = setting.Value
+		case "vcs.modified":
+			bi.Modified = setting.Value == "true"
+		case "vcs.time":
+			bi.Date = setting.Value
+		}
+	}
+	if info.GoVersion != "" {
+		bi.GoVersion = info.GoVersion
+	}
+	return bi
+}
+
+// String is the module version of the binary, or the VCS revision it was built from
+func (bi buildInfo) String() string {
+	if bi.Version != "devel" && bi.Version != "unknown" {
+		return bi.Version
+	}
+	if bi.Commit == "unknown" {
+		return bi.Version
+	}
+	revision := bi.Commit
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if bi.Modified {
+		revision += "-dirty"
+	}
+	return "devel " + revision
+}
+
+// fields are the space separated key=value fields of the build header and -version, in a fixed order
+func (bi buildInfo) fields() string {
+	return fmt.Sprintf("version=%s commit=%s modified=%t date=%s go=%s", bi.Version, bi.Commit, bi.Modified, bi.Date, bi.GoVersion)
+}
+
+// header is the build header line of the text outputs
+func (bi buildInfo) header() string {
+	return buildHeaderPrefix + bi.fields() + "\n"
+}
+
+// startedHeader is the header line of the start time of the run, in seconds rounded down
+func (mc *MassCRC32C) startedHeader() string {
+	return startedHeaderPrefix + mc.startTime.UTC().Format(time.RFC3339) + "\n"
+}
+
+// EnableBuildHeader writes the build header line and the start time of the run first in the text outputs,
+// must be called before Startup
+func (mc *MassCRC32C) EnableBuildHeader() {
+	mc.buildHeader = true
+}
+
+// parseBuildHeader parses a build header line as passed to the onComment of a manifest parser
+func parseBuildHeader(line string) (buildInfo, bool) {
+	if !strings.HasPrefix(line, buildHeaderPrefix) {
+		return buildInfo{}, false
+	}
+	var bi buildInfo
+	for _, field := range strings.Fields(line[len(buildHeaderPrefix):]) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return buildInfo{}, false
+		}
+		switch key {
+		case "version":
+			bi.Version = value
+		case "commit":
+			bi.Commit = value
+		case "modified":
+			bi.Modified = value == "true"
+		case "date":
+			bi.Date = value
+		case "go":
+			bi.GoVersion = value
+		}
+	}
+	return bi, bi.Version != ""
+}
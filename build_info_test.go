@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	installed := buildInfoOf(&debug.BuildInfo{GoVersion: "go1.22.1", Main: debug.Module{Version: "v1.2.3"}}, true)
+	if installed.String() != "v1.2.3" {
+		t.Errorf("got %s", installed)
+	}
+	// the header format is read by the tools of the manifests, changing it breaks them
+	if got := installed.header(); got != "# mass-crc32c build version=v1.2.3 commit=unknown modified=false date=unknown go=go1.22.1\n" {
+		t.Errorf("got header %q", got)
+	}
+
+	built := buildInfoOf(&debug.BuildInfo{
+		GoVersion: "go1.22.1",
+		Main:      debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+			{Key: "vcs.time", Value: "2024-06-17T10:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}, true)
+	if built.String() != "devel 0123456789ab-dirty" || built.Date != "2024-06-17T10:00:00Z" {
+		t.Errorf("got %s, %+v", built, built)
+	}
+	if parsed, ok := parseBuildHeader(built.header()[:len(built.header())-1]); !ok || parsed != built {
+		t.Errorf("got %+v, expected %+v", parsed, built)
+	}
+
+	if unknown := buildInfoOf(nil, false); unknown.String() != "unknown" {
+		t.Errorf("got %s without build info", unknown)
+	}
+	for _, bad := range []string{"# mass-crc32c poly=ieee", "# mass-crc32c build commit=abc", "# mass-crc32c build version"} {
+		if _, ok := parseBuildHeader(bad); ok {
+			t.Errorf("%q: expected no build header", bad)
+		}
+	}
+}
+
+// Test the build header of -out is a comment of the manifest parser, handed to onComment
+func TestBuildHeader(t *testing.T) {
+	out := &bytes.Buffer{}
+	runPaths(t, 1, []string{"test_data.txt", "test_data.txt"}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableBuildHeader()
+	})
+
+	mp, err := newManifestParser("out", bytes.NewReader(out.Bytes()), true, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []buildInfo
+	mp.onComment = func(line string) {
+		if bi, ok := parseBuildHeader(line); ok {
+			headers = append(headers, bi)
+		}
+	}
+	records := 0
+	for {
+		_, err := mp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+	if len(headers) != 1 || headers[0] != toolBuild() || records != 2 {
+		t.Errorf("got %+v and %d records, expected the build header of %+v and 2 records", headers, records, toolBuild())
+	}
+}
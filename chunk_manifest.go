@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// chunkRecord is the CRC of a byte range of a file, like the components of a GCS composite object
+type chunkRecord struct {
+	offset uint64
+	length uint64
+	crc    uint32
+}
+
+// chunkedCRCReader computes the CRC of every chunkSize bytes of reader, the last chunk may be shorter.
+// The whole CRC is combined from the chunk ones so the data is checksummed once.
+// As for CRCReader the size is what was read before the error on error.
+func (mc *MassCRC32C) chunkedCRCReader(reader io.Reader, chunkSize uint64) (string, uint64, []chunkRecord, error) {
+	buf := mc.bufferPool.Get().([]byte)
+	defer func() { mc.bufferPool.Put(buf) }()
+	var chunks []chunkRecord
+	var chunk chunkRecord
+	whole := uint32(0)
+	fileSize := uint64(0)
+	finishChunk := func() {
+		chunks = append(chunks, chunk)
+		whole = crc32cCombine(whole, chunk.crc, chunk.length)
+		chunk = chunkRecord{offset: chunk.offset + chunk.length}
+	}
+	for {
+		n, err := reader.Read(buf)
+		fileSize += uint64(n)
+		for data := buf[:n]; len(data) > 0; {
+			take := chunkSize - chunk.length
+			if uint64(len(data)) < take {
+				take = uint64(len(data))
+			}
+			chunk.crc = crc32.Update(chunk.crc, mc.crc32cTableG, data[:take])
+			chunk.length += take
+			data = data[take:]
+			if chunk.length == chunkSize {
+				finishChunk()
+			}
+		}
+		switch err {
+		case nil:
+		case io.EOF:
+			mc.bytesRead.Add(fileSize)
+			if chunk.length > 0 {
+				finishChunk()
+			}
+			return mc.formatCRC(whole), fileSize, chunks, nil
+		default:
+			mc.bytesRead.Add(fileSize)
+			return "", fileSize, nil, err
+		}
+	}
+}
+
+// crc32cCombine returns the CRC of the concatenation of two blocks from their CRCs and the length
+// of the second one, by applying len2 zero bytes to crc1 with squared GF(2) matrices as zlib does
+func crc32cCombine(crc1 uint32, crc2 uint32, len2 uint64) uint32 {
+	if len2 == 0 {
+		return crc1
+	}
+	var even, odd [32]uint32 // operators for 2^n zero bits
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(&even, &odd) // 2 zero bits
+	gf2MatrixSquare(&odd, &even) // 4 zero bits
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	sum := uint32(0)
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square *[32]uint32, mat *[32]uint32) {
+	for n := 0; n < 32; n++ {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+// parseByteSize parses a size in bytes with an optional binary unit suffix: K, M, G or T
+func parseByteSize(s string) (uint64, error) {
+	multiplier := uint64(1)
+	number := strings.TrimSuffix(strings.ToUpper(s), "B")
+	if number != "" {
+		if i := strings.IndexByte("KMGT", number[len(number)-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			number = number[:len(number)-1]
+		}
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || n == 0 || n > (1<<64-1)/multiplier {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+func writeChunkRecords(w io.Writer, res Result) {
+	for _, chunk := range res.Chunks {
+		fmt.Fprintf(w, "%s %d %d %s\n", chunk.CRC, chunk.Offset, chunk.Length, res.Path)
+	}
+}
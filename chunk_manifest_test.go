@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCRC32CCombine(t *testing.T) {
+	table := crc32.MakeTable(crc32.Castagnoli)
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, split := range []int{0, 1, 7, 4096, 65537, len(data) - 1, len(data)} {
+		crc1 := crc32.Checksum(data[:split], table)
+		crc2 := crc32.Checksum(data[split:], table)
+		if got, expected := crc32cCombine(crc1, crc2, uint64(len(data)-split)), crc32.Checksum(data, table); got != expected {
+			t.Errorf("split at %d: got %08x, expected %08x", split, got, expected)
+		}
+	}
+}
+
+func TestChunkedCRCReader(t *testing.T) {
+	const chunkSize = 1000
+	table := crc32.MakeTable(crc32.Castagnoli)
+	mc := InitMassCRC32C(1, 1) // 1KB reads straddle the chunk boundaries
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 3*chunkSize + 17, 1023, 1024, 1025} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+		readers := map[string]io.Reader{
+			"plain":    bytes.NewReader(data),
+			"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+			"data+EOF": iotest.DataErrReader(bytes.NewReader(data)),
+		}
+		for name, reader := range readers {
+			crc, fileSize, chunks, err := mc.chunkedCRCReader(reader, chunkSize)
+			expectedCRC, _, _ := mc.CRCReader(bytes.NewReader(data))
+			if err != nil || crc != expectedCRC || fileSize != uint64(size) {
+				t.Errorf("%d bytes %s: got %s %d %v, expected %s", size, name, crc, fileSize, err, expectedCRC)
+			}
+			if expected := (size + chunkSize - 1) / chunkSize; len(chunks) != expected {
+				t.Errorf("%d bytes %s: got %d chunks, expected %d", size, name, len(chunks), expected)
+				continue
+			}
+			offset := uint64(0)
+			for i, chunk := range chunks {
+				length := uint64(chunkSize)
+				if i == len(chunks)-1 {
+					length = uint64(size) - offset // the last one may be short
+				}
+				if chunk.offset != offset || chunk.length != length {
+					t.Errorf("%d bytes %s: chunk %d is %d+%d, expected %d+%d", size, name, i, chunk.offset, chunk.length, offset, length)
+				}
+				if expected := crc32.Checksum(data[offset:offset+length], table); chunk.crc != expected {
+					t.Errorf("%d bytes %s: chunk %d crc %08x, expected %08x", size, name, i, chunk.crc, expected)
+				}
+				offset += length
+			}
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, expected := range map[string]uint64{"1": 1, "4096": 4096, "1K": 1 << 10, "64m": 64 << 20, "1G": 1 << 30, "2GB": 2 << 30, "1T": 1 << 40} {
+		if got, err := parseByteSize(s); err != nil || got != expected {
+			t.Errorf("%q: got %d, %v, expected %d", s, got, err, expected)
+		}
+	}
+	for _, bad := range []string{"", "0", "G", "-1G", "1.5G", "1P", "99999999999T"} {
+		if _, err := parseByteSize(bad); err == nil {
+			t.Errorf("%q must be rejected", bad)
+		}
+	}
+}
+
+func TestChunkManifestOutput(t *testing.T) {
+	data, err := os.ReadFile("test_data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, chunkOut := &bytes.Buffer{}, &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableChunkManifest(10, chunkOut)
+	})
+
+	expectedCRC, _, _ := mc.CRCReader(bytes.NewReader(data))
+	if out.String() != fmt.Sprintf("%s %d test_data.txt\n", expectedCRC, len(data)) {
+		t.Errorf("the whole file record changed: %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(chunkOut.String(), "\n"), "\n")
+	if len(lines) != (len(data)+9)/10 {
+		t.Fatalf("got %d chunk records for %d bytes", len(lines), len(data))
+	}
+	table := crc32.MakeTable(crc32.Castagnoli)
+	b := make([]byte, 4)
+	for i, line := range lines {
+		end := (i + 1) * 10
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.BigEndian.PutUint32(b, crc32.Checksum(data[i*10:end], table))
+		if expected := fmt.Sprintf("%s %d %d test_data.txt", base64.StdEncoding.EncodeToString(b), i*10, end-i*10); line != expected {
+			t.Errorf("got %q, expected %q", line, expected)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// cleanOutput is the subset of the records of the files read and checksummed without error in this run:
+// every clean record is a record of the main output too, the others being the ones carried forward by -since.
+// The errors are in neither.
+type cleanOutput struct {
+	out     io.Writer
+	records atomic.Uint64 // records of the main output
+	clean   atomic.Uint64
+}
+
+// add is called by the writer goroutine for every record of the main output
+func (co *cleanOutput) add(res Result, write recordWriter) {
+	co.records.Add(1)
+	if res.Carried || res.BadBlocks != nil {
+		return
+	}
+	co.clean.Add(1)
+	write(co.out, res)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the clean output is the main output without the carried forward records, errors in neither
+func TestCleanOutput(t *testing.T) {
+	dir, paths := sinceFixture(t)
+	manifest := filepath.Join(dir, "old.txt")
+	data := &bytes.Buffer{}
+	fmt.Fprintf(data, "# mass-crc32c started=%s\n", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	for _, path := range paths {
+		fmt.Fprintf(data, "AAAAAA== %d %s\n", len(filepath.Base(path)), path)
+	}
+	if err := os.WriteFile(manifest, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	clean := &bytes.Buffer{}
+	debugOut := &bytes.Buffer{}
+	mc := runPaths(t, 1, append(paths, filepath.Join(dir, "missing")), func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.DebugOut = debugOut
+		mc.EnableCleanOutput(clean)
+		if err := mc.LoadSinceManifest(manifest, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	mc.PrintSummary()
+
+	carried := "AAAAAA== 9 " + paths[0] + "\n"
+	if strings.Count(out.String(), "\n") != 3 || !strings.Contains(out.String(), carried) {
+		t.Fatalf("got %q, expected the 3 records with the carried forward one", out.String())
+	}
+	if expected := strings.Replace(out.String(), carried, "", 1); clean.String() != expected {
+		t.Errorf("got %q, expected %q", clean.String(), expected)
+	}
+	if !strings.Contains(debugOut.String(), "Records written: 3, clean: 2\n") {
+		t.Errorf("counts missing from the summary: %q", debugOut.String())
+	}
+}
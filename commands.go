@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of the CLI. define registers its own flags in fs, next to the shared ones,
+// and returns the function running it with the arguments left once fs is parsed.
+type command struct {
+	name    string
+	args    string // the arguments of the usage line
+	summary string
+	define  func(fs *flag.FlagSet, shared *sharedFlags) func(args []string, sources map[string]configSource) int
+}
+
+// commands are the subcommands, the first one runs the invocations naming none
+var commands = []command{
+	{
+		name:    "compute",
+		args:    "[options] [path ...]",
+		summary: "write the CRC of the files walked from the paths or listed on stdin, the default",
+		define:  defineCompute,
+	},
+	{
+		name:    "diff",
+		args:    "[options] manifest-a manifest-b",
+		summary: "compare two manifests without reading any file, like compute -diff",
+		define:  defineDiff,
+	},
+}
+
+// envPrefix starts the environment variables of the flags of cmd: those of compute, the default, have none
+// of their own so that MASS_CRC32C_OUT is -out of compute alone, those of diff are MASS_CRC32C_DIFF_*
+func (cmd *command) envPrefix() string {
+	if cmd == &commands[0] {
+		return envPrefix
+	}
+	return envPrefix + strings.ToUpper(cmd.name) + "_"
+}
+
+// buildFlags registers the compute flags of the optional builds, like -chaos
+var buildFlags []func(fs *flag.FlagSet)
+
+// sharedFlags are the flags registered in every subcommand: the output, its compression and -p
+type sharedFlags struct {
+	p                *int
+	out              *string
+	outLockWait      *time.Duration
+	compress         *bool
+	compressParallel *int
+	printConfig      *bool
+	version          *bool
+}
+
+func registerSharedFlags(fs *flag.FlagSet) *sharedFlags {
+	return &sharedFlags{
+		p:                fs.Int("p", 1, "# of cpu used"),
+		out:              fs.String("out", "", "write CRC to file"),
+		outLockWait:      fs.Duration("out-lock-wait", 0, "wait up to this duration for another run writing -out to finish instead of failing"),
+		compress:         fs.Bool("c", false, "enable file output compression"),
+		compressParallel: fs.Int("compress-parallel", 1, "with -c, compress the outputs on N goroutines as concatenated gzip members, for outputs faster than a core can compress, needs -p above 1"),
+		printConfig:      fs.Bool("print-config", false, "print the value of every flag and whether it comes from its default, its "+envPrefix+"* environment variable or the command line, then exit"),
+		version:          fs.Bool("version", false, "print the version, VCS commit and commit date the binary was built from, then exit"),
+	}
+}
+
+// compressJobs returns the goroutines compressing the outputs, 0 without -c
+func (sf *sharedFlags) compressJobs() (int, error) {
+	if *sf.compressParallel < 1 {
+		return 0, errors.New("-compress-parallel must be at least 1")
+	}
+	if !*sf.compress {
+		return 0, nil
+	}
+	return *sf.compressParallel, nil
+}
+
+// openOut makes -out the StdOut of mc, its lock is held until the returned function closes it
+func (sf *sharedFlags) openOut(mc *MassCRC32C, outs *outFiles, sum *summedWriter) (func(), error) {
+	lock, err := acquireOutLock(*sf.out, *sf.outLockWait)
+	if err != nil {
+		return nil, err
+	}
+	w, closeFunc, err := outs.open("out", *sf.out, sum)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	mc.StdOut = w
+	return func() {
+		closeFunc()
+		lock.release()
+	}, nil
+}
+
+// commandOf returns the subcommand named by the first argument and the arguments following it, the
+// default one with all of them when it names none. A first argument naming both a subcommand and an
+// existing path stays a path walked by compute, like before the subcommands.
+func commandOf(args []string, debugOut io.Writer) (*command, []string) {
+	if len(args) == 0 {
+		return &commands[0], args
+	}
+	for i := range commands {
+		cmd := &commands[i]
+		if args[0] != cmd.name {
+			continue
+		}
+		if _, err := os.Lstat(args[0]); err == nil {
+			fmt.Fprintf(debugOut, "warning: %s is both a subcommand and a path, walked as a path, use ./%s for the path or %s %s for the subcommand\n", args[0], args[0], commands[0].name, cmd.name)
+			break
+		}
+		return cmd, args[1:]
+	}
+	return &commands[0], args
+}
+
+// newCommandFlags returns the flag set of cmd, with the shared flags, and the function running it
+func newCommandFlags(cmd *command) (*flag.FlagSet, *sharedFlags, func(args []string, sources map[string]configSource) int) {
+	fs := flag.NewFlagSet(os.Args[0]+" "+cmd.name, flag.ExitOnError)
+	shared := registerSharedFlags(fs)
+	execute := cmd.define(fs, shared)
+	fs.Usage = func() { printUsage(fs.Output(), fs, cmd) }
+	return fs, shared, execute
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet, cmd *command) {
+	if cmd == &commands[0] {
+		fmt.Fprintf(
+			w,
+			"Usage of %s: [command] [options] [path ...]\n%s recurses over paths provided as arguments or gets the file list form stdin otherwize, "+
+				"-stdin reads the list before walking the paths; a quoted path holding *, ? or [ is a glob pattern expanded without the ARG_MAX limit of the shell\n",
+			os.Args[0],
+			os.Args[0],
+		)
+	} else {
+		fmt.Fprintf(w, "Usage of %s %s: %s\n%s\n", os.Args[0], cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintf(w, "Commands, %s without any:\n", commands[0].name)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(
+		w,
+		"Every option can be set by its %s* environment variable too, e.g. %s for -out, the command line wins\nOptions:\n",
+		cmd.envPrefix(),
+		envName(cmd.envPrefix(), "out"),
+	)
+	fs.PrintDefaults()
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses args for their subcommand and returns its exit code
+func run(args []string) int {
+	cmd, args := commandOf(args, os.Stderr)
+	fs, shared, execute := newCommandFlags(cmd)
+	fs.Parse(args)
+	sources, err := applyEnv(fs, cmd.envPrefix(), os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: bad environment variable %v\n", err)
+		return 2
+	}
+	if *shared.version {
+		fmt.Println("mass-crc32c " + toolBuild().fields())
+		return 0
+	}
+	if *shared.printConfig {
+		printConfig(os.Stdout, fs, cmd.envPrefix(), sources)
+		return 0
+	}
+
+	runtime.GOMAXPROCS(*shared.p) // limit number of kernel threads (CPUs used)
+
+	return execute(fs.Args(), sources)
+}
+
+// defineDiff registers the flags of diff in fs, its run function returns 1 when the manifests differ
+// and 2 on an error
+func defineDiff(fs *flag.FlagSet, shared *sharedFlags) func(args []string, sources map[string]configSource) int {
+	strictParse := fs.Bool("strict-parse", false, "fail on malformed manifest lines instead of skipping them")
+
+	return func(args []string, sources map[string]configSource) int {
+		mc := InitMassCRC32C(1, 1)
+		compressJobs, err := shared.compressJobs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 2
+		}
+		if *shared.out != "" {
+			closeOut, err := shared.openOut(mc, &outFiles{compressJobs: compressJobs, debugOut: mc.DebugOut}, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeOut()
+		}
+		return runDiff(mc, args, *strictParse)
+	}
+}
+
+// runDiff writes the differences of the two manifests of args, for diff and compute -diff
+func runDiff(mc *MassCRC32C, args []string, strictParse bool) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "error: diff needs two manifests as arguments")
+		return 2
+	}
+	if strictParse {
+		mc.EnableStrictParse()
+	}
+	differ, err := mc.DiffManifests(args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	if differ {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// legacyConfig is the -print-config of the flag-only CLI before the subcommands, the flags added since
+// are in no line
+const legacyConfig = `FLAG                            VALUE         SOURCE   ENV
+-0                              "false"       default  MASS_CRC32C_0
+-algo                           "crc32c"      default  MASS_CRC32C_ALGO
+-allow-overlap                  "false"       default  MASS_CRC32C_ALLOW_OVERLAP
+-bad-block-fill                 "zeros"       default  MASS_CRC32C_BAD_BLOCK_FILL
+-bad-block-size                 "4K"          default  MASS_CRC32C_BAD_BLOCK_SIZE
+-batch                          "1000"        default  MASS_CRC32C_BATCH
+-big-dir-streaming              "false"       default  MASS_CRC32C_BIG_DIR_STREAMING
+-c                              "false"       default  MASS_CRC32C_COMPRESS
+-chunk-manifest                 ""            default  MASS_CRC32C_CHUNK_MANIFEST
+-chunk-out                      ""            default  MASS_CRC32C_CHUNK_OUT
+-compress-parallel              "1"           default  MASS_CRC32C_COMPRESS_PARALLEL
+-compression-sample             "64"          default  MASS_CRC32C_COMPRESSION_SAMPLE
+-coordinator                    ""            default  MASS_CRC32C_COORDINATOR
+-crc-init                       "0xFFFFFFFF"  default  MASS_CRC32C_CRC_INIT
+-crc-poly                       ""            default  MASS_CRC32C_CRC_POLY
+-crc-reflect                    "true"        default  MASS_CRC32C_CRC_REFLECT
+-crc-xorout                     "0xFFFFFFFF"  default  MASS_CRC32C_CRC_XOROUT
+-diff                           "false"       default  MASS_CRC32C_DIFF
+-dir-retry                      "0"           default  MASS_CRC32C_DIR_RETRY
+-dir-retry-delay                "2s"          default  MASS_CRC32C_DIR_RETRY_DELAY
+-direrrout                      ""            default  MASS_CRC32C_DIRERROUT
+-edge-digest                    ""            default  MASS_CRC32C_EDGE_DIGEST
+-enc                            "base64"      default  MASS_CRC32C_ENC
+-errformat                      "text"        default  MASS_CRC32C_ERRFORMAT
+-error-cache                    ""            default  MASS_CRC32C_ERROR_CACHE
+-error-cache-age                "168h0m0s"    default  MASS_CRC32C_ERROR_CACHE_AGE
+-errout                         ""            default  MASS_CRC32C_ERROUT
+-estimate-compression           "false"       default  MASS_CRC32C_ESTIMATE_COMPRESSION
+-events                         ""            default  MASS_CRC32C_EVENTS
+-events-recursive               "false"       default  MASS_CRC32C_EVENTS_RECURSIVE
+-fingerprint                    "false"       default  MASS_CRC32C_FINGERPRINT
+-fingerprint-exact              "false"       default  MASS_CRC32C_FINGERPRINT_EXACT
+-format                         "text"        default  MASS_CRC32C_FORMAT
+-growing-files                  "follow"      default  MASS_CRC32C_GROWING_FILES
+-header                         "false"       default  MASS_CRC32C_HEADER
+-input                          "text"        default  MASS_CRC32C_INPUT
+-j                              "1"           default  MASS_CRC32C_JOBS
+-l                              "100"         default  MASS_CRC32C_LIST_QUEUE
+-low-memory                     "false"       default  MASS_CRC32C_LOW_MEMORY
+-min-free-space                 "1G"          default  MASS_CRC32C_MIN_FREE_SPACE
+-ordered                        "false"       default  MASS_CRC32C_ORDERED
+-ordered-window                 "10000"       default  MASS_CRC32C_ORDERED_WINDOW
+-out                            ""            default  MASS_CRC32C_OUT
+-out-clean                      ""            default  MASS_CRC32C_OUT_CLEAN
+-out-indexed                    ""            default  MASS_CRC32C_OUT_INDEXED
+-out-lock-wait                  "0s"          default  MASS_CRC32C_OUT_LOCK_WAIT
+-p                              "1"           default  MASS_CRC32C_CPUS
+-pause-on-low-space             "false"       default  MASS_CRC32C_PAUSE_ON_LOW_SPACE
+-poly                           "castagnoli"  default  MASS_CRC32C_POLY
+-print-config                   "true"        flag     MASS_CRC32C_PRINT_CONFIG
+-progress-markers               "0"           default  MASS_CRC32C_PROGRESS_MARKERS
+-record                         ""            default  MASS_CRC32C_RECORD
+-replay                         ""            default  MASS_CRC32C_REPLAY
+-retry-denied                   "false"       default  MASS_CRC32C_RETRY_DENIED
+-s                              "1"           default  MASS_CRC32C_READ_SIZE
+-since                          ""            default  MASS_CRC32C_SINCE
+-since-time                     ""            default  MASS_CRC32C_SINCE_TIME
+-skip-bad-blocks                "false"       default  MASS_CRC32C_SKIP_BAD_BLOCKS
+-skip-snapshot-dirs             "false"       default  MASS_CRC32C_SKIP_SNAPSHOT_DIRS
+-snapshot-dir-names             ""            default  MASS_CRC32C_SNAPSHOT_DIR_NAMES
+-sqlite                         ""            default  MASS_CRC32C_SQLITE
+-sqlite-batch                   "1000"        default  MASS_CRC32C_SQLITE_BATCH
+-sqlite-only                    "false"       default  MASS_CRC32C_SQLITE_ONLY
+-sqlite-run-id                  ""            default  MASS_CRC32C_SQLITE_RUN_ID
+-stat-fields                    ""            default  MASS_CRC32C_STAT_FIELDS
+-stdin                          "false"       default  MASS_CRC32C_STDIN
+-strict-parse                   "false"       default  MASS_CRC32C_STRICT_PARSE
+-strict-types                   "false"       default  MASS_CRC32C_STRICT_TYPES
+-strict-types-include-symlinks  "false"       default  MASS_CRC32C_STRICT_TYPES_INCLUDE_SYMLINKS
+-tier-jobs                      ""            default  MASS_CRC32C_TIER_JOBS
+-walk-pause-on-errors           "false"       default  MASS_CRC32C_WALK_PAUSE_ON_ERRORS
+-walk-rate                      "0"           default  MASS_CRC32C_WALK_RATE
+-worker                         ""            default  MASS_CRC32C_WORKER
+-x                              "false"       default  MASS_CRC32C_EXTENDED_SUMMARY
+`
+
+// parseCommand parses args like run and returns the subcommand, its -print-config and its arguments
+func parseCommand(t *testing.T, args []string) (string, string, []string) {
+	cmd, args := commandOf(args, io.Discard)
+	fs, _, _ := newCommandFlags(cmd)
+	fs.Init(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("%v parsing %q", err, args)
+	}
+	sources, err := applyEnv(fs, cmd.envPrefix(), func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &bytes.Buffer{}
+	printConfig(config, fs, cmd.envPrefix(), sources)
+	return cmd.name, config.String(), fs.Args()
+}
+
+func TestLegacyFlags(t *testing.T) {
+	name, config, args := parseCommand(t, []string{"-print-config"})
+	if name != "compute" || len(args) != 0 {
+		t.Errorf("got %s %v", name, args)
+	}
+	for _, line := range strings.SplitAfter(legacyConfig, "\n") {
+		if !strings.Contains(config, line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+
+	for _, legacy := range [][]string{
+		nil,
+		{"-j", "8", "-out", "crc.txt", "-c", "-ordered", "data"},
+		{"-stdin", "-0", "-x", "-estimate-compression", "a", "b"},
+		{"-diff", "-strict-parse", "a.txt", "b.txt"},
+		{"-format", "sfv", "--", "-dash"},
+	} {
+		name, config, args := parseCommand(t, legacy)
+		subName, subConfig, subArgs := parseCommand(t, append([]string{"compute"}, legacy...))
+		if name != "compute" || subName != "compute" || config != subConfig || strings.Join(args, "\x00") != strings.Join(subArgs, "\x00") {
+			t.Errorf("%q got %s %q, with compute %s %q", legacy, name, args, subName, subArgs)
+		}
+		if config == subConfig && len(legacy) > 0 && !strings.Contains(config, " flag ") {
+			t.Errorf("%q got no flag set", legacy)
+		}
+	}
+}
+
+func TestCommandOf(t *testing.T) {
+	name, config, args := parseCommand(t, []string{"diff", "-out", "diff.txt", "-strict-parse", "a.txt", "b.txt"})
+	if name != "diff" || !reflect.DeepEqual(args, []string{"a.txt", "b.txt"}) {
+		t.Errorf("got %s %q", name, args)
+	}
+	for _, line := range []string{
+		`-out                "diff.txt"  flag     MASS_CRC32C_DIFF_OUT`,
+		`-strict-parse       "true"      flag     MASS_CRC32C_DIFF_STRICT_PARSE`,
+	} {
+		if !strings.Contains(config, line) {
+			t.Errorf("missing %q in:\n%s", line, config)
+		}
+	}
+
+	// a path named like a subcommand is walked as before
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Mkdir("diff", 0755); err != nil {
+		t.Fatal(err)
+	}
+	warnings := &bytes.Buffer{}
+	cmd, args := commandOf([]string{"diff", "other"}, warnings)
+	if cmd.name != "compute" || !reflect.DeepEqual(args, []string{"diff", "other"}) || !strings.Contains(warnings.String(), "walked as a path") {
+		t.Errorf("got %s %q, warnings %q", cmd.name, args, warnings)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("AAAAAA== 1 same\nAAAAAA== 1 gone\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("AAAAAA== 1 same\nAAAAAA== 2 new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	legacyOut := filepath.Join(dir, "legacy.txt")
+	subOut := filepath.Join(dir, "sub.txt")
+	if code := run([]string{"-diff", "-out", legacyOut, a, b}); code != 1 {
+		t.Errorf("got exit code %d with -diff", code)
+	}
+	if code := run([]string{"diff", "-out", subOut, a, b}); code != 1 {
+		t.Errorf("got exit code %d with diff", code)
+	}
+	legacy, err := os.ReadFile(legacyOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := os.ReadFile(subOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy) == 0 || !bytes.Equal(legacy, sub) {
+		t.Errorf("got %q with diff, %q with -diff", sub, legacy)
+	}
+	if code := run([]string{"diff", a}); code != 2 {
+		t.Errorf("got exit code %d with one manifest", code)
+	}
+
+	// the -out of compute in the environment is not the one of diff
+	t.Setenv(envName(envPrefix, "out"), a)
+	if code := run([]string{"diff", a, b}); code != 1 {
+		t.Errorf("got exit code %d with diff", code)
+	}
+	if manifest, err := os.ReadFile(a); err != nil || string(manifest) != "AAAAAA== 1 same\nAAAAAA== 1 gone\n" {
+		t.Errorf("got %q %v, expected the manifest of compute -out untouched", manifest, err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// composedObject is a GCS composite object of the -compose-verify spec, one JSON object per composed
+// object: {"object": "gs://bucket/name", "path": "/data/name", "crc32c": "...", "components": [{"size": N}, ...]}
+type composedObject struct {
+	Object     string              `json:"object"`
+	Path       string              `json:"path"`   // the local file of the -chunk-manifest records
+	CRC32C     string              `json:"crc32c"` // the composite CRC32C of the object metadata
+	Components []composedComponent `json:"components"`
+}
+
+// composedComponent is a component object in the order composed, its crc32c is verified when given
+type composedComponent struct {
+	Size   uint64 `json:"size"`
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+// readComposeSpec reads the composed objects of the spec, a stream of JSON objects
+func readComposeSpec(r io.Reader) ([]composedObject, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var objects []composedObject
+	for {
+		var obj composedObject
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", len(objects), err)
+		}
+		if obj.Object == "" || obj.Path == "" || len(obj.Components) == 0 {
+			return nil, fmt.Errorf("object %d: needs an object, a path and components", len(objects))
+		}
+		if _, err := decodeCRC(obj.CRC32C); err != nil {
+			return nil, fmt.Errorf("object %s: bad crc32c: %w", obj.Object, err)
+		}
+		for i, comp := range obj.Components {
+			if comp.CRC32C == "" {
+				continue
+			}
+			if _, err := decodeCRC(comp.CRC32C); err != nil {
+				return nil, fmt.Errorf("object %s: component %d: bad crc32c: %w", obj.Object, i, err)
+			}
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// parseChunkLine parses a "crc offset length path" record of -chunk-out
+func parseChunkLine(line string) (string, chunkRecord, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 || fields[3] == "" {
+		return "", chunkRecord{}, errors.New("malformed chunk record")
+	}
+	crc, err := decodeCRC(fields[0])
+	if err != nil {
+		return "", chunkRecord{}, fmt.Errorf("malformed crc: %w", err)
+	}
+	offset, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return "", chunkRecord{}, fmt.Errorf("malformed offset: %w", err)
+	}
+	length, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil || length == 0 {
+		return "", chunkRecord{}, fmt.Errorf("malformed length %q", fields[2])
+	}
+	return fields[3], chunkRecord{offset: offset, length: length, crc: crc}, nil
+}
+
+// readChunkManifest reads the chunk records of the paths wanted from a -chunk-out manifest, gzipped or not,
+// sorted by offset
+func readChunkManifest(r io.Reader, wanted map[string]bool) (map[string][]chunkRecord, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	chunks := map[string][]chunkRecord{}
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), manifestMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		path, chunk, err := parseChunkLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if wanted[path] {
+			chunks[path] = append(chunks[path], chunk)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, records := range chunks {
+		sort.Slice(records, func(i, j int) bool { return records[i].offset < records[j].offset })
+	}
+	return chunks, nil
+}
+
+// composeCheck is the verification of a composed object
+type composeCheck struct {
+	composite  uint32
+	mismatches []string // the composite and components not matching the spec
+}
+
+// verifyComposed combines the chunk CRCs of obj into its composite CRC, and into the CRCs of its components
+// given, with crc32cCombine like the whole CRC of the chunked reads. The chunks must cover the object from 0
+// without gap, and the components given a CRC start and end on chunk boundaries.
+func (mc *MassCRC32C) verifyComposed(obj composedObject, chunks []chunkRecord) (composeCheck, error) {
+	var check composeCheck
+	size := uint64(0)
+	for _, comp := range obj.Components {
+		size += comp.Size
+	}
+	covered := uint64(0)
+	for _, chunk := range chunks {
+		if chunk.offset != covered {
+			return check, fmt.Errorf("the chunk records of %s cover up to %d then start at %d", obj.Path, covered, chunk.offset)
+		}
+		covered += chunk.length
+	}
+	if covered != size {
+		return check, fmt.Errorf("the components sum to %d bytes, the chunk records of %s cover %d", size, obj.Path, covered)
+	}
+	// boundary tells whether a chunk ends at offset, the next one to combine starting there
+	next := 0
+	boundary := func(offset uint64) bool {
+		if next == 0 {
+			return offset == 0
+		}
+		return chunks[next-1].offset+chunks[next-1].length == offset
+	}
+	end := uint64(0)
+	for i, comp := range obj.Components {
+		aligned := boundary(end)
+		end += comp.Size
+		crc := uint32(0)
+		for ; next < len(chunks) && chunks[next].offset+chunks[next].length <= end; next++ {
+			crc = crc32cCombine(crc, chunks[next].crc, chunks[next].length)
+			check.composite = crc32cCombine(check.composite, chunks[next].crc, chunks[next].length)
+		}
+		if comp.CRC32C == "" {
+			continue
+		}
+		if !aligned || !boundary(end) {
+			return check, fmt.Errorf("component %d is not on the chunk boundaries: use a -chunk-manifest size dividing the component sizes", i)
+		}
+		if computed := mc.formatCRC(crc); !sameCRC(comp.CRC32C, computed) {
+			check.mismatches = append(check.mismatches, fmt.Sprintf("component %d expected %s computed %s", i, comp.CRC32C, computed))
+		}
+	}
+	for ; next < len(chunks); next++ {
+		check.composite = crc32cCombine(check.composite, chunks[next].crc, chunks[next].length)
+	}
+	if computed := mc.formatCRC(check.composite); !sameCRC(obj.CRC32C, computed) {
+		check.mismatches = append(check.mismatches, fmt.Sprintf("composite expected %s computed %s", obj.CRC32C, computed))
+	}
+	return check, nil
+}
+
+// ComposeVerify verifies the composite CRC32C of the objects of the spec at specPath against the chunk
+// records of the -chunk-out manifest at chunksPath, writing a match or mismatch line per object to StdOut,
+// the objects failing to be verified are reported on ErrOut. It returns whether every object matched.
+func (mc *MassCRC32C) ComposeVerify(specPath string, chunksPath string) (bool, error) {
+	specFile, err := os.Open(specPath)
+	if err != nil {
+		return false, err
+	}
+	objects, err := readComposeSpec(specFile)
+	specFile.Close()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", specPath, err)
+	}
+	wanted := map[string]bool{}
+	for _, obj := range objects {
+		wanted[obj.Path] = true
+	}
+	chunksFile, err := os.Open(chunksPath)
+	if err != nil {
+		return false, err
+	}
+	chunks, err := readChunkManifest(chunksFile, wanted)
+	chunksFile.Close()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", chunksPath, err)
+	}
+
+	var matched, mismatched, failed uint64
+	for _, obj := range objects {
+		check, err := mc.verifyComposed(obj, chunks[obj.Path])
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(mc.ErrOut, "error: %s: %v\n", obj.Object, err)
+		case len(check.mismatches) > 0:
+			mismatched++
+			fmt.Fprintf(mc.StdOut, "mismatch %s %s: %s\n", mc.formatCRC(check.composite), obj.Object, strings.Join(check.mismatches, ", "))
+		default:
+			matched++
+			fmt.Fprintf(mc.StdOut, "match %s %s\n", mc.formatCRC(check.composite), obj.Object)
+		}
+	}
+	fmt.Fprintf(mc.DebugOut, "Composed objects: %d matching, %d mismatching, %d not verified\n", matched, mismatched, failed)
+	return mismatched == 0 && failed == 0, nil
+}
+
+// runComposeVerify verifies the objects of the spec against the chunk manifest of args, for compute -compose-verify
+func runComposeVerify(mc *MassCRC32C, specPath string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "error: -compose-verify needs the -chunk-out manifest as argument")
+		return 2
+	}
+	ok, err := mc.ComposeVerify(specPath, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComposeVerify(t *testing.T) {
+	data, err := os.ReadFile("test_data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkOut := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.EnableChunkManifest(500, chunkOut)
+	})
+	dir := t.TempDir()
+	chunks := filepath.Join(dir, "chunks")
+	if err := os.WriteFile(chunks, chunkOut.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := crc32.MakeTable(crc32.Castagnoli)
+	crcOf := func(b []byte) string { return mc.formatCRC(crc32.Checksum(b, table)) }
+	whole := crcOf(data)
+	objects := []composedObject{
+		{Object: "gs://b/match", Path: "test_data.txt", CRC32C: whole, Components: []composedComponent{
+			{Size: 1000, CRC32C: crcOf(data[:1000])}, {Size: 2000}, {Size: 538, CRC32C: crcOf(data[3000:])},
+		}},
+		{Object: "gs://b/mismatch", Path: "test_data.txt", CRC32C: crcOf(data[1:]), Components: []composedComponent{
+			{Size: 500, CRC32C: crcOf(data[1:501])}, {Size: 3038},
+		}},
+		{Object: "gs://b/unaligned", Path: "test_data.txt", CRC32C: whole, Components: []composedComponent{
+			{Size: 700, CRC32C: crcOf(data[:700])}, {Size: 2838},
+		}},
+		{Object: "gs://b/short", Path: "test_data.txt", CRC32C: whole, Components: []composedComponent{{Size: 3000}}},
+		{Object: "gs://b/missing", Path: "missing", CRC32C: whole, Components: []composedComponent{{Size: 1}}},
+	}
+	var spec bytes.Buffer
+	enc := json.NewEncoder(&spec)
+	for _, obj := range objects {
+		enc.Encode(obj)
+	}
+	specPath := filepath.Join(dir, "spec")
+	if err := os.WriteFile(specPath, spec.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	mc.StdOut = out
+	mc.ErrOut = errOut
+	ok, err := mc.ComposeVerify(specPath, chunks)
+	if err != nil || ok {
+		t.Fatalf("got %t %v, expected a mismatch", ok, err)
+	}
+	expected := "match " + whole + " gs://b/match\n" +
+		"mismatch " + whole + " gs://b/mismatch: component 0 expected " + crcOf(data[1:501]) + " computed " + crcOf(data[:500]) +
+		", composite expected " + crcOf(data[1:]) + " computed " + whole + "\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+	for _, object := range []string{"unaligned", "short", "missing"} {
+		if !strings.Contains(errOut.String(), "error: gs://b/"+object+": ") {
+			t.Errorf("got %q, expected %s not verified", errOut.String(), object)
+		}
+	}
+
+	if err := os.WriteFile(specPath, []byte(`{"object": "gs://b/o", "path": "p", "crc32c": "bad", "components": [{"size": 1}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mc.ComposeVerify(specPath, chunks); err == nil {
+		t.Error("expected the bad spec refused")
+	}
+}
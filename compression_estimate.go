@@ -0,0 +1,152 @@
+package main
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	compressionCPUShare   = 0.05 // of the wall time of the workers the trials may take, the samples over it are skipped
+	compressionExtensions = 20   // extensions printed by the summary, the ones with the most bytes sampled
+)
+
+// compressionEstimate estimates the compression ratio of the data read by -estimate-compression: a flate
+// level 1 trial, close to the fast compressors used for archives, of one buffer read in every, per
+// extension and overall. The trials only read the buffers, the digests are computed from the same
+// bytes unchanged. Their CPU is measured and bounded to compressionCPUShare of the workers wall time.
+type compressionEstimate struct {
+	every    uint64
+	cpuShare float64 // compressionCPUShare, raised by the tests
+	workers  int
+	start    time.Time
+	reads    atomic.Uint64
+	spent    atomic.Int64 // nanoseconds of the trials
+	skipped  atomic.Uint64
+	writers  sync.Pool // *flate.Writer, about 1MB each
+
+	mu         sync.Mutex
+	extensions map[string]*compressionRatio
+	all        compressionRatio
+	buffers    uint64 // buffers sampled
+}
+
+type compressionRatio struct {
+	sampled    uint64
+	compressed uint64
+}
+
+func (cr compressionRatio) String() string {
+	if cr.sampled == 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("%.2f over %dB", float64(cr.compressed)/float64(cr.sampled), cr.sampled)
+}
+
+// EnableCompressionEstimate estimates the compression ratio of the data from a flate trial of one in every
+// buffer read, printed by the extended summary, must be called before Startup
+func (mc *MassCRC32C) EnableCompressionEstimate(every uint64) {
+	mc.compression = &compressionEstimate{
+		every:      every,
+		cpuShare:   compressionCPUShare,
+		extensions: make(map[string]*compressionRatio),
+		writers: sync.Pool{New: func() any {
+			w, _ := flate.NewWriter(io.Discard, flate.BestSpeed)
+			return w
+		}},
+	}
+}
+
+// countingWriter counts the bytes of the flate output
+type countingWriter struct {
+	n uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += uint64(len(p))
+	return len(p), nil
+}
+
+// sample runs the trial of a buffer of a file of extension ext when its turn has come and the CPU budget allows
+func (ce *compressionEstimate) sample(ext string, p []byte) {
+	if len(p) == 0 || ce.reads.Add(1)%ce.every != 0 {
+		return
+	}
+	start := time.Now()
+	if budget := ce.cpuShare * float64(start.Sub(ce.start)) * float64(ce.workers); float64(ce.spent.Load()) > budget {
+		ce.skipped.Add(1)
+		return
+	}
+	w := ce.writers.Get().(*flate.Writer)
+	out := &countingWriter{}
+	w.Reset(out)
+	w.Write(p)
+	w.Close()
+	ce.writers.Put(w)
+	ce.spent.Add(int64(time.Since(start)))
+
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ratio := ce.extensions[ext]
+	if ratio == nil {
+		ratio = &compressionRatio{}
+		ce.extensions[ext] = ratio
+	}
+	ratio.sampled += uint64(len(p))
+	ratio.compressed += out.n
+	ce.all.sampled += uint64(len(p))
+	ce.all.compressed += out.n
+	ce.buffers++
+}
+
+// compressionReader samples the buffers read from a file for the compression estimate
+type compressionReader struct {
+	r   io.Reader
+	ce  *compressionEstimate
+	ext string
+}
+
+func (ce *compressionEstimate) newReader(r io.Reader, path string) *compressionReader {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		ext = "(none)"
+	}
+	return &compressionReader{r: r, ce: ce, ext: ext}
+}
+
+func (cr *compressionReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.ce.sample(cr.ext, p[:n])
+	return n, err
+}
+
+// print prints the overall ratio, the CPU spent and the ratios of the extensions with the most bytes sampled
+func (ce *compressionEstimate) print(w io.Writer) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	fmt.Fprintf(
+		w,
+		"Compression estimate (flate level 1, 1 in %d buffers): %s, %d buffers sampled, %d skipped over the CPU budget, %s spent\n",
+		ce.every, ce.all, ce.buffers, ce.skipped.Load(), time.Duration(ce.spent.Load()),
+	)
+	exts := make([]string, 0, len(ce.extensions))
+	for ext := range ce.extensions {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		a, b := ce.extensions[exts[i]], ce.extensions[exts[j]]
+		return a.sampled > b.sampled || (a.sampled == b.sampled && exts[i] < exts[j])
+	})
+	if len(exts) > compressionExtensions {
+		exts = exts[:compressionExtensions]
+	}
+	for _, ext := range exts {
+		fmt.Fprintf(w, "  %s: %s\n", ext, ce.extensions[ext])
+	}
+}
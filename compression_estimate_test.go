@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the estimate tells compressible from random data per extension and leaves the CRCs unchanged
+func TestCompressionEstimate(t *testing.T) {
+	dir := t.TempDir()
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := map[string][]byte{
+		"text.txt":   []byte(strings.Repeat("compressible text, ", 4000)),
+		"random.bin": random,
+		"noext":      []byte(strings.Repeat("x", 1000)),
+	}
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	run := func(estimate bool) (string, *compressionEstimate) {
+		out := &bytes.Buffer{}
+		mc := runPaths(t, 2, paths, func(mc *MassCRC32C) {
+			mc.readSizeG = 4
+			mc.StdOut = out
+			mc.EnableOrderedOutput(defaultOrderedWindow)
+			if estimate {
+				mc.EnableCompressionEstimate(1)
+				mc.compression.cpuShare = 1e9
+			}
+		})
+		return out.String(), mc.compression
+	}
+	plain, _ := run(false)
+	estimated, ce := run(true)
+	if plain != estimated {
+		t.Errorf("got %q, expected %q", estimated, plain)
+	}
+	txt, bin, none := ce.extensions[".txt"], ce.extensions[".bin"], ce.extensions["(none)"]
+	if txt == nil || bin == nil || none == nil {
+		t.Fatalf("got %v", ce.extensions)
+	}
+	if txt.sampled != 76000 || txt.compressed*5 > txt.sampled || bin.compressed < bin.sampled || none.sampled != 1000 {
+		t.Errorf("got .txt %s, .bin %s, none %s", txt, bin, none)
+	}
+	if ce.all.sampled != 76000+64<<10+1000 || ce.buffers != 19+16+1 || ce.skipped.Load() != 0 || ce.spent.Load() <= 0 {
+		t.Errorf("got %s, %d buffers, %d skipped, %d spent", ce.all, ce.buffers, ce.skipped.Load(), ce.spent.Load())
+	}
+
+	summary := &bytes.Buffer{}
+	ce.print(summary)
+	lines := strings.Split(summary.String(), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "Compression estimate (flate level 1, 1 in 1 buffers): 0.") ||
+		!strings.HasPrefix(lines[1], "  .txt: 0.") || !strings.HasPrefix(lines[2], "  .bin: 1.") || !strings.HasPrefix(lines[3], "  (none): 0.") {
+		t.Errorf("got %q", summary.String())
+	}
+}
+
+// Test one buffer in every is sampled and the trials stop once over the CPU budget
+func TestCompressionSampling(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	mc.EnableCompressionEstimate(4)
+	ce := mc.compression
+	ce.cpuShare = 1e9
+	ce.workers = 1
+	for i := 0; i < 10; i++ {
+		ce.sample(".txt", []byte("data"))
+	}
+	if ce.buffers != 2 || ce.all.sampled != 8 {
+		t.Errorf("got %d buffers, %dB", ce.buffers, ce.all.sampled)
+	}
+	ce.cpuShare = 0
+	for i := 0; i < 8; i++ {
+		ce.sample(".txt", []byte("data"))
+	}
+	if ce.buffers != 2 || ce.skipped.Load() != 2 {
+		t.Errorf("got %d buffers, %d skipped", ce.buffers, ce.skipped.Load())
+	}
+}
+
+// BenchmarkCompressionEstimate measures the cost of the trials on reads of 64KB of text, by sampling rate
+func BenchmarkCompressionEstimate(b *testing.B) {
+	data := []byte(strings.Repeat("compressible text, ", 1<<16))
+	for _, every := range []uint64{0, 64, 16, 1} {
+		b.Run(fmt.Sprintf("every%d", every), func(b *testing.B) {
+			mc := InitMassCRC32C(64, 1)
+			var ce *compressionEstimate
+			if every > 0 {
+				mc.EnableCompressionEstimate(every)
+				ce = mc.compression
+				ce.cpuShare = 1e9
+				ce.workers = 1
+			}
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var r io.Reader = bytes.NewReader(data)
+				if ce != nil {
+					r = ce.newReader(r, "bench.txt")
+				}
+				if _, _, err := mc.CRCReader(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
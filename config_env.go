@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const envPrefix = "MASS_CRC32C_"
+
+// envAliases names the environment variables of the single letter flags
+var envAliases = map[string]string{
+	"p": "CPUS",
+	"j": "JOBS",
+	"l": "LIST_QUEUE",
+	"s": "READ_SIZE",
+	"c": "COMPRESS",
+	"x": "EXTENDED_SUMMARY",
+	"z": "NUL_RECORDS",
+}
+
+// envName is the environment variable of a flag of the subcommand whose variables start with prefix,
+// e.g. MASS_CRC32C_OUT_LOCK_WAIT for -out-lock-wait of compute
+func envName(prefix string, flagName string) string {
+	if alias, ok := envAliases[flagName]; ok {
+		return prefix + alias
+	}
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+type configSource int
+
+const (
+	sourceDefault configSource = iota
+	sourceEnv
+	sourceFlag
+)
+
+func (s configSource) String() string {
+	return [...]string{"default", "env", "flag"}[s]
+}
+
+// applyEnv sets the flags of the parsed fs not given on the command line from their environment variable
+// and returns the source of every flag, a value the flag rejects is an error naming the variable
+func applyEnv(fs *flag.FlagSet, prefix string, lookup func(string) (string, bool)) (map[string]configSource, error) {
+	sources := make(map[string]configSource)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] == sourceFlag {
+			return
+		}
+		value, ok := lookup(envName(prefix, f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s=%q: %v", envName(prefix, f.Name), value, setErr)
+			return
+		}
+		sources[f.Name] = sourceEnv
+	})
+	return sources, err
+}
+
+// printConfig prints the build header line then the value of every flag with its source and environment variable
+func printConfig(w io.Writer, fs *flag.FlagSet, prefix string, sources map[string]configSource) {
+	fmt.Fprint(w, toolBuild().header())
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAG\tVALUE\tSOURCE\tENV")
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(tw, "-%s\t%q\t%s\t%s\n", f.Name, f.Value.String(), sources[f.Name], envName(prefix, f.Name))
+	})
+	tw.Flush()
+}
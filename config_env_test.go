@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"j":             "MASS_CRC32C_JOBS",
+		"out":           "MASS_CRC32C_OUT",
+		"out-lock-wait": "MASS_CRC32C_OUT_LOCK_WAIT",
+	} {
+		if got := envName(envPrefix, name); got != expected {
+			t.Errorf("got %s for -%s, expected %s", got, name, expected)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jobs := fs.Int("j", 1, "")
+	out := fs.String("out", "", "")
+	compress := fs.Bool("c", false, "")
+	wait := fs.Duration("out-lock-wait", 0, "")
+	chunk := fs.String("chunk-manifest", "", "")
+	errFormat := fs.String("errformat", "text", "")
+	env := map[string]string{
+		"MASS_CRC32C_JOBS":           "8",
+		"MASS_CRC32C_OUT":            "env.txt",
+		"MASS_CRC32C_COMPRESS":       "1",
+		"MASS_CRC32C_OUT_LOCK_WAIT":  "1m30s",
+		"MASS_CRC32C_CHUNK_MANIFEST": "1G",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := fs.Parse([]string{"-out", "flag.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := applyEnv(fs, envPrefix, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *jobs != 8 || *out != "flag.txt" || !*compress || *wait != 90*time.Second || *errFormat != "text" {
+		t.Errorf("got -j %d -out %s -c %t -out-lock-wait %s -errformat %s", *jobs, *out, *compress, *wait, *errFormat)
+	}
+	if size, err := parseByteSize(*chunk); err != nil || size != 1<<30 {
+		t.Errorf("got -chunk-manifest %s parsed to %d %v, expected 1GiB", *chunk, size, err)
+	}
+	expected := map[string]configSource{"j": sourceEnv, "out": sourceFlag, "c": sourceEnv, "errformat": sourceDefault}
+	for name, source := range expected {
+		if sources[name] != source {
+			t.Errorf("got source %s for -%s, expected %s", sources[name], name, source)
+		}
+	}
+
+	printed := &bytes.Buffer{}
+	printConfig(printed, fs, envPrefix, sources)
+	if !containsFields(printed.String(), "-out", `"flag.txt"`, "flag", "MASS_CRC32C_OUT") {
+		t.Errorf("unexpected config: %q", printed.String())
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{"MASS_CRC32C_JOBS": "many", "MASS_CRC32C_COMPRESS": "yes please", "MASS_CRC32C_OUT_LOCK_WAIT": "10"} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Int("j", 1, "")
+		fs.Bool("c", false, "")
+		fs.Duration("out-lock-wait", 0, "")
+		fs.Parse(nil)
+		_, err := applyEnv(fs, envPrefix, func(env string) (string, bool) { return value, env == name })
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("got %v for %s=%s, expected an error naming the variable", err, name, value)
+		}
+	}
+}
+
+func containsFields(text string, fields ...string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Join(strings.Fields(line), " ") == strings.Join(fields, " ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The -enc encodings of the CRCs in the records, base64 like gsutil by default. The manifests, the
+// expected CRCs of the JSON jobs and the edges are read in any, told apart by crcEncodingOf: a
+// base64 CRC is 8 characters ending in "==", a hex one 8 hex digits and a base64url one 6 characters.
+const (
+	encBase64    = "base64"
+	encHex       = "hex"
+	encBase64URL = "base64url" // the unpadded URL and filename safe alphabet, for URLs and JSON keys
+)
+
+func parseEncoding(name string) (string, error) {
+	switch name {
+	case encBase64, encHex, encBase64URL:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q, expected %s, %s or %s", name, encBase64, encHex, encBase64URL)
+}
+
+// SetEncoding writes the CRCs of the records, chunks and edges in enc, must be called before Startup
+func (mc *MassCRC32C) SetEncoding(enc string) {
+	mc.encoding = enc
+}
+
+// formatCRC is the text of crc in the records
+func (mc *MassCRC32C) formatCRC(crc uint32) string {
+	switch mc.encoding {
+	case encHex:
+		return fmt.Sprintf("%08x", crc)
+	case encBase64URL:
+		return base64.RawURLEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, crc))
+	}
+	return encodeCRC(crc)
+}
+
+// crcEncodingOf tells the encoding of a CRC of the records, base64 for the invalid ones
+func crcEncodingOf(crc string) string {
+	switch {
+	case isHexCRC(crc):
+		return encHex
+	case len(crc) == 6:
+		return encBase64URL
+	}
+	return encBase64
+}
+
+// isHexCRC tells whether crc is a CRC of -enc hex, in either case
+func isHexCRC(crc string) bool {
+	if len(crc) != 8 {
+		return false
+	}
+	_, err := hex.DecodeString(crc)
+	return err == nil
+}
+
+// sameCRC tells whether two CRCs of the records are the same, decoded when their encodings differ
+func sameCRC(a string, b string) bool {
+	if enc := crcEncodingOf(a); enc == crcEncodingOf(b) {
+		return a == b || (enc == encHex && strings.EqualFold(a, b))
+	}
+	crcA, errA := decodeCRC(a)
+	crcB, errB := decodeCRC(b)
+	return errA == nil && errB == nil && crcA == crcB
+}
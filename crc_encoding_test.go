@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the -enc encodings of the same payloads decode to the same CRC
+func TestCRCEncoding(t *testing.T) {
+	table := crc32.MakeTable(crc32.Castagnoli)
+	payloads := []string{"", "a", "short test data", strings.Repeat("long test data ", 1000), "file 0", "file 16"}
+	for _, payload := range payloads {
+		crc := crc32.Checksum([]byte(payload), table)
+		encoded := make(map[string]string)
+		for _, enc := range []string{encBase64, encHex, encBase64URL} {
+			mc := InitMassCRC32C(1, 1)
+			mc.SetEncoding(enc)
+			digest, _, err := mc.CRCReader(strings.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded[enc] = digest
+			if decoded, err := decodeCRC(digest); err != nil || decoded != crc || crcEncodingOf(digest) != enc {
+				t.Errorf("decoding %s %s: got %08x %v, expected %08x", enc, digest, decoded, err, crc)
+			}
+		}
+		b64, b64URL := encoded[encBase64], encoded[encBase64URL]
+		if b64 != encodeCRC(crc) || encoded[encHex] != fmt.Sprintf("%08x", crc) || strings.ContainsAny(b64URL, "+/=") ||
+			b64URL != strings.NewReplacer("+", "-", "/", "_").Replace(strings.TrimSuffix(b64, "==")) {
+			t.Errorf("%.20q: got %v, expected the CRC %08x", payload, encoded, crc)
+		}
+		if decoded, err := decodeCRC(strings.ToUpper(encoded[encHex])); err != nil || decoded != crc {
+			t.Errorf("decoding the uppercase hex: got %08x %v", decoded, err)
+		}
+		for _, a := range encoded {
+			for _, b := range encoded {
+				if !sameCRC(a, b) {
+					t.Errorf("%s and %s differ", a, b)
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"WaIfQg==", "59a21f42", true},
+		{"WaIfQg", "59a21f42", true},
+		{"xx/j/w==", "xx_j_w", true},
+		{"xx/j/w==", "xx_j_g", false},
+		{"59A21F42", "59a21f42", true},
+		{"WaIfQg==", "59a21f43", false},
+		{"AAAAAA==", "AAAAAB==", false}, // the same bytes, but not a CRC written by the tool
+		{"AAAAAA==", "bad", false},
+	}
+	for _, test := range tests {
+		if sameCRC(test.a, test.b) != test.same {
+			t.Errorf("%s %s: expected same=%v", test.a, test.b, test.same)
+		}
+	}
+	for _, bad := range []string{"59a21f4", "59a21f4g", "59a21f4200", "xx/j/w", "xx_j_w=="} {
+		if _, err := decodeCRC(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+// Test a hex run verifies the base64 expected CRCs and carries forward the CRCs of a base64 manifest
+func TestHexEncodingRun(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "previous")
+	if err := os.WriteFile(manifest, []byte("WaIfQg== 3538 test_data.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.SetEncoding(encHex)
+		if err := mc.LoadSinceManifest(manifest, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if out.String() != "59a21f42 3538 test_data.txt\n" || mc.carriedForwardCount.Load() != 1 {
+		t.Errorf("got %q, %d carried forward", out.String(), mc.carriedForwardCount.Load())
+	}
+
+	item := QueueItem{Path: "test_data.txt", Expected: "WaIfQg=="}
+	if err := item.verify("59a21f42", nil); err != nil {
+		t.Error(err)
+	}
+	item.Expected = "59a21f43"
+	if err := item.verify("WaIfQg==", nil); err == nil {
+		t.Error("expected a mismatch")
+	}
+}
+
+// Test the jsonl and CSV records of -enc base64url are URL safe and decode to the CRCs of the standard
+// encoding for the same files
+func TestBase64URLRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("file %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	run := func(enc string, format string) map[string]string {
+		out := &bytes.Buffer{}
+		runPaths(t, 4, paths, func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.SetEncoding(enc)
+			if format == "csv" {
+				mc.EnableCSVOutput(false)
+			} else {
+				mc.EnableJSONLOutput()
+			}
+		})
+		crcs := make(map[string]string)
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			if format == "csv" {
+				fields := strings.Split(line, ",")
+				crcs[fields[2]] = fields[0]
+				continue
+			}
+			rec, err := parseJSONRecord(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crcs[rec.Path] = rec.CRC
+		}
+		return crcs
+	}
+	for _, format := range []string{"jsonl", "csv"} {
+		standard := run(encBase64, format)
+		urlSafe := run(encBase64URL, format)
+		if len(standard) != len(paths) || len(urlSafe) != len(paths) {
+			t.Fatalf("%s: got %d and %d records", format, len(standard), len(urlSafe))
+		}
+		escaped := 0
+		for path, crc := range urlSafe {
+			if strings.ContainsAny(standard[path], "+/") {
+				escaped++
+			}
+			expected, _ := decodeCRC(standard[path])
+			if decoded, err := decodeCRC(crc); err != nil || decoded != expected || strings.ContainsAny(crc, "+/=") {
+				t.Errorf("%s %s: got %s, expected %s", format, path, crc, standard[path])
+			}
+			if err := (QueueItem{Path: path, Expected: standard[path]}).verify(crc, nil); err != nil {
+				t.Error(err)
+			}
+		}
+		if escaped == 0 {
+			t.Errorf("%s: no standard CRC needing escaping", format)
+		}
+	}
+}
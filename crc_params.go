@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// crcParams are the parameters of a CRC-32 in the Rocksoft model: the polynomial in normal form
+// without its x^32 term, the initial register, whether the bytes are processed and the result
+// given least significant bit first, and the final xor
+type crcParams struct {
+	poly    uint32
+	init    uint32
+	reflect bool
+	xorOut  uint32
+}
+
+// castagnoliParams are the CRC-32C ones, the default
+var castagnoliParams = crcParams{poly: 0x1EDC6F41, init: 0xFFFFFFFF, reflect: true, xorOut: 0xFFFFFFFF}
+
+// ieeeParams are the CRC-32 of zip, gzip and the legacy archive tools, -poly ieee
+var ieeeParams = crcParams{poly: 0x04C11DB7, init: 0xFFFFFFFF, reflect: true, xorOut: 0xFFFFFFFF}
+
+// The -poly names, the text manifests of another polynomial than CRC-32C start with a
+// "# mass-crc32c poly=<name>" header line telling their consumers
+const (
+	polyCastagnoli   = "castagnoli"
+	polyIEEE         = "ieee"
+	polyHeaderPrefix = "# mass-crc32c poly="
+)
+
+func parsePoly(name string) (crcParams, error) {
+	switch name {
+	case polyCastagnoli:
+		return castagnoliParams, nil
+	case polyIEEE:
+		return ieeeParams, nil
+	}
+	return crcParams{}, fmt.Errorf("unknown polynomial %q, expected %s or %s", name, polyCastagnoli, polyIEEE)
+}
+
+// polyName is the -poly name of p, empty for the custom -crc-poly ones
+func (p crcParams) polyName() string {
+	switch p {
+	case castagnoliParams:
+		return polyCastagnoli
+	case ieeeParams:
+		return polyIEEE
+	}
+	return ""
+}
+
+func (p crcParams) validate() error {
+	if p.poly&1 == 0 {
+		return errors.New("the polynomial must have its x^0 term, an odd value")
+	}
+	return nil
+}
+
+func (p crcParams) String() string {
+	switch p {
+	case castagnoliParams:
+		return "CRC-32C (Castagnoli)"
+	case ieeeParams:
+		return "CRC-32 (IEEE)"
+	}
+	return fmt.Sprintf("poly 0x%08X init 0x%08X reflect %t xorout 0x%08X", p.poly, p.init, p.reflect, p.xorOut)
+}
+
+// crcEngine computes the CRC of crcParams: the reflected ones with hash/crc32, which keeps the
+// hardware CRC-32C and IEEE implementations, the others with a most significant bit first table
+type crcEngine struct {
+	params   crcParams
+	table    *crc32.Table // reflected
+	msbTable *[256]uint32 // not reflected
+}
+
+func newCRCEngine(p crcParams) *crcEngine {
+	e := &crcEngine{params: p}
+	if p.reflect {
+		e.table = crc32.MakeTable(bits.Reverse32(p.poly))
+		return e
+	}
+	e.msbTable = new([256]uint32)
+	for i := range e.msbTable {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ p.poly
+			} else {
+				c <<= 1
+			}
+		}
+		e.msbTable[i] = c
+	}
+	return e
+}
+
+// start is the state before the first byte. The reflected state is the complement of the
+// reflected register, the convention of crc32.Update, so CRC-32C starts from 0 as before.
+func (e *crcEngine) start() uint32 {
+	if e.table != nil {
+		return ^bits.Reverse32(e.params.init)
+	}
+	return e.params.init
+}
+
+func (e *crcEngine) update(state uint32, p []byte) uint32 {
+	if e.table != nil {
+		return crc32.Update(state, e.table, p)
+	}
+	for _, b := range p {
+		state = state<<8 ^ e.msbTable[byte(state>>24)^b]
+	}
+	return state
+}
+
+// sum is the CRC of the data given to update since start
+func (e *crcEngine) sum(state uint32) uint32 {
+	if e.table != nil {
+		state = ^state
+	}
+	return state ^ e.params.xorOut
+}
+
+// parseCRCParams parses the -crc-* flags, the values are hexadecimal with a 0x prefix or decimal
+func parseCRCParams(poly string, init string, reflect bool, xorOut string) (crcParams, error) {
+	p := crcParams{reflect: reflect}
+	for _, v := range []struct {
+		name  string
+		text  string
+		value *uint32
+	}{
+		{"-crc-poly", poly, &p.poly},
+		{"-crc-init", init, &p.init},
+		{"-crc-xorout", xorOut, &p.xorOut},
+	} {
+		n, err := strconv.ParseUint(v.text, 0, 32)
+		if err != nil {
+			return crcParams{}, fmt.Errorf("bad %s %q, expected a 32-bit value like 0x04C11DB7", v.name, v.text)
+		}
+		*v.value = uint32(n)
+	}
+	if err := p.validate(); err != nil {
+		return crcParams{}, fmt.Errorf("bad -crc-poly %s: %w", poly, err)
+	}
+	return p, nil
+}
+
+// polyHeader is the header line of the text records of the -poly ieee CRC, empty for CRC-32C
+// and the custom -crc-poly ones
+func (p crcParams) polyHeader() string {
+	if name := p.polyName(); name != "" && name != polyCastagnoli {
+		return polyHeaderPrefix + name + "\n"
+	}
+	return ""
+}
+
+// writeTextHeader is the writeHeader of the text records with the build and start time headers or the poly
+// header of -poly ieee
+func (mc *MassCRC32C) writeTextHeader(w io.Writer) error {
+	header := mc.crc.params.polyHeader()
+	if mc.buildHeader {
+		header = toolBuild().header() + mc.startedHeader() + header
+	}
+	_, err := io.WriteString(w, header)
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the check values of the CRC catalogue, the CRC of "123456789"
+func TestCRCVariants(t *testing.T) {
+	tests := []struct {
+		name   string
+		params crcParams
+		check  uint32
+	}{
+		{"CRC-32C", castagnoliParams, 0xE3069283},
+		{"CRC-32/ISO-HDLC", crcParams{0x04C11DB7, 0xFFFFFFFF, true, 0xFFFFFFFF}, 0xCBF43926},
+		{"CRC-32/JAMCRC", crcParams{0x04C11DB7, 0xFFFFFFFF, true, 0}, 0x340BC6D9},
+		{"CRC-32/BZIP2", crcParams{0x04C11DB7, 0xFFFFFFFF, false, 0xFFFFFFFF}, 0xFC891918},
+		{"CRC-32/MPEG-2", crcParams{0x04C11DB7, 0xFFFFFFFF, false, 0}, 0x0376E6E7},
+		{"CRC-32/CKSUM", crcParams{0x04C11DB7, 0, false, 0xFFFFFFFF}, 0x765E7680},
+		{"CRC-32Q", crcParams{0x814141AB, 0, false, 0}, 0x3010BF7F},
+		{"CRC-32/XFER", crcParams{0x000000AF, 0, false, 0}, 0xBD0BE338},
+		{"CRC-32/CD-ROM-EDC", crcParams{0x8001801B, 0, true, 0}, 0x6EC2EDC4},
+	}
+	for _, test := range tests {
+		e := newCRCEngine(test.params)
+		if got := e.sum(e.update(e.start(), []byte("123456789"))); got != test.check {
+			t.Errorf("%s: got 0x%08X, expected 0x%08X", test.name, got, test.check)
+		}
+		// split updates give the same CRC
+		state := e.start()
+		for _, part := range []string{"1", "2345", "", "6789"} {
+			state = e.update(state, []byte(part))
+		}
+		if got := e.sum(state); got != test.check {
+			t.Errorf("%s in parts: got 0x%08X, expected 0x%08X", test.name, got, test.check)
+		}
+	}
+}
+
+func TestCRCReaderParams(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	data := strings.Repeat("123456789", 1000) // several reads
+	defaultCRC, _, _ := mc.CRCReader(strings.NewReader(data))
+	mc.SetCRCParams(crcParams{0x04C11DB7, 0xFFFFFFFF, false, 0})
+	crc, size, err := mc.CRCReader(strings.NewReader(data))
+	if err != nil || size != uint64(len(data)) || crc == defaultCRC {
+		t.Fatalf("got %s %d %v, expected another CRC than CRC-32C %s", crc, size, err, defaultCRC)
+	}
+	e := newCRCEngine(crcParams{0x04C11DB7, 0xFFFFFFFF, false, 0})
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, e.sum(e.update(e.start(), []byte(data))))
+	if expected := base64.StdEncoding.EncodeToString(b); crc != expected {
+		t.Errorf("got %s, expected %s", crc, expected)
+	}
+	if got := mc.crc.params.String(); got != "poly 0x04C11DB7 init 0xFFFFFFFF reflect false xorout 0x00000000" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestParseCRCParams(t *testing.T) {
+	tests := []struct {
+		poly, init string
+		reflect    bool
+		xorOut     string
+		ok         bool
+	}{
+		{"0x04C11DB7", "0xFFFFFFFF", true, "0xFFFFFFFF", true},
+		{"0x1EDC6F41", "0", false, "4294967295", true},
+		{"0x04C11DB6", "0xFFFFFFFF", true, "0xFFFFFFFF", false}, // no x^0 term
+		{"0", "0", true, "0", false},
+		{"0x104C11DB7", "0xFFFFFFFF", true, "0xFFFFFFFF", false}, // more than 32 bits
+		{"0x04C11DB7", "-1", true, "0", false},
+		{"0x04C11DB7", "0", true, "xyz", false},
+	}
+	for _, test := range tests {
+		_, err := parseCRCParams(test.poly, test.init, test.reflect, test.xorOut)
+		if (err == nil) != test.ok {
+			t.Errorf("%+v: got %v", test, err)
+		}
+	}
+	if p, _ := parseCRCParams("0x1EDC6F41", "0xFFFFFFFF", true, "0xFFFFFFFF"); p != castagnoliParams || p.String() != "CRC-32C (Castagnoli)" {
+		t.Errorf("got %s", p)
+	}
+}
+
+func TestParsePoly(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		params crcParams
+		header string
+	}{
+		{"castagnoli", castagnoliParams, ""},
+		{"ieee", ieeeParams, "# mass-crc32c poly=ieee\n"},
+	} {
+		params, err := parsePoly(test.name)
+		if err != nil || params != test.params || params.polyName() != test.name || params.polyHeader() != test.header {
+			t.Errorf("%s: got %+v %v", test.name, params, err)
+		}
+	}
+	if _, err := parsePoly("koopman"); err == nil {
+		t.Error("expected an unknown polynomial error")
+	}
+	if name := (crcParams{0x04C11DB7, 0, false, 0}).polyName(); name != "" {
+		t.Errorf("got custom polynomial name %q", name)
+	}
+}
+
+// Test the records of -poly ieee are named so and a -since manifest of another polynomial is refused
+func TestPolyIEEE(t *testing.T) {
+	expected := "AYuAVw==" // the CRC-32 of test_data.txt, like zlib.crc32
+	for _, format := range []string{"text", "jsonl", "csv"} {
+		out := &bytes.Buffer{}
+		mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.SetCRCParams(ieeeParams)
+			switch format {
+			case "jsonl":
+				mc.EnableJSONLOutput()
+			case "csv":
+				mc.EnableCSVOutput(true)
+			}
+		})
+		records := map[string]string{
+			"text":  "# mass-crc32c poly=ieee\n" + expected + " 3538 test_data.txt\n",
+			"jsonl": `{"crc32":"` + expected + `","size":3538,"path":"test_data.txt"}` + "\n",
+			"csv":   "crc32,size,path\n" + expected + ",3538,test_data.txt\n",
+		}
+		if out.String() != records[format] {
+			t.Errorf("%s: got %q, expected %q", format, out.String(), records[format])
+		}
+		if mc.algoName() != "CRC-32 (IEEE)" {
+			t.Errorf("got %s", mc.algoName())
+		}
+	}
+
+	dir := t.TempDir()
+	castagnoli := filepath.Join(dir, "castagnoli.txt")
+	ieee := filepath.Join(dir, "ieee.txt")
+	started := "# mass-crc32c started=" + time.Now().Format(time.RFC3339) + "\n"
+	os.WriteFile(castagnoli, []byte(started+"WaIfQg== 3538 test_data.txt\n"), 0644)
+	os.WriteFile(ieee, []byte(started+"# mass-crc32c poly=ieee\n"+expected+" 3538 test_data.txt\n"), 0644)
+	mc := InitMassCRC32C(1, 1)
+	mc.DebugOut = io.Discard
+	if err := mc.LoadSinceManifest(ieee, time.Time{}); err == nil {
+		t.Error("expected a CRC-32C run to refuse an IEEE manifest")
+	}
+	mc.SetCRCParams(ieeeParams)
+	if err := mc.LoadSinceManifest(castagnoli, time.Time{}); err == nil || !strings.Contains(err.Error(), "castagnoli polynomial, not ieee") {
+		t.Errorf("got %v", err)
+	}
+	if err := mc.LoadSinceManifest(ieee, time.Time{}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+)
+
+// newCSVRecordWriter encodes the rows of the recordColumns in a reused buffer written whole, so no row
+// stays buffered in a csv.Writer, its records must be written by a single goroutine. The columns are
+// taken at the first row, once the run is configured.
+func (mc *MassCRC32C) newCSVRecordWriter() recordWriter {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	var cols []recordColumn
+	var row []string
+	return func(w io.Writer, res Result) {
+		if cols == nil {
+			cols = mc.recordColumns()
+			row = make([]string, len(cols))
+		}
+		digests := mc.splitDigests(res.CRC)
+		for i, col := range cols {
+			row[i] = col.value(&res, digests)
+		}
+		buf.Reset()
+		cw.Write(row)
+		cw.Flush()
+		w.Write(buf.Bytes())
+	}
+}
+
+// writeCSVHeader writes the column names row
+func (mc *MassCRC32C) writeCSVHeader(w io.Writer) error {
+	var header []string
+	for _, col := range mc.recordColumns() {
+		header = append(header, col.header)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.Flush()
+	return cw.Error()
+}
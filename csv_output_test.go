@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVRecords(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	mc.EnableCSVOutput(true)
+	mc.EnableStatFields(statFields{inode: true})
+	paths := []string{"plain", "with space", "com,ma", `quo"te`, "new\nline", " lead"}
+	out := &bytes.Buffer{}
+	mc.writeHeader(out)
+	for i, path := range paths {
+		mc.writeRecord(out, Result{Path: path, Ordinal: "9", CRC: "AAAAAA==", Size: uint64(i), Inode: 42})
+	}
+	rows, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(paths)+1 || strings.Join(rows[0], ",") != "crc,size,path,inode" {
+		t.Fatalf("got %q", rows)
+	}
+	for i, path := range paths {
+		if expected := []string{"AAAAAA==", fmt.Sprint(i), path, "42"}; fmt.Sprintf("%q", rows[i+1]) != fmt.Sprintf("%q", expected) {
+			t.Errorf("got %q, expected %q", rows[i+1], expected)
+		}
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a,b", "c"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, header := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		clean := &bytes.Buffer{}
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.EnableCSVOutput(header)
+			mc.EnableCleanOutput(clean)
+		}
+		runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc}
+			fi.walkRoots([]string{root})
+		})
+
+		for _, output := range []*bytes.Buffer{out, clean} {
+			rows, err := csv.NewReader(output).ReadAll()
+			if header {
+				if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != "crc,size,path" {
+					t.Errorf("got %q %v, expected a header row and 2 rows", rows, err)
+				}
+			} else if err != nil || len(rows) != 2 || rows[0][2] != filepath.Join(root, "a,b") {
+				t.Errorf("got %q %v, expected 2 rows", rows, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const defaultErrorCacheAge = 7 * 24 * time.Hour
+
+// deniedDirs prunes the directories a previous run was denied access to,
+// used by the walker only, a retried directory leaves the cache unless it is denied again
+type deniedDirs struct {
+	cache   *persistentSet
+	retry   bool
+	now     func() time.Time
+	skipped atomic.Uint64
+}
+
+// prune reports whether a cached denied directory is skipped
+func (dd *deniedDirs) prune(path string) bool {
+	if !dd.cache.Contains(path) {
+		return false
+	}
+	if dd.retry {
+		dd.cache.Remove(path)
+		return false
+	}
+	dd.skipped.Add(1)
+	return true
+}
+
+func (dd *deniedDirs) denied(path string) {
+	dd.cache.Add(path, dd.now())
+}
+
+// Close notes the skipped directories and saves the cache
+func (dd *deniedDirs) Close(debugOut io.Writer) error {
+	if skipped := dd.skipped.Load(); skipped > 0 {
+		fmt.Fprintf(debugOut, "skipped %d previously-denied dirs, see -retry-denied\n", skipped)
+	}
+	return dd.cache.Save()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test a denied directory is cached, pruned by the next run and walked again with retry
+func TestDeniedDirs(t *testing.T) {
+	root := t.TempDir()
+	restricted := filepath.Join(root, "restricted")
+	if err := os.MkdirAll(restricted, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(restricted, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "state")
+	run := func(retry bool, deny bool) (string, string) {
+		out := &bytes.Buffer{}
+		debugOut := &bytes.Buffer{}
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.DebugOut = debugOut
+			mc.EnableErrorCache(cache, time.Hour, retry)
+		}
+		runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc}
+			if deny {
+				// running as root the permissions are not enforced, give the walker the error ReadDir gets
+				fi.walkHandler(restricted, replayEntry{path: restricted, typ: fs.ModeDir}, fmt.Errorf("open %s: %w", restricted, fs.ErrPermission))
+			} else {
+				fi.walkRoots([]string{root})
+			}
+		})
+		return out.String(), debugOut.String()
+	}
+
+	run(false, true)
+	if out, debugOut := run(false, false); out != "" || !strings.Contains(debugOut, "skipped 1 previously-denied dirs") {
+		t.Errorf("got %q %q, expected the denied dir pruned", out, debugOut)
+	}
+	if out, _ := run(true, false); strings.Count(out, "\n") != 1 {
+		t.Errorf("got %q, expected the denied dir walked again", out)
+	}
+	if out, debugOut := run(false, false); out == "" || strings.Contains(debugOut, "skipped") {
+		t.Errorf("got %q %q, expected the dir walked once accessible again", out, debugOut)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// The -algo digests computed by CRCReader, written base64 encoded in the records but SHA-256, xxHash64 and BLAKE3
+// in lowercase hex, and the CRC in the -enc encoding
+const (
+	algoCRC32C = "crc32c" // the CRC of crcParams, CRC-32C unless -crc-poly
+	algoMD5    = "md5"    // the MD5 of the GCS non-composite objects and gsutil
+	algoSHA256 = "sha256" // the hex SHA-256 of sha256sum
+	algoXXH64  = "xxh64"  // the hex xxHash64 of xxhsum, for the local duplicate scans
+	algoBLAKE3 = "blake3" // the hex BLAKE3 of b3sum, for the content-addressed stores
+)
+
+func parseAlgo(name string) (string, error) {
+	switch name {
+	case algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown algorithm %q, expected %s, %s, %s, %s or %s", name, algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3)
+}
+
+// parseAlgos parses the comma separated algorithms of -algo, computed in a single read pass
+// and written one column per digest in the order given
+func parseAlgos(spec string) ([]string, error) {
+	var algos []string
+	for _, name := range strings.Split(spec, ",") {
+		algo, err := parseAlgo(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		for _, prev := range algos {
+			if prev == algo {
+				return nil, fmt.Errorf("algorithm %s given twice", algo)
+			}
+		}
+		algos = append(algos, algo)
+	}
+	if len(algos) == 0 {
+		return nil, errors.New("no algorithm")
+	}
+	return algos, nil
+}
+
+// crcHash is the hash.Hash of a crcEngine, its sum is the big endian CRC
+type crcHash struct {
+	e     *crcEngine
+	state uint32
+}
+
+func (h *crcHash) Write(p []byte) (int, error) {
+	h.state = h.e.update(h.state, p)
+	return len(p), nil
+}
+
+func (h *crcHash) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, h.e.sum(h.state))
+}
+
+func (h *crcHash) Reset()         { h.state = h.e.start() }
+func (h *crcHash) Size() int      { return 4 }
+func (h *crcHash) BlockSize() int { return 1 }
+
+// newDigests returns the hashes of the -algo of the run, in order
+func (mc *MassCRC32C) newDigests() []hash.Hash {
+	digests := make([]hash.Hash, len(mc.algos))
+	for i, algo := range mc.algos {
+		switch algo {
+		case algoMD5:
+			digests[i] = md5.New()
+		case algoSHA256:
+			digests[i] = sha256.New()
+		case algoXXH64:
+			digests[i] = newXXH64()
+		case algoBLAKE3:
+			digests[i] = newBLAKE3()
+		default:
+			digests[i] = &crcHash{e: mc.crc, state: mc.crc.start()}
+		}
+	}
+	return digests
+}
+
+// encodeDigests is the text of the digests in the records, separated by spaces
+func (mc *MassCRC32C) encodeDigests(digests []hash.Hash) string {
+	if len(digests) == 1 {
+		return mc.encodeDigest(mc.algos[0], digests[0].Sum(nil))
+	}
+	encoded := make([]string, len(digests))
+	for i, digest := range digests {
+		encoded[i] = mc.encodeDigest(mc.algos[i], digest.Sum(nil))
+	}
+	return strings.Join(encoded, " ")
+}
+
+// encodeDigest encodes a digest of algo, the CRC in the -enc encoding
+func (mc *MassCRC32C) encodeDigest(algo string, sum []byte) string {
+	switch algo {
+	case algoCRC32C:
+		return mc.formatCRC(binary.BigEndian.Uint32(sum))
+	case algoSHA256, algoXXH64, algoBLAKE3:
+		return hex.EncodeToString(sum)
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+// splitDigests splits the digests of a result in the order of the algorithms
+func (mc *MassCRC32C) splitDigests(crc string) []string {
+	if len(mc.algos) == 1 {
+		return []string{crc}
+	}
+	return strings.SplitN(crc, " ", len(mc.algos))
+}
+
+// plainCRC tells whether the run computes the CRC alone, the records other modes parse back
+func (mc *MassCRC32C) plainCRC() bool {
+	return len(mc.algos) == 1 && mc.algos[0] == algoCRC32C
+}
+
+// algoName is the algorithm of the summary
+func (mc *MassCRC32C) algoName() string {
+	names := make([]string, len(mc.algos))
+	for i, algo := range mc.algos {
+		switch algo {
+		case algoMD5:
+			names[i] = "MD5"
+		case algoSHA256:
+			names[i] = "SHA-256"
+		case algoXXH64:
+			names[i] = "xxHash64"
+		case algoBLAKE3:
+			names[i] = "BLAKE3"
+		default:
+			names[i] = mc.crc.params.String()
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseAlgo(t *testing.T) {
+	for _, name := range []string{"crc32c", "md5", "sha256", "xxh64", "blake3"} {
+		if algo, err := parseAlgo(name); err != nil || algo != name {
+			t.Errorf("%s: got %s %v", name, algo, err)
+		}
+	}
+	if _, err := parseAlgo("sha1"); err == nil {
+		t.Error("expected an unknown algorithm error")
+	}
+}
+
+// Test the CRC hash resets to the engine start and the CSV header names the digest
+func TestDigest(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	h := mc.newDigests()[0]
+	h.Write([]byte("garbage"))
+	h.Reset()
+	h.Write([]byte("short test data"))
+	if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != "4AmyZA==" || h.Size() != 4 {
+		t.Errorf("got %s size %d", got, h.Size())
+	}
+	if mc.algoName() != "CRC-32C (Castagnoli)" {
+		t.Errorf("got %s", mc.algoName())
+	}
+
+	mc.SetAlgos(algoMD5)
+	out := &bytes.Buffer{}
+	mc.writeCSVHeader(out)
+	if out.String() != "md5,size,path\n" || mc.algoName() != "MD5" {
+		t.Errorf("got %q %s", out.String(), mc.algoName())
+	}
+}
+
+// Test a failing read accounts the size read so far whatever the algorithm
+func TestDigestReadError(t *testing.T) {
+	for _, algo := range []string{algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3} {
+		mc := InitMassCRC32C(1, 1)
+		mc.SetAlgos(algo)
+		reader := io.MultiReader(strings.NewReader("12345"), iotest.ErrReader(io.ErrClosedPipe))
+		digest, size, err := mc.CRCReader(reader)
+		if digest != "" || size != 5 || err != io.ErrClosedPipe || mc.bytesRead.Load() != 5 {
+			t.Errorf("%s: got %q %d %v, %d bytes read", algo, digest, size, err, mc.bytesRead.Load())
+		}
+	}
+}
+
+func TestParseAlgos(t *testing.T) {
+	algos, err := parseAlgos("sha256, crc32c,md5")
+	if err != nil || strings.Join(algos, ",") != "sha256,crc32c,md5" {
+		t.Errorf("got %q %v", algos, err)
+	}
+	for _, spec := range []string{"", "md5,", "md5,sha1", "md5,md5"} {
+		if _, err := parseAlgos(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+// Test a multiple -algo reads the data once, each digest being the one of its algorithm alone,
+// and names the digests in the requested order in the CSV and jsonl records
+func TestMultiDigest(t *testing.T) {
+	payload := strings.Repeat("multiple digests ", 200)
+	algos := []string{algoSHA256, algoCRC32C, algoMD5}
+	var expected []string
+	for _, algo := range algos {
+		mc := InitMassCRC32C(1, 1)
+		mc.SetAlgos(algo)
+		digest, _, err := mc.CRCReader(strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, digest)
+	}
+
+	mc := InitMassCRC32C(1, 1)
+	mc.SetAlgos(algos...)
+	data := makeDummyFileReader(payload)
+	digests, size, err := mc.CRCReader(data)
+	if err != nil || digests != strings.Join(expected, " ") || size != uint64(len(payload)) {
+		t.Errorf("got %q %d %v, expected %q", digests, size, err, expected)
+	}
+	if *data.readCount != 4 || mc.bytesRead.Load() != uint64(len(payload)) {
+		t.Errorf("got %d reads, %d bytes read", *data.readCount, mc.bytesRead.Load())
+	}
+	if mc.algoName() != "SHA-256, CRC-32C (Castagnoli), MD5" {
+		t.Errorf("got %s", mc.algoName())
+	}
+
+	res := Result{Path: "a b", CRC: digests, Size: size}
+	out := &bytes.Buffer{}
+	mc.writeCSVHeader(out)
+	mc.newCSVRecordWriter()(out, res)
+	csv := "sha256,crc32c,md5,size,path\n" + strings.Join(expected, ",") + ",3400,a b\n"
+	if out.String() != csv {
+		t.Errorf("got %q, expected %q", out.String(), csv)
+	}
+	out.Reset()
+	mc.writeJSONRecord(out, res)
+	jsonl := `{"crc32c":"` + expected[1] + `","md5":"` + expected[2] + `","sha256":"` + expected[0] + `","size":3400,"path":"a b"}` + "\n"
+	if out.String() != jsonl {
+		t.Errorf("got %q, expected %q", out.String(), jsonl)
+	}
+}
+
+func BenchmarkCRCReader(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1MiB
+	for _, algo := range []string{algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3} {
+		b.Run(algo, func(b *testing.B) {
+			mc := InitMassCRC32C(256, 1)
+			mc.SetAlgos(algo)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := mc.CRCReader(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
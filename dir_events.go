@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// dirState tracks the files of a directory still in flight
+type dirState struct {
+	parent      *dirState
+	path        string
+	outstanding int  // files queued but not written yet
+	children    int  // sub directories not DONE yet, only used in recursive mode
+	enumerated  bool // the walker left the directory
+	incomplete  bool // a sub directory failed to be listed, only used in recursive mode
+	files       uint64
+	bytes       uint64
+}
+
+// dirTracker emits a DONE event once every file of a directory has been written.
+// The walker opens directories and adds files, the writer marks files done,
+// whichever comes last triggers the event.
+type dirTracker struct {
+	mu        sync.Mutex
+	out       io.Writer
+	recursive bool
+	dirs      map[string]*dirState
+	walkStack []*dirState // directories the walker is currently in
+}
+
+func newDirTracker(out io.Writer, recursive bool) *dirTracker {
+	return &dirTracker{
+		out:       out,
+		recursive: recursive,
+		dirs:      make(map[string]*dirState),
+	}
+}
+
+// isUnder reports whether path is dir itself or below it, both being clean paths
+func isUnder(path string, dir string) bool {
+	for {
+		if path == dir {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// leaveDirs marks the directories the walk moved away from as enumerated, must hold mu
+func (dt *dirTracker) leaveDirs(path string) {
+	for len(dt.walkStack) > 0 {
+		top := dt.walkStack[len(dt.walkStack)-1]
+		if isUnder(path, top.path) {
+			return
+		}
+		dt.walkStack = dt.walkStack[:len(dt.walkStack)-1]
+		top.enumerated = true
+		dt.checkDone(top)
+	}
+}
+
+// enterDir is called by the walker for every directory, in walk order
+func (dt *dirTracker) enterDir(path string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	path = filepath.Clean(path)
+	dt.leaveDirs(path)
+	ds := &dirState{path: path}
+	if dt.recursive && len(dt.walkStack) > 0 {
+		ds.parent = dt.walkStack[len(dt.walkStack)-1]
+		ds.parent.children++
+	}
+	dt.dirs[path] = ds
+	dt.walkStack = append(dt.walkStack, ds)
+}
+
+// dropDir forgets a directory the walker could not list yet, it gets its DONE event when listed again,
+// outside the recursive totals of its parent
+func (dt *dirTracker) dropDir(path string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if ds := dt.remove(path); ds != nil && ds.parent != nil {
+		ds.parent.children--
+		dt.checkDone(ds.parent)
+	}
+}
+
+// failDir forgets a directory the walker failed to list, without a DONE event since its files are
+// unknown, in recursive mode its ancestors get none either as their totals miss its tree
+func (dt *dirTracker) failDir(path string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	ds := dt.remove(path)
+	if ds == nil || ds.parent == nil {
+		return
+	}
+	for parent := ds.parent; parent != nil; parent = parent.parent {
+		parent.incomplete = true
+	}
+	ds.parent.children--
+	dt.checkDone(ds.parent)
+}
+
+// remove forgets the directory path, returning its state, nil when unknown, must hold mu
+func (dt *dirTracker) remove(path string) *dirState {
+	path = filepath.Clean(path)
+	ds, ok := dt.dirs[path]
+	if !ok {
+		return nil
+	}
+	delete(dt.dirs, path)
+	for i, s := range dt.walkStack {
+		if s == ds {
+			dt.walkStack = append(dt.walkStack[:i], dt.walkStack[i+1:]...)
+			break
+		}
+	}
+	return ds
+}
+
+// addFile is called by the walker before queueing a file
+func (dt *dirTracker) addFile(path string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.leaveDirs(path)
+	if ds, ok := dt.dirs[filepath.Dir(path)]; ok {
+		ds.outstanding++
+	}
+}
+
+// fileDone is called by the writer once the record of a file is written
+func (dt *dirTracker) fileDone(path string, size uint64, ok bool) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	ds, found := dt.dirs[filepath.Dir(path)]
+	if !found {
+		return
+	}
+	ds.outstanding--
+	if ok {
+		ds.files++
+		ds.bytes += size
+	}
+	dt.checkDone(ds)
+}
+
+// endWalk is called when the walk of a root is over, remaining directories are enumerated unless the walk
+// stopped early: the directories it was in are partly listed then and forgotten without a DONE event
+func (dt *dirTracker) endWalk(complete bool) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	for len(dt.walkStack) > 0 {
+		top := dt.walkStack[len(dt.walkStack)-1]
+		dt.walkStack = dt.walkStack[:len(dt.walkStack)-1]
+		if !complete {
+			delete(dt.dirs, top.path)
+			continue
+		}
+		top.enumerated = true
+		dt.checkDone(top)
+	}
+}
+
+// checkDone emits the DONE event when the directory is complete, must hold mu
+func (dt *dirTracker) checkDone(ds *dirState) {
+	if !ds.enumerated || ds.outstanding > 0 || ds.children > 0 {
+		return
+	}
+	delete(dt.dirs, ds.path)
+	if !ds.incomplete {
+		fmt.Fprintf(dt.out, "DONE %s files=%d bytes=%d\n", ds.path, ds.files, ds.bytes)
+	}
+	if ds.parent != nil {
+		// in recursive mode the counts are the totals of the sub tree
+		ds.parent.files += ds.files
+		ds.parent.bytes += ds.bytes
+		ds.parent.children--
+		dt.checkDone(ds.parent)
+	}
+}
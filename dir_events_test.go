@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Test events of files written after and before their directory is enumerated
+func TestDirTracker(t *testing.T) {
+	out := &bytes.Buffer{}
+	dt := newDirTracker(out, false)
+	dt.enterDir("root")
+	dt.addFile("root/a")
+	dt.enterDir("root/sub")
+	dt.addFile("root/sub/b")
+	dt.fileDone("root/sub/b", 3, true) // written while sub is still walked
+	if out.Len() > 0 {
+		t.Errorf("unexpected event before enumeration end: %q", out.String())
+	}
+	dt.addFile("root/c") // leaving sub
+	if got := out.String(); got != "DONE root/sub files=1 bytes=3\n" {
+		t.Errorf("got %q, expected sub DONE", got)
+	}
+	out.Reset()
+	dt.endWalk(true)
+	if out.Len() > 0 {
+		t.Errorf("unexpected event with outstanding files: %q", out.String())
+	}
+	dt.fileDone("root/a", 1, true)
+	dt.fileDone("root/c", 0, false) // errors are done but not counted
+	if got := out.String(); got != "DONE root files=1 bytes=1\n" {
+		t.Errorf("got %q, expected root DONE", got)
+	}
+}
+
+func TestDirTrackerRecursive(t *testing.T) {
+	out := &bytes.Buffer{}
+	dt := newDirTracker(out, true)
+	dt.enterDir("root")
+	dt.addFile("root/a")
+	dt.enterDir("root/sub")
+	dt.addFile("root/sub/b")
+	dt.endWalk(true)
+	dt.fileDone("root/a", 1, true)
+	if out.Len() > 0 {
+		t.Errorf("root DONE before its sub directory: %q", out.String())
+	}
+	dt.fileDone("root/sub/b", 3, true)
+	expected := "DONE root/sub files=1 bytes=3\nDONE root files=2 bytes=4\n"
+	if got := out.String(); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+// Test the events of an actual walk through the pipeline
+func TestDirEventsWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "sub/b", "sub/c", "sub/deep/d", "z"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.EnableDirEvents(out, false)
+	}
+	runPipeline(t, 4, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		if err := filepath.WalkDir(root, fi.walkHandler); err != nil {
+			t.Fatal(err)
+		}
+		mc.dirEvents.endWalk(true)
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	expected := []string{
+		"DONE " + root + " files=2 bytes=2",
+		"DONE " + filepath.Join(root, "sub") + " files=2 bytes=10",
+		"DONE " + filepath.Join(root, "sub/deep") + " files=1 bytes=10",
+	}
+	sort.Strings(expected)
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got %q, expected %q", lines, expected)
+	}
+}
+
+// Test the directories partly listed, by an interrupted walk or a listing failing, get no DONE event,
+// nor their ancestors in recursive mode
+func TestDirTrackerIncomplete(t *testing.T) {
+	out := &bytes.Buffer{}
+	dt := newDirTracker(out, false)
+	dt.enterDir("root")
+	dt.addFile("root/a")
+	dt.enterDir("root/denied")
+	dt.failDir("root/denied")
+	dt.enterDir("root/sub")
+	dt.addFile("root/sub/b")
+	dt.endWalk(false)
+	dt.fileDone("root/a", 1, true)
+	dt.fileDone("root/sub/b", 1, true)
+	if out.Len() > 0 {
+		t.Errorf("got %q, expected no DONE event", out.String())
+	}
+
+	dt = newDirTracker(out, true)
+	dt.enterDir("root")
+	dt.addFile("root/a")
+	dt.enterDir("root/ok")
+	dt.enterDir("root/denied")
+	dt.failDir("root/denied")
+	dt.endWalk(true)
+	dt.fileDone("root/a", 1, true)
+	if got := out.String(); got != "DONE root/ok files=0 bytes=0\n" {
+		t.Errorf("got %q, expected the complete sub directory DONE alone", got)
+	}
+}
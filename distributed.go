@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Coordinator/worker protocol over TCP, every frame is a type byte, a big endian uint32 payload length and the payload.
+// Strings are uvarint length prefixed.
+//
+//	worker -> coordinator  frameRequest  empty, asks for a batch
+//	coordinator -> worker  frameBatch    uint64 batch id, uvarint count, paths
+//	coordinator -> worker  frameEnd      empty, no more work
+//	worker -> coordinator  frameResults  uint64 batch id, uvarint count, records of crc, uvarint size, uvarint error class, error in batch order
+//
+// The results frame acknowledges the batch, batches of a worker dropping its connection are handed to another one.
+const (
+	frameRequest = 'R'
+	frameBatch   = 'B'
+	frameEnd     = 'E'
+	frameResults = 'D'
+
+	maxFrameSize = 64 << 20
+)
+
+func writeFrame(w *bufio.Writer, frameType byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	_, err := io.ReadFull(r, payload)
+	return header[0], payload, err
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// frameReader decodes a payload, the first error sticks
+type frameReader struct {
+	buf []byte
+	err error
+}
+
+func (fr *frameReader) uvarint() uint64 {
+	if fr.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(fr.buf)
+	if n <= 0 {
+		fr.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	fr.buf = fr.buf[n:]
+	return v
+}
+
+// count reads the count of the records following, each of a byte at least, refusing a count the rest of the
+// payload cannot hold before it sizes anything
+func (fr *frameReader) count() uint64 {
+	n := fr.uvarint()
+	if fr.err == nil && n > uint64(len(fr.buf)) {
+		fr.err = fmt.Errorf("count %d beyond the %d bytes left in the frame", n, len(fr.buf))
+	}
+	if fr.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (fr *frameReader) uint64() uint64 {
+	if fr.err != nil {
+		return 0
+	}
+	if len(fr.buf) < 8 {
+		fr.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint64(fr.buf)
+	fr.buf = fr.buf[8:]
+	return v
+}
+
+func (fr *frameReader) string() string {
+	n := fr.uvarint()
+	if fr.err != nil {
+		return ""
+	}
+	if uint64(len(fr.buf)) < n {
+		fr.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(fr.buf[:n])
+	fr.buf = fr.buf[n:]
+	return s
+}
+
+type pathBatch struct {
+	id    uint64
+	items []QueueItem
+}
+
+// coordinator hands out batches of the walked paths to the workers and writes their results
+type coordinator struct {
+	mc        *MassCRC32C
+	listener  net.Listener
+	batchSize int
+
+	batches    chan *pathBatch
+	retryReady chan struct{} // notified when a batch is back in retry
+	done       chan struct{} // closed when every batch is acknowledged
+
+	mu          sync.Mutex // also serializes the results sent to the writer
+	nextID      uint64
+	pending     map[uint64]*pathBatch // handed out, not acknowledged yet
+	retry       []*pathBatch
+	batcherDone bool
+	stopped     bool // interrupted, results are not written anymore
+}
+
+// EnableCoordinator listens on addr for workers, Startup or Run then feed them the paths of PathQueueG instead
+// of starting local handlers and TearDown returns once every batch is acknowledged. Must be called before Startup.
+func (mc *MassCRC32C) EnableCoordinator(addr string, batchSize int) (net.Addr, error) {
+	listener, err := coordinatorListener(addr, mc.DebugOut)
+	if err != nil {
+		return nil, err
+	}
+	co := &coordinator{
+		mc:         mc,
+		listener:   listener,
+		batchSize:  batchSize,
+		batches:    make(chan *pathBatch),
+		retryReady: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		pending:    make(map[uint64]*pathBatch),
+	}
+	mc.coordinator = co
+	return listener.Addr(), nil
+}
+
+// start feeds the workers in place of the local handlers, called by Startup
+func (co *coordinator) start() {
+	co.mc.wg.Add(1)
+	goroutines.spawn(goroutineCoordinator, co.batcher)
+	goroutines.spawn(goroutineCoordinator, co.accept)
+}
+
+// coordinatorListener uses the socket passed by systemd socket activation instead of binding addr when there is one
+func coordinatorListener(addr string, debugOut io.Writer) (net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		return net.Listen("tcp", addr)
+	}
+	for _, l := range listeners[1:] {
+		l.Close()
+	}
+	fmt.Fprintf(
+		debugOut,
+		"coordinator: using the socket of systemd socket activation (%d passed, first one used), ignoring %s\n",
+		len(listeners),
+		addr,
+	)
+	return listeners[0], nil
+}
+
+// batcher groups the queued paths in batches, it holds the wait group until all of them are acknowledged
+func (co *coordinator) batcher() {
+	defer co.mc.wg.Done()
+	defer co.listener.Close()
+	batch := &pathBatch{}
+	for item := range co.mc.PathQueueG {
+		batch.items = append(batch.items, item)
+		if len(batch.items) >= co.batchSize {
+			if !co.send(batch) {
+				break
+			}
+			batch = &pathBatch{}
+		}
+	}
+	if len(batch.items) > 0 {
+		co.send(batch)
+	}
+	co.mu.Lock()
+	co.batcherDone = true
+	co.checkDone()
+	co.mu.Unlock()
+
+	for {
+		select {
+		case <-co.done:
+			return
+		case <-time.After(100 * time.Millisecond):
+			if co.mc.Interrupted.Load() {
+				co.mu.Lock()
+				co.stopped = true
+				fmt.Fprintf(co.mc.DebugOut, "interrupted with %d batches not acknowledged\n", len(co.pending)+len(co.retry))
+				co.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+func (co *coordinator) send(batch *pathBatch) bool {
+	co.mu.Lock()
+	co.nextID++
+	batch.id = co.nextID
+	co.mu.Unlock()
+	for {
+		select {
+		case co.batches <- batch:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			if co.mc.Interrupted.Load() {
+				return false
+			}
+		}
+	}
+}
+
+// checkDone must hold mu
+func (co *coordinator) checkDone() {
+	if co.batcherDone && len(co.pending) == 0 && len(co.retry) == 0 {
+		select {
+		case <-co.done:
+		default:
+			close(co.done)
+		}
+	}
+}
+
+// nextBatch blocks until a batch is available, false when all the work is done
+func (co *coordinator) nextBatch() (*pathBatch, bool) {
+	for {
+		co.mu.Lock()
+		if len(co.retry) > 0 {
+			batch := co.retry[0]
+			co.retry = co.retry[1:]
+			co.pending[batch.id] = batch
+			co.mu.Unlock()
+			return batch, true
+		}
+		co.mu.Unlock()
+		select {
+		case batch := <-co.batches:
+			co.mu.Lock()
+			co.pending[batch.id] = batch
+			co.mu.Unlock()
+			return batch, true
+		case <-co.retryReady:
+		case <-time.After(100 * time.Millisecond): // several batches may be back in retry for one notification
+		case <-co.done:
+			return nil, false
+		}
+	}
+}
+
+func (co *coordinator) accept() {
+	for {
+		conn, err := co.listener.Accept()
+		if err != nil {
+			return // listener closed by the batcher
+		}
+		goroutines.spawn(goroutineWorkerConn, func() { co.serve(conn) })
+	}
+}
+
+// serve handles a worker connection, its unacknowledged batches are put back in retry when it goes away
+func (co *coordinator) serve(conn net.Conn) {
+	fmt.Fprintf(co.mc.DebugOut, "worker connected: %s\n", conn.RemoteAddr())
+
+	inflight := make(map[uint64]*pathBatch)
+	defer func() {
+		conn.Close()
+		co.mu.Lock()
+		for id, batch := range inflight {
+			if _, ok := co.pending[id]; ok {
+				delete(co.pending, id)
+				co.retry = append(co.retry, batch)
+			}
+		}
+		co.mu.Unlock()
+		if len(inflight) > 0 {
+			fmt.Fprintf(co.mc.DebugOut, "worker %s left with %d batches, reassigning\n", conn.RemoteAddr(), len(inflight))
+			select {
+			case co.retryReady <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		frameType, payload, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				co.mc.printErr(errScopeWorker, conn.RemoteAddr().String(), "", err)
+			}
+			return
+		}
+		switch frameType {
+		case frameRequest:
+			batch, ok := co.nextBatch()
+			if !ok {
+				_ = writeFrame(w, frameEnd, nil)
+				return
+			}
+			inflight[batch.id] = batch
+			buf := binary.BigEndian.AppendUint64(nil, batch.id)
+			buf = binary.AppendUvarint(buf, uint64(len(batch.items)))
+			for _, item := range batch.items {
+				buf = appendString(buf, item.Path)
+			}
+			if err = writeFrame(w, frameBatch, buf); err != nil {
+				return
+			}
+		case frameResults:
+			if err = co.acknowledge(conn.RemoteAddr().String(), payload, inflight); err != nil {
+				co.mc.printErr(errScopeWorker, conn.RemoteAddr().String(), "", err)
+				return
+			}
+		default:
+			co.mc.printErr(errScopeWorker, conn.RemoteAddr().String(), "", fmt.Errorf("unexpected frame %q", frameType))
+			return
+		}
+	}
+}
+
+func (co *coordinator) acknowledge(worker string, payload []byte, inflight map[uint64]*pathBatch) error {
+	fr := frameReader{buf: payload}
+	id := fr.uint64()
+	count := fr.count()
+	results := make([]fileResult, 0, count)
+	for i := uint64(0); i < count && fr.err == nil; i++ {
+		res := fileResult{crc: fr.string(), size: fr.uvarint()}
+		res.err = readError(&fr)
+		results = append(results, res)
+	}
+	if fr.err != nil {
+		return fr.err
+	}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	batch, ok := co.pending[id]
+	delete(co.pending, id)
+	delete(inflight, id)
+	if !ok || co.stopped {
+		return nil // already completed by another worker
+	}
+	if len(results) != len(batch.items) {
+		return fmt.Errorf("batch %d: got %d results for %d paths", id, len(results), len(batch.items))
+	}
+	for i, res := range results {
+		res.item = batch.items[i]
+		res.item.worker = worker
+		if res.err != nil {
+			co.mc.fileErrorCount.Add(1)
+		} else {
+			co.mc.fileCount.Add(1)
+			co.mc.totalDataComputed.Add(res.size)
+		}
+		co.mc.sendResult(res)
+	}
+	co.checkDone()
+	return nil
+}
+
+// worker runs the batches received from a coordinator through the local handlers
+type worker struct {
+	mc      *MassCRC32C
+	wg      sync.WaitGroup
+	base    uint64 // sequence of the first path of the batch
+	results []fileResult
+}
+
+// handler stores the result at the index of the path in the batch, its sequence from the first one of the batch
+func (wk *worker) handler(item QueueItem) error {
+	defer wk.wg.Done()
+	err, fileSize, crc := wk.mc.pathToCRC(item.Path, item.worker)
+	if err != nil {
+		wk.mc.fileErrorCount.Add(1)
+	} else {
+		wk.mc.countComputed(item, fileSize)
+	}
+	wk.results[item.seq-wk.base] = fileResult{item: item, crc: crc, size: fileSize, err: err}
+	return nil
+}
+
+// RunWorker pulls batches from the coordinator at addr until there is no more work,
+// it replaces Startup and must be followed by TearDown.
+func (mc *MassCRC32C) RunWorker(addr string, jobCount int) error {
+	wk := worker{mc: mc}
+	mc.HandlerFunc = wk.handler
+	mc.accounting.remote = true
+	mc.Startup(jobCount)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for !mc.Interrupted.Load() {
+		if err = writeFrame(w, frameRequest, nil); err != nil {
+			return err
+		}
+		frameType, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		if frameType == frameEnd {
+			return nil
+		}
+		if frameType != frameBatch {
+			return fmt.Errorf("unexpected frame %q", frameType)
+		}
+		fr := frameReader{buf: payload}
+		id := fr.uint64()
+		count := fr.count()
+		paths := make([]string, 0, count)
+		for i := uint64(0); i < count && fr.err == nil; i++ {
+			paths = append(paths, fr.string())
+		}
+		if fr.err != nil {
+			return fr.err
+		}
+
+		wk.base = mc.enqueueSeq.Load()
+		wk.results = make([]fileResult, len(paths))
+		wk.wg.Add(len(paths))
+		queued := 0
+		for _, path := range paths {
+			if mc.EnqueueItem(QueueItem{Path: path}) != nil {
+				break
+			}
+			queued++
+		}
+		wk.wg.Add(queued - len(paths)) // the paths left after an interruption are not queued
+		wk.wg.Wait()
+		if queued < len(paths) {
+			break // the batch not acknowledged is handed to another worker
+		}
+
+		buf := binary.BigEndian.AppendUint64(nil, id)
+		buf = binary.AppendUvarint(buf, uint64(len(wk.results)))
+		for _, res := range wk.results {
+			buf = appendString(buf, res.crc)
+			buf = binary.AppendUvarint(buf, res.size)
+			buf = appendError(buf, res.err)
+		}
+		if err = writeFrame(w, frameResults, buf); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(mc.DebugOut, "worker interrupted")
+	return nil
+}
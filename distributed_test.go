@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Test a coordinator with two workers, one of them dying with a batch which must be reassigned
+func TestCoordinatorWorkers(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d", i))
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	co := InitMassCRC32C(1, 10)
+	co.StdOut = out
+	co.ErrOut = errOut
+	co.DebugOut = io.Discard
+	addr, err := co.EnableCoordinator("127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	co.Startup(1)
+
+	// a worker taking a batch and disconnecting without acknowledging it
+	dead, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadW := bufio.NewWriter(dead)
+	if err = writeFrame(deadW, frameRequest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, path := range paths {
+			co.Enqueue(path)
+		}
+		co.TearDown()
+	}()
+
+	if frameType, _, err := readFrame(bufio.NewReader(dead)); err != nil || frameType != frameBatch {
+		t.Fatalf("dead worker got frame %q, err %v", frameType, err)
+	}
+	dead.Close()
+
+	wk := InitMassCRC32C(1, 1)
+	wk.DebugOut = io.Discard
+	if err = wk.RunWorker(addr.String(), 2); err != nil {
+		t.Errorf("worker error: %v", err)
+	}
+	wk.TearDown()
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("got %d records, expected 50", len(lines))
+	}
+	var written []string
+	for _, line := range lines {
+		written = append(written, line[strings.LastIndex(line, " ")+1:])
+	}
+	sort.Strings(written)
+	for i, path := range paths[:50] {
+		if written[i] != path {
+			t.Errorf("got %s, expected %s", written[i], path)
+		}
+	}
+	// the class of the error computed by the worker is kept by the coordinator
+	if !strings.Contains(errOut.String(), "class=NOT_FOUND") || !strings.Contains(errOut.String(), "missing") {
+		t.Errorf("missing file error not reported: %q", errOut.String())
+	}
+	if co.fileCount.Load() != 50 || co.fileErrorCount.Load() != 1 {
+		t.Errorf("coordinator counters error, got %d files %d errors", co.fileCount.Load(), co.fileErrorCount.Load())
+	}
+	if wk.fileCount.Load() != 50 {
+		t.Errorf("worker counter error, got %d files", wk.fileCount.Load())
+	}
+}
+
+// Test a worker failing to reach its coordinator exits as an input error
+func TestWorkerExitCode(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if code := run([]string{"-worker", addr}); code != 3 {
+		t.Errorf("got exit code %d, expected 3 with the coordinator gone", code)
+	}
+}
+
+// Test the frames holding a count beyond their size are refused before anything is sized by it
+func TestMalformedFrames(t *testing.T) {
+	payload := binary.AppendUvarint(binary.BigEndian.AppendUint64(nil, 1), 1<<62)
+	co := &coordinator{mc: InitMassCRC32C(1, 1)}
+	if err := co.acknowledge("w", payload, map[uint64]*pathBatch{}); err == nil {
+		t.Error("expected the results frame refused")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		w := bufio.NewWriter(conn)
+		readFrame(bufio.NewReader(conn))
+		writeFrame(w, frameBatch, payload)
+	}()
+	wk := InitMassCRC32C(1, 1)
+	wk.DebugOut = io.Discard
+	if err := wk.RunWorker(ln.Addr().String(), 1); err == nil {
+		t.Error("expected the batch frame refused")
+	}
+	wk.TearDown()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The edge digests of -edge-digest are the CRC of the first and of the last N bytes of a file, written
+// in its record next to the CRC of the whole file. Comparing them tells a truncated or appended file,
+// its tail differs, from a rewritten header, its head differs, without reading the files again.
+// A file smaller than 2N bytes has the CRC of the whole file as both edges.
+
+// edgeDigests are the head and tail CRC of a record, nil when -edge-digest is off or the file is not regular
+type edgeDigests struct {
+	head string
+	tail string
+}
+
+// edgeReader computes the head CRC from the stream read for the CRC of the whole file
+type edgeReader struct {
+	r     io.Reader
+	e     *crcEngine
+	left  int64 // head bytes still to hash
+	state uint32
+}
+
+func newEdgeReader(r io.Reader, e *crcEngine, edgeSize int64) *edgeReader {
+	return &edgeReader{r: r, e: e, left: edgeSize, state: e.start()}
+}
+
+func (er *edgeReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if er.left > 0 && n > 0 {
+		head := int64(n)
+		if head > er.left {
+			head = er.left
+		}
+		er.state = er.e.update(er.state, p[:head])
+		er.left -= head
+	}
+	return n, err
+}
+
+// edges returns the edge digests of a file read whole, fileSize bytes of CRC crc, reading its last
+// edgeSize bytes again. The tail is the one of the data read, not of a file grown or shrunk since.
+func (mc *MassCRC32C) edges(er *edgeReader, file io.ReaderAt, crc string, fileSize uint64) (*edgeDigests, error) {
+	edgeSize := uint64(mc.edgeSize)
+	if fileSize < 2*edgeSize {
+		return &edgeDigests{head: crc, tail: crc}, nil
+	}
+	tail, err := mc.crcSection(file, int64(fileSize-edgeSize), int64(edgeSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading the tail of the edge digest: %w", err)
+	}
+	mc.edgeBytes.Add(edgeSize)
+	return &edgeDigests{head: mc.formatCRC(er.e.sum(er.state)), tail: tail}, nil
+}
+
+// crcSection is the CRC of the n bytes of r at off, read with a buffer of the pool
+func (mc *MassCRC32C) crcSection(r io.ReaderAt, off int64, n int64) (string, error) {
+	buf := mc.bufferPool.Get().([]byte)
+	defer func() { mc.bufferPool.Put(buf) }()
+	state := mc.crc.start()
+	for n > 0 {
+		chunk := buf
+		if int64(len(chunk)) > n {
+			chunk = chunk[:n]
+		}
+		read, err := r.ReadAt(chunk, off)
+		state = mc.crc.update(state, chunk[:read])
+		if read < len(chunk) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // shrunk since read
+			}
+			return "", err
+		}
+		off += int64(read)
+		n -= int64(read)
+	}
+	return mc.formatCRC(mc.crc.sum(state)), nil
+}
+
+// edgeMismatch tells which edges of the record differ from the expected ones, empty when none differs
+// or none is expected
+func (item QueueItem) edgeMismatch(edges *edgeDigests) string {
+	if edges == nil {
+		return ""
+	}
+	var differ []string
+	if item.ExpectedHead != "" && !sameCRC(item.ExpectedHead, edges.head) {
+		differ = append(differ, "head")
+	}
+	if item.ExpectedTail != "" && !sameCRC(item.ExpectedTail, edges.tail) {
+		differ = append(differ, "tail")
+	}
+	switch len(differ) {
+	case 0:
+		return ""
+	case 1:
+		return differ[0] + " differs"
+	}
+	return strings.Join(differ, " and ") + " differ"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Test the head comes from the stream and the tail is read again, a file below 2 edges having
+// the CRC of the whole file as both, and the records parse back without the edge fields
+func TestEdgeDigest(t *testing.T) {
+	root := t.TempDir()
+	var data []byte
+	for i := 0; len(data) < 5000; i++ {
+		data = strconv.AppendInt(data, int64(i), 10)
+	}
+	data = data[:5000]
+	big := filepath.Join(root, "big")
+	small := filepath.Join(root, "small")
+	if err := os.WriteFile(big, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(small, data[:2047], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{big, small}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableEdgeDigest(1024)
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+	})
+
+	expected := crcOf(data) + " 5000 " + big + "\thead=" + crcOf(data[:1024]) + " tail=" + crcOf(data[5000-1024:]) + "\n" +
+		crcOf(data[:2047]) + " 2047 " + small + "\thead=" + crcOf(data[:2047]) + " tail=" + crcOf(data[:2047]) + "\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+	if mc.edgeBytes.Load() != 1024 {
+		t.Errorf("got %d tail bytes read again", mc.edgeBytes.Load())
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if record, err := parseManifestLine(strings.TrimSuffix(line, "\n")); err != nil || strings.Contains(record.Path, "\t") {
+			t.Errorf("%q: got %+v %v", line, record, err)
+		}
+	}
+}
+
+func TestEdgeMismatch(t *testing.T) {
+	edges := &edgeDigests{head: "AAAAAA==", tail: "BBBBBB=="}
+	tests := []struct {
+		item QueueItem
+		err  string
+	}{
+		{QueueItem{Expected: "CCCCCC==", ExpectedHead: "AAAAAA==", ExpectedTail: "BBBBBB=="}, ""},
+		{QueueItem{Expected: "DDDDDD==", ExpectedHead: "AAAAAA==", ExpectedTail: "EEEEEE=="}, "checksum mismatch: tail differs, expected DDDDDD==, got CCCCCC=="},
+		{QueueItem{ExpectedHead: "EEEEEE==", ExpectedTail: "EEEEEE=="}, "checksum mismatch: head and tail differ"},
+		{QueueItem{Expected: "DDDDDD=="}, "checksum mismatch: expected DDDDDD==, got CCCCCC=="},
+	}
+	for _, test := range tests {
+		err := test.item.verify("CCCCCC==", edges)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%+v: got %v", test.item, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err || !errors.Is(err, errChecksumMismatch) {
+			t.Errorf("%+v: got %v, expected %s", test.item, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// errClass is the error taxonomy of the output contract, its tokens are what automation keys on:
+// never rename one, only append new classes
+type errClass int
+
+const (
+	classUnknown     errClass = iota
+	classNotFound             // the path went away
+	classPermission           // access denied
+	classIO                   // the storage failed the operation
+	classStale                // stale network file handle
+	classTimeout              // the storage did not answer in time
+	classChanged              // the file changed while being read
+	classTooManyOpen          // out of file descriptors
+	classCancelled            // the run was interrupted
+	classType                 // unexpected file type with -strict-types
+	classMismatch             // the CRC is not the expected one of an -input json job
+	errClassCount
+)
+
+var errClassNames = [errClassCount]string{
+	"UNKNOWN",
+	"NOT_FOUND",
+	"PERMISSION",
+	"IO",
+	"STALE",
+	"TIMEOUT",
+	"CHANGED",
+	"TOO_MANY_OPEN",
+	"CANCELLED",
+	"TYPE",
+	"MISMATCH",
+}
+
+var errFileChanged = errors.New("file changed while reading")
+
+func (c errClass) String() string {
+	if c < 0 || c >= errClassCount {
+		return errClassNames[classUnknown]
+	}
+	return errClassNames[c]
+}
+
+// classify maps an error to its class, unwrapping it, the errno checks go first
+// since the generic fs errors would hide them
+func classify(err error) errClass {
+	var replayed *replayError
+	if errors.As(err, &replayed) {
+		return replayed.class
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ESTALE:
+			return classStale
+		case syscall.ETIMEDOUT:
+			return classTimeout
+		case syscall.EMFILE, syscall.ENFILE:
+			return classTooManyOpen
+		case syscall.EIO, syscall.ENOSPC, syscall.EROFS:
+			return classIO
+		}
+	}
+	var timeout interface{ Timeout() bool }
+	switch {
+	case err == nil:
+		return classUnknown
+	case errors.Is(err, errUnexpectedType):
+		return classType
+	case errors.Is(err, errChecksumMismatch):
+		return classMismatch
+	case errors.Is(err, errFileChanged):
+		return classChanged
+	case errors.Is(err, ErrInterrupted), errors.Is(err, context.Canceled):
+		return classCancelled
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return classTimeout
+	case errors.Is(err, fs.ErrNotExist):
+		return classNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return classPermission
+	case errno == 0 && errors.As(err, &timeout) && timeout.Timeout(): // Errno reports EAGAIN as a timeout
+		return classTimeout
+	case errors.As(err, new(*fs.PathError)), errors.Is(err, io.ErrUnexpectedEOF):
+		return classIO
+	default:
+		return classUnknown
+	}
+}
+
+// printClassCounts prints the reported errors by class, nothing when there were none
+func (er *errorReporter) printClassCounts(w io.Writer) {
+	var parts []string
+	for c := errClass(0); c < errClassCount; c++ {
+		if n := er.classCounts[c].Load(); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", c, n))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "Errors by class: %s\n", strings.Join(parts, " "))
+	}
+}
+
+// waste accounts the bytes read from a file before it failed with err
+func (er *errorReporter) waste(err error, bytes uint64) {
+	if bytes > 0 {
+		er.classWasted[classify(err)].Add(bytes)
+	}
+}
+
+// printWastedBytes prints the bytes read from failed files, in total and by class, nothing when none
+func (er *errorReporter) printWastedBytes(w io.Writer) {
+	var parts []string
+	total := uint64(0)
+	for c := errClass(0); c < errClassCount; c++ {
+		if n := er.classWasted[c].Load(); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%dB", c, n))
+			total += n
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "Wasted data: %dB, by class: %s\n", total, strings.Join(parts, " "))
+	}
+}
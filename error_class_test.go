@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	pathErr := func(errno syscall.Errno) error {
+		return &fs.PathError{Op: "open", Path: "/x", Err: errno}
+	}
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{pathErr(syscall.ENOENT), "NOT_FOUND"},
+		{fmt.Errorf("retry: %w", pathErr(syscall.ENOENT)), "NOT_FOUND"},
+		{os.ErrNotExist, "NOT_FOUND"},
+		{pathErr(syscall.EACCES), "PERMISSION"},
+		{pathErr(syscall.EPERM), "PERMISSION"},
+		{fmt.Errorf("listing: %w", os.ErrPermission), "PERMISSION"},
+		{pathErr(syscall.EIO), "IO"},
+		{pathErr(syscall.ENOSPC), "IO"},
+		{&fs.PathError{Op: "read", Path: "/x", Err: errors.New("odd")}, "IO"},
+		{io.ErrUnexpectedEOF, "IO"},
+		{pathErr(syscall.ESTALE), "STALE"},
+		{fmt.Errorf("wrapped: %w", pathErr(syscall.ESTALE)), "STALE"},
+		{pathErr(syscall.ETIMEDOUT), "TIMEOUT"},
+		{os.ErrDeadlineExceeded, "TIMEOUT"},
+		{context.DeadlineExceeded, "TIMEOUT"},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, "TIMEOUT"},
+		{pathErr(syscall.EAGAIN), "IO"}, // not a timeout despite Errno.Timeout
+		{errFileChanged, "CHANGED"},
+		{fmt.Errorf("%s: %w", "/x", errFileChanged), "CHANGED"},
+		{pathErr(syscall.EMFILE), "TOO_MANY_OPEN"},
+		{pathErr(syscall.ENFILE), "TOO_MANY_OPEN"},
+		{ErrInterrupted, "CANCELLED"},
+		{fmt.Errorf("batch: %w", context.Canceled), "CANCELLED"},
+		{fmt.Errorf("%w: fifo", errUnexpectedType), "TYPE"},
+		{QueueItem{Expected: "AAAAAA=="}.verify("AAAAAB==", nil), "MISMATCH"},
+		{errors.New("something"), "UNKNOWN"},
+		{nil, "UNKNOWN"},
+	}
+	for _, test := range tests {
+		if class := classify(test.err).String(); class != test.class {
+			t.Errorf("%v: got %s, expected %s", test.err, class, test.class)
+		}
+	}
+}
+
+// the tokens are an output contract, this list only ever grows at its end
+func TestErrClassTokens(t *testing.T) {
+	expected := []string{"UNKNOWN", "NOT_FOUND", "PERMISSION", "IO", "STALE", "TIMEOUT", "CHANGED", "TOO_MANY_OPEN", "CANCELLED", "TYPE", "MISMATCH"}
+	if int(errClassCount) != len(expected) {
+		t.Fatalf("%d classes, expected %d", errClassCount, len(expected))
+	}
+	for i, token := range expected {
+		if got := errClass(i).String(); got != token {
+			t.Errorf("class %d is %s, expected %s", i, got, token)
+		}
+	}
+	if got := errClass(-1).String(); got != "UNKNOWN" {
+		t.Errorf("out of range class is %s", got)
+	}
+}
+
+func TestErrorClassCounts(t *testing.T) {
+	er := errorReporter{now: time.Now}
+	out := &bytes.Buffer{}
+	er.printClassCounts(out)
+	if out.Len() != 0 {
+		t.Errorf("nothing expected without errors, got %q", out)
+	}
+	for _, err := range []error{os.ErrNotExist, os.ErrNotExist, pathErrno(syscall.EIO)} {
+		er.print(io.Discard, errScopeFile, "0", "/x", err)
+	}
+	er.printClassCounts(out)
+	if out.String() != "Errors by class: NOT_FOUND=2 IO=1\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestWastedBytes(t *testing.T) {
+	er := errorReporter{now: time.Now}
+	out := &bytes.Buffer{}
+	er.waste(pathErrno(syscall.EIO), 0)
+	er.printWastedBytes(out)
+	if out.Len() != 0 {
+		t.Errorf("nothing expected without wasted bytes, got %q", out)
+	}
+	er.waste(pathErrno(syscall.EIO), 100)
+	er.waste(pathErrno(syscall.EIO), 20)
+	er.waste(fmt.Errorf("%w: grew", errFileChanged), 5)
+	er.printWastedBytes(out)
+	if out.String() != "Wasted data: 125B, by class: IO=120B CHANGED=5B\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func pathErrno(errno syscall.Errno) error {
+	return &fs.PathError{Op: "read", Path: "/x", Err: errno}
+}
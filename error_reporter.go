@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scopes of the reported errors
+const (
+	errScopeFile   = "file"   // reading or closing a file
+	errScopeDir    = "dir"    // listing a directory
+	errScopeWalk   = "walk"   // the walk of a root aborted
+	errScopeList   = "list"   // reading the path list
+	errScopeWorker = "worker" // a remote worker connection
+)
+
+var errUnexpectedType = errors.New("unexpected file type")
+
+// errorRecord fields are written in this order in both formats
+type errorRecord struct {
+	Time   string `json:"time"`
+	Scope  string `json:"scope"`
+	Class  string `json:"class"`
+	Worker string `json:"worker"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+// errorReporter serializes the error records of the walker, the workers and the writer
+type errorReporter struct {
+	mu     sync.Mutex
+	json   bool
+	nul    bool   // -z, the records end with a NUL
+	escape bool   // -escape-controls, the control characters of the paths of the text records are escaped
+	prefix string // starts the text records, "# " when they share the file of the records
+	now    func() time.Time
+	sinks  map[string]io.Writer // by scope, the default writer for the others
+
+	classCounts [errClassCount]atomic.Uint64
+	classWasted [errClassCount]atomic.Uint64 // bytes read from the files before they failed
+}
+
+// route sends the records of the scopes to w instead of the default writer, must be called before any print
+func (er *errorReporter) route(w io.Writer, scopes ...string) {
+	if er.sinks == nil {
+		er.sinks = make(map[string]io.Writer)
+	}
+	for _, scope := range scopes {
+		er.sinks[scope] = w
+	}
+}
+
+// print writes a record to the sink of its scope, w by default, returning the error writing it
+func (er *errorReporter) print(w io.Writer, scope string, worker string, path string, err error) error {
+	if sink, ok := er.sinks[scope]; ok {
+		w = sink
+	}
+	class := classify(err)
+	er.classCounts[class].Add(1)
+	rec := errorRecord{
+		Time:   er.now().UTC().Format(time.RFC3339),
+		Scope:  scope,
+		Class:  class.String(),
+		Worker: worker,
+		Path:   path,
+		Error:  err.Error(),
+	}
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	if er.json {
+		line, _ := json.Marshal(rec)
+		_, err := w.Write(append(line, er.lineEnd()))
+		return err
+	}
+	text := rec.Error
+	if er.escape {
+		// the os errors hold the path too
+		path, text = escapeControls(path), escapeControls(text)
+	}
+	_, err = fmt.Fprintf(
+		w,
+		"%s%s error scope=%s class=%s worker=%s path='%s': %s%c",
+		er.prefix,
+		rec.Time,
+		rec.Scope,
+		rec.Class,
+		rec.Worker,
+		path,
+		text,
+		er.lineEnd(),
+	)
+	return err
+}
+
+func (er *errorReporter) lineEnd() byte {
+	if er.nul {
+		return 0
+	}
+	return '\n'
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func fixedNow() time.Time {
+	return time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("CEST", 2*3600))
+}
+
+func TestErrorRecordFormat(t *testing.T) {
+	err := &fs.PathError{Op: "open", Path: "/a b", Err: syscall.ENOENT}
+	out := &bytes.Buffer{}
+	er := errorReporter{now: fixedNow}
+	er.print(out, errScopeFile, "3", "/a b", err)
+	expected := "2024-05-06T05:08:09Z error scope=file class=NOT_FOUND worker=3 path='/a b': open /a b: no such file or directory\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+
+	out.Reset()
+	er.json = true
+	er.print(out, errScopeDir, "walker", "/d", fmt.Errorf("listing: %w", os.ErrPermission))
+	expected = `{"time":"2024-05-06T05:08:09Z","scope":"dir","class":"PERMISSION","worker":"walker","path":"/d","error":"listing: permission denied"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+}
+
+// Test concurrent reports never interleave, meant to be run with -race
+func TestErrorReporterConcurrent(t *testing.T) {
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.ErrOut = out
+	mc.SetJSONErrors(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				mc.printErr(errScopeFile, fmt.Sprint(worker), strings.Repeat("p", j), errors.New("failed"))
+			}
+		}(i)
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1600 {
+		t.Fatalf("got %d lines, expected 1600", len(lines))
+	}
+	for _, line := range lines {
+		var rec errorRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("interleaved record %q: %v", line, err)
+		}
+	}
+}
+
+// Test the directory errors go to their sink, the file errors to ErrOut, counted as before
+func TestRouteErrors(t *testing.T) {
+	errOut := &bytes.Buffer{}
+	dirErrOut := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.ErrOut = errOut
+		mc.RouteErrors(dirErrOut, errScopeDir, errScopeWalk)
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.walkHandler("/denied", replayEntry{path: "/denied", typ: fs.ModeDir}, fmt.Errorf("open /denied: %w", fs.ErrPermission))
+		mc.Enqueue("missing.txt")
+	})
+
+	if strings.Count(dirErrOut.String(), "\n") != 1 || !strings.Contains(dirErrOut.String(), "scope=dir class=PERMISSION") {
+		t.Errorf("got %q, expected the dir error", dirErrOut.String())
+	}
+	if strings.Contains(errOut.String(), "scope=dir") || !strings.Contains(errOut.String(), "scope=file class=NOT_FOUND") {
+		t.Errorf("got %q, expected the file error", errOut.String())
+	}
+	if stats := mc.Stats(); stats.DirErrors != 1 || stats.FileErrors != 1 {
+		t.Errorf("got %d dir and %d file errors, expected 1 and 1", stats.DirErrors, stats.FileErrors)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// excludePatterns are the glob patterns of -exclude or -include in the syntax of path.Match, matched against the
+// base name and the path relative to the walked root, or the path as listed, with / separators
+type excludePatterns []string
+
+func newExcludePatterns(patterns []string) (excludePatterns, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	return excludePatterns(patterns), nil
+}
+
+// match tells whether rel or its base name matches a pattern
+func (ep excludePatterns) match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	base := path.Base(rel)
+	for _, pattern := range ep {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathRegexps are the expressions of -exclude-re or -include-re, OR-ed and matched against the full path
+type pathRegexps []*regexp.Regexp
+
+func newPathRegexps(exprs []string) (pathRegexps, error) {
+	var prs pathRegexps
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", expr, err)
+		}
+		prs = append(prs, re)
+	}
+	return prs, nil
+}
+
+func (prs pathRegexps) match(p string) bool {
+	for _, re := range prs {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenName tells whether the base name of a path is hidden, starting with a dot
+func hiddenName(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+// hiddenPath tells whether a component of the listed path p is hidden
+func hiddenPath(p string) bool {
+	for _, name := range strings.Split(filepath.ToSlash(p), "/") {
+		if hiddenName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipHidden prunes the hidden directories and ignores the hidden files while walking, the roots excepted,
+// and ignores the listed paths with a hidden component, must be called before Startup
+func (mc *MassCRC32C) SkipHidden() {
+	mc.skipHidden = true
+}
+
+// stringsFlag is a flag.Value repeatable to give several values
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(value string) error {
+	*sf = append(*sf, value)
+	return nil
+}
+
+// SetExcludes skips the files and prunes the directories matching a pattern while walking, and skips
+// the listed paths matching one, must be called before Startup
+func (mc *MassCRC32C) SetExcludes(patterns []string) error {
+	ep, err := newExcludePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	mc.excludes = ep
+	return nil
+}
+
+// SetRegexpFilters skips the paths matching an exclude expression, and with include expressions only
+// queues the files matching one, like SetExcludes and SetIncludes, must be called before Startup
+func (mc *MassCRC32C) SetRegexpFilters(excludes []string, includes []string) error {
+	var err error
+	if mc.excludeRes, err = newPathRegexps(excludes); err != nil {
+		return fmt.Errorf("-exclude-re %w", err)
+	}
+	if mc.includeRes, err = newPathRegexps(includes); err != nil {
+		return fmt.Errorf("-include-re %w", err)
+	}
+	return nil
+}
+
+// excluded tells whether path, walked from root or listed when root is empty, matches an -exclude pattern
+// or -exclude-re expression, counting it
+func (mc *MassCRC32C) excluded(p string, root string) bool {
+	if len(mc.excludes) == 0 && len(mc.excludeRes) == 0 {
+		return false
+	}
+	if !mc.excludes.match(relPath(p, root)) && !mc.excludeRes.match(p) {
+		return false
+	}
+	mc.excludedCount.Add(1)
+	return true
+}
+
+// relPath is p relative to root, p cleaned when root is empty
+func relPath(p string, root string) string {
+	if root != "" {
+		if rel, err := filepath.Rel(root, p); err == nil {
+			return rel
+		}
+	}
+	return filepath.Clean(p)
+}
+
+// SetIncludes only queues the walked regular files matching a pattern, counting the others as ignored, the
+// directories are walked whatever their names and -exclude wins. The listed paths are not filtered, must be
+// called before Startup
+func (mc *MassCRC32C) SetIncludes(patterns []string) error {
+	ep, err := newExcludePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	mc.includes = ep
+	return nil
+}
+
+// included tells whether the file path, walked from root or listed when root is empty, matches an
+// -include pattern or -include-re expression, true without any. The listed paths have no root the patterns
+// would be relative to, only the expressions filter them.
+func (mc *MassCRC32C) included(p string, root string) bool {
+	if root == "" {
+		return len(mc.includeRes) == 0 || mc.includeRes.match(p)
+	}
+	if len(mc.includes) == 0 && len(mc.includeRes) == 0 {
+		return true
+	}
+	return mc.includes.match(relPath(p, root)) || mc.includeRes.match(p)
+}
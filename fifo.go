@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// fifoPoll bounds each wait on a named pipe, for the interrupt to be seen
+const fifoPoll = 100 * time.Millisecond
+
+// explicitPipe tells whether the root path, a symlink like the /dev/fd/63 of a shell process substitution
+// followed, is a named pipe to read. The pipes found by the walk are ignored: nothing may ever write them.
+func explicitPipe(path string) bool {
+	info, err := os.Stat(longPath(path))
+	return err == nil && info.Mode()&fs.ModeNamedPipe != 0
+}
+
+// fifoReader reads a named pipe given explicitly, a root or a listed path, until its writers close it.
+// The reads give up after -fifo-timeout from the open and on an interrupt, where the platform opens the
+// pipes without blocking the wait for a writer does too.
+type fifoReader struct {
+	*sourceFile
+	timeout     time.Duration // 0 without -fifo-timeout
+	deadline    time.Time
+	interrupted func() bool
+}
+
+func newFIFOReader(file *sourceFile, timeout time.Duration, interrupted func() bool) (*fifoReader, error) {
+	fr := &fifoReader{sourceFile: file, timeout: timeout, interrupted: interrupted}
+	if timeout > 0 {
+		fr.deadline = time.Now().Add(timeout)
+	}
+	return fr, fr.waitWriter()
+}
+
+// waitWriter waits for a writer to open the pipe, a read before would be an EOF
+func (fr *fifoReader) waitWriter() error {
+	rc, err := fr.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	for {
+		if fr.setDeadline() != nil {
+			return nil // not in the poller, the open blocked until a writer came
+		}
+		err := rc.Read(writerConnected)
+		if err == nil || !os.IsTimeout(err) {
+			return err
+		}
+		if err := fr.expired(); err != nil {
+			return err
+		}
+	}
+}
+
+func (fr *fifoReader) Read(p []byte) (int, error) {
+	for {
+		if fr.setDeadline() != nil {
+			return fr.sourceFile.Read(p)
+		}
+		n, err := fr.sourceFile.Read(p)
+		if n > 0 || err == nil || !os.IsTimeout(err) {
+			return n, err
+		}
+		if err := fr.expired(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// setDeadline bounds the next wait by fifoPoll and the -fifo-timeout deadline, failing when the pipe
+// is not in the poller
+func (fr *fifoReader) setDeadline() error {
+	deadline := time.Now().Add(fifoPoll)
+	if !fr.deadline.IsZero() && fr.deadline.Before(deadline) {
+		deadline = fr.deadline
+	}
+	return fr.SetReadDeadline(deadline)
+}
+
+// expired returns the error ending the wait once interrupted or past the -fifo-timeout deadline
+func (fr *fifoReader) expired() error {
+	if fr.interrupted() {
+		return ErrInterrupted
+	}
+	if !fr.deadline.IsZero() && !time.Now().Before(fr.deadline) {
+		return fmt.Errorf("named pipe not closed by its writers within -fifo-timeout %s: %w", fr.timeout, os.ErrDeadlineExceeded)
+	}
+	return nil
+}
+
+// SetFIFOTimeout gives up the named pipes given explicitly after timeout, no limit when 0, must be called before Startup
+func (mc *MassCRC32C) SetFIFOTimeout(timeout time.Duration) {
+	mc.fifoTimeout = timeout
+}
+
+// stopping tells whether the run was interrupted or its context cancelled
+func (mc *MassCRC32C) stopping() bool {
+	return mc.Interrupted.Load() || mc.cancelled()
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openFlags opens the local files without blocking on a named pipe without a writer, fileOpener then
+// waits for one in the poller, and switches the other files back to blocking
+const openFlags = syscall.O_NONBLOCK
+
+// writerConnected tells whether a writer opened the pipe of fd: it wrote or already closed it
+func writerConnected(fd uintptr) bool {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, 0)
+	return err != nil || n > 0
+}
+
+// clearNonblock switches a file opened with openFlags back to blocking, the flag is
+// meaningless on a regular file but passed down to the FUSE and network file systems
+func clearNonblock(file *sourceFile) error {
+	return syscall.SetNonblock(int(file.Fd()), false)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func mkfifo(t *testing.T, path string) {
+	t.Helper()
+	if err := unix.Mkfifo(path, 0600); err != nil {
+		t.Skipf("no named pipes: %v", err)
+	}
+}
+
+// writeFIFO writes data to the named pipe path in a goroutine once it is opened by a reader
+func writeFIFO(t *testing.T, path string, data []byte) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			done <- err
+			return
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		done <- err
+	}()
+	return done
+}
+
+// Test a named pipe given as a root is read to EOF while the one found by the walk is ignored
+func TestFIFORoot(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("streamed through a pipe\n"), 10000)
+	reference := filepath.Join(dir, "reference")
+	if err := os.WriteFile(reference, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pipe := filepath.Join(dir, "pipe")
+	mkfifo(t, pipe)
+	if err := os.Mkdir(filepath.Join(dir, "walked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mkfifo(t, filepath.Join(dir, "walked", "pipe"))
+	// like the /dev/fd/63 of a shell process substitution
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(pipe, link); err != nil {
+		t.Fatal(err)
+	}
+
+	written := writeFIFO(t, pipe, data)
+	out := &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.SetFIFOTimeout(10 * time.Second)
+	}
+	mc := runPipeline(t, 2, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		res = fi.walkRoots([]string{link, filepath.Join(dir, "walked"), reference})
+	})
+	if err := <-written; err != nil || res.Err != nil {
+		t.Fatal(err, res.Err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || mc.Stats().Ignored != 1 {
+		t.Fatalf("got %q, %d ignored, expected the root pipe and the reference computed", lines, mc.Stats().Ignored)
+	}
+	sort.Strings(lines) // the link before the reference
+	crc := func(line string) string { return line[:strings.IndexByte(line, ' ')] }
+	if crc(lines[0]) != crc(lines[1]) || !strings.HasSuffix(lines[0], " "+link) {
+		t.Errorf("got %q, expected the CRC of the data written to the pipe", lines)
+	}
+}
+
+// Test a listed named pipe nobody opens for writing fails after -fifo-timeout or on an interrupt
+func TestFIFONoWriter(t *testing.T) {
+	pipe := filepath.Join(t.TempDir(), "pipe")
+	mkfifo(t, pipe)
+
+	errOut := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.ErrOut = errOut
+		mc.stdin = strings.NewReader(pipe + "\n")
+		mc.SetFIFOTimeout(300 * time.Millisecond)
+	}
+	start := time.Now()
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.ReadFileList()
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+	if !strings.Contains(errOut.String(), "-fifo-timeout 300ms") || !strings.Contains(errOut.String(), "TIMEOUT") || mc.Stats().FileErrors != 1 {
+		t.Errorf("got %q, expected a timeout", errOut.String())
+	}
+
+	// a writer coming and going without writing is an empty pipe
+	errOut.Reset()
+	out := &bytes.Buffer{}
+	written := writeFIFO(t, pipe, nil)
+	runPaths(t, 1, []string{pipe}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.SetFIFOTimeout(10 * time.Second)
+	})
+	if err := <-written; err != nil || !strings.HasSuffix(out.String(), " 0 "+pipe+"\n") || errOut.Len() > 0 {
+		t.Errorf("got %q %q %v, expected an empty record", out.String(), errOut.String(), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	mc = InitMassCRC32C(1, 1)
+	mc.StdOut = io.Discard
+	mc.ErrOut = io.Discard
+	mc.DebugOut = io.Discard
+	mc.DisableSignalHandling = true
+	results := make(chan Result, 1)
+	yield := mc.Results()
+	go func() {
+		yield(func(res Result) bool {
+			results <- res
+			return true
+		})
+		close(results)
+	}()
+	err := mc.Run(ctx, 1, func() error { return mc.Enqueue(pipe) })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, expected the run cancelled", err)
+	}
+	if res, ok := <-results; ok && !errors.Is(res.Err, ErrInterrupted) {
+		t.Errorf("got %+v, expected the open interrupted", res)
+	}
+}
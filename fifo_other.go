@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+// openFlags are none: the open of a named pipe blocks until a writer comes, neither the interrupt
+// nor -fifo-timeout end that wait
+const openFlags = 0
+
+func writerConnected(fd uintptr) bool {
+	return true
+}
+
+func clearNonblock(file *sourceFile) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+// fileIdentity identifies a file whatever the hard link it is reached through:
+// the device and inode on unix, the volume serial number and file index on windows.
+// It is comparable so it keys maps as is, the zero value is an unknown identity.
+type fileIdentity struct {
+	volume uint64
+	index  uint64
+}
+
+func (id fileIdentity) known() bool {
+	return id != fileIdentity{}
+}
+
+// Equal tells whether both identities are known and the same file
+func (id fileIdentity) Equal(other fileIdentity) bool {
+	return id.known() && id == other
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestFileIdentityEqual(t *testing.T) {
+	a := fileIdentity{volume: 1, index: 7}
+	tests := []struct {
+		a, b  fileIdentity
+		equal bool
+	}{
+		{a, a, true},
+		{a, fileIdentity{volume: 2, index: 7}, false},
+		{a, fileIdentity{volume: 1, index: 8}, false},
+		{fileIdentity{}, fileIdentity{}, false},
+	}
+	for _, test := range tests {
+		if got := test.a.Equal(test.b); got != test.equal {
+			t.Errorf("%+v equal %+v: got %t", test.a, test.b, got)
+		}
+	}
+}
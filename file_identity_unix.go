@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileStatOf is the identity and link count of the file at path from its info
+func fileStatOf(path string, info os.FileInfo) fileStat {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}
+	}
+	return fileStat{id: fileIdentity{volume: uint64(st.Dev), index: uint64(st.Ino)}, nlink: uint64(st.Nlink)}
+}
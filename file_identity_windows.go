@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileStatOf is the identity and link count of the file at path, info does not carry them
+// on windows so the file is opened for GetFileInformationByHandle
+func fileStatOf(path string, info os.FileInfo) fileStat {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileStat{}
+	}
+	defer f.Close()
+	var data syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &data); err != nil {
+		return fileStat{}
+	}
+	return fileStat{
+		id: fileIdentity{
+			volume: uint64(data.VolumeSerialNumber),
+			index:  uint64(data.FileIndexHigh)<<32 | uint64(data.FileIndexLow),
+		},
+		nlink: uint64(data.NumberOfLinks),
+	}
+}
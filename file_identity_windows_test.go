@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStatOfHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	c := filepath.Join(dir, "c")
+	for _, path := range []string{a, c} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(a, b); err != nil {
+		t.Skipf("no hard links on this volume: %v", err)
+	}
+	stats := make([]fileStat, 3)
+	for i, path := range []string{a, b, c} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats[i] = fileStatOf(path, info)
+	}
+	if !stats[0].id.Equal(stats[1].id) || stats[0].nlink != 2 || stats[1].nlink != 2 {
+		t.Errorf("hard links a %+v and b %+v must be the same file with 2 links", stats[0], stats[1])
+	}
+	if stats[0].id.Equal(stats[2].id) || stats[2].nlink != 1 || !stats[2].id.known() {
+		t.Errorf("c %+v must be another file with 1 link", stats[2])
+	}
+}
@@ -2,69 +2,517 @@ package main
 
 import (
 	"bufio"
-	"flag"
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
-	"sync/atomic"
+	"strings"
+	"time"
 )
 
+// InputResult tells how a producer ended: completed, interrupted or stopped by an error
+type InputResult struct {
+	Enqueued    uint64 // paths queued
+	Interrupted bool   // stopped by a CTRL+C
+	Err         error  // the error stopping it, a root walk or the list read failing
+}
+
+// add accounts the result of a following producer, the first error is kept
+func (res *InputResult) add(next InputResult) {
+	res.Enqueued += next.Enqueued
+	res.Interrupted = res.Interrupted || next.Interrupted
+	if res.Err == nil {
+		res.Err = next.Err
+	}
+}
+
+// printInputResult tells why the input stopped early, nothing when it completed
+func printInputResult(w io.Writer, res InputResult) {
+	if res.Err != nil {
+		fmt.Fprintf(w, "Input aborted after %d paths queued: %v\n", res.Enqueued, res.Err)
+	} else if res.Interrupted {
+		fmt.Fprintf(w, "Input interrupted after %d paths queued\n", res.Enqueued)
+	}
+}
+
 type FileInput struct {
-	mc *MassCRC32C
+	mc              *MassCRC32C
+	root            string // root being walked, exempt from pruning
+	allowOverlap    bool   // walk the roots nested in another one again
+	maxDepth        int    // -maxdepth, the directories at this depth below their root are not entered, unlimited when 0
+	followLinks     bool   // -L, the symlinks are followed
+	xdev            bool   // -xdev, the directories on another device than their root are not entered
+	rootDevice      uint64 // with -xdev, the device of the root walked
+	rootDeviceKnown bool
+	visited         map[fileIdentity]string // with -L, the first path of the directories walked
+	loops           map[fileIdentity]bool   // with -L, the directories reached again already reported
+	nulSeparated    bool                    // -0, the list entries end with a NUL instead of a newline
+	lists           []string                // -files-from, the list files read in turn instead of stdin, - for stdin
+	guard           listGuard
+
+	dirRetry      int           // retry passes of the directories failing with a transient error
+	dirRetryDelay time.Duration // wait before each retry pass
+	pendingDirs   []string      // directories of the root to retry
+	retryAttempt  int           // retry pass running, 0 during the walk of the root
+	retrying      string        // directory walked again by the retry pass
+
+	walkDir func(root string, fn fs.WalkDirFunc) error // filepath.WalkDir when nil
 }
 
 func (fi *FileInput) walkHandler(path string, dir fs.DirEntry, err error) error {
-	if fi.mc.Interrupted {
+	if fi.mc.Interrupted.Load() {
 		return io.EOF
 	}
+	fi.mc.schedCheckpoint(fi.mc.walkerProbe)
+	if fi.mc.recorder != nil {
+		fi.mc.recorder.entry(path, dir, err)
+	}
 	if err != nil {
-		if dir.IsDir() {
-			fmt.Fprintf(fi.mc.ErrOut, "dir error: '%s': %v\n", path, err)
-			atomic.AddUint64(&fi.mc.directoryErrorCount, 1)
+		if fi.mc.walkPacer != nil && dir != nil && dir.IsDir() {
+			fi.mc.walkPacer.dirError()
+		}
+		if fi.deferDir(path, dir, err) {
+			return nil
+		}
+		if dir != nil && dir.IsDir() {
+			fi.mc.printErr(errScopeDir, "walker", path, err)
+			fi.mc.directoryErrorCount.Add(1)
+			if fi.mc.dirEvents != nil {
+				fi.mc.dirEvents.failDir(path)
+			}
+			if fi.mc.deniedDirs != nil && classify(err) == classPermission {
+				fi.mc.deniedDirs.denied(path)
+			}
 		} else {
-			fmt.Fprintf(fi.mc.ErrOut, "file error: '%s': %v\n", path, err)
-			atomic.AddUint64(&fi.mc.fileErrorCount, 1)
+			fi.mc.printErr(errScopeFile, "walker", path, err)
+			fi.mc.fileErrorCount.Add(1)
+		}
+		return nil
+	}
+	if fi.mc.skipOwned(path) {
+		if dir.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if path != fi.root && fi.mc.excluded(path, fi.root) {
+		if dir.IsDir() {
+			fmt.Fprintf(fi.mc.DebugOut, "excluding dir: %s\n", path)
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if fi.mc.skipHidden && path != fi.root && hiddenName(dir.Name()) {
+		if dir.IsDir() {
+			fmt.Fprintf(fi.mc.DebugOut, "skipping hidden dir: %s\n", path)
+			return filepath.SkipDir
 		}
+		fmt.Fprintf(fi.mc.DebugOut, "ignoring hidden: %s\n", path)
+		fi.mc.ignoredFilesCount.Add(1)
 		return nil
 	}
 	if dir.IsDir() {
+		if fi.maxDepth > 0 && path != fi.root && fi.depth(path) >= fi.maxDepth {
+			fmt.Fprintf(fi.mc.DebugOut, "not entering dir at -maxdepth: %s\n", path)
+			return filepath.SkipDir
+		}
+		if fi.xdev && fi.crossesDevice(path, dir) {
+			return filepath.SkipDir
+		}
+		if fi.followLinks && path != fi.retrying && !fi.visitDir(path, dir) {
+			return filepath.SkipDir
+		}
+		if name := fi.mc.snapshotDirs.match(path); name != "" && path != fi.root {
+			if fi.mc.snapshotDirs.skip {
+				fmt.Fprintf(fi.mc.DebugOut, "skipping snapshot dir: %s\n", path)
+				fi.mc.snapshotDirs.pruned.Add(1)
+				return filepath.SkipDir
+			}
+			if !fi.mc.snapshotDirs.warned[name] {
+				fi.mc.snapshotDirs.warned[name] = true
+				fmt.Fprintf(fi.mc.DebugOut, "warning: walking %s snapshot dir %s, files may be read once per snapshot, see -skip-snapshot-dirs\n", name, path)
+			}
+		}
+		if fi.mc.deniedDirs != nil && fi.mc.deniedDirs.prune(path) {
+			return filepath.SkipDir
+		}
+		if fi.mc.walkPacer != nil && !fi.mc.walkPacer.wait(func() bool { return fi.mc.Interrupted.Load() }) {
+			return io.EOF
+		}
 		fmt.Fprintf(fi.mc.DebugOut, "entering dir: %s\n", path)
+		if fi.mc.dirEvents != nil {
+			fi.mc.dirEvents.enterDir(path)
+		}
 		return nil
 	}
 	if !dir.Type().IsRegular() {
+		if path == fi.root && explicitPipe(path) {
+			return fi.enqueueFile(path, dir.Info)
+		}
+		if fi.followLinks && dir.Type()&fs.ModeSymlink != 0 {
+			return fi.followLink(path)
+		}
+		if fi.mc.strictTypes.check(dir.Type()) {
+			fi.mc.printErr(errScopeFile, "walker", path, fmt.Errorf("%w: %s", errUnexpectedType, fileTypeName(dir.Type())))
+			fi.mc.fileErrorCount.Add(1)
+			return nil
+		}
 		fmt.Fprintf(fi.mc.DebugOut, "ignoring: %s\n", path)
-		atomic.AddUint64(&fi.mc.ignoredFilesCount, 1)
+		fi.mc.ignoredFilesCount.Add(1)
+		return nil
+	}
+	return fi.enqueueFile(path, dir.Info)
+}
+
+// enqueueFile queues the walked regular file path unless not included, info is only called for the
+// consumers of the walk info
+func (fi *FileInput) enqueueFile(path string, info func() (fs.FileInfo, error)) error {
+	if path != fi.root && !fi.mc.included(path, fi.root) {
+		fmt.Fprintf(fi.mc.DebugOut, "ignoring, not included: %s\n", path)
+		fi.mc.ignoredFilesCount.Add(1)
 		return nil
 	}
-	fi.mc.PathQueueG <- path // add a path message to the queue (blocking when queue is full)
+	item := QueueItem{Path: path}
+	if fi.mc.filtersInfo() {
+		// the info listed by the walk, lstat'ed where the platform does not list it, a failing one is left to the read
+		if info, err := info(); err == nil {
+			if fi.mc.infoFiltered(path, info) {
+				return nil
+			}
+			item.Info = info
+		}
+	}
+	if fi.mc.walkPacer != nil {
+		fi.mc.walkPacer.listed()
+	}
+	if fi.mc.dirEvents != nil {
+		fi.mc.dirEvents.addFile(path)
+	}
+	if fi.mc.wantsWalkInfo() && item.Info == nil {
+		// an lstat where the platform does not list the info with the entries, once for every consumer
+		if info, err := info(); err == nil {
+			item.Info = info
+		}
+	}
+	if fi.mc.EnqueueItem(item) != nil {
+		return io.EOF
+	}
 	return nil
 }
 
-func (fi *FileInput) WalkDirectories() {
-	for _, arg := range flag.Args() {
-		err := filepath.WalkDir(arg, fi.walkHandler)
+// depth is the count of the components of path below the walked root, 1 for its entries
+func (fi *FileInput) depth(path string) int {
+	rel, err := filepath.Rel(fi.root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// rootKey is the absolute path of root with its symlinks resolved, only cleaned when it cannot be resolved
+func rootKey(root string) string {
+	key, err := filepath.Abs(root)
+	if err != nil {
+		return filepath.Clean(root)
+	}
+	if resolved, err := filepath.EvalSymlinks(key); err == nil {
+		key = resolved
+	}
+	return key
+}
+
+// overlappingRoot returns the root the i-th one is the same as or nested in, -1 when none:
+// the outermost root is kept whatever the order, the first one among identical ones
+func overlappingRoot(keys []string, i int) int {
+	for j, key := range keys {
+		if j == i {
+			continue
+		}
+		if keys[i] == key {
+			if j < i {
+				return j
+			}
+		} else if isUnder(keys[i], key) {
+			return j
+		}
+	}
+	return -1
+}
+
+// dedupRoots drops the roots walked already as part of another one, unless allowOverlap
+func dedupRoots(roots []string, allowOverlap bool, debugOut io.Writer) []string {
+	keys := make([]string, len(roots))
+	for i, root := range roots {
+		keys[i] = rootKey(root)
+	}
+	var kept []string
+	for i, root := range roots {
+		j := overlappingRoot(keys, i)
+		switch {
+		case j < 0:
+			kept = append(kept, root)
+		case allowOverlap:
+			fmt.Fprintf(debugOut, "warning: root %s overlaps root %s, its files are processed twice\n", root, roots[j])
+			kept = append(kept, root)
+		default:
+			fmt.Fprintf(debugOut, "warning: root %s overlaps root %s, skipped, see -allow-overlap\n", root, roots[j])
+		}
+	}
+	return kept
+}
+
+// prunesWalk tells whether the walk of a root may not enter a directory below it, a nested root then may
+// not be walked as part of the outer one
+func (fi *FileInput) prunesWalk() bool {
+	return fi.maxDepth > 0 || fi.xdev || fi.mc.skipHidden || len(fi.mc.excludes) > 0 || len(fi.mc.excludeRes) > 0 ||
+		fi.mc.snapshotDirs.skip
+}
+
+// WalkDirectories walks the roots in turn, the glob patterns expanded. The nested roots are walked
+// on their own too when the walk prunes directories.
+func (fi *FileInput) WalkDirectories(roots []string) InputResult {
+	return fi.walkRoots(dedupRoots(fi.expandRoots(roots), fi.allowOverlap || fi.prunesWalk(), fi.mc.DebugOut))
+}
+
+// Run feeds the queue with the -files-from lists, or the stdin list when readList or without roots, then walks
+// the roots. The lists are read to their end first, a path both listed and walked is processed twice.
+func (fi *FileInput) Run(roots []string, readList bool) InputResult {
+	var res InputResult
+	if len(fi.lists) > 0 {
+		res = fi.readListFiles(fi.lists)
+	} else if readList || len(roots) == 0 {
+		res = fi.ReadFileList()
+	}
+	if len(roots) > 0 {
+		if fi.mc.Interrupted.Load() {
+			res.Interrupted = true
+		} else {
+			res.add(fi.WalkDirectories(roots))
+		}
+	}
+	return res
+}
+
+// walkRoots walks the roots in turn, stopping at the first interrupted or failing one
+func (fi *FileInput) walkRoots(roots []string) InputResult {
+	start := fi.mc.enqueueSeq.Load()
+	var res InputResult
+	for _, arg := range roots {
+		fi.root = arg
+		if fi.xdev {
+			fi.setRootDevice(arg)
+		}
+		if fi.mc.recorder != nil {
+			fi.mc.recorder.root(arg)
+		}
+		err := fi.walkPath(arg)
+		if err == nil && fi.dirRetry > 0 {
+			err = fi.retryDirs()
+		}
+		if fi.mc.recorder != nil {
+			fi.mc.recorder.endWalk()
+		}
+		if fi.mc.dirEvents != nil {
+			fi.mc.dirEvents.endWalk(err == nil)
+		}
+		fi.mc.rootsWalked.Add(1)
 		if err == io.EOF {
 			fmt.Fprintln(fi.mc.DebugOut, "directory walk interrupted")
+			res.Interrupted = true
 			break
 		} else if err != nil {
-			fmt.Fprintf(fi.mc.ErrOut, "error while walking: %v\n", err)
+			fi.mc.printErr(errScopeWalk, "walker", arg, err)
+			res.Err = fmt.Errorf("walking %s: %w", arg, err)
 			break
 		}
 	}
+	res.Enqueued = fi.mc.enqueueSeq.Load() - start
+	return res
+}
+
+// walkPath walks the tree of arg, reporting the paths under it as given
+func (fi *FileInput) walkPath(arg string) error {
+	walked := walkRoot(arg)
+	handler := fi.walkHandler
+	if walked != arg {
+		handler = func(path string, dir fs.DirEntry, err error) error {
+			if rel := strings.TrimPrefix(path, walked); rel != "" {
+				path = filepath.Join(arg, rel)
+			} else {
+				path = arg
+			}
+			return fi.walkHandler(path, dir, err)
+		}
+	}
+	walkDir := fi.walkDir
+	if walkDir == nil {
+		walkDir = filepath.WalkDir
+	}
+	return walkDir(walked, handler)
+}
+
+// deferDir schedules for the retry pass a directory failing with what may be a mount in progress:
+// not found or an I/O error while its parent exists. The errors of the last pass are reported.
+func (fi *FileInput) deferDir(path string, dir fs.DirEntry, err error) bool {
+	if fi.retryAttempt >= fi.dirRetry {
+		return false
+	}
+	if (dir == nil || !dir.IsDir()) && path != fi.root && path != fi.retrying {
+		return false
+	}
+	if class := classify(err); class != classNotFound && class != classIO {
+		return false
+	}
+	if _, statErr := os.Stat(longPath(filepath.Dir(path))); statErr != nil {
+		return false
+	}
+	fi.pendingDirs = append(fi.pendingDirs, path)
+	if fi.mc.dirEvents != nil {
+		fi.mc.dirEvents.dropDir(path)
+	}
+	return true
+}
+
+// retryDirs walks the directories deferred during the walk of the root again, up to dirRetry passes
+func (fi *FileInput) retryDirs() error {
+	defer func() {
+		fi.pendingDirs = nil
+		fi.retryAttempt = 0
+		fi.retrying = ""
+	}()
+	for fi.retryAttempt = 1; fi.retryAttempt <= fi.dirRetry && len(fi.pendingDirs) > 0; fi.retryAttempt++ {
+		pending := fi.pendingDirs
+		fi.pendingDirs = nil
+		time.Sleep(fi.dirRetryDelay)
+		for _, path := range pending {
+			deferred := len(fi.pendingDirs)
+			fi.retrying = path
+			if err := fi.walkPath(path); err != nil {
+				return err
+			}
+			// a directory failing again is deferred before anything under it
+			if len(fi.pendingDirs) == deferred || fi.pendingDirs[deferred] != path {
+				fmt.Fprintf(fi.mc.DebugOut, "dir %s listed on retry %d\n", path, fi.retryAttempt)
+			}
+		}
+	}
+	return nil
+}
+
+// splitOrdinal splits the optional leading ordinal of a list line: digits followed by a tab,
+// a path starting with digits without a tab is left untouched
+func splitOrdinal(line string) (string, string) {
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i > 0 && i < len(line) && line[i] == '\t' {
+		return line[:i], line[i+1:]
+	}
+	return "", line
 }
 
-func (fi *FileInput) ReadFileList() {
-	lineScanner := bufio.NewScanner(fi.mc.stdin)
+// ordinalLess compares ordinals numerically whatever their length and leading zeros
+func ordinalLess(a string, b string) bool {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// scanNULs is the bufio.SplitFunc of the NUL terminated entries of find -print0 and xargs -0,
+// the last one may miss its NUL
+func scanNULs(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (fi *FileInput) ReadFileList() InputResult {
+	return fi.readList(fi.mc.stdin)
+}
+
+// readList feeds the queue with the entries of the list r, stdin or a -files-from file
+func (fi *FileInput) readList(r io.Reader) InputResult {
+	if fi.mc.jsonInput {
+		return fi.readJSONList(r)
+	}
+	start := fi.mc.enqueueSeq.Load()
+	var res InputResult
+	split := bufio.ScanLines
+	if fi.nulSeparated {
+		split = scanNULs
+	}
+	lineScanner, bounded := fi.guard.scanner(r, split)
+	lastOrdinal := ""
+	warnedOrder := false
+	lineNumber := 0
 	for lineScanner.Scan() {
-		if fi.mc.Interrupted {
-			fmt.Fprintln(fi.mc.DebugOut, "directory walk interrupted")
-			break
+		lineNumber++
+		if fi.nulSeparated && len(lineScanner.Bytes()) == 0 {
+			continue
+		}
+		fi.mc.schedCheckpoint(fi.mc.walkerProbe)
+		if fi.mc.recorder != nil {
+			fi.mc.recorder.listLine(lineScanner.Text())
+		}
+		err := fi.guard.check(lineScanner.Text())
+		if bounded.skipped > 0 {
+			err = fi.guard.tooLong(len(lineScanner.Text()) + bounded.skipped)
+		}
+		if err != nil {
+			if err := fi.rejectEntry(lineNumber, lineScanner.Text(), err); err != nil {
+				res.Err = err
+				break
+			}
+			continue
 		}
-		fi.mc.PathQueueG <- lineScanner.Text()
-		if err := lineScanner.Err(); err != nil {
-			fmt.Fprintf(fi.mc.ErrOut, "error while reading stdin: %v\n", err)
+		ordinal, path := splitOrdinal(lineScanner.Text())
+		path, hintsText := splitHints(path)
+		hints, errs := parseHints(hintsText)
+		for _, err := range errs {
+			fmt.Fprintf(fi.mc.DebugOut, "warning: list line %d: %v, ignored\n", lineNumber, err)
+		}
+		if fi.mc.skipOwned(path) || fi.mc.excluded(path, "") {
+			continue
+		}
+		if fi.mc.skipHidden && hiddenPath(path) {
+			fmt.Fprintf(fi.mc.DebugOut, "ignoring hidden: %s\n", path)
+			fi.mc.ignoredFilesCount.Add(1)
+			continue
+		}
+		if !fi.mc.included(path, "") {
+			fmt.Fprintf(fi.mc.DebugOut, "ignoring, not included: %s\n", path)
+			fi.mc.ignoredFilesCount.Add(1)
+			continue
+		}
+		if ordinal != "" {
+			// -ordered writes in list order, which is the ordinal order only when the list is sorted
+			if lastOrdinal != "" && !ordinalLess(lastOrdinal, ordinal) && !warnedOrder {
+				fmt.Fprintf(fi.mc.DebugOut, "warning: ordinal %s after %s, the list is not in ordinal order\n", ordinal, lastOrdinal)
+				warnedOrder = true
+			}
+			lastOrdinal = ordinal
+		}
+		if fi.mc.EnqueueItem(QueueItem{Path: path, Ordinal: ordinal, Hints: hints}) != nil {
+			fmt.Fprintln(fi.mc.DebugOut, "directory walk interrupted")
+			res.Interrupted = true
 			break
 		}
 	}
+	if err := lineScanner.Err(); err != nil {
+		fi.mc.printErr(errScopeList, "reader", "", err)
+		res.Err = fmt.Errorf("reading the list: %w", err)
+	}
+	fi.mc.listsRead.Add(1)
+	res.Enqueued = fi.mc.enqueueSeq.Load() - start
+	return res
 }
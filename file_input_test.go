@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // Test stdin line reader
@@ -22,7 +33,7 @@ type testReader struct {
 func (tb *testReader) Read(p []byte) (n int, err error) {
 	msg := <-tb.scanLnChIn
 	if msg.err != nil {
-		return 0, err
+		return 0, msg.err
 	}
 	n = copy(p, msg.path)
 	return
@@ -49,13 +60,13 @@ func testBufferSetup(items []scanLnMsg) *testReader {
 	return &tb
 }
 
-func (tb *testReader) testHandler(path string) (err error) {
+func (tb *testReader) testHandler(item QueueItem) (err error) {
 	msg := <-tb.scanLnChOut
 	if msg.err != nil {
 		return err
 	}
-	if msg.path != path {
-		err = fmt.Errorf("got %s, expected %s", path, msg.path)
+	if msg.path != item.Path {
+		err = fmt.Errorf("got %s, expected %s", item.Path, msg.path)
 		tb.scanLnChErr <- err
 	}
 	return err
@@ -73,8 +84,11 @@ func TestReadFileList(t *testing.T) {
 	mc.stdin = tb
 	fi := FileInput{mc: mc}
 	mc.Startup(1)
-	fi.ReadFileList()
+	res := fi.ReadFileList()
 	mc.TearDown()
+	if res != (InputResult{Enqueued: 4}) {
+		t.Errorf("got %+v, expected 4 paths enqueued", res)
+	}
 	if len(tb.scanLnChIn) > 0 {
 		t.Errorf("input queue isn't empty: %d remaining", len(tb.scanLnChIn))
 	}
@@ -85,3 +99,508 @@ func TestReadFileList(t *testing.T) {
 		t.Errorf("%v\n", <-tb.scanLnChErr)
 	}
 }
+
+// Test -0 reads the NUL terminated entries of find -print0, with newlines in the paths once allowed, skipping
+// the empty entries, and stops once interrupted
+func TestReadFileListNUL(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.HandlerFunc = func(item QueueItem) error {
+			mu.Lock()
+			paths = append(paths, item.Path)
+			mu.Unlock()
+			return nil
+		}
+		mc.stdin = strings.NewReader("path1\x00\x00with\nnewline\x00path 3\n\x00\x00last without NUL")
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, nulSeparated: true, guard: listGuard{allowNewlines: true}}
+		res = fi.ReadFileList()
+	})
+	expected := []string{"path1", "with\nnewline", "path 3\n", "last without NUL"}
+	if res != (InputResult{Enqueued: 4}) || fmt.Sprintf("%q", paths) != fmt.Sprintf("%q", expected) {
+		t.Errorf("got %+v %q, expected %q", res, paths, expected)
+	}
+
+	setup = func(mc *MassCRC32C) {
+		mc.HandlerFunc = func(item QueueItem) error { return nil }
+		mc.stdin = strings.NewReader("path1\x00path2\x00")
+		mc.Interrupted.Store(true)
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, nulSeparated: true}
+		res = fi.ReadFileList()
+	})
+	if res != (InputResult{Interrupted: true}) {
+		t.Errorf("got %+v, expected an interrupted list", res)
+	}
+}
+
+func TestSplitOrdinal(t *testing.T) {
+	tests := []struct {
+		line    string
+		ordinal string
+		path    string
+	}{
+		{"000123\t/path", "000123", "/path"},
+		{"7\trelative path", "7", "relative path"},
+		{"/path", "", "/path"},
+		{"2023-report.txt", "", "2023-report.txt"},
+		{"2023", "", "2023"},
+		{"12 \tpath", "", "12 \tpath"},
+		{"\tpath", "", "\tpath"},
+		{"12\t", "12", ""},
+	}
+	for _, test := range tests {
+		ordinal, path := splitOrdinal(test.line)
+		if ordinal != test.ordinal || path != test.path {
+			t.Errorf("%q: got (%q, %q), expected (%q, %q)", test.line, ordinal, path, test.ordinal, test.path)
+		}
+	}
+	if !ordinalLess("99", "000100") || ordinalLess("0100", "99") || ordinalLess("5", "05") {
+		t.Errorf("ordinals must compare numerically")
+	}
+}
+
+// Test -ordered writes the records in list order with their ordinal despite parallel reads
+func TestOrderedOutput(t *testing.T) {
+	dir := t.TempDir()
+	list := &strings.Builder{}
+	expected := &strings.Builder{}
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%03d", i))
+		payload := strings.Repeat("x", (i*37)%3000)
+		if err := os.WriteFile(path, []byte(payload), 0644); err != nil {
+			t.Fatal(err)
+		}
+		crc := crcOf([]byte(payload))
+		if i%2 == 0 {
+			fmt.Fprintf(list, "%06d\t%s\n", i+1000, path)
+			fmt.Fprintf(expected, "%06d\t%s %d %s\n", i+1000, crc, len(payload), path)
+		} else {
+			fmt.Fprintf(list, "%s\n", path)
+			fmt.Fprintf(expected, "%s %d %s\n", crc, len(payload), path)
+		}
+	}
+	out := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.stdin = strings.NewReader(list.String())
+		mc.StdOut = out
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+	}
+	runPipeline(t, 8, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.ReadFileList()
+	})
+	if out.String() != expected.String() {
+		t.Errorf("ordered output mismatch, got:\n%s", out.String())
+	}
+}
+
+// Test -ordered writes an unsorted list in list order with a warning, the ordinals are not sorted
+func TestOrderedUnsortedOrdinals(t *testing.T) {
+	list := "1\ttest_data.txt\n3\ttest_data.txt\n2\ttest_data.txt\n4\ttest_data.txt\n"
+	out, debugOut := &bytes.Buffer{}, &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.stdin = strings.NewReader(list)
+		mc.StdOut = out
+		mc.DebugOut = debugOut
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+	}
+	runPipeline(t, 2, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		res = fi.ReadFileList()
+	})
+	if res != (InputResult{Enqueued: 4}) || !strings.Contains(debugOut.String(), "warning: ordinal 2 after 3") {
+		t.Errorf("got %+v %q, expected the unsorted list read with a warning", res, debugOut.String())
+	}
+	expected := "1\tWaIfQg== 3538 test_data.txt\n3\tWaIfQg== 3538 test_data.txt\n2\tWaIfQg== 3538 test_data.txt\n4\tWaIfQg== 3538 test_data.txt\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected the list order", out.String())
+	}
+}
+
+// Test a slow file pauses the input once the -ordered window is full, instead of holding the rest of the run
+func TestOrderedWindow(t *testing.T) {
+	out := &bytes.Buffer{}
+	release := make(chan struct{})
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableOrderedOutput(3)
+		mc.HandlerFunc = func(item QueueItem) error {
+			if item.seq == 0 {
+				<-release
+			}
+			return mc.fileHandler(item)
+		}
+	}
+	paths := make([]string, 20)
+	for i := range paths {
+		paths[i] = "test_data.txt"
+	}
+	runPipeline(t, 4, setup, func(mc *MassCRC32C) {
+		done := make(chan error)
+		go func() {
+			done <- mc.EnqueueBatch(paths)
+		}()
+		time.Sleep(200 * time.Millisecond)
+		if queued := mc.enqueueSeq.Load(); queued != 3 {
+			t.Errorf("got %d paths queued, expected the input paused at the window", queued)
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+	if records := strings.Count(out.String(), "\n"); records != 20 {
+		t.Errorf("got %d records", records)
+	}
+}
+
+func TestDedupRoots(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	projects := filepath.Join(data, "projects")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{projects, other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link")
+	hasSymlinks := os.Symlink(data, link) == nil
+
+	tests := []struct {
+		roots    []string
+		expected []string
+		symlink  bool
+	}{
+		{[]string{data, other}, []string{data, other}, false},
+		{[]string{data, projects}, []string{data}, false},
+		{[]string{projects, data}, []string{data}, false},
+		{[]string{data, data + string(filepath.Separator)}, []string{data}, false},
+		{[]string{projects, filepath.Join(projects, "..", "projects"), other}, []string{projects, other}, false},
+		{[]string{filepath.Join(data, "..", "data"), projects}, []string{filepath.Join(data, "..", "data")}, false},
+		{[]string{data, filepath.Join(link, "projects")}, []string{data}, true},
+		{[]string{link, data}, []string{link}, true},
+	}
+	for _, test := range tests {
+		if test.symlink && !hasSymlinks {
+			continue
+		}
+		debugOut := &bytes.Buffer{}
+		kept := dedupRoots(test.roots, false, debugOut)
+		if fmt.Sprint(kept) != fmt.Sprint(test.expected) {
+			t.Errorf("%v: kept %v, expected %v", test.roots, kept, test.expected)
+		}
+		if strings.Count(debugOut.String(), "skipped, see -allow-overlap") != len(test.roots)-len(test.expected) {
+			t.Errorf("%v: expected a warning per skipped root, got %q", test.roots, debugOut)
+		}
+
+		debugOut.Reset()
+		kept = dedupRoots(test.roots, true, debugOut)
+		if fmt.Sprint(kept) != fmt.Sprint(test.roots) {
+			t.Errorf("%v: -allow-overlap kept %v", test.roots, kept)
+		}
+		if strings.Count(debugOut.String(), "processed twice") != len(test.roots)-len(test.expected) {
+			t.Errorf("%v: expected a warning per overlap, got %q", test.roots, debugOut)
+		}
+	}
+}
+
+// Test a nested root is walked on its own when -maxdepth keeps the walk of the outer one from reaching it
+func TestNestedRootPruned(t *testing.T) {
+	data := t.TempDir()
+	nested := filepath.Join(data, "projects", "deep")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(data, "f"), filepath.Join(nested, "g")} {
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	var res InputResult
+	runPipeline(t, 1, func(mc *MassCRC32C) { mc.StdOut = out }, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, maxDepth: 1}
+		res = fi.WalkDirectories([]string{data, nested})
+	})
+	if res.Enqueued != 2 || !strings.Contains(out.String(), filepath.Join(nested, "g")) {
+		t.Errorf("got %+v %q, expected the nested root walked", res, out.String())
+	}
+}
+
+// failingWalkDir fails the listing of dir failures times, like an automounted directory not mounted yet
+func failingWalkDir(dir string, failures int) func(root string, fn fs.WalkDirFunc) error {
+	return func(root string, fn fs.WalkDirFunc) error {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if path != dir || failures == 0 || err != nil {
+				return fn(path, d, err)
+			}
+			failures--
+			if err := fn(path, d, nil); err != nil {
+				return err
+			}
+			if err := fn(path, d, &fs.PathError{Op: "open", Path: path, Err: syscall.ENOENT}); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		})
+	}
+}
+
+func TestDirRetry(t *testing.T) {
+	root := t.TempDir()
+	auto := filepath.Join(root, "auto")
+	for _, path := range []string{filepath.Join(auto, "a"), filepath.Join(auto, "sub", "b"), filepath.Join(root, "c")} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name      string
+		failures  int
+		records   int
+		dirErrors uint64
+		note      string
+	}{
+		{"listed on first retry", 1, 3, 0, "dir " + auto + " listed on retry 1\n"},
+		{"listed on last retry", 2, 3, 0, "dir " + auto + " listed on retry 2\n"},
+		{"persistent failure", 3, 1, 1, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			errOut := &bytes.Buffer{}
+			debugOut := &bytes.Buffer{}
+			events := &bytes.Buffer{}
+			setup := func(mc *MassCRC32C) {
+				mc.StdOut = out
+				mc.ErrOut = errOut
+				mc.DebugOut = debugOut
+				mc.EnableDirEvents(events, false)
+			}
+			mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+				fi := FileInput{mc: mc, dirRetry: 2, walkDir: failingWalkDir(auto, test.failures)}
+				fi.walkRoots([]string{root})
+			})
+
+			if lines := strings.Count(out.String(), "\n"); lines != test.records {
+				t.Errorf("got %d records, expected %d: %q", lines, test.records, out.String())
+			}
+			if got := mc.Stats().DirErrors; got != test.dirErrors || strings.Count(errOut.String(), "\n") != int(test.dirErrors) {
+				t.Errorf("got %d dir errors %q, expected %d", got, errOut.String(), test.dirErrors)
+			}
+			if test.note != "" && !strings.Contains(debugOut.String(), test.note) {
+				t.Errorf("note %q missing from %q", test.note, debugOut.String())
+			}
+			if strings.Count(events.String(), "DONE "+auto+" ") > 1 {
+				t.Errorf("got several DONE events for the retried dir: %q", events.String())
+			}
+		})
+	}
+}
+
+func TestRunListAndRoots(t *testing.T) {
+	root := t.TempDir()
+	extra := t.TempDir()
+	for _, path := range []string{filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(extra, "c")} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		list     string
+		roots    []string
+		readList bool
+		records  int
+	}{
+		{"list only", filepath.Join(extra, "c") + "\n", nil, false, 1},
+		{"roots only", "", []string{root}, false, 2},
+		{"roots ignore stdin without -stdin", filepath.Join(extra, "c") + "\n", []string{root}, false, 2},
+		{"list and roots", filepath.Join(extra, "c") + "\n", []string{root}, true, 3},
+		{"overlapping list and roots", filepath.Join(root, "a") + "\n", []string{root}, true, 3},
+		{"empty list and roots", "", []string{root}, true, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			var res InputResult
+			setup := func(mc *MassCRC32C) {
+				mc.StdOut = out
+				mc.stdin = strings.NewReader(test.list)
+			}
+			mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+				fi := FileInput{mc: mc}
+				res = fi.Run(test.roots, test.readList)
+			})
+
+			if res != (InputResult{Enqueued: uint64(test.records)}) {
+				t.Errorf("got %+v, expected %d paths enqueued", res, test.records)
+			}
+
+			if lines := strings.Count(out.String(), "\n"); lines != test.records {
+				t.Errorf("got %d records, expected %d: %q", lines, test.records, out.String())
+			}
+			if got := mc.Stats().Files; got != uint64(test.records) {
+				t.Errorf("got %d files computed, expected %d", got, test.records)
+			}
+		})
+	}
+}
+
+func TestInputResult(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walkFailure := errors.New("walk failure")
+	listFailure := errors.New("list failure")
+	tests := []struct {
+		name        string
+		list        io.Reader
+		roots       []string
+		walkDir     func(root string, fn fs.WalkDirFunc) error
+		interrupted bool
+		res         InputResult
+		err         error
+		summary     string
+	}{
+		{"list completed", strings.NewReader(root + "/a\n" + root + "/b\n"), nil, nil, false, InputResult{Enqueued: 2}, nil, ""},
+		{"walk completed", nil, []string{root}, nil, false, InputResult{Enqueued: 2}, nil, ""},
+		{"list interrupted", strings.NewReader(root + "/a\n"), nil, nil, true, InputResult{Interrupted: true}, nil, "Input interrupted after 0 paths queued\n"},
+		{"walk interrupted", nil, []string{root}, nil, true, InputResult{Interrupted: true}, nil, "Input interrupted after 0 paths queued\n"},
+		{
+			"list aborted", io.MultiReader(strings.NewReader(root+"/a\n"), iotest.ErrReader(listFailure)), nil, nil, false,
+			InputResult{Enqueued: 1}, listFailure, "Input aborted after 1 paths queued: reading the list: list failure\n",
+		},
+		{
+			"walk aborted", nil, []string{root, root + "/other"},
+			func(root string, fn fs.WalkDirFunc) error {
+				if filepath.Base(root) == "other" {
+					return walkFailure
+				}
+				return filepath.WalkDir(root, fn)
+			},
+			false, InputResult{Enqueued: 2}, walkFailure, "Input aborted after 2 paths queued: walking " + root + "/other: walk failure\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var res InputResult
+			setup := func(mc *MassCRC32C) {
+				mc.stdin = test.list
+				mc.Interrupted.Store(test.interrupted)
+			}
+			runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+				fi := FileInput{mc: mc, allowOverlap: true, walkDir: test.walkDir}
+				res = fi.Run(test.roots, test.list != nil)
+			})
+
+			if !errors.Is(res.Err, test.err) || res.Enqueued != test.res.Enqueued || res.Interrupted != test.res.Interrupted {
+				t.Errorf("got %+v, expected %+v with error %v", res, test.res, test.err)
+			}
+			summary := &bytes.Buffer{}
+			printInputResult(summary, res)
+			if summary.String() != test.summary {
+				t.Errorf("got summary %q, expected %q", summary, test.summary)
+			}
+		})
+	}
+}
+
+// Test the walk captures the file info only for the consumers of cachedInfo, and the records use it
+func TestWalkInfo(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, withStat := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		var withInfo atomic.Uint64
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			if withStat {
+				mc.EnableStatFields(statFields{nlink: true})
+			}
+			mc.HandlerFunc = func(item QueueItem) error {
+				if item.Info != nil && item.Info.Size() == 1 {
+					withInfo.Add(1)
+				}
+				return mc.fileHandler(item)
+			}
+		}
+		mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc}
+			fi.Run([]string{root}, false)
+		})
+
+		expected := uint64(0)
+		if withStat {
+			expected = 2
+		}
+		if withInfo.Load() != expected {
+			t.Errorf("stat fields %t: got %d items with info, expected %d", withStat, withInfo.Load(), expected)
+		}
+		if withStat && (strings.Count(out.String(), "\tnlink=") != 2 || mc.Stats().Files != 2) {
+			t.Errorf("got %q", out.String())
+		}
+	}
+}
+
+// Test -maxdepth counts the levels below each root, computing the files at the limit without entering
+// the directories there
+func TestMaxDepth(t *testing.T) {
+	base := t.TempDir()
+	shallow := filepath.Join(base, "shallow")
+	deep := filepath.Join(base, "deep", "er", "root")
+	for _, root := range []string{shallow, deep} {
+		for _, name := range []string{"f1", "d1/f2", "d1/d2/f3", "d1/d2/d3/f4"} {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for maxDepth, expected := range map[int]string{
+		0: "d1/d2/d3/f4 d1/d2/f3 d1/f2 f1",
+		1: "f1",
+		2: "d1/f2 f1",
+		3: "d1/d2/f3 d1/f2 f1",
+	} {
+		out := &bytes.Buffer{}
+		runPipeline(t, 1, func(mc *MassCRC32C) { mc.StdOut = out }, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc, maxDepth: maxDepth}
+			fi.walkRoots([]string{shallow, deep})
+		})
+		got := map[string][]string{}
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			path := line[strings.LastIndexByte(line, ' ')+1:]
+			for _, root := range []string{shallow, deep} {
+				if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+					got[root] = append(got[root], filepath.ToSlash(rel))
+				}
+			}
+		}
+		for _, root := range []string{shallow, deep} {
+			if strings.Join(got[root], " ") != expected {
+				t.Errorf("-maxdepth %d, %s: got %q, expected %q", maxDepth, root, got[root], expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// checkListFiles fails on the first -files-from list missing, before any worker starts
+func checkListFiles(names []string) error {
+	for _, name := range names {
+		if name == "-" {
+			continue
+		}
+		if _, err := os.Stat(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openListFile opens the -files-from list name, stdin for -, decompressing it on the fly when named *.gz
+func openListFile(name string, stdin io.Reader) (io.Reader, func() error, error) {
+	if name == "-" {
+		return stdin, func() error { return nil }, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, f.Close, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return gz, func() error {
+		gz.Close()
+		return f.Close()
+	}, nil
+}
+
+// readListFiles reads the lists in turn, stopping at the first interrupted or failing one
+func (fi *FileInput) readListFiles(names []string) InputResult {
+	var res InputResult
+	for _, name := range names {
+		if fi.mc.Interrupted.Load() {
+			res.Interrupted = true
+			break
+		}
+		r, closeFunc, err := openListFile(name, fi.mc.stdin)
+		if err != nil {
+			fi.mc.printErr(errScopeList, "reader", "", err)
+			res.Err = fmt.Errorf("opening the list: %w", err)
+			break
+		}
+		fmt.Fprintf(fi.mc.DebugOut, "reading the list %s\n", name)
+		res.add(fi.readList(r))
+		closeFunc()
+		if res.Interrupted || res.Err != nil {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the -files-from lists, plain, gzipped and stdin, are read in turn before the roots are walked
+func TestFilesFrom(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	plain := filepath.Join(t.TempDir(), "list")
+	if err := os.WriteFile(plain, []byte(paths[0]+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(paths[1] + "\n" + paths[2] + "\n"))
+	gz.Close()
+	compressed := filepath.Join(t.TempDir(), "list.gz")
+	if err := os.WriteFile(compressed, gzipped.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+		mc.stdin = strings.NewReader(paths[3] + "\n")
+	}
+	mc := runPipeline(t, 2, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, lists: []string{plain, compressed, "-"}}
+		res = fi.Run(nil, false)
+	})
+	if res != (InputResult{Enqueued: 4}) || mc.listsRead.Load() != 3 {
+		t.Fatalf("got %+v, %d lists read, expected the 4 listed paths", res, mc.listsRead.Load())
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		got = append(got, line[strings.LastIndexByte(line, ' ')+1:])
+	}
+	if strings.Join(got, " ") != strings.Join(paths, " ") {
+		t.Errorf("got %q, expected the lists in turn", got)
+	}
+
+	if err := checkListFiles([]string{plain, "-", filepath.Join(dir, "missing")}); !os.IsNotExist(err) {
+		t.Errorf("got %v, expected the missing list reported", err)
+	}
+	// a list which is not gzip despite its name stops the input
+	if err := os.WriteFile(compressed, []byte(paths[0]+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runPipeline(t, 1, nil, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, lists: []string{compressed, plain}}
+		res = fi.Run(nil, false)
+	})
+	if res.Err == nil || res.Enqueued != 0 {
+		t.Errorf("got %+v, expected the bad gzip list to stop the input", res)
+	}
+}
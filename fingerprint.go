@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// fingerprintTuple is the fixed size form of a record kept in memory, 32 bytes per file.
+// The path is reduced to 128 bits of its SHA-256: two paths colliding would need about 2^64 files
+// to become likely, use -fingerprint-exact to rule it out.
+type fingerprintTuple struct {
+	pathHash [16]byte
+	size     uint64
+	crc      uint32
+}
+
+// fingerprinter derives a single value of a dataset that changes when any path, content or size does,
+// hashing the records in path order so -j and the walk order do not matter. Used by the writer goroutine only.
+type fingerprinter struct {
+	exact  bool
+	tuples []fingerprintTuple
+	sorter *indexWriter // external sort of the full records with exact
+	sum    string
+}
+
+func newFingerprinter(exact bool) *fingerprinter {
+	fp := &fingerprinter{exact: exact}
+	if exact {
+		fp.sorter = newIndexWriter(filepath.Join(os.TempDir(), "mass-crc32c-fingerprint"))
+	}
+	return fp
+}
+
+// Add takes a record, its CRC in any -enc: the fingerprint does not depend on it
+func (fp *fingerprinter) Add(rec manifestRecord) error {
+	crc, err := decodeCRC(rec.CRC)
+	if err != nil {
+		return err
+	}
+	if fp.exact {
+		rec.CRC = encodeCRC(crc)
+		return fp.sorter.Add(rec)
+	}
+	fp.tuples = append(fp.tuples, fingerprintTuple{
+		pathHash: hashPath(rec.Path),
+		size:     rec.Size,
+		crc:      crc,
+	})
+	return nil
+}
+
+func hashPath(path string) [16]byte {
+	var h [16]byte
+	sum := sha256.Sum256([]byte(path))
+	copy(h[:], sum[:])
+	return h
+}
+
+// finish computes the fingerprint: the SHA-256 of the "path\0crc\0size\n" records sorted by path,
+// the crc in base64, with exact, of the (path hash, crc, size) tuples sorted by path hash otherwise
+func (fp *fingerprinter) finish() error {
+	h := sha256.New()
+	if fp.exact {
+		if err := fp.sorter.merge(func(rec manifestRecord) error {
+			writeFingerprintRecord(h, rec)
+			return nil
+		}); err != nil {
+			return err
+		}
+	} else {
+		sort.Slice(fp.tuples, func(i, j int) bool {
+			return bytes.Compare(fp.tuples[i].pathHash[:], fp.tuples[j].pathHash[:]) < 0
+		})
+		buf := make([]byte, 28)
+		for _, t := range fp.tuples {
+			copy(buf, t.pathHash[:])
+			binary.BigEndian.PutUint32(buf[16:], t.crc)
+			binary.BigEndian.PutUint64(buf[20:], t.size)
+			h.Write(buf)
+		}
+		fp.tuples = nil
+	}
+	fp.sum = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+func writeFingerprintRecord(h hash.Hash, rec manifestRecord) {
+	h.Write([]byte(rec.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(rec.CRC))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendUint(nil, rec.Size, 10))
+	h.Write([]byte{'\n'})
+}
+
+func (fp *fingerprinter) mode() string {
+	if fp.exact {
+		return "exact"
+	}
+	return "compact"
+}
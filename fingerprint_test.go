@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runFingerprint(t *testing.T, paths []string, jobCount int, exact bool) string {
+	mc := runPaths(t, jobCount, paths, func(mc *MassCRC32C) {
+		mc.EnableFingerprint(exact)
+		if exact {
+			mc.fingerprint.sorter.runRecords = 3 // several sorted runs
+		}
+	})
+	return mc.fingerprint.sum
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%02d", i))
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	reversed := make([]string, len(paths))
+	for i, path := range paths {
+		reversed[len(paths)-1-i] = path
+	}
+
+	for _, exact := range []bool{false, true} {
+		reference := runFingerprint(t, paths, 1, exact)
+		if got := runFingerprint(t, reversed, 4, exact); got != reference {
+			t.Errorf("exact=%v: fingerprint depends on -j or order: %s != %s", exact, got, reference)
+		}
+		// errors are not records
+		if got := runFingerprint(t, append(paths, filepath.Join(dir, "missing")), 2, exact); got != reference {
+			t.Errorf("exact=%v: a failed file changed the fingerprint", exact)
+		}
+		if got := runFingerprint(t, paths[1:], 1, exact); got == reference {
+			t.Errorf("exact=%v: a missing path must change the fingerprint", exact)
+		}
+	}
+
+	renamed := paths[0] + "r"
+	if err := os.Rename(paths[0], renamed); err != nil {
+		t.Fatal(err)
+	}
+	paths[0] = renamed
+	compact, exact := runFingerprint(t, paths, 1, false), runFingerprint(t, paths, 1, true)
+	if err := os.WriteFile(paths[3], []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if runFingerprint(t, paths, 1, false) == compact || runFingerprint(t, paths, 1, true) == exact {
+		t.Error("a content change must change the fingerprint")
+	}
+}
+
+// Test the exact fingerprint value, the same for the records of every -enc
+func TestFingerprintExactValue(t *testing.T) {
+	sum := sha256.Sum256([]byte("a\x00AAAAAA==\x0010\nb\x00AAAAAQ==\x002\n"))
+	for _, crcs := range [][2]string{{"AAAAAQ==", "AAAAAA=="}, {"00000001", "00000000"}, {"AAAAAQ", "AAAAAA"}} {
+		fp := newFingerprinter(true)
+		for _, rec := range []manifestRecord{{Path: "b", CRC: crcs[0], Size: 2}, {Path: "a", CRC: crcs[1], Size: 10}} {
+			if err := fp.Add(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := fp.finish(); err != nil {
+			t.Fatal(err)
+		}
+		if fp.sum != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: got %s", crcs[0], fp.sum)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "errors"
+
+const freeSpaceSupported = false
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space unknown on this platform")
+}
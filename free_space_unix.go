@@ -0,0 +1,16 @@
+//go:build linux || darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+const freeSpaceSupported = true
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem of path
+func freeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+const freeSpaceSupported = true
+
+// freeSpace returns the bytes available to the user on the volume of path, asked for its directory
+// as GetDiskFreeSpaceEx does not take files
+func freeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(filepath.Dir(path))
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err = windows.GetDiskFreeSpaceEx(dir, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// globMeta are the characters making a root a filepath.Glob pattern
+const globMeta = "*?["
+
+// expandRoots replaces the roots holding glob metacharacters by their matches, for the file sets like
+// /data/shard-*/current overflowing ARG_MAX once expanded by the shell. A root existing as named is kept
+// whatever its name, a pattern matching nothing or malformed is reported like a missing root. The matches
+// are walked as roots, a file matched is queued like a file root. Like the shell, a wildcard does not
+// match the dot entries unless its component starts with a dot.
+func (fi *FileInput) expandRoots(roots []string) []string {
+	var expanded []string
+	for _, root := range roots {
+		if !strings.ContainsAny(root, globMeta) {
+			expanded = append(expanded, root)
+			continue
+		}
+		if _, err := os.Lstat(longPath(root)); err == nil {
+			expanded = append(expanded, root)
+			continue
+		}
+		matches, err := filepath.Glob(root)
+		matches = visibleMatches(root, matches)
+		if err == nil && len(matches) == 0 {
+			err = fmt.Errorf("no match: %w", fs.ErrNotExist)
+		}
+		if err != nil {
+			fi.mc.printErr(errScopeFile, "walker", root, err)
+			fi.mc.fileErrorCount.Add(1)
+			continue
+		}
+		fmt.Fprintf(fi.mc.DebugOut, "pattern %s: %d matches\n", root, len(matches))
+		expanded = append(expanded, matches...)
+	}
+	return expanded
+}
+
+// visibleMatches drops the matches of pattern naming a dot entry where the pattern component has no
+// leading dot, the shell hides them from * and the matches are exempt from -skip-hidden as roots
+func visibleMatches(pattern string, matches []string) []string {
+	patternParts := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+	visible := matches[:0]
+	for _, match := range matches {
+		parts := strings.Split(filepath.Clean(match), string(filepath.Separator))
+		hidden := false
+		for i := 0; i < len(parts) && len(parts) == len(patternParts); i++ {
+			if strings.HasPrefix(parts[i], ".") && !strings.HasPrefix(patternParts[i], ".") {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			visible = append(visible, match)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGlobRoots(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"shard-1/current/f", "shard-2/current/f", "shard-2/old/f", "shard-3/current", "literal[1]/f", "other/f"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		// shard-3/current is a file matched, literal[1] exists as named
+		res = fi.WalkDirectories([]string{
+			filepath.Join(root, "shard-*", "current"),
+			filepath.Join(root, "literal[1]"),
+			filepath.Join(root, "none-*"),
+			filepath.Join(root, "other"),
+		})
+	})
+
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		rel, _ := filepath.Rel(root, line[strings.LastIndexByte(line, ' ')+1:])
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	if got := strings.Join(paths, " "); got != "literal[1]/f other/f shard-1/current/f shard-2/current/f shard-3/current" || res.Enqueued != 5 {
+		t.Errorf("got %s, %+v", got, res)
+	}
+	if !strings.Contains(errOut.String(), filepath.Join(root, "none-*")) || mc.Stats().FileErrors != 1 || mc.Stats().Roots != 5 {
+		t.Errorf("got %q, %+v, expected the pattern matching nothing reported", errOut.String(), mc.Stats())
+	}
+}
+
+// Test a wildcard skips the dot entries like the shell, a pattern component starting with a dot matches them
+func TestGlobRootsDotEntries(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a/f", ".h/f", "b/.snapshot/f", "b/current/f"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	mc := runPipeline(t, 1, func(mc *MassCRC32C) { mc.StdOut = out }, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.WalkDirectories([]string{filepath.Join(root, "*"), filepath.Join(root, ".h*")})
+	})
+
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		rel, _ := filepath.Rel(root, line[strings.LastIndexByte(line, ' ')+1:])
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	// b/.snapshot is reached by the walk of b, not by the pattern
+	if got := strings.Join(paths, " "); got != ".h/f a/f b/.snapshot/f b/current/f" || mc.Stats().Roots != 3 {
+		t.Errorf("got %s, %+v", got, mc.Stats())
+	}
+}
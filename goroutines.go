@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// goroutineCategory labels the goroutines spawned beyond the worker pool, counted by the goroutine registry
+type goroutineCategory int
+
+const (
+	goroutineWriter        goroutineCategory = iota // writeResults
+	goroutineSignals                                // HandleSignals
+	goroutineFreeMemory                             // the periodic FreeOSMemory of -low-memory
+	goroutineRunWatcher                             // the context watcher of Run
+	goroutineGzipWriter                             // the ordered writer of a parallel gzip output
+	goroutineGzipBlock                              // a block compressed for a parallel gzip output
+	goroutineCoordinator                            // the batcher and listener of -coordinator
+	goroutineWorkerConn                             // a worker connection of -coordinator
+	goroutinePrioritySpool                          // the -priority-spool follower
+	goroutineCategoryCount
+)
+
+var goroutineCategoryNames = [goroutineCategoryCount]string{
+	"writer", "signals", "free-os-memory", "run-watcher", "gzip-writer", "gzip-block", "coordinator", "worker-conn", "priority-spool",
+}
+
+// goroutineRegistry counts the running goroutines by category, and the most ever running together, for
+// the extended summary and SIGUSR2 to show which feature piles them up. It is process wide like the
+// goroutines, so the library runs of a process add up.
+type goroutineRegistry struct {
+	running [goroutineCategoryCount]atomic.Int64
+	peak    [goroutineCategoryCount]atomic.Int64
+}
+
+var goroutines goroutineRegistry
+
+// spawn runs f in a goroutine counted in category until it returns
+func (gr *goroutineRegistry) spawn(category goroutineCategory, f func()) {
+	n := gr.running[category].Add(1)
+	for {
+		peak := gr.peak[category].Load()
+		if n <= peak || gr.peak[category].CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	go func() {
+		defer gr.running[category].Add(-1)
+		f()
+	}()
+}
+
+// print writes the total count of goroutines of the process, the workers and the running and peak counts
+// of the categories ever spawned
+func (gr *goroutineRegistry) print(w io.Writer, workers int) {
+	var categories []string
+	for category := goroutineCategory(0); category < goroutineCategoryCount; category++ {
+		if peak := gr.peak[category].Load(); peak > 0 {
+			categories = append(categories, fmt.Sprintf("%s %d (peak %d)", goroutineCategoryNames[category], gr.running[category].Load(), peak))
+		}
+	}
+	fmt.Fprintf(w, "Goroutines: %d, %d workers", runtime.NumGoroutine(), workers)
+	if len(categories) > 0 {
+		fmt.Fprintf(w, ", %s", strings.Join(categories, ", "))
+	}
+	fmt.Fprintln(w)
+}
+
+func isDiagnosticSignal(sig os.Signal) bool {
+	for _, diagnostic := range diagnosticSignals {
+		if sig == diagnostic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoroutineRegistry(t *testing.T) {
+	var gr goroutineRegistry
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		gr.spawn(goroutineGzipBlock, func() { <-release })
+	}
+	if got := gr.running[goroutineGzipBlock].Load(); got != 3 {
+		t.Errorf("got %d running, expected 3", got)
+	}
+	out := &bytes.Buffer{}
+	gr.print(out, 4)
+	if !strings.Contains(out.String(), ", 4 workers, gzip-block 3 (peak 3)\n") || strings.Contains(out.String(), "writer") {
+		t.Errorf("got %q", out.String())
+	}
+	close(release)
+	for deadline := time.Now().Add(5 * time.Second); gr.running[goroutineGzipBlock].Load() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the goroutines did not end")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := gr.peak[goroutineGzipBlock].Load(); got != 3 {
+		t.Errorf("got a peak of %d, expected 3", got)
+	}
+}
+
+// Test a run leaves no tracked goroutine behind once torn down
+func TestGoroutinesAfterRun(t *testing.T) {
+	var before [goroutineCategoryCount]int64
+	for category := range before {
+		before[category] = goroutines.running[category].Load()
+	}
+	pw := newParallelGzipWriter(io.Discard, 2, 16)
+	pw.Write(bytes.Repeat([]byte("block"), 20))
+	runPaths(t, 2, nil, func(mc *MassCRC32C) {
+		mc.EnableLowMemory(lowMemoryPreset(1))
+	})
+	pw.Close()
+	if goroutines.peak[goroutineWriter].Load() == 0 || goroutines.peak[goroutineGzipBlock].Load() == 0 || goroutines.peak[goroutineFreeMemory].Load() == 0 {
+		t.Error("expected the writer, gzip blocks and FreeOSMemory loop counted")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		var running []string
+		for category := goroutineCategory(0); category < goroutineCategoryCount; category++ {
+			if goroutines.running[category].Load() != before[category] {
+				running = append(running, goroutineCategoryNames[category])
+			}
+		}
+		if len(running) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still running: %s", strings.Join(running, ", "))
+		}
+	}
+}
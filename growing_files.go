@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// growthPolicy is how the files whose size changes while they are read are checksummed
+type growthPolicy int
+
+const (
+	growthFollow   growthPolicy = iota // read up to EOF whatever the size at open
+	growthTruncate                     // read up to the size at open, a reproducible CRC of a growing log
+	growthError                        // read up to EOF and fail when the size differs from the size at open
+)
+
+var growthPolicyNames = []string{"follow", "truncate", "error"}
+
+var (
+	errFileShrank = fmt.Errorf("%w: shrank below its size at open", errFileChanged)
+	errFileGrew   = fmt.Errorf("%w: grew past its size at open", errFileChanged)
+)
+
+func parseGrowthPolicy(name string) (growthPolicy, error) {
+	for i, policyName := range growthPolicyNames {
+		if name == policyName {
+			return growthPolicy(i), nil
+		}
+	}
+	return growthFollow, fmt.Errorf("unknown policy %q, expected %s", name, strings.Join(growthPolicyNames, ", "))
+}
+
+func (p growthPolicy) String() string {
+	return growthPolicyNames[p]
+}
+
+// check compares the bytes read with the size at open, a file shrinking is a short read failing with every policy but follow
+func (p growthPolicy) check(read uint64, openSize uint64) error {
+	switch {
+	case p == growthFollow:
+		return nil
+	case read < openSize:
+		return errFileShrank
+	case p == growthError && read > openSize:
+		return errFileGrew
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test the policies on a procfs file, regular with a size of 0 at open but content to read, like a file grown since
+func TestGrowthPolicyProcfs(t *testing.T) {
+	path := "/proc/self/status"
+	tests := []struct {
+		policy growthPolicy
+		empty  bool
+		err    error
+	}{
+		{growthFollow, false, nil},
+		{growthTruncate, true, nil},
+		{growthError, false, errFileGrew},
+	}
+	for _, test := range tests {
+		mc := InitMassCRC32C(1, 1)
+		mc.SetGrowingFiles(test.policy)
+		err, fileSize, _ := mc.pathToCRC(path, "0")
+		if !errors.Is(err, test.err) || (fileSize == 0) != test.empty {
+			t.Errorf("%s: got %v after %d bytes", test.policy, err, fileSize)
+		}
+	}
+}
+
+func TestGrowthErrorWastedBytes(t *testing.T) {
+	mc := runPaths(t, 1, []string{"/proc/self/status"}, func(mc *MassCRC32C) {
+		mc.SetGrowingFiles(growthError)
+	})
+	if wasted := mc.errReporter.classWasted[classChanged].Load(); wasted == 0 || wasted != mc.Stats().BytesRead {
+		t.Errorf("got %d bytes wasted as CHANGED, expected the %d bytes read", wasted, mc.Stats().BytesRead)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGrowthPolicyCheck(t *testing.T) {
+	tests := []struct {
+		policy   growthPolicy
+		read     uint64
+		openSize uint64
+		expected error
+	}{
+		{growthFollow, 10, 20, nil},
+		{growthFollow, 30, 20, nil},
+		{growthTruncate, 20, 20, nil},
+		{growthTruncate, 10, 20, errFileShrank},
+		{growthError, 20, 20, nil},
+		{growthError, 10, 20, errFileShrank},
+		{growthError, 30, 20, errFileGrew},
+	}
+	for _, test := range tests {
+		if err := test.policy.check(test.read, test.openSize); err != test.expected {
+			t.Errorf("%s %d/%d: got %v, expected %v", test.policy, test.read, test.openSize, err, test.expected)
+		}
+	}
+	if classify(errFileGrew) != classChanged || !errors.Is(errFileShrank, errFileChanged) {
+		t.Errorf("size changes are not classified as CHANGED")
+	}
+	if _, err := parseGrowthPolicy("tail"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+// Test a file keeping its size gets the same CRC whatever the policy
+func TestGrowthPolicyStable(t *testing.T) {
+	for _, name := range growthPolicyNames {
+		policy, err := parseGrowthPolicy(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mc := InitMassCRC32C(1, 1)
+		mc.SetGrowingFiles(policy)
+		err, fileSize, crc := mc.pathToCRC("test_data.txt", "0")
+		if err != nil || crc != "WaIfQg==" || fileSize != 3538 {
+			t.Errorf("%s: got %v %d %s", name, err, fileSize, crc)
+		}
+	}
+}
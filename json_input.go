@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonJob is a job of -input json, the list is a stream of these objects or a JSON array of them
+type jsonJob struct {
+	Path     string          `json:"path"`
+	Expected string          `json:"expected_crc32c,omitempty"` // verified against the computed CRC when set
+	Label    json.RawMessage `json:"label,omitempty"`           // an object copied in the records
+
+	ExpectedHead string `json:"expected_head_crc32c,omitempty"` // verified against the -edge-digest edges when set
+	ExpectedTail string `json:"expected_tail_crc32c,omitempty"`
+}
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// verify checks crc and the edge digests against the expected ones of the item, if any. The edges are
+// compared first so a mismatch tells whether the head or the tail of the file differs.
+func (item QueueItem) verify(crc string, edges *edgeDigests) error {
+	if differ := item.edgeMismatch(edges); differ != "" {
+		if item.Expected == "" {
+			return fmt.Errorf("%w: %s", errChecksumMismatch, differ)
+		}
+		return fmt.Errorf("%w: %s, expected %s, got %s", errChecksumMismatch, differ, item.Expected, crc)
+	}
+	if item.Expected == "" || sameCRC(crc, item.Expected) {
+		return nil
+	}
+	return fmt.Errorf("%w: expected %s, got %s", errChecksumMismatch, item.Expected, crc)
+}
+
+// expects reports whether the item has a checksum to verify
+func (item QueueItem) expects() bool {
+	return item.Expected != "" || item.ExpectedHead != "" || item.ExpectedTail != ""
+}
+
+// validate checks a decoded job and compacts its label
+func (job *jsonJob) validate() error {
+	if job.Path == "" {
+		return errors.New("empty path")
+	}
+	for _, expected := range []struct {
+		name string
+		crc  string
+	}{
+		{"expected_crc32c", job.Expected},
+		{"expected_head_crc32c", job.ExpectedHead},
+		{"expected_tail_crc32c", job.ExpectedTail},
+	} {
+		if expected.crc == "" {
+			continue
+		}
+		if _, err := decodeCRC(expected.crc); err != nil {
+			return fmt.Errorf("malformed %s: %w", expected.name, err)
+		}
+	}
+	if job.Label != nil {
+		var label map[string]json.RawMessage
+		if err := json.Unmarshal(job.Label, &label); err != nil || label == nil {
+			return errors.New("label is not an object")
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, job.Label)
+		job.Label = compact.Bytes()
+	}
+	return nil
+}
+
+// jsonJobDecoder decodes the jobs of the list one at a time, index counts them from 0
+type jsonJobDecoder struct {
+	dec    *json.Decoder
+	array  bool // the jobs are the elements of an array
+	closed bool // the array was closed, only whitespace may follow
+	index  int
+}
+
+func newJSONJobDecoder(r io.Reader) *jsonJobDecoder {
+	br := bufio.NewReader(r)
+	jd := &jsonJobDecoder{dec: json.NewDecoder(br), index: -1}
+	jd.dec.DisallowUnknownFields()
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return jd // the decoder reports it
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			br.UnreadByte()
+			jd.array = b == '['
+			return jd
+		}
+	}
+}
+
+// next returns the next job, io.EOF after the last one. A job that is not valid is returned with
+// an error and fatal false, the following ones can still be decoded, the list ends on a fatal error.
+func (jd *jsonJobDecoder) next() (job jsonJob, fatal bool, err error) {
+	if jd.array && jd.index == -1 {
+		if _, err := jd.dec.Token(); err != nil {
+			return jsonJob{}, true, err
+		}
+	}
+	if jd.array && !jd.closed && !jd.dec.More() {
+		if _, err := jd.dec.Token(); err != nil {
+			return jsonJob{}, true, fmt.Errorf("after job %d: %w", jd.index, err)
+		}
+		jd.closed = true
+	}
+	if jd.closed {
+		if _, err := jd.dec.Token(); err != io.EOF {
+			return jsonJob{}, true, fmt.Errorf("after job %d: trailing data after the array", jd.index)
+		}
+		return jsonJob{}, false, io.EOF
+	}
+	jd.index++
+	if err := jd.dec.Decode(&job); err != nil {
+		if err == io.EOF && !jd.array {
+			return jsonJob{}, false, io.EOF
+		}
+		fatal := err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, new(*json.SyntaxError))
+		return jsonJob{}, fatal, fmt.Errorf("job %d: %w", jd.index, err)
+	}
+	if err := job.validate(); err != nil {
+		return jsonJob{}, false, fmt.Errorf("job %d: %w", jd.index, err)
+	}
+	return job, false, nil
+}
+
+// readJSONList is ReadFileList for -input json, an invalid job is reported and skipped,
+// a malformed list stops the input
+func (fi *FileInput) readJSONList(r io.Reader) InputResult {
+	start := fi.mc.enqueueSeq.Load()
+	var res InputResult
+	jd := newJSONJobDecoder(r)
+	for {
+		fi.mc.schedCheckpoint(fi.mc.walkerProbe)
+		job, fatal, err := jd.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fi.mc.printErr(errScopeList, "reader", "", err)
+			if fatal {
+				res.Err = fmt.Errorf("reading the jobs: %w", err)
+				break
+			}
+			continue
+		}
+		if fi.mc.edgeSize == 0 && (job.ExpectedHead != "" || job.ExpectedTail != "") {
+			fi.mc.printErr(errScopeList, "reader", "", fmt.Errorf("job %d: the expected edges need -edge-digest", jd.index))
+			continue
+		}
+		if fi.mc.skipOwned(job.Path) || fi.mc.excluded(job.Path, "") {
+			continue
+		}
+		if fi.mc.skipHidden && hiddenPath(job.Path) {
+			fmt.Fprintf(fi.mc.DebugOut, "ignoring hidden: %s\n", job.Path)
+			fi.mc.ignoredFilesCount.Add(1)
+			continue
+		}
+		if !fi.mc.included(job.Path, "") {
+			fmt.Fprintf(fi.mc.DebugOut, "ignoring, not included: %s\n", job.Path)
+			fi.mc.ignoredFilesCount.Add(1)
+			continue
+		}
+		item := QueueItem{Path: job.Path, Expected: job.Expected, ExpectedHead: job.ExpectedHead, ExpectedTail: job.ExpectedTail, Label: job.Label}
+		if fi.mc.EnqueueItem(item) != nil {
+			fmt.Fprintln(fi.mc.DebugOut, "directory walk interrupted")
+			res.Interrupted = true
+			break
+		}
+	}
+	fi.mc.listsRead.Add(1)
+	res.Enqueued = fi.mc.enqueueSeq.Load() - start
+	return res
+}
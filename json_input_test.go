@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJSONJobDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		paths []string
+		errs  []string // the errors in order, the last one is fatal when fatal
+		fatal bool
+	}{
+		{"stream", `{"path":"a"} {"path":"b","label":{"k": 1}}` + "\n", []string{"a", "b"}, nil, false},
+		{"array", ` [{"path":"a"},{"path":"b"}] ` + "\n", []string{"a", "b"}, nil, false},
+		{"empty array", "[]", nil, nil, false},
+		{"empty", "", nil, nil, false},
+		{"invalid jobs", `{"path":""} {"path":"a","label":[1]} {"path":"b","size":1} {"path":"c","expected_crc32c":"x"} {"path":"d"}`,
+			[]string{"d"}, []string{"job 0: empty path", "job 1: label is not an object", `job 2: json: unknown field "size"`, "job 3: malformed expected_crc32c"}, false},
+		{"wrong type", `[{"path":1},{"path":"a"}]`, []string{"a"}, []string{"job 0: json: cannot unmarshal number"}, false},
+		{"stream garbage", `{"path":"a"} x`, []string{"a"}, []string{"job 1: invalid character 'x'"}, true},
+		{"array garbage", `[{"path":"a"}] {"path":"b"}`, []string{"a"}, []string{"after job 0: trailing data after the array"}, true},
+		{"unterminated array", `[{"path":"a"}`, []string{"a"}, []string{"job 1: unexpected end of JSON input"}, true},
+		{"cut object", `{"path":"a"} {"path":`, []string{"a"}, []string{"job 1: unexpected EOF"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jd := newJSONJobDecoder(strings.NewReader(test.input))
+			var paths []string
+			var errs []string
+			fatal := false
+			for !fatal {
+				job, jobFatal, err := jd.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					errs = append(errs, err.Error())
+					fatal = jobFatal
+					continue
+				}
+				paths = append(paths, job.Path)
+			}
+			if strings.Join(paths, ",") != strings.Join(test.paths, ",") || fatal != test.fatal || len(errs) != len(test.errs) {
+				t.Fatalf("got %q %q fatal %t, expected %q %q fatal %t", paths, errs, fatal, test.paths, test.errs, test.fatal)
+			}
+			for i, err := range errs {
+				if !strings.HasPrefix(err, test.errs[i]) {
+					t.Errorf("got error %q, expected %q", err, test.errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJSONInput(t *testing.T) {
+	err, _, data := InitMassCRC32C(1, 1).pathToCRC("test_data.txt", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := `[
+		{"path": "test_data.txt", "expected_crc32c": "` + data + `", "label": {"job": "a b",  "n": 1}},
+		{"path": "test_data.txt", "expected_crc32c": "AAAAAA=="},
+		{"path": "test_data.txt"}
+	]`
+	for _, format := range []string{"jsonl", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			errOut := &bytes.Buffer{}
+			var res InputResult
+			setup := func(mc *MassCRC32C) {
+				mc.StdOut = out
+				mc.ErrOut = errOut
+				mc.stdin = strings.NewReader(jobs)
+				mc.EnableJSONInput()
+				if format == "jsonl" {
+					mc.EnableJSONLOutput()
+				} else {
+					mc.EnableCSVOutput(true)
+				}
+				mc.EnableOrderedOutput(defaultOrderedWindow)
+			}
+			mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+				fi := FileInput{mc: mc}
+				res = fi.Run(nil, false)
+			})
+
+			if res.Err != nil || res.Enqueued != 3 {
+				t.Errorf("got %+v", res)
+			}
+			expected := `{"crc32c":"` + data + `","size":3538,"path":"test_data.txt","label":{"job":"a b","n":1}}` + "\n" +
+				`{"crc32c":"` + data + `","size":3538,"path":"test_data.txt"}` + "\n"
+			if format == "csv" {
+				expected = "crc,size,path,label\n" +
+					data + `,3538,test_data.txt,"{""job"":""a b"",""n"":1}"` + "\n" +
+					data + ",3538,test_data.txt,\n"
+			}
+			if out.String() != expected {
+				t.Errorf("got %q, expected %q", out.String(), expected)
+			}
+			if mc.Mismatches() != 1 || mc.verifiedCount.Load() != 1 || mc.Stats().FileErrors != 1 {
+				t.Errorf("got %d mismatches %d verified %d errors", mc.Mismatches(), mc.verifiedCount.Load(), mc.Stats().FileErrors)
+			}
+			if !strings.Contains(errOut.String(), "class=MISMATCH") || !strings.Contains(errOut.String(), "expected AAAAAA==, got "+data) {
+				t.Errorf("got errors %q", errOut.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// jsonRecord is a record of -format jsonl, one JSON object per line
+type jsonRecord struct {
+	Ordinal string  `json:"ordinal,omitempty"`
+	CRC32C  string  `json:"crc32c,omitempty"`
+	CRC32   string  `json:"crc32,omitempty"`  // with -poly ieee
+	MD5     string  `json:"md5,omitempty"`    // with -algo md5
+	SHA256  string  `json:"sha256,omitempty"` // with -algo sha256
+	XXH64   string  `json:"xxh64,omitempty"`  // with -algo xxh64
+	BLAKE3  string  `json:"blake3,omitempty"` // with -algo blake3
+	Size    uint64  `json:"size"`
+	Path    string  `json:"path"`
+	Nlink   *uint64 `json:"nlink,omitempty"` // with -stat-fields nlink
+	Inode   *uint64 `json:"inode,omitempty"` // with -stat-fields inode
+	Btime   *string `json:"btime,omitempty"` // with -stat-fields btime, empty when unknown
+
+	BadBlocks []jsonBadRange  `json:"bad_blocks,omitempty"`  // the unreadable ranges of a partial record
+	Head      string          `json:"head_crc32c,omitempty"` // the CRC of the first -edge-digest bytes
+	Tail      string          `json:"tail_crc32c,omitempty"` // the CRC of the last -edge-digest bytes
+	Label     json.RawMessage `json:"label,omitempty"`       // the label of the -input json job
+}
+
+type jsonBadRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// writeJSONRecord writes a jsonl record, with a field per -algo digest, the enabled stat fields,
+// the bad ranges, the edges and the job label
+func (mc *MassCRC32C) writeJSONRecord(w io.Writer, res Result) {
+	rec := jsonRecord{Ordinal: res.Ordinal, Size: res.Size, Path: res.Path, Label: res.Label, Head: res.Head, Tail: res.Tail}
+	for i, digest := range mc.splitDigests(res.CRC) {
+		switch mc.algos[i] {
+		case algoMD5:
+			rec.MD5 = digest
+		case algoSHA256:
+			rec.SHA256 = digest
+		case algoXXH64:
+			rec.XXH64 = digest
+		case algoBLAKE3:
+			rec.BLAKE3 = digest
+		default:
+			if mc.crc.params == ieeeParams {
+				rec.CRC32 = digest
+			} else {
+				rec.CRC32C = digest
+			}
+		}
+	}
+	if mc.statFields.nlink {
+		rec.Nlink = &res.Nlink
+	}
+	if mc.statFields.inode {
+		rec.Inode = &res.Inode
+	}
+	if mc.statFields.btime {
+		btime := formatBirthTime(res.Btime)
+		rec.Btime = &btime
+	}
+	for _, r := range res.BadBlocks {
+		rec.BadBlocks = append(rec.BadBlocks, jsonBadRange{Offset: r.Offset, Length: r.Length})
+	}
+	line, _ := json.Marshal(rec)
+	w.Write(append(line, '\n'))
+}
+
+// parseJSONRecord parses a jsonl record line, the manifests of -format jsonl
+func parseJSONRecord(line string) (manifestRecord, error) {
+	var rec jsonRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return manifestRecord{}, err
+	}
+	return rec.manifestRecord(rec.CRC32C)
+}
+
+// manifestRecord validates the record whose CRC is crc, the value of its crc32c or crc32 field
+func (rec *jsonRecord) manifestRecord(crc string) (manifestRecord, error) {
+	if _, err := decodeCRC(crc); err != nil {
+		return manifestRecord{}, err
+	}
+	if rec.Path == "" {
+		return manifestRecord{}, errors.New("empty path")
+	}
+	return manifestRecord{CRC: crc, Size: rec.Size, Path: rec.Path, Partial: len(rec.BadBlocks) > 0}, nil
+}
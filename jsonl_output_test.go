@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONLOutput(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"with space", "quote\"d"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.EnableJSONLOutput()
+		mc.SetJSONErrors(true)
+		mc.EnableStatFields(statFields{nlink: true})
+		mc.stdin = strings.NewReader("7\t" + filepath.Join(root, "missing") + "\n")
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.Run([]string{root}, true)
+	})
+
+	records, _, diag, err := parseAll(t, out.Bytes(), true)
+	if err != nil || len(records) != 2 || diag != "" {
+		t.Fatalf("got %v %v %q from %q", records, err, diag, out)
+	}
+	for _, rec := range records {
+		name := filepath.Base(rec.Path)
+		expectedCRC, _, _ := mc.CRCReader(strings.NewReader(name))
+		if rec.CRC != expectedCRC || rec.Size != uint64(len(name)) {
+			t.Errorf("got %+v, expected %s %d", rec, expectedCRC, len(name))
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil || fields["nlink"] != float64(1) || fields["inode"] != nil {
+			t.Errorf("got %v %v from %q, expected nlink only", fields, err, line)
+		}
+	}
+	var rec errorRecord
+	if err := json.Unmarshal(errOut.Bytes(), &rec); err != nil || rec.Class != "NOT_FOUND" {
+		t.Errorf("got %+v %v from %q, expected a JSON error record", rec, err, errOut)
+	}
+}
+
+func TestJSONRecordOrdinal(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	out := &bytes.Buffer{}
+	mc.writeJSONRecord(out, Result{Path: "a b", Ordinal: "0042", CRC: "AAAAAA==", Size: 3})
+	if out.String() != `{"ordinal":"0042","crc32c":"AAAAAA==","size":3,"path":"a b"}`+"\n" {
+		t.Errorf("got %q", out)
+	}
+	for _, line := range []string{`{"crc32c":"bad","size":3,"path":"a"}`, `{"crc32c":"AAAAAA==","size":3}`, `{"crc32c":`} {
+		if _, err := parseManifestLine(line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
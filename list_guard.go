@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	errEntryTooLong = errors.New("entry too long")
+	errEntryNUL     = errors.New("NUL byte in entry")
+	errEntryNewline = errors.New("newline in entry")
+)
+
+// listGuard validates the entries of the stdin list generated by less trusted tooling, the zero value
+// rejects the NUL bytes no path can hold and the newlines only a -0 list can hold
+type listGuard struct {
+	maxLen        int  // -max-path-len, unlimited when 0
+	allowNewlines bool // -allow-newlines, the entries of a -0 list holding a newline are kept
+	strict        bool // -strict-input, a rejected entry stops the input
+}
+
+// check returns why entry is rejected, nil when it is valid
+func (lg listGuard) check(entry string) error {
+	if lg.maxLen > 0 && len(entry) > lg.maxLen {
+		return lg.tooLong(len(entry))
+	}
+	if strings.IndexByte(entry, 0) >= 0 {
+		return errEntryNUL
+	}
+	if !lg.allowNewlines && strings.ContainsAny(entry, "\n\r") {
+		return errEntryNewline
+	}
+	return nil
+}
+
+func (lg listGuard) tooLong(size int) error {
+	return fmt.Errorf("%w: %d bytes, more than %d", errEntryTooLong, size, lg.maxLen)
+}
+
+// scanner returns the scanner of the entries of the list r separated by split. With a maximum length, the
+// entries longer are cut and the rest of them skipped, for check to reject them without holding them whole.
+func (lg listGuard) scanner(r io.Reader, split bufio.SplitFunc) (*bufio.Scanner, *boundedSplit) {
+	scanner := bufio.NewScanner(r)
+	bs := &boundedSplit{split: split, max: lg.maxLen}
+	if lg.maxLen == 0 {
+		scanner.Split(split)
+		scanner.Buffer(nil, math.MaxInt)
+		return scanner, bs
+	}
+	scanner.Split(bs.Split)
+	// room for an entry of max bytes, its separator and the byte telling it is longer, on top of the
+	// default buffer not to read the short entries a few bytes at a time
+	scanner.Buffer(nil, bufio.MaxScanTokenSize+lg.maxLen+2)
+	return scanner, bs
+}
+
+// boundedSplit wraps the split function of a list, returning the first max+1 bytes of the entries longer than
+// max with the count of the bytes skipped
+type boundedSplit struct {
+	split   bufio.SplitFunc
+	max     int
+	head    []byte // the first bytes of the entry being skipped
+	skipped int    // the bytes skipped of the last entry, 0 when it was whole
+}
+
+func (bs *boundedSplit) Split(data []byte, atEOF bool) (int, []byte, error) {
+	if bs.head == nil {
+		bs.skipped = 0
+		advance, token, err := bs.split(data, atEOF)
+		if token != nil || advance > 0 || err != nil || atEOF || len(data) <= bs.max+1 {
+			return advance, token, err
+		}
+		bs.head = append([]byte{}, data[:bs.max+1]...)
+		bs.skipped = len(data) - len(bs.head)
+		return len(data), nil, nil
+	}
+	advance, token, err := bs.split(data, atEOF)
+	if err != nil {
+		return advance, token, err
+	}
+	if token == nil && advance == 0 && !atEOF {
+		bs.skipped += len(data)
+		return len(data), nil, nil
+	}
+	// the end of the entry
+	bs.skipped += len(token)
+	head := bs.head
+	bs.head = nil
+	return advance, head, nil
+}
+
+// rejectEntry reports the entry of the list line rejected by err, returning the error stopping the input
+// with -strict-input
+func (fi *FileInput) rejectEntry(line int, entry string, err error) error {
+	fi.mc.rejectedCount.Add(1)
+	const shown = 64
+	if len(entry) > shown {
+		entry = entry[:shown] + "..."
+	}
+	err = fmt.Errorf("list line %d: %w, rejected: %s", line, err, strconv.Quote(entry))
+	fi.mc.printErr(errScopeList, "reader", "", err)
+	if fi.guard.strict {
+		return err
+	}
+	return nil
+}
+
+// escapeControls replaces the control characters of path with their \x escape and the backslashes with
+// a double one, for the text error records to not drive the terminals
+func escapeControls(path string) string {
+	if strings.IndexFunc(path, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '\\' }) < 0 {
+		return path
+	}
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// EscapeControls escapes the control characters of the paths of the text error records, the paths are
+// opened and recorded as they are
+func (mc *MassCRC32C) EscapeControls() {
+	mc.errReporter.escape = true
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListGuardCheck(t *testing.T) {
+	tests := []struct {
+		guard listGuard
+		entry string
+		err   error
+	}{
+		{listGuard{}, strings.Repeat("a", 100000), nil},
+		{listGuard{maxLen: 10}, "0123456789", nil},
+		{listGuard{maxLen: 10}, "0123456789a", errEntryTooLong},
+		{listGuard{}, "a\x00b", errEntryNUL},
+		{listGuard{allowNewlines: true}, "a\nb", nil},
+		{listGuard{}, "a\nb", errEntryNewline},
+		{listGuard{}, "a\rb", errEntryNewline},
+		{listGuard{}, "a\tb\x1b[2J", nil},
+	}
+	for _, test := range tests {
+		if err := test.guard.check(test.entry); !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%+v %.20q: got %v, expected %v", test.guard, test.entry, err, test.err)
+		}
+	}
+}
+
+// listRun reads list with guard, returning the paths queued, the error records and the input result
+func listRun(t *testing.T, list string, guard listGuard, nulSeparated bool) ([]string, string, InputResult) {
+	var mu sync.Mutex
+	var paths []string
+	errOut := &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.ErrOut = errOut
+		mc.HandlerFunc = func(item QueueItem) error {
+			mu.Lock()
+			paths = append(paths, item.Path)
+			mu.Unlock()
+			return nil
+		}
+		mc.stdin = strings.NewReader(list)
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, nulSeparated: nulSeparated, guard: guard}
+		res = fi.ReadFileList()
+	})
+	if rejected := mc.Stats().Rejected; rejected != uint64(strings.Count(errOut.String(), "rejected")) {
+		paths = append(paths, fmt.Sprintf("%d rejected", rejected))
+	}
+	return paths, errOut.String(), res
+}
+
+// Test the rejected entries are reported with their line number and skipped, or stop the input with -strict-input
+func TestListGuard(t *testing.T) {
+	list := "ok1\n" + strings.Repeat("x", 5000) + "\nbad\x00nul\nok2\n"
+	paths, errs, res := listRun(t, list, listGuard{maxLen: 4096}, false)
+	if strings.Join(paths, " ") != "ok1 ok2" || res != (InputResult{Enqueued: 2}) {
+		t.Errorf("got %q %+v", paths, res)
+	}
+	for _, expected := range []string{
+		"list line 2: entry too long: 5000 bytes, more than 4096, rejected: \"xxxx",
+		"list line 3: NUL byte in entry, rejected: \"bad\\x00nul\"",
+	} {
+		if !strings.Contains(errs, expected) {
+			t.Errorf("missing %q in %q", expected, errs)
+		}
+	}
+
+	paths, errs, res = listRun(t, list, listGuard{maxLen: 4096, strict: true}, false)
+	if strings.Join(paths, " ") != "ok1" || res.Err == nil || !strings.Contains(res.Err.Error(), "list line 2") || strings.Contains(errs, "line 3") {
+		t.Errorf("got %q %+v %q", paths, res, errs)
+	}
+
+	// -0 rejects the newlines unless allowed
+	list = "a\nb\x00c\x00"
+	if paths, _, _ := listRun(t, list, listGuard{allowNewlines: true}, true); strings.Join(paths, " ") != "a\nb c" {
+		t.Errorf("got %q", paths)
+	}
+	if paths, errs, _ := listRun(t, list, listGuard{}, true); strings.Join(paths, " ") != "c" || !strings.Contains(errs, "list line 1: newline in entry") {
+		t.Errorf("got %q %q", paths, errs)
+	}
+}
+
+func TestEscapeControls(t *testing.T) {
+	for path, expected := range map[string]string{
+		"plain/path é": "plain/path é",
+		"a\x1b[2Jb":    `a\x1b[2Jb`,
+		"new\nline\t":  `new\x0aline\x09`,
+		`back\slash`:   `back\\slash`,
+		"del\x7f":      `del\x7f`,
+	} {
+		if got := escapeControls(path); got != expected {
+			t.Errorf("%q: got %q, expected %q", path, got, expected)
+		}
+	}
+
+	er := errorReporter{escape: true, now: func() time.Time { return time.Unix(0, 0) }}
+	out := &bytes.Buffer{}
+	er.print(out, errScopeFile, "0", "evil\x1b]0;title\x07", errors.New("open evil\x1b]0;title\x07: denied"))
+	expected := `1970-01-01T00:00:00Z error scope=file class=UNKNOWN worker=0 path='evil\x1b]0;title\x07': open evil\x1b]0;title\x07: denied` + "\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+}
+
+// Test the entries longer than the scanner buffer are rejected alone, with or without a maximum length
+func TestListGuardHugeEntry(t *testing.T) {
+	huge := strings.Repeat("x", 3<<20)
+	for _, nulSeparated := range []bool{false, true} {
+		sep := "\n"
+		if nulSeparated {
+			sep = "\x00"
+		}
+		list := "ok1" + sep + huge + sep + "ok2" + sep + huge
+		paths, errs, res := listRun(t, list, listGuard{maxLen: 4096}, nulSeparated)
+		if strings.Join(paths, " ") != "ok1 ok2" || res != (InputResult{Enqueued: 2}) {
+			t.Errorf("-0=%t: got %q %+v", nulSeparated, paths, res)
+		}
+		for _, line := range []string{"2", "4"} {
+			expected := fmt.Sprintf("list line %s: entry too long: %d bytes, more than 4096", line, len(huge))
+			if !strings.Contains(errs, expected) {
+				t.Errorf("-0=%t: missing %q in %q", nulSeparated, expected, errs)
+			}
+		}
+
+		paths, errs, res = listRun(t, list, listGuard{}, nulSeparated)
+		if len(paths) != 4 || len(paths[1]) != len(huge) || res != (InputResult{Enqueued: 4}) || errs != "" {
+			t.Errorf("-0=%t: got %d paths %+v %q, expected the huge entries queued unlimited", nulSeparated, len(paths), res, errs)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Input list line grammar, the hints are separated from the path by a tab since paths may contain spaces:
+//
+//	line  = [ordinal TAB] path [TAB hints]
+//	hints = hint *(" " hint)
+//	hint  = key "=" value
+//
+// Known keys are size, the declared size in bytes, and tier, a storage tier name limited by -tier-jobs.
+// Unknown keys are ignored, malformed hints are reported and skipped while the path is queued anyway.
+// A line without a tab after the path is a plain path as before, spaces included.
+
+// Hints are the optional per path hints of the input list
+type Hints struct {
+	Size    uint64 // declared size, valid with HasSize
+	HasSize bool
+	Tier    string // storage tier, "" when not given
+}
+
+// splitHints splits the optional hints following the path of a list line
+func splitHints(line string) (string, string) {
+	path, hints, _ := strings.Cut(line, "\t")
+	return path, hints
+}
+
+// parseHints parses what it can, returning an error per malformed hint
+func parseHints(s string) (Hints, []error) {
+	var hints Hints
+	var errs []error
+	for _, hint := range strings.Fields(s) {
+		key, value, ok := strings.Cut(hint, "=")
+		if !ok || key == "" {
+			errs = append(errs, fmt.Errorf("malformed hint %q", hint))
+			continue
+		}
+		switch key {
+		case "size":
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("malformed size hint %q", value))
+				continue
+			}
+			hints.Size, hints.HasSize = size, true
+		case "tier":
+			if value == "" {
+				errs = append(errs, errors.New("empty tier hint"))
+				continue
+			}
+			hints.Tier = value
+		}
+	}
+	return hints, errs
+}
+
+// parseTierJobs parses the "tier=jobs,..." value of -tier-jobs
+func parseTierJobs(s string) (map[string]int, error) {
+	tierJobs := make(map[string]int)
+	for _, field := range strings.Split(s, ",") {
+		tier, value, ok := strings.Cut(field, "=")
+		jobs, err := strconv.Atoi(value)
+		if !ok || tier == "" || err != nil || jobs < 1 {
+			return nil, fmt.Errorf("malformed tier jobs %q, expected tier=jobs", field)
+		}
+		tierJobs[tier] = jobs
+	}
+	return tierJobs, nil
+}
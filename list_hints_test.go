@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseHints(t *testing.T) {
+	tests := []struct {
+		line   string
+		path   string
+		hints  Hints
+		errors int
+	}{
+		{"/a b/c", "/a b/c", Hints{}, 0},
+		{"/a b/c size=12", "/a b/c size=12", Hints{}, 0}, // no tab, the path has a space
+		{"/a\tsize=12345 tier=cold", "/a", Hints{Size: 12345, HasSize: true, Tier: "cold"}, 0},
+		{"/a\t tier=hot  owner=x ", "/a", Hints{Tier: "hot"}, 0},
+		{"/a\t", "/a", Hints{}, 0},
+		{"/a\tsize=big tier=cold", "/a", Hints{Tier: "cold"}, 1},
+		{"/a\tsize=-1 junk =x tier=", "/a", Hints{}, 4},
+	}
+	for _, test := range tests {
+		path, text := splitHints(test.line)
+		hints, errs := parseHints(text)
+		if path != test.path || hints != test.hints || len(errs) != test.errors {
+			t.Errorf("%q: got %q %+v %v, expected %q %+v and %d errors", test.line, path, hints, errs, test.path, test.hints, test.errors)
+		}
+	}
+}
+
+func TestParseTierJobs(t *testing.T) {
+	tierJobs, err := parseTierJobs("cold=2,hot=8")
+	if err != nil || len(tierJobs) != 2 || tierJobs["cold"] != 2 || tierJobs["hot"] != 8 {
+		t.Errorf("got %v, %v", tierJobs, err)
+	}
+	for _, bad := range []string{"", "cold", "cold=0", "=2", "cold=x", "cold=2,"} {
+		if _, err := parseTierJobs(bad); err == nil {
+			t.Errorf("%q must be rejected", bad)
+		}
+	}
+}
+
+func TestReadFileListHints(t *testing.T) {
+	debugOut := &bytes.Buffer{}
+	var items []QueueItem
+	var mu sync.Mutex
+	setup := func(mc *MassCRC32C) {
+		mc.stdin = strings.NewReader("3\ttest_data.txt\tsize=7 tier=cold\ntest_data.txt\tsize=x\ntest_data.txt\n")
+		mc.DebugOut = debugOut
+		mc.HandlerFunc = func(item QueueItem) error {
+			mu.Lock()
+			items = append(items, item)
+			mu.Unlock()
+			return nil
+		}
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.ReadFileList()
+	})
+
+	if len(items) != 3 {
+		t.Fatalf("got %+v", items)
+	}
+	if items[0].Path != "test_data.txt" || items[0].Ordinal != "3" || items[0].Hints != (Hints{Size: 7, HasSize: true, Tier: "cold"}) {
+		t.Errorf("got %+v", items[0])
+	}
+	if items[1].Path != "test_data.txt" || items[1].Hints != (Hints{}) || items[2].Path != "test_data.txt" {
+		t.Errorf("got %+v", items[1:])
+	}
+	if !strings.Contains(debugOut.String(), `warning: list line 2: malformed size hint "x", ignored`) {
+		t.Errorf("expected a parse warning, got %q", debugOut)
+	}
+}
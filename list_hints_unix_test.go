@@ -0,0 +1,58 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fifoReaders opens the fifos having a reader waiting for a writer, their reads then block until closed
+func fifoReaders(fifos []string) []*os.File {
+	var writers []*os.File
+	for _, fifo := range fifos {
+		if f, err := os.OpenFile(fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			writers = append(writers, f)
+		}
+	}
+	return writers
+}
+
+func TestTierJobs(t *testing.T) {
+	dir := t.TempDir()
+	var fifos []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		fifo := filepath.Join(dir, name)
+		if err := syscall.Mkfifo(fifo, 0644); err != nil {
+			t.Skipf("no fifo support: %v", err)
+		}
+		fifos = append(fifos, fifo)
+	}
+	setup := func(mc *MassCRC32C) {
+		mc.LimitTierJobs(map[string]int{"cold": 2})
+	}
+	mc := runPipeline(t, 5, setup, func(mc *MassCRC32C) {
+		for _, fifo := range fifos {
+			mc.EnqueueItem(QueueItem{Path: fifo, Hints: Hints{Tier: "cold"}})
+		}
+		mc.EnqueueItem(QueueItem{Path: "test_data.txt", Hints: Hints{Tier: "hot"}})
+
+		deadline := time.Now().Add(5 * time.Second)
+		for mc.fileCount.Load() < uint64(len(fifos)+1) && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond) // let the allowed workers open their fifo
+			writers := fifoReaders(fifos)
+			if len(writers) > 2 {
+				t.Fatalf("%d concurrent cold reads, expected at most 2", len(writers))
+			}
+			for _, w := range writers {
+				w.Close()
+			}
+		}
+	})
+	if mc.fileCount.Load() != uint64(len(fifos)+1) {
+		t.Errorf("got %d files, expected %d", mc.fileCount.Load(), len(fifos)+1)
+	}
+}
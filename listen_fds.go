@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// sd_listen_fds protocol: the sockets passed by systemd start at fd 3
+const listenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation, none without activation.
+// LISTEN_PID must be this process, the variables are unset so child processes do not inherit them.
+func systemdListeners() ([]net.Listener, error) {
+	return inheritedListeners(listenFDsStart)
+}
+
+func inheritedListeners(firstFD int) ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil // meant for another process
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	return fdListeners(firstFD, count)
+}
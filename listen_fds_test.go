@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestInheritedListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File() // a dup standing for the fd passed by systemd
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	listeners, err := inheritedListeners(int(f.Fd()))
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("sockets of another process must be ignored, got %v, %v", listeners, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("the variables must be unset")
+	}
+
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listeners, err = inheritedListeners(int(f.Fd()))
+	if err != nil || len(listeners) != 1 {
+		t.Fatalf("expected 1 listener, got %v, %v", listeners, err)
+	}
+	defer listeners[0].Close()
+	if listeners[0].Addr().String() != l.Addr().String() {
+		t.Errorf("got %s, expected %s", listeners[0].Addr(), l.Addr())
+	}
+	if os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "" {
+		t.Error("the variables must be unset")
+	}
+
+	listeners, err = inheritedListeners(int(f.Fd()))
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("no activation expected without the variables, got %v, %v", listeners, err)
+	}
+}
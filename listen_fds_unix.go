@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+func fdListeners(firstFD int, count int) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for fd := firstFD; fd < firstFD+count; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("listen-fd-%d", fd))
+		l, err := net.FileListener(f) // works on a dup, systemd keeps its own copy too
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket activation fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
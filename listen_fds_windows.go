@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// no socket activation on windows
+func fdListeners(firstFD int, count int) ([]net.Listener, error) {
+	return nil, nil
+}
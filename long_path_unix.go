@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+func longPath(path string) string {
+	return path
+}
+
+func walkRoot(root string) string {
+	return root
+}
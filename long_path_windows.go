@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MAX_PATH is 260 with the drive and the final NUL, leave room for the file names joined by the walker
+const longPathThreshold = 240
+
+// longPath returns the extended-length form of a long path for the open calls,
+// the prefix disables the path normalization so the path is absolutized and cleaned first
+func longPath(path string) string {
+	if len(path) < longPathThreshold || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// walkRoot returns the form of root to walk: the runtime only extends absolute long paths,
+// relative roots are walked absolutized
+func walkRoot(root string) string {
+	if filepath.IsAbs(root) {
+		return root
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return root
+	}
+	return abs
+}
@@ -0,0 +1,86 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	short := `C:\data\file`
+	if got := longPath(short); got != short {
+		t.Errorf("short path changed to %s", got)
+	}
+	unc := `\\server\share\` + strings.Repeat(`d\`, 130) + "file"
+	if got := longPath(unc); got != `\\?\UNC\server\share\`+strings.Repeat(`d\`, 130)+"file" {
+		t.Errorf("got %s", got)
+	}
+	drive := `C:\` + strings.Repeat(`d\`, 130) + "file"
+	if got := longPath(drive); got != `\\?\`+drive {
+		t.Errorf("got %s", got)
+	}
+	if got := longPath(`\\?\` + drive); got != `\\?\`+drive {
+		t.Errorf("prefixed path changed to %s", got)
+	}
+}
+
+// deepTree creates a file nested deeper than MAX_PATH under dir, returning its path relative to dir
+func deepTree(t *testing.T, dir string) string {
+	rel := "file"
+	for len(rel) < 300 {
+		rel = filepath.Join("directory_name_segment", rel)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, rel), []byte("deep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rel
+}
+
+func TestLongPathChecksum(t *testing.T) {
+	dir := t.TempDir()
+	rel := deepTree(t, dir)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	mc := InitMassCRC32C(1, 1)
+	for _, path := range []string{rel, filepath.Join(dir, rel)} {
+		err, size, _ := mc.pathToCRC(path, "0")
+		if err != nil || size != 4 {
+			t.Errorf("%d chars path: %v, size %d", len(path), err, size)
+		}
+	}
+}
+
+func TestLongPathWalk(t *testing.T) {
+	dir := t.TempDir()
+	rel := deepTree(t, dir)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+	}
+	root := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.WalkDirectories([]string{root})
+	})
+	if errOut.Len() != 0 || !strings.HasSuffix(out.String(), " 4 "+rel+"\n") {
+		t.Errorf("expected the relative path in the output, got %q, errors %q", out, errOut)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	lowMemoryReadSize      = 64      // kbytes
+	lowMemoryLargeFileSize = 1 << 30 // bytes
+	lowMemoryLargeFileJobs = 1
+	lowMemoryFreeOSMemory  = 30 * time.Second
+)
+
+// lowMemoryConfig bounds the memory of a run and the page cache it leaves behind
+type lowMemoryConfig struct {
+	readSize      int           // size of reads in kbytes
+	dropPageCache bool          // advise the kernel to drop the cached pages of each file once read
+	largeFileSize uint64        // size from which a file counts against largeFileJobs
+	largeFileJobs int           // concurrent reads of large files
+	freeOSMemory  time.Duration // period of the debug.FreeOSMemory calls
+}
+
+// lowMemoryPreset is the configuration of -low-memory, readSize is only ever lowered
+func lowMemoryPreset(readSize int) lowMemoryConfig {
+	if readSize > lowMemoryReadSize {
+		readSize = lowMemoryReadSize
+	}
+	return lowMemoryConfig{
+		readSize:      readSize,
+		dropPageCache: dropPageCacheSupported,
+		largeFileSize: lowMemoryLargeFileSize,
+		largeFileJobs: lowMemoryLargeFileJobs,
+		freeOSMemory:  lowMemoryFreeOSMemory,
+	}
+}
+
+func (c lowMemoryConfig) String() string {
+	return fmt.Sprintf(
+		"read size %dKB, drop page cache %t, %d concurrent reads of files from %d bytes, FreeOSMemory every %s",
+		c.readSize, c.dropPageCache, c.largeFileJobs, c.largeFileSize, c.freeOSMemory,
+	)
+}
+
+// acquireLargeFile blocks while largeFileJobs large files are being read, the size class is the one of
+// the size of the open file, a file of unknown size is not limited. The returned function releases the slot.
+func (mc *MassCRC32C) acquireLargeFile(size int64) func() {
+	if mc.largeFileSlots == nil || size < 0 || uint64(size) < mc.lowMemory.largeFileSize {
+		return func() {}
+	}
+	mc.largeFileSlots <- struct{}{}
+	return func() { <-mc.largeFileSlots }
+}
+
+// freeOSMemoryLoop returns the freed heap to the OS every period until stop is closed
+func freeOSMemoryLoop(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			debug.FreeOSMemory()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+const dropPageCacheSupported = true
+
+// dropPageCache advises the kernel the cached pages of a file read once are not needed anymore
+func dropPageCache(fd uintptr) error {
+	return unix.Fadvise(int(fd), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+const dropPageCacheSupported = false
+
+func dropPageCache(fd uintptr) error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLowMemoryPreset(t *testing.T) {
+	tests := []struct {
+		name     string
+		readSize int
+		expected lowMemoryConfig
+	}{
+		{"default read size kept", 1, lowMemoryConfig{1, dropPageCacheSupported, 1 << 30, 1, 30 * time.Second}},
+		{"large read size lowered", 1024, lowMemoryConfig{64, dropPageCacheSupported, 1 << 30, 1, 30 * time.Second}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cfg := lowMemoryPreset(test.readSize); cfg != test.expected {
+				t.Errorf("got %+v, expected %+v", cfg, test.expected)
+			}
+		})
+	}
+}
+
+// Test a run with the preset gives the same CRC
+func TestLowMemoryPathToCRC(t *testing.T) {
+	mc := InitMassCRC32C(1024, 1)
+	cfg := lowMemoryPreset(1024)
+	cfg.largeFileSize = 1 // every file holds the single slot
+	mc.EnableLowMemory(cfg)
+	err, fileSize, crc := mc.pathToCRC("test_data.txt", "0")
+	if err != nil || crc != "WaIfQg==" || fileSize != 3538 {
+		t.Errorf("got %v %d %s, expected WaIfQg== of 3538 bytes", err, fileSize, crc)
+	}
+	if len(mc.largeFileSlots) != 0 {
+		t.Errorf("large file slot not released")
+	}
+	if mc.readSizeG != 64 {
+		t.Errorf("got read size %d, expected 64", mc.readSizeG)
+	}
+}
@@ -2,91 +2,884 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
-func printUsage() {
-	fmt.Fprintf(
-		os.Stderr,
-		"Usage of %s: [options] [path ...]\n%s recurses over paths provided as arguments or gets the file list form stdin otherwize\nOptions:\n",
-		os.Args[0],
-		os.Args[0],
-	)
-	flag.PrintDefaults()
+// openOutFile opens path for writing, through a gzip stream when compressJobs is set,
+// compressed by compressJobs goroutines when more than 1.
+// The returned close function flushes and closes everything.
+func openOutFile(path string, compressJobs int, debugOut io.Writer) (io.Writer, func(), error) {
+	return openSummedOutFile(path, compressJobs, debugOut, nil)
 }
 
-func main() {
-	p := flag.Int("p", 1, "# of cpu used")
-	jobCountP := flag.Int("j", 1, "# of parallel reads")
-	listQueueLength := flag.Int("l", 100, "size of list ahead queue")
-	readSizeP := flag.Int("s", 1, "size of reads in kbytes")
-	outFile := flag.String("out", "", "write CRC to file")
-	outErr := flag.String("errout", "", "write errors to file")
-	compress := flag.Bool("c", false, "enable file output compression")
-	flag.Usage = printUsage
-
-	flag.Parse()
+// openSummedOutFile is openOutFile computing in sum the CRC-32C of the bytes written to the file when not nil,
+// the file is then synced before being closed
+func openSummedOutFile(path string, compressJobs int, debugOut io.Writer, sum *summedWriter) (io.Writer, func(), error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fw io.Writer = f
+	closeFile := func() { f.Close() }
+	if sum != nil {
+		sum.w = f
+		fw = sum
+		closeFile = func() {
+			if err := f.Sync(); err != nil {
+				fmt.Fprintf(debugOut, "Error: failed to sync %s: %v\n", path, err)
+			}
+			f.Close()
+		}
+	}
+	if compressJobs == 0 {
+		return fw, closeFile, nil
+	}
+	if compressJobs > 1 {
+		pw := newParallelGzipWriter(fw, compressJobs, parallelGzipBlockSize)
+		return pw, func() {
+			if err := pw.Close(); err != nil {
+				fmt.Fprintf(debugOut, "Error: failed to write gzip stream: %v", err)
+			}
+			closeFile()
+		}, nil
+	}
+	gzWriter := gzip.NewWriter(fw)
+	return gzWriter, func() {
+		err := gzWriter.Flush()
+		if err != nil {
+			fmt.Fprintf(debugOut, "Error: failed to flush gzip stream: %v", err)
+		}
+		err = gzWriter.Close()
+		if err != nil {
+			fmt.Fprintf(debugOut, "Error: failed to close gzip stream: %v", err)
+		}
+		closeFile()
+	}, nil
+}
 
-	runtime.GOMAXPROCS(*p) // limit number of kernel threads (CPUs used)
+// defineCompute registers the flags of compute in fs. Its run function returns the exit code once the
+// deferred outputs are closed: 2 on a setup error, 3 when the input or the -worker connection to the
+// coordinator stopped on an error, 130 when
+// interrupted, 1 when -strict-types found non-regular files, a file did not match the expected CRC of
+// its -input json job, the manifests of -diff differ, an object of -compose-verify does not match or
+// -strict-accounting found records missing, 4 when
+// -publish failed
+func defineCompute(fs *flag.FlagSet, shared *sharedFlags) func(args []string, sources map[string]configSource) int {
+	jobCountP := fs.Int("j", 1, "# of parallel reads")
+	listQueueLength := fs.Int("l", 100, "size of list ahead queue")
+	readSizeP := fs.Int("s", 1, "size of reads in kbytes")
+	algo := fs.String("algo", algoCRC32C, "digest written in the records: crc32c, md5, the MD5 of the GCS non-composite objects, base64 encoded like gsutil, sha256, in lowercase hex like sha256sum, xxh64, the xxHash64 in lowercase hex like xxhsum for local dedup scans, or blake3, the BLAKE3 in lowercase hex like b3sum, with -s 64 a sensible read size; a comma separated list computes them in one read pass, one column or jsonl field each in order; other than crc32c alone, not with -format binary")
+	poly := fs.String("poly", polyCastagnoli, "CRC-32 polynomial: castagnoli, the CRC-32C of GCS, or ieee, the CRC-32 of zip, gzip and legacy archive tools, named in a header line of the text records, the crc32 field of jsonl and column of csv")
+	enc := fs.String("enc", encBase64, "encoding of the CRCs in the records, chunk records and edge digests: base64, like gsutil, hex, 8 lowercase hex digits, or base64url, 6 characters of the URL safe alphabet without padding; the manifests and expected CRCs read are accepted in any")
+	crcPoly := fs.String("crc-poly", "", "compute a custom CRC-32 of this normal form polynomial, e.g. 0x04C11DB7, instead of CRC-32C")
+	crcInit := fs.String("crc-init", "0xFFFFFFFF", "with -crc-poly, the initial register value")
+	crcReflect := fs.Bool("crc-reflect", true, "with -crc-poly, process the bytes and give the result least significant bit first")
+	crcXorOut := fs.String("crc-xorout", "0xFFFFFFFF", "with -crc-poly, the value xored with the result")
+	lowMemory := fs.Bool("low-memory", false, "bound the memory and the page cache used: smaller reads, page cache dropped after each file (Linux), one large file read at a time and periodic FreeOSMemory")
+	minFreeSpace := fs.String("min-free-space", "1G", "with -out, warn when the filesystem of the output has less free space, checked every few minutes, e.g. 500M or 2G, 0 to not check")
+	pauseOnLowSpace := fs.Bool("pause-on-low-space", false, "with -out, hold the output and so the reads while the free space is below -min-free-space instead of failing once full")
+	publish := fs.String("publish", "", "after a successful run, upload -out to this gs://bucket/object, the object named after -out when ending with /, with retries, verifying the CRC32C of the object against the bytes written, exit code 4 when it fails; authenticated with GOOGLE_OAUTH_ACCESS_TOKEN or the GCE metadata server, or none with STORAGE_EMULATOR_HOST")
+	outErr := fs.String("errout", "", "write errors to file")
+	dirErrOut := fs.String("direrrout", "", "write the directory listing and walk errors to file instead of -errout")
+	errFormat := fs.String("errformat", "text", "format of the errors: text or json")
+	progressMarkers := fs.Uint64("progress-markers", 0, "write a \"# progress files=X bytes=Y ts=T\" line to the output after every N records and after the last one")
+	statFieldsP := fs.String("stat-fields", "", "comma separated stat fields written after a tab following the path of the text records: nlink, inode (the file index on windows), 0 where unsupported, or btime, the birth time of statx on Linux and of stat on macOS, empty where unsupported; the summary reports the computed data unique by inode")
+	format := fs.String("format", "text", "format of the records of -out and -out-clean: text, jsonl, a JSON object per line also making -errformat json by default, csv, without the list ordinals, binary, compact and without the list ordinals, or sfv, the path and IEEE CRC-32 in hex of the SFV tools, implying -poly ieee -enc hex")
+	csvHeader := fs.Bool("header", false, "with -format csv, write a column names row first")
+	schemaHeader := fs.Bool("schema-header", true, "with -format csv or jsonl, start the output with a \"# schema=N format=F cols=C,...\" comment line declaring the columns of the records, mapped by it when the output is read back as a manifest; -schema-header=false for the readers not skipping comment lines")
+	outClean := fs.String("out-clean", "", "also write to file the CRC of the files read without error in this run, not the ones carried forward by -since")
+	outIndexed := fs.String("out-indexed", "", "also write CRC to file as a path sorted indexed manifest")
+	sqlitePath := fs.String("sqlite", "", "also write CRC to the files table of a SQLite database, updating known paths")
+	sqliteBatch := fs.Int("sqlite-batch", defaultSQLiteBatch, "# of rows per -sqlite transaction")
+	sqliteRunID := fs.String("sqlite-run-id", "", "run_id of the -sqlite rows, the start time by default")
+	sqliteOnly := fs.Bool("sqlite-only", false, "with -sqlite, do not write the text output")
+	chunkManifest := fs.String("chunk-manifest", "", "also write the CRC of every chunk of this size (e.g. 1G) of the files to -chunk-out")
+	chunkOut := fs.String("chunk-out", "", "write the -chunk-manifest records to file")
+	fingerprint := fs.Bool("fingerprint", false, "print a fingerprint of all the paths, CRC and sizes in the summary")
+	fingerprintExact := fs.Bool("fingerprint-exact", false, "with -fingerprint, sort the full paths on disk instead of path hashes in memory")
+	eventsFile := fs.String("events", "", "write a DONE line to file when all files directly under a walked directory are processed")
+	eventsRecursive := fs.Bool("events-recursive", false, "with -events, a directory is DONE only when its sub directories are DONE")
+	prioritySpool := fs.String("priority-spool", "", "follow this existing file and checksum the paths appended to it, a line each, ahead of the queued ones, their results echoed to the debug output as soon as computed, e.g. echo /data/f >> spool for an auditor waiting on a long run")
+	coordinatorAddr := fs.String("coordinator", "", "listen on address for workers and distribute them the paths")
+	workerAddr := fs.String("worker", "", "process the paths distributed by the coordinator at address")
+	batchSize := fs.Int("batch", 1000, "# of paths per batch sent to workers")
+	ordered := fs.Bool("ordered", false, "write CRC in the order paths are listed or walked, the list order whatever the ordinals: sort the list by ordinal for the ordinal order")
+	orderedWindow := fs.Int("ordered-window", defaultOrderedWindow, "with -ordered, # of results held waiting for a slower file before pausing the input")
+	shuffle := fs.Bool("shuffle", false, "read the paths listed or walked in a random order within a window of -l paths, to spread the reads of a directory over the shards of an object-backed filesystem")
+	shuffleSeed := fs.Int64("shuffle-seed", 0, "with -shuffle, the seed of the order, the same seed giving the same order for the same paths with -j 1, a random one printed at start when 0")
+	sinceManifest := fs.String("since", "", "write the CRC of a previous manifest for files unchanged since its run instead of reading them")
+	strictParse := fs.Bool("strict-parse", false, "fail on malformed manifest lines instead of skipping them")
+	sinceTime := fs.String("since-time", "", "start time of the -since manifest run in RFC3339 when it has no header")
+	strictTypesP := fs.Bool("strict-types", false, "report non-regular files found while walking as errors instead of ignoring them")
+	strictSymlinks := fs.Bool("strict-types-include-symlinks", false, "with -strict-types, report symlinks too")
+	growingFiles := fs.String("growing-files", "follow", "files whose size changes while read: follow reads up to EOF, truncate reads up to the size at open, error fails them; a file shrinking below its size at open fails unless follow")
+	skipBadBlocks := fs.Bool("skip-bad-blocks", false, "step over the ranges of the files failing to read with an I/O error instead of failing them, the partial records are flagged with a badblocks field and reported on the error output")
+	badBlockSize := fs.String("bad-block-size", "4K", "with -skip-bad-blocks, a failed read resumes at the next multiple of this size")
+	badBlockFill := fs.String("bad-block-fill", "zeros", "with -skip-bad-blocks, zeros hashes zeros in place of the unreadable ranges, skip leaves them out")
+	edgeDigest := fs.String("edge-digest", "", "also write the CRC of the first and last N bytes, like 64K, of the regular files in head and tail fields to triage a mismatch, the CRC of the whole file in both below 2N bytes; the expected_head_crc32c and expected_tail_crc32c of the -input json jobs are verified first")
+	tierJobs := fs.String("tier-jobs", "", "comma separated tier=jobs limiting the parallel reads of the list paths with a tier hint")
+	dirRetry := fs.Int("dir-retry", 0, "walk the directories failing as not found or with an I/O error while their parent exists again up to N times after the walk of their root")
+	dirRetryDelay := fs.Duration("dir-retry-delay", 2*time.Second, "with -dir-retry, wait before each retry pass")
+	bigDirStreaming := fs.Bool("big-dir-streaming", false, "read the directories by batches of 10000 entries, walking the larger ones unsorted, to bound the memory with directories of millions of entries")
+	walkRate := fs.Float64("walk-rate", 0, "pace the walk to at most N directory listings per second to spare the metadata servers, unlimited when 0")
+	walkPauseOnErrors := fs.Bool("walk-pause-on-errors", false, "pause the walk after 3 consecutive directory errors, 500ms doubling with every further one up to 30s, until a file is listed again")
+	var excludes stringsFlag
+	fs.Var(&excludes, "exclude", "skip the files and prune the directories whose base name or path relative to the walked root, or path as listed, matches this glob pattern, e.g. *.tmp or node_modules, repeatable")
+	var includes stringsFlag
+	fs.Var(&includes, "include", "only compute the walked regular files whose base name or path relative to the walked root matches this glob pattern, e.g. *.parquet, counting the others as ignored, directories are still walked and -exclude wins, the listed paths are not filtered, repeatable")
+	var excludeRes, includeRes stringsFlag
+	fs.Var(&excludeRes, "exclude-re", "like -exclude with a regular expression matched against the full path as walked or listed, e.g. '/(tmp|cache)/', repeatable and OR-ed")
+	fs.Var(&includeRes, "include-re", "like -include with a regular expression matched against the full path as walked or listed, e.g. '\\.(parquet|orc)$', repeatable and OR-ed with -include, the listed paths are filtered by the expressions alone")
+	maxDepth := fs.Int("maxdepth", 0, "like find -maxdepth, only walk N levels below each root: the files N levels down are computed, the directories there are not entered, unlimited when 0")
+	minSize := fs.String("minsize", "", "only compute the files of at least this size, like 1G, counting the others as size filtered, -minsize 1 leaves the empty files out")
+	maxSize := fs.String("maxsize", "", "only compute the files of at most this size, like 100M, counting the others as size filtered, -maxsize 0 keeps the empty files only")
+	keepEmpty := fs.Bool("keep-empty", false, "with -minsize or -maxsize, also compute the empty files")
+	newerThan := fs.String("newer-than", "", "only compute the files modified after this RFC3339 timestamp, like 2024-06-17T00:00:00Z, or after the file named, like the -out of the last run, counting the others as skipped")
+	olderThan := fs.String("older-than", "", "only compute the files modified before this RFC3339 timestamp or the file named, counting the others as skipped")
+	skipHidden := fs.Bool("skip-hidden", false, "prune the directories and ignore the files whose name starts with a dot while walking, the roots excepted, and ignore the listed paths with such a component")
+	fifoTimeout := fs.Duration("fifo-timeout", 0, "give up the named pipes given as roots or listed, like the <(...) of a shell, not closed by their writers within this duration, no limit when 0; the pipes found by the walk are ignored")
+	xdev := fs.Bool("xdev", false, "like find -xdev, do not enter the directories on another file system than their root, like /proc or the network mounts under /, counting them in the summary")
+	followLinks := fs.Bool("L", false, "follow the symlinks to files and directories while walking, the directories reached again through a symlink are reported once and not walked again, the dangling symlinks are file errors")
+	allowOverlap := fs.Bool("allow-overlap", false, "walk the roots nested in another root again instead of skipping them, always done with -maxdepth, -exclude, -exclude-re, -skip-hidden, -xdev or -skip-snapshot-dirs")
+	skipSnapshotDirs := fs.Bool("skip-snapshot-dirs", false, "prune snapshot directories ("+strings.Join(defaultSnapshotDirNames, ", ")+") while walking")
+	snapshotDirNames := fs.String("snapshot-dir-names", "", "comma separated extra snapshot directory names for -skip-snapshot-dirs")
+	recordFile := fs.String("record", "", "write the walk events and the results to file, for -replay")
+	replayFile := fs.String("replay", "", "replay the walk events and the results of a -record file instead of reading the files")
+	errorCache := fs.String("error-cache", "", "prune the directories denied in previous runs using this cache file, and add the denied ones")
+	errorCacheAge := fs.Duration("error-cache-age", defaultErrorCacheAge, "with -error-cache, walk a denied directory again after this duration")
+	retryDenied := fs.Bool("retry-denied", false, "with -error-cache, walk the cached denied directories again")
+	strictAccounting := fs.Bool("strict-accounting", false, "exit 1 when the records written differ from the files counted, a record lost or failing to be written, reported on the debug output in any case")
+	extendedSummary := fs.Bool("x", false, "print an extended summary")
+	estimateCompression := fs.Bool("estimate-compression", false, "with -x, estimate the compression ratio of the data, overall and per extension, from a flate level 1 trial of some of the buffers read, taking at most 5% more CPU")
+	compressionSample := fs.Uint64("compression-sample", 64, "with -estimate-compression, try to compress one in N buffers read")
+	composeVerify := fs.String("compose-verify", "", "verify the composite CRC32C of the GCS composite objects of this spec, a JSON object per object: {\"object\", \"path\", \"crc32c\" of the object metadata, \"components\": [{\"size\", optional \"crc32c\"}, ...] in the order composed}, against the CRCs of the -chunk-out manifest given as argument, the chunks of the path combined, instead of reading files: write a match or mismatch line per object, exit 1 when one does not match or cannot be verified")
+	diff := fs.Bool("diff", false, "compare the two manifests given as arguments instead of reading files: write the paths only in the first one, only in the second one and the changed ones, prefixed with only-a, only-b and changed, exit 1 when they differ")
+	inputFormat := fs.String("input", "text", "format of the file list: text, a path per line, or json, a stream or an array of {\"path\", \"expected_crc32c\", \"label\"} objects whose expected CRC is verified, a mismatch being a MISMATCH error, and whose label object is written in the records of -format jsonl, the default then, or csv")
+	readStdin := fs.Bool("stdin", false, "read the file list from stdin even with paths as arguments, before walking them")
+	var filesFrom stringsFlag
+	fs.Var(&filesFrom, "files-from", "read the file list from this file instead of stdin, - for stdin, decompressing it when named *.gz, before walking the paths given as arguments; repeatable, the lists are read in turn")
+	nulRecords := fs.Bool("z", false, "end the records of -format text, jsonl or csv, their header, the progress markers and the error records with a NUL instead of a newline, for xargs -0 and the like with the file names with newlines")
+	nulSeparated := fs.Bool("0", false, "the entries of the stdin file list end with a NUL instead of a newline, like the output of find -print0, for the file names with newlines; the empty entries are skipped")
+	maxPathLen := fs.Int("max-path-len", 4096, "reject the entries of the stdin text list longer than N bytes, unlimited when 0; the entries holding a NUL are always rejected")
+	allowNewlines := fs.Bool("allow-newlines", false, "keep the entries of the stdin -0 list holding a newline or carriage return instead of rejecting them")
+	strictInput := fs.Bool("strict-input", false, "stop the input with exit code 3 at the first rejected entry of the stdin list instead of reporting and skipping it")
+	escapeControls := fs.Bool("escape-controls", false, "escape the control characters and backslashes of the paths and errors of the text error records as \\xNN and \\\\, the files are opened and recorded with their raw names")
+	for _, register := range buildFlags {
+		register(fs)
+	}
 
-	mc := InitMassCRC32C(*readSizeP, *listQueueLength)
-	if *outFile != "" {
-		f, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE, 0644)
+	return func(args []string, sources map[string]configSource) int {
+		mc := InitMassCRC32C(*readSizeP, *listQueueLength)
+		mc.HandleSignals()
+		mc.ExtendedSummary = *extendedSummary
+		if *lowMemory {
+			cfg := lowMemoryPreset(*readSizeP)
+			mc.EnableLowMemory(cfg)
+			fmt.Fprintf(mc.DebugOut, "low memory: %s\n", cfg)
+		}
+		switch *errFormat {
+		case "text":
+		case "json":
+			mc.SetJSONErrors(true)
+		default:
+			fmt.Fprintf(os.Stderr, "error: unknown -errformat %s\n", *errFormat)
+			return 2
+		}
+		if *format == "sfv" {
+			for _, conflict := range []struct {
+				name string
+				set  bool
+			}{
+				{"algo " + *algo, *algo != algoCRC32C},
+				{"poly " + *poly, *poly != polyIEEE && sources["poly"] != sourceDefault},
+				{"enc " + *enc, *enc != encHex && sources["enc"] != sourceDefault},
+				{"crc-poly", *crcPoly != ""},
+				{"chunk-manifest", *chunkManifest != ""},
+				{"sqlite", *sqlitePath != ""},
+				{"stat-fields", *statFieldsP != ""},
+				{"edge-digest", *edgeDigest != ""},
+				{"skip-bad-blocks", *skipBadBlocks},
+				{"progress-markers", *progressMarkers > 0},
+			} {
+				if conflict.set {
+					fmt.Fprintf(os.Stderr, "error: -format sfv writes the IEEE CRC-32 alone in hex, not with -%s\n", conflict.name)
+					return 2
+				}
+			}
+			*poly = polyIEEE
+			*enc = encHex
+		}
+		algos, err := parseAlgos(*algo)
 		if err != nil {
-			os.Exit(2)
+			fmt.Fprintf(os.Stderr, "error: bad -algo: %v\n", err)
+			return 2
 		}
-		defer f.Close()
-		if *compress {
-			gzWriter := gzip.NewWriter(f)
-			defer func(gzWriter *gzip.Writer) {
-				err := gzWriter.Flush()
-				if err != nil {
-					fmt.Fprintf(mc.DebugOut, "Error: failed to flush gzip stream: %v", err)
+		mc.SetAlgos(algos...)
+		if !mc.plainCRC() {
+			for _, crcOnly := range []struct {
+				name string
+				set  bool
+			}{
+				{"crc-poly", *crcPoly != ""},
+				{"poly " + *poly, *poly != polyCastagnoli},
+				{"format " + *format, *format == "binary"},
+				{"input json", *inputFormat == "json"},
+				{"since", *sinceManifest != ""},
+				{"chunk-manifest", *chunkManifest != ""},
+				{"fingerprint", *fingerprint},
+			} {
+				if crcOnly.set {
+					fmt.Fprintf(os.Stderr, "error: -%s needs the CRC alone, not -algo %s\n", crcOnly.name, *algo)
+					return 2
 				}
-				err = gzWriter.Close()
-				if err != nil {
-					fmt.Fprintf(mc.DebugOut, "Error: failed to close gzip stream: %v", err)
+			}
+		}
+		polyParams, err := parsePoly(*poly)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: bad -poly: %v\n", err)
+			return 2
+		}
+		if polyParams != castagnoliParams {
+			for _, castagnoliOnly := range []struct {
+				name string
+				set  bool
+			}{
+				{"crc-poly", *crcPoly != ""},
+				{"chunk-manifest", *chunkManifest != ""},
+				{"format binary", *format == "binary"},
+				{"sqlite", *sqlitePath != ""},
+			} {
+				if castagnoliOnly.set {
+					fmt.Fprintf(os.Stderr, "error: -%s needs the CRC-32C, not -poly %s\n", castagnoliOnly.name, *poly)
+					return 2
 				}
-			}(gzWriter)
-			mc.StdOut = gzWriter
+			}
+			mc.SetCRCParams(polyParams)
+		}
+		if *crcPoly != "" {
+			if *chunkManifest != "" {
+				fmt.Fprintln(os.Stderr, "error: -chunk-manifest needs the default CRC-32C, not -crc-poly")
+				return 2
+			}
+			params, err := parseCRCParams(*crcPoly, *crcInit, *crcReflect, *crcXorOut)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			mc.SetCRCParams(params)
 		} else {
-			mc.StdOut = f
+			for _, name := range []string{"crc-init", "crc-reflect", "crc-xorout"} {
+				if sources[name] != sourceDefault {
+					fmt.Fprintf(os.Stderr, "error: -%s needs -crc-poly\n", name)
+					return 2
+				}
+			}
 		}
-	}
-	if *outErr != "" {
-		f, err := os.OpenFile(*outErr, os.O_WRONLY|os.O_CREATE, 0644)
+		encoding, err := parseEncoding(*enc)
 		if err != nil {
-			os.Exit(2)
+			fmt.Fprintf(os.Stderr, "error: bad -enc: %v\n", err)
+			return 2
 		}
-		defer f.Close()
-		if *compress {
-			gzWriter := gzip.NewWriter(f)
-			defer func(gzWriter *gzip.Writer) {
-				err := gzWriter.Flush()
-				if err != nil {
-					fmt.Fprintf(mc.DebugOut, "Error: failed to flush gzip stream: %v", err)
+		if encoding != encBase64 && *format == "binary" {
+			fmt.Fprintln(os.Stderr, "error: -enc needs a text record format, the -format binary CRCs are raw")
+			return 2
+		}
+		mc.SetEncoding(encoding)
+		compressJobs, err := shared.compressJobs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 2
+		}
+		var pub *publisher
+		var outSum *summedWriter
+		if *publish != "" {
+			if *shared.out == "" {
+				fmt.Fprintln(os.Stderr, "error: -publish needs -out")
+				return 2
+			}
+			if pub, err = newPublisher(*publish, *shared.out); err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -publish: %v\n", err)
+				return 2
+			}
+			outSum = &summedWriter{}
+		}
+		outs := &outFiles{compressJobs: compressJobs, debugOut: mc.DebugOut}
+		closeOut := func() {}
+		// -out is truncated when opened, before the -since manifest is loaded
+		if *shared.out != "" && *sinceManifest != "" && sameFile(*shared.out, *sinceManifest) {
+			fmt.Fprintln(os.Stderr, "error: -since is the -out file, rename the previous manifest first")
+			return 2
+		}
+		if *shared.out != "" {
+			closeFunc, err := shared.openOut(mc, outs, outSum)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			var once sync.Once
+			closeOut = func() { once.Do(closeFunc) }
+			defer closeOut()
+		}
+		if *minFreeSpace != "0" || *pauseOnLowSpace {
+			minFree, err := parseByteSize(*minFreeSpace)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -min-free-space: %v\n", err)
+				return 2
+			}
+			for _, name := range []string{"min-free-space", "pause-on-low-space"} {
+				if sources[name] != sourceDefault && *shared.out == "" {
+					fmt.Fprintf(os.Stderr, "error: -%s needs -out\n", name)
+					return 2
 				}
-				err = gzWriter.Close()
-				if err != nil {
-					fmt.Fprintf(mc.DebugOut, "Error: failed to close gzip stream: %v", err)
+			}
+			if *pauseOnLowSpace && !freeSpaceSupported {
+				fmt.Fprintln(os.Stderr, "error: -pause-on-low-space is not supported on this platform")
+				return 2
+			}
+			if *shared.out != "" && freeSpaceSupported {
+				mc.EnableOutSpaceCheck(*shared.out, minFree, *pauseOnLowSpace)
+			}
+		}
+		if *diff && *composeVerify != "" {
+			fmt.Fprintln(os.Stderr, "error: -compose-verify conflicts with -diff")
+			return 2
+		}
+		if *diff {
+			return runDiff(mc, args, *strictParse)
+		}
+		if *composeVerify != "" {
+			return runComposeVerify(mc, *composeVerify, args)
+		}
+		if *outErr != "" {
+			w, closeFunc, err := outs.open("errout", *outErr, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeFunc()
+			mc.ErrOut = w
+		}
+		if *outClean != "" {
+			w, closeFunc, err := outs.open("out-clean", *outClean, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeFunc()
+			mc.EnableCleanOutput(w)
+		}
+		if *dirErrOut != "" {
+			w, closeFunc, err := outs.open("direrrout", *dirErrOut, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeFunc()
+			mc.RouteErrors(w, errScopeDir, errScopeWalk)
+		}
+		if *eventsFile != "" {
+			w, closeFunc, err := outs.open("events", *eventsFile, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeFunc()
+			mc.EnableDirEvents(w, *eventsRecursive)
+		}
+		switch *inputFormat {
+		case "text":
+		case "json":
+			for _, unsupported := range []struct {
+				name string
+				set  bool
+			}{
+				{"record", *recordFile != ""},
+				{"replay", *replayFile != ""},
+				{"coordinator", *coordinatorAddr != ""},
+				{"worker", *workerAddr != ""},
+			} {
+				if unsupported.set {
+					fmt.Fprintf(os.Stderr, "error: -%s does not support -input json\n", unsupported.name)
+					return 2
+				}
+			}
+			if *nulSeparated {
+				fmt.Fprintln(os.Stderr, "error: -0 needs -input text, the JSON jobs are separated by newlines")
+				return 2
+			}
+			if sources["format"] == sourceDefault {
+				*format = "jsonl"
+			} else if *format != "jsonl" && *format != "csv" {
+				fmt.Fprintln(os.Stderr, "error: -input json needs -format jsonl or csv to write the labels")
+				return 2
+			}
+			mc.EnableJSONInput()
+		default:
+			fmt.Fprintf(os.Stderr, "error: unknown -input %s\n", *inputFormat)
+			return 2
+		}
+		switch *format {
+		case "text":
+			if *shared.out != "" {
+				mc.EnableBuildHeader()
+			}
+		case "binary":
+			if *progressMarkers > 0 {
+				fmt.Fprintln(os.Stderr, "error: -progress-markers needs -format text")
+				return 2
+			}
+			if *statFieldsP != "" {
+				fmt.Fprintln(os.Stderr, "error: -stat-fields needs -format text, jsonl or csv")
+				return 2
+			}
+			mc.EnableBinaryOutput()
+		case "csv":
+			if *progressMarkers > 0 {
+				fmt.Fprintln(os.Stderr, "error: -progress-markers needs -format text")
+				return 2
+			}
+			mc.EnableCSVOutput(*csvHeader)
+			if *schemaHeader {
+				mc.EnableSchemaHeader()
+			}
+		case "sfv":
+			mc.EnableSFVOutput()
+		case "jsonl":
+			if *progressMarkers > 0 {
+				fmt.Fprintln(os.Stderr, "error: -progress-markers needs -format text")
+				return 2
+			}
+			mc.EnableJSONLOutput()
+			if *schemaHeader {
+				mc.EnableSchemaHeader()
+			}
+			if sources["errformat"] == sourceDefault {
+				mc.SetJSONErrors(true)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "error: unknown -format %s\n", *format)
+			return 2
+		}
+		if *nulRecords {
+			switch *format {
+			case "binary", "sfv":
+				fmt.Fprintf(os.Stderr, "error: -z needs -format text, jsonl or csv, not %s\n", *format)
+				return 2
+			case "text":
+				for _, trailing := range []struct {
+					name string
+					set  bool
+				}{
+					{"stat-fields", *statFieldsP != ""},
+					{"skip-bad-blocks", *skipBadBlocks},
+					{"edge-digest", *edgeDigest != ""},
+				} {
+					if trailing.set {
+						fmt.Fprintf(os.Stderr, "error: -z with -%s needs -format jsonl or csv, the fields after the path of a text record are not delimited\n", trailing.name)
+						return 2
+					}
+				}
+			}
+			mc.EnableNULRecords()
+		}
+		if *statFieldsP != "" {
+			sf, err := parseStatFields(*statFieldsP)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -stat-fields: %v\n", err)
+				return 2
+			}
+			mc.EnableStatFields(sf)
+			if sf.btime && !mc.birthTimes {
+				fmt.Fprintln(mc.DebugOut, "warning: the birth times are not available on this system, the btime fields are empty")
+			}
+		}
+		if *progressMarkers > 0 {
+			mc.EnableProgressMarkers(*progressMarkers)
+		}
+		if *ordered {
+			// the coordinator holds the paths of a batch until it is full
+			if *orderedWindow < 1 || (*coordinatorAddr != "" && *orderedWindow < *batchSize) {
+				fmt.Fprintf(os.Stderr, "error: bad -ordered-window %d, must be at least 1 and -batch with -coordinator\n", *orderedWindow)
+				return 2
+			}
+			mc.EnableOrderedOutput(*orderedWindow)
+		} else if sources["ordered-window"] != sourceDefault {
+			fmt.Fprintln(os.Stderr, "error: -ordered-window needs -ordered")
+			return 2
+		}
+		if err := mc.SetExcludes(excludes); err != nil {
+			fmt.Fprintf(os.Stderr, "error: bad -exclude: %v\n", err)
+			return 2
+		}
+		if len(filesFrom) > 0 {
+			if *readStdin {
+				fmt.Fprintln(os.Stderr, "error: -stdin conflicts with -files-from, use -files-from - to read stdin")
+				return 2
+			}
+			if *replayFile != "" {
+				fmt.Fprintln(os.Stderr, "error: -files-from conflicts with -replay, the replayed list is in the -record file")
+				return 2
+			}
+			if err := checkListFiles(filesFrom); err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -files-from: %v\n", err)
+				return 2
+			}
+		}
+		if *prioritySpool != "" {
+			if *coordinatorAddr != "" || *workerAddr != "" || *replayFile != "" {
+				fmt.Fprintln(os.Stderr, "error: -priority-spool conflicts with -coordinator, -worker and -replay")
+				return 2
+			}
+			if err := mc.WatchPrioritySpool(*prioritySpool); err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -priority-spool: %v\n", err)
+				return 2
+			}
+		}
+		if *xdev && !xdevSupported {
+			fmt.Fprintln(os.Stderr, "error: -xdev is not supported on this platform")
+			return 2
+		}
+		if *maxDepth < 0 {
+			fmt.Fprintln(os.Stderr, "error: -maxdepth must not be negative")
+			return 2
+		}
+		if *maxPathLen < 0 {
+			fmt.Fprintln(os.Stderr, "error: -max-path-len must not be negative")
+			return 2
+		}
+		if *escapeControls {
+			mc.EscapeControls()
+		}
+		if *skipHidden {
+			mc.SkipHidden()
+		}
+		if *fifoTimeout < 0 {
+			fmt.Fprintln(os.Stderr, "error: -fifo-timeout must not be negative")
+			return 2
+		}
+		mc.SetFIFOTimeout(*fifoTimeout)
+		if err := mc.SetIncludes(includes); err != nil {
+			fmt.Fprintf(os.Stderr, "error: bad -include: %v\n", err)
+			return 2
+		}
+		if err := mc.SetRegexpFilters(excludeRes, includeRes); err != nil {
+			fmt.Fprintf(os.Stderr, "error: bad %v\n", err)
+			return 2
+		}
+		if err := mc.SetSizeFilter(*minSize, *maxSize, *keepEmpty); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 2
+		}
+		if err := mc.SetMtimeFilter(*newerThan, *olderThan); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 2
+		}
+		if *shuffle {
+			for _, conflict := range []struct {
+				name string
+				set  bool
+			}{
+				{"ordered", *ordered},
+				{"worker", *workerAddr != ""},
+			} {
+				if conflict.set {
+					fmt.Fprintf(os.Stderr, "error: -shuffle does not support -%s\n", conflict.name)
+					return 2
+				}
+			}
+			seed := *shuffleSeed
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+				fmt.Fprintf(mc.DebugOut, "shuffle seed: %d\n", seed)
+			}
+			mc.EnableShuffle(seed)
+		} else if sources["shuffle-seed"] != sourceDefault {
+			fmt.Fprintln(os.Stderr, "error: -shuffle-seed needs -shuffle")
+			return 2
+		}
+		policy, err := parseGrowthPolicy(*growingFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: bad -growing-files: %v\n", err)
+			return 2
+		}
+		mc.SetGrowingFiles(policy)
+		if *skipBadBlocks {
+			for _, unflagged := range []struct {
+				name string
+				set  bool
+			}{
+				{"format binary", *format == "binary"},
+				{"sqlite", *sqlitePath != ""},
+				{"out-indexed", *outIndexed != ""},
+				{"chunk-manifest", *chunkManifest != ""},
+				{"fingerprint", *fingerprint},
+				{"record", *recordFile != ""},
+			} {
+				if unflagged.set {
+					fmt.Fprintf(os.Stderr, "error: -%s cannot flag the partial records of -skip-bad-blocks\n", unflagged.name)
+					return 2
 				}
-			}(gzWriter)
-			mc.ErrOut = gzWriter
+			}
+			blockSize, err := parseByteSize(*badBlockSize)
+			if err != nil || blockSize == 0 {
+				fmt.Fprintf(os.Stderr, "error: bad -bad-block-size %q\n", *badBlockSize)
+				return 2
+			}
+			skip, err := parseBadBlockFill(*badBlockFill)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -bad-block-fill: %v\n", err)
+				return 2
+			}
+			mc.EnableSkipBadBlocks(badBlockConfig{blockSize: int64(blockSize), skip: skip})
 		} else {
-			mc.ErrOut = f
+			for _, name := range []string{"bad-block-size", "bad-block-fill"} {
+				if sources[name] != sourceDefault {
+					fmt.Fprintf(os.Stderr, "error: -%s needs -skip-bad-blocks\n", name)
+					return 2
+				}
+			}
+		}
+		if *edgeDigest != "" {
+			for _, edgeless := range []struct {
+				name string
+				set  bool
+			}{
+				{"format binary", *format == "binary"},
+				{"algo " + *algo, !mc.plainCRC()},
+				{"skip-bad-blocks", *skipBadBlocks},
+				{"since", *sinceManifest != ""},
+				{"record", *recordFile != ""},
+			} {
+				if edgeless.set {
+					fmt.Fprintf(os.Stderr, "error: -%s cannot write the edges of -edge-digest\n", edgeless.name)
+					return 2
+				}
+			}
+			edgeSize, err := parseByteSize(*edgeDigest)
+			if err != nil || edgeSize > 1<<40 {
+				fmt.Fprintf(os.Stderr, "error: bad -edge-digest %q\n", *edgeDigest)
+				return 2
+			}
+			mc.EnableEdgeDigest(int64(edgeSize))
+		}
+		if *estimateCompression {
+			if !*extendedSummary {
+				fmt.Fprintln(os.Stderr, "error: -estimate-compression needs -x, the estimate is printed by the extended summary")
+				return 2
+			}
+			if *compressionSample == 0 {
+				fmt.Fprintln(os.Stderr, "error: -compression-sample must be at least 1")
+				return 2
+			}
+			mc.EnableCompressionEstimate(*compressionSample)
+		} else if sources["compression-sample"] != sourceDefault {
+			fmt.Fprintln(os.Stderr, "error: -compression-sample needs -estimate-compression")
+			return 2
+		}
+		if *tierJobs != "" {
+			limits, err := parseTierJobs(*tierJobs)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -tier-jobs: %v\n", err)
+				return 2
+			}
+			mc.LimitTierJobs(limits)
+		}
+		if *walkRate < 0 {
+			fmt.Fprintln(os.Stderr, "error: -walk-rate must not be negative")
+			return 2
+		}
+		if *walkRate > 0 || *walkPauseOnErrors {
+			mc.EnableWalkPacing(*walkRate, *walkPauseOnErrors)
+		}
+		if *skipSnapshotDirs {
+			var extraNames []string
+			if *snapshotDirNames != "" {
+				extraNames = strings.Split(*snapshotDirNames, ",")
+			}
+			mc.SkipSnapshotDirs(extraNames)
+		}
+		if *errorCache != "" {
+			mc.EnableErrorCache(*errorCache, *errorCacheAge, *retryDenied)
+		}
+		if *strictTypesP {
+			mc.EnableStrictTypes(*strictSymlinks)
+		}
+		if *strictParse {
+			mc.EnableStrictParse()
+		}
+		if *sinceManifest != "" {
+			var runTime time.Time
+			if *sinceTime != "" {
+				var err error
+				runTime, err = time.Parse(time.RFC3339, *sinceTime)
+				if err != nil {
+					fmt.Fprintf(mc.ErrOut, "error: bad -since-time: %v\n", err)
+					return 2
+				}
+			}
+			err := mc.LoadSinceManifest(*sinceManifest, runTime)
+			if err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while loading -since manifest: %v\n", err)
+				return 2
+			}
+		}
+		if *recordFile != "" {
+			if err := mc.EnableRecording(*recordFile); err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while creating -record file: %v\n", err)
+				return 2
+			}
+		}
+		if *replayFile != "" {
+			if err := mc.EnableReplay(*replayFile); err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while loading -replay file: %v\n", err)
+				return 2
+			}
+		}
+		if *outIndexed != "" {
+			mc.EnableIndexedOutput(*outIndexed)
+		}
+		if *chunkManifest != "" {
+			chunkSize, err := parseByteSize(*chunkManifest)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: bad -chunk-manifest: %v\n", err)
+				return 2
+			}
+			if *chunkOut == "" {
+				fmt.Fprintln(os.Stderr, "error: -chunk-manifest needs -chunk-out")
+				return 2
+			}
+			w, closeFunc, err := outs.open("chunk-out", *chunkOut, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 2
+			}
+			defer closeFunc()
+			mc.EnableChunkManifest(chunkSize, w)
+		}
+		if *fingerprint || *fingerprintExact {
+			mc.EnableFingerprint(*fingerprintExact)
+		}
+		if *sqlitePath != "" {
+			runID := *sqliteRunID
+			if runID == "" {
+				runID = time.Now().UTC().Format(time.RFC3339)
+			}
+			if err := mc.EnableSQLiteOutput(*sqlitePath, runID, *sqliteBatch); err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while opening -sqlite database: %v\n", err)
+				return 2
+			}
+			if *sqliteOnly {
+				mc.StdOut = io.Discard
+			}
+		}
+		for _, records := range []string{"out", "out-clean"} {
+			if outs.shared(records, "errout") || outs.shared(records, "direrrout") {
+				mc.CommentErrors()
+			}
+		}
+		// the run never checksums what it writes, nor the side files it writes next to them
+		for _, owned := range []struct {
+			path  string
+			sides []string
+		}{
+			{*shared.out, []string{outLockSuffix}},
+			{*outErr, nil},
+			{*dirErrOut, nil},
+			{*outClean, nil},
+			{*outIndexed, []string{indexRunPattern, indexOffsetsPattern}},
+			{*sqlitePath, sqliteSideSuffixes},
+			{*chunkOut, nil},
+			{*eventsFile, nil},
+			{*recordFile, nil},
+			{*errorCache, []string{persistentSetTempPattern}},
+			{*prioritySpool, nil},
+		} {
+			if owned.path != "" {
+				mc.OwnPath(owned.path, owned.sides...)
+			}
+		}
+		if *workerAddr != "" {
+			err := mc.RunWorker(*workerAddr, *jobCountP)
+			if err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while working for coordinator: %v\n", err)
+			}
+			mc.TearDown()
+			mc.PrintSummary()
+			// the batches are the input of a worker, a lost coordinator stops it like a failing list
+			stats := mc.Stats()
+			input := InputResult{Enqueued: stats.Files + stats.FileErrors, Interrupted: mc.Interrupted.Load(), Err: err}
+			printInputResult(mc.DebugOut, input)
+			switch {
+			case input.Err != nil:
+				return 3
+			case input.Interrupted:
+				return 130
+			case mc.StrictTypeFailures() > 0, mc.Mismatches() > 0:
+				return 1
+			}
+			return 0
+		}
+		fi := FileInput{mc: mc, allowOverlap: *allowOverlap, nulSeparated: *nulSeparated, dirRetry: *dirRetry, dirRetryDelay: *dirRetryDelay}
+		fi.maxDepth = *maxDepth
+		fi.followLinks = *followLinks
+		fi.xdev = *xdev
+		fi.lists = filesFrom
+		fi.guard = listGuard{maxLen: *maxPathLen, allowNewlines: *allowNewlines, strict: *strictInput}
+		if *bigDirStreaming {
+			fi.walkDir = streamingWalkDir(streamingWalkBatch)
+		}
+		var input InputResult
+		produce := func() error {
+			if *replayFile != "" {
+				input = fi.Replay()
+			} else {
+				input = fi.Run(args, *readStdin)
+			}
+			return input.Err
 		}
-	}
-	mc.Startup(*jobCountP)
-	fi := FileInput{mc: mc}
 
-	if flag.NArg() == 0 {
-		fi.ReadFileList()
-	} else {
-		fi.WalkDirectories()
+		if *coordinatorAddr != "" {
+			addr, err := mc.EnableCoordinator(*coordinatorAddr, *batchSize)
+			if err != nil {
+				fmt.Fprintf(mc.ErrOut, "error while starting coordinator: %v\n", err)
+				return 2
+			}
+			fmt.Fprintf(mc.DebugOut, "coordinator listening on %s\n", addr)
+		}
+		// the input error is reported by printInputResult
+		_ = mc.Run(context.Background(), *jobCountP, produce)
+		mc.PrintSummary()
+		printInputResult(mc.DebugOut, input)
+		switch {
+		case input.Err != nil:
+			return 3
+		case input.Interrupted:
+			return 130
+		case mc.StrictTypeFailures() > 0, mc.Mismatches() > 0:
+			return 1
+		case *strictAccounting && mc.AccountingDiscrepancies() > 0:
+			return 1
+		}
+		if pub != nil {
+			if mc.AccountingDiscrepancies() > 0 {
+				fmt.Fprintf(mc.ErrOut, "error: not publishing %s to %s, records failed to be written\n", *shared.out, pub)
+				return exitPublishFailed
+			}
+			closeOut()
+			info, err := pub.publish(*shared.out, outSum.crc)
+			if err != nil {
+				fmt.Fprintf(mc.ErrOut, "error: failed to publish %s to %s, the local file is intact: %v\n", *shared.out, pub, err)
+				return exitPublishFailed
+			}
+			fmt.Fprintf(mc.DebugOut, "Published to %s: generation %s, etag %s\n", pub, info.Generation, info.Etag)
+		}
+		return 0
 	}
-	mc.TearDown()
-	mc.PrintSummary()
 }
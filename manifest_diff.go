@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The records of -diff are written with a prefix per category, followed by the records of the manifests:
+//
+//	only-a crc size path
+//	only-b crc size path
+//	changed crcA sizeA crcB sizeB path
+
+// diffCounts are the counts of paths per category of a manifest diff
+type diffCounts struct {
+	onlyA   uint64
+	onlyB   uint64
+	changed uint64
+	same    uint64
+}
+
+func (dc diffCounts) differ() bool {
+	return dc.onlyA > 0 || dc.onlyB > 0 || dc.changed > 0
+}
+
+// manifestDiff writes the differences between two manifests
+type manifestDiff struct {
+	out    io.Writer
+	counts diffCounts
+}
+
+func (md *manifestDiff) onlyA(rec manifestRecord) {
+	md.counts.onlyA++
+	fmt.Fprintf(md.out, "only-a %s %d %s\n", rec.CRC, rec.Size, rec.Path)
+}
+
+func (md *manifestDiff) onlyB(rec manifestRecord) {
+	md.counts.onlyB++
+	fmt.Fprintf(md.out, "only-b %s %d %s\n", rec.CRC, rec.Size, rec.Path)
+}
+
+func (md *manifestDiff) both(a manifestRecord, b manifestRecord) {
+	if sameCRC(a.CRC, b.CRC) && a.Size == b.Size {
+		md.counts.same++
+		return
+	}
+	md.counts.changed++
+	fmt.Fprintf(md.out, "changed %s %d %s %d %s\n", a.CRC, a.Size, b.CRC, b.Size, a.Path)
+}
+
+// openManifestParser opens a manifest file for a newManifestParser, the returned function closes both
+func openManifestParser(path string, strict bool, diag io.Writer) (*manifestParser, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	mp, err := newManifestParser(path, f, strict, diag)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return mp, func() {
+		mp.Close()
+		f.Close()
+	}, nil
+}
+
+// manifestSorted reads a manifest through to tell whether its paths are strictly increasing, and the
+// polynomial of its CRCs from its poly header line, castagnoli without. Malformed lines are only reported
+// by the diff pass.
+func manifestSorted(path string, strict bool) (bool, string, error) {
+	mp, closeFunc, err := openManifestParser(path, strict, io.Discard)
+	if err != nil {
+		return false, "", err
+	}
+	defer closeFunc()
+	poly := polyCastagnoli
+	mp.onComment = func(line string) {
+		if strings.HasPrefix(line, polyHeaderPrefix) {
+			poly = strings.TrimSpace(line[len(polyHeaderPrefix):])
+		}
+	}
+	previous := ""
+	for first := true; ; first = false {
+		rec, err := mp.Next()
+		if err == io.EOF {
+			return true, poly, nil
+		}
+		if err != nil {
+			return false, "", err
+		}
+		if !first && rec.Path <= previous {
+			return false, poly, nil // the header lines come before the records
+		}
+		previous = rec.Path
+	}
+}
+
+// diffSide is one manifest of a diff, a text one or an indexed one (-out-indexed)
+type diffSide struct {
+	path   string
+	index  *IndexedManifest
+	sorted bool
+	poly   string
+}
+
+// openDiffSide opens an indexed manifest, sorted by construction, or reads a text one through once to
+// tell whether it is sorted
+func openDiffSide(path string, strict bool) (*diffSide, error) {
+	if im, err := OpenIndexedManifest(path); err == nil {
+		return &diffSide{path: path, index: im, sorted: true, poly: polyCastagnoli}, nil
+	} else if !errors.Is(err, errBadIndex) {
+		return nil, err
+	}
+	sorted, poly, err := manifestSorted(path, strict)
+	if err != nil {
+		return nil, err
+	}
+	return &diffSide{path: path, sorted: sorted, poly: poly}, nil
+}
+
+// records opens a sequential reader of the records, the returned function closes it
+func (ds *diffSide) records(strict bool, diag io.Writer) (func() (manifestRecord, error), func(), error) {
+	if ds.index != nil {
+		return ds.index.Records(), func() {}, nil
+	}
+	mp, closeFunc, err := openManifestParser(ds.path, strict, diag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mp.Next, closeFunc, nil
+}
+
+func (ds *diffSide) close() {
+	if ds.index != nil {
+		ds.index.Close()
+	}
+}
+
+// DiffManifests writes to StdOut the paths only in the manifest at pathA, only in the one at pathB and
+// the paths of both with a different CRC or size, without reading any file. Manifests both sorted by path
+// are streamed, an unsorted one against an indexed one is streamed with every path looked up in the index,
+// otherwise the records of pathA are loaded in memory. It returns whether they differ, and an error for
+// manifests of CRCs of different polynomials, every file would differ.
+func (mc *MassCRC32C) DiffManifests(pathA string, pathB string) (bool, error) {
+	a, err := openDiffSide(pathA, mc.strictParse)
+	if err != nil {
+		return false, err
+	}
+	defer a.close()
+	b, err := openDiffSide(pathB, mc.strictParse)
+	if err != nil {
+		return false, err
+	}
+	defer b.close()
+	if a.poly != b.poly {
+		return false, fmt.Errorf("%s: the CRCs use the %s polynomial, %s the %s one", pathA, a.poly, pathB, b.poly)
+	}
+	md := &manifestDiff{out: mc.StdOut}
+	var method string
+	switch {
+	case a.sorted && b.sorted:
+		err = md.merge(a, b, mc.strictParse, mc.DebugOut)
+		method = "streamed"
+	case b.index != nil:
+		err = md.lookupIndex(a, b.index, true, mc.strictParse, mc.DebugOut)
+		method = "a streamed, looked up in the index of b"
+	case a.index != nil:
+		err = md.lookupIndex(b, a.index, false, mc.strictParse, mc.DebugOut)
+		method = "b streamed, looked up in the index of a"
+	default:
+		err = md.lookup(a, b, mc.strictParse, mc.DebugOut)
+		method = "in memory, the manifests are not both sorted by path"
+	}
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(
+		mc.DebugOut,
+		"Diff: %d only in a, %d only in b, %d changed, %d identical (%s)\n",
+		md.counts.onlyA, md.counts.onlyB, md.counts.changed, md.counts.same, method,
+	)
+	return md.counts.differ(), nil
+}
+
+// merge walks two manifests sorted by path side by side
+func (md *manifestDiff) merge(sideA *diffSide, sideB *diffSide, strict bool, diag io.Writer) error {
+	nextA, closeA, err := sideA.records(strict, diag)
+	if err != nil {
+		return err
+	}
+	defer closeA()
+	nextB, closeB, err := sideB.records(strict, diag)
+	if err != nil {
+		return err
+	}
+	defer closeB()
+	recA, errA := nextA()
+	recB, errB := nextB()
+	for errA == nil && errB == nil {
+		switch {
+		case recA.Path < recB.Path:
+			md.onlyA(recA)
+			recA, errA = nextA()
+		case recA.Path > recB.Path:
+			md.onlyB(recB)
+			recB, errB = nextB()
+		default:
+			md.both(recA, recB)
+			recA, errA = nextA()
+			recB, errB = nextB()
+		}
+	}
+	for errA == nil {
+		md.onlyA(recA)
+		recA, errA = nextA()
+	}
+	for errB == nil {
+		md.onlyB(recB)
+		recB, errB = nextB()
+	}
+	if errA != io.EOF {
+		return errA
+	}
+	if errB != io.EOF {
+		return errB
+	}
+	return nil
+}
+
+// lookupIndex streams the text manifest of side and looks every path up in the index of the other one,
+// isA tells which one side is. Only a bit per indexed record is kept in memory to write the paths only
+// in the index last, in path order.
+func (md *manifestDiff) lookupIndex(side *diffSide, im *IndexedManifest, isA bool, strict bool, diag io.Writer) error {
+	next, closeFunc, err := side.records(strict, diag)
+	if err != nil {
+		return err
+	}
+	defer closeFunc()
+	matched := make([]uint64, (im.Len()+63)/64)
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		i, other, found, err := im.search(rec.Path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case found && matched[i/64]&(1<<(i%64)) == 0:
+			matched[i/64] |= 1 << (i % 64)
+			if isA {
+				md.both(rec, other)
+			} else {
+				md.both(other, rec)
+			}
+		case isA:
+			md.onlyA(rec)
+		default:
+			md.onlyB(rec)
+		}
+	}
+	i := uint64(0)
+	return im.Scan(func(rec manifestRecord) error {
+		if matched[i/64]&(1<<(i%64)) == 0 {
+			if isA {
+				md.onlyB(rec)
+			} else {
+				md.onlyA(rec)
+			}
+		}
+		i++
+		return nil
+	})
+}
+
+// lookup loads the records of the manifest of sideA in a map and streams the one of sideB,
+// the paths only in a are written last, sorted
+func (md *manifestDiff) lookup(sideA *diffSide, sideB *diffSide, strict bool, diag io.Writer) error {
+	nextA, closeA, err := sideA.records(strict, diag)
+	if err != nil {
+		return err
+	}
+	defer closeA()
+	records := make(map[string]manifestRecord)
+	for {
+		rec, err := nextA()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		records[rec.Path] = rec
+	}
+	nextB, closeB, err := sideB.records(strict, diag)
+	if err != nil {
+		return err
+	}
+	defer closeB()
+	for {
+		recB, err := nextB()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if recA, ok := records[recB.Path]; ok {
+			delete(records, recB.Path)
+			md.both(recA, recB)
+		} else {
+			md.onlyB(recB)
+		}
+	}
+	paths := make([]string, 0, len(records))
+	for path := range records {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		md.onlyA(records[path])
+	}
+	return nil
+}
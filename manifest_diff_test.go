@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, path string, lines []string, gzipped bool) {
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	if gzipped {
+		var buf bytes.Buffer
+		gzWriter := gzip.NewWriter(&buf)
+		gzWriter.Write(data)
+		gzWriter.Close()
+		data = buf.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	a := []string{
+		"# mass-crc32c started=2024-01-01T00:00:00Z",
+		"AAAAAA== 1 a",
+		"BBBBBB== 2 b c",
+		"CCCCCC== 3 d",
+		"DDDDDD== 4 e",
+	}
+	b := []string{
+		"1\tAAAAAA== 1 a\tnlink=1",
+		"BBBBBB== 5 b c",
+		"EEEEEE== 3 d",
+		"FFFFFF== 6 f",
+	}
+	expected := []string{
+		"changed BBBBBB== 2 BBBBBB== 5 b c",
+		"changed CCCCCC== 3 EEEEEE== 3 d",
+		"only-a DDDDDD== 4 e",
+		"only-b FFFFFF== 6 f",
+	}
+	unsorted := func(lines []string) []string {
+		return append([]string{lines[len(lines)-1]}, lines[:len(lines)-1]...)
+	}
+	tests := []struct {
+		name     string
+		a        []string
+		b        []string
+		streamed bool
+	}{
+		{"sorted", a, b, true},
+		{"a unsorted", unsorted(a), b, false},
+		{"b unsorted", a, unsorted(b), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			pathA := filepath.Join(dir, "a.txt")
+			pathB := filepath.Join(dir, "b.txt.gz")
+			writeManifest(t, pathA, test.a, false)
+			writeManifest(t, pathB, test.b, true)
+			out := &bytes.Buffer{}
+			debug := &bytes.Buffer{}
+			mc := InitMassCRC32C(1, 1)
+			mc.StdOut = out
+			mc.DebugOut = debug
+			differ, err := mc.DiffManifests(pathA, pathB)
+			if err != nil || !differ {
+				t.Fatalf("got %t %v", differ, err)
+			}
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if test.streamed {
+				if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+					t.Errorf("got %q, expected %q", lines, expected)
+				}
+			} else {
+				// the paths only in a come last
+				if len(lines) != len(expected) || lines[len(lines)-1] != "only-a DDDDDD== 4 e" {
+					t.Errorf("got %q", lines)
+				}
+				for _, line := range expected {
+					if !strings.Contains(out.String(), line+"\n") {
+						t.Errorf("missing %q in %q", line, out.String())
+					}
+				}
+			}
+			summary := "Diff: 1 only in a, 1 only in b, 2 changed, 1 identical (streamed)"
+			if !test.streamed {
+				summary = "Diff: 1 only in a, 1 only in b, 2 changed, 1 identical (in memory"
+			}
+			if !strings.Contains(debug.String(), summary) {
+				t.Errorf("got summary %q", debug.String())
+			}
+		})
+	}
+}
+
+func TestDiffManifestsIdentical(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.txt")
+	pathB := filepath.Join(dir, "b.txt")
+	writeManifest(t, pathA, []string{"AAAAAA== 1 a", "BBBBBB== 2 b"}, false)
+	writeManifest(t, pathB, []string{"BBBBBB== 2 b", "AAAAAA== 1 a"}, false)
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.StdOut = out
+	mc.DebugOut = &bytes.Buffer{}
+	if differ, err := mc.DiffManifests(pathA, pathB); err != nil || differ || out.Len() != 0 {
+		t.Errorf("got %t %v %q", differ, err, out.String())
+	}
+
+	writeManifest(t, pathB, []string{"BBBBBB== 2 b", "not a record"}, false)
+	mc.EnableStrictParse()
+	if _, err := mc.DiffManifests(pathA, pathB); err == nil {
+		t.Error("expected a strict parse error")
+	}
+	if _, err := mc.DiffManifests(pathA, filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected a missing manifest error")
+	}
+}
+
+// Test manifests of CRCs of different polynomials are refused instead of every file reported changed
+func TestDiffManifestsPoly(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.txt")
+	pathB := filepath.Join(dir, "b.txt")
+	writeManifest(t, pathA, []string{"AAAAAA== 1 a"}, false)
+	writeManifest(t, pathB, []string{"# mass-crc32c poly=ieee", "BBBBBB== 1 a"}, true)
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.StdOut = out
+	mc.DebugOut = &bytes.Buffer{}
+	if _, err := mc.DiffManifests(pathA, pathB); err == nil || !strings.Contains(err.Error(), "castagnoli polynomial") || out.Len() != 0 {
+		t.Errorf("got %v %q, expected the polynomials refused", err, out.String())
+	}
+	writeManifest(t, pathA, []string{"# mass-crc32c poly=ieee", "BBBBBB== 1 a"}, false)
+	if differ, err := mc.DiffManifests(pathA, pathB); err != nil || differ {
+		t.Errorf("got %t %v", differ, err)
+	}
+}
+
+// Test an indexed manifest is read through its index, streamed against a sorted one and looked up from an unsorted one
+func TestDiffManifestsIndexed(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "a.idx")
+	iw := newIndexWriter(indexPath)
+	for _, rec := range []manifestRecord{
+		{Path: "e", CRC: "DDDDDD==", Size: 4},
+		{Path: "a", CRC: "AAAAAA==", Size: 1},
+		{Path: "d", CRC: "CCCCCC==", Size: 3},
+		{Path: "b c", CRC: "BBBBBB==", Size: 2},
+	} {
+		iw.Add(rec)
+	}
+	if err := iw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sortedPath := filepath.Join(dir, "b.txt")
+	writeManifest(t, sortedPath, []string{"AAAAAA== 1 a", "BBBBBB== 5 b c", "EEEEEE== 3 d", "FFFFFF== 6 f"}, false)
+	unsortedPath := filepath.Join(dir, "b-unsorted.txt")
+	writeManifest(t, unsortedPath, []string{"FFFFFF== 6 f", "EEEEEE== 3 d", "AAAAAA== 1 a", "BBBBBB== 5 b c"}, false)
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected []string
+		method   string
+	}{
+		{
+			"sorted", indexPath, sortedPath,
+			[]string{"changed BBBBBB== 2 BBBBBB== 5 b c", "changed CCCCCC== 3 EEEEEE== 3 d", "only-a DDDDDD== 4 e", "only-b FFFFFF== 6 f"},
+			"(streamed)",
+		},
+		{
+			"b unsorted", indexPath, unsortedPath,
+			[]string{"only-b FFFFFF== 6 f", "changed CCCCCC== 3 EEEEEE== 3 d", "changed BBBBBB== 2 BBBBBB== 5 b c", "only-a DDDDDD== 4 e"},
+			"(b streamed, looked up in the index of a)",
+		},
+		{
+			"a unsorted", unsortedPath, indexPath,
+			[]string{"only-a FFFFFF== 6 f", "changed EEEEEE== 3 CCCCCC== 3 d", "changed BBBBBB== 5 BBBBBB== 2 b c", "only-b DDDDDD== 4 e"},
+			"(a streamed, looked up in the index of b)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			debug := &bytes.Buffer{}
+			mc := InitMassCRC32C(1, 1)
+			mc.StdOut = out
+			mc.DebugOut = debug
+			differ, err := mc.DiffManifests(test.a, test.b)
+			if err != nil || !differ {
+				t.Fatalf("got %t %v", differ, err)
+			}
+			if expected := strings.Join(test.expected, "\n") + "\n"; out.String() != expected {
+				t.Errorf("got %q, expected %q", out.String(), expected)
+			}
+			if !strings.Contains(debug.String(), "1 only in a, 1 only in b, 2 changed, 1 identical "+test.method) {
+				t.Errorf("got summary %q", debug.String())
+			}
+		})
+	}
+}
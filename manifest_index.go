@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Indexed manifest layout, all integers big endian:
+//
+//	header  magic "MCRCIDX\x00", uint32 version, uint32 reserved
+//	records sorted by path, each one: uvarint path length, path,
+//	        uvarint crc length, crc, uvarint size
+//	offsets uint64 offset of each record from the start of the file
+//	footer  uint64 offsets start, uint64 record count, magic "MCRCEND\x00"
+//
+// The offsets table allows a binary search with a few seeks per lookup.
+const (
+	indexMagic      = "MCRCIDX\x00"
+	indexEndMagic   = "MCRCEND\x00"
+	indexVersion    = 1
+	indexHeaderSize = 16
+	indexFooterSize = 24
+
+	// records kept in memory before spilling a sorted run to a temp file
+	defaultIndexRunRecords = 1 << 20
+
+	// the temp files of the runs and offsets named after the index, their * replaced by os.CreateTemp
+	indexRunPattern     = ".run-*"
+	indexOffsetsPattern = ".offsets-*"
+)
+
+var errBadIndex = errors.New("not an indexed manifest")
+
+type manifestRecord struct {
+	Path    string
+	CRC     string
+	Size    uint64
+	Partial bool // read with -skip-bad-blocks, the CRC does not cover the unreadable ranges
+}
+
+func appendRecord(buf []byte, rec manifestRecord) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(rec.Path)))
+	buf = append(buf, rec.Path...)
+	buf = binary.AppendUvarint(buf, uint64(len(rec.CRC)))
+	buf = append(buf, rec.CRC...)
+	return binary.AppendUvarint(buf, rec.Size)
+}
+
+func readRecord(r *bufio.Reader) (manifestRecord, error) {
+	var rec manifestRecord
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return string(b), err
+	}
+	var err error
+	if rec.Path, err = readString(); err != nil {
+		return rec, err // io.EOF on a clean end of stream
+	}
+	if rec.CRC, err = readString(); err != nil {
+		return rec, io.ErrUnexpectedEOF
+	}
+	if rec.Size, err = binary.ReadUvarint(r); err != nil {
+		return rec, io.ErrUnexpectedEOF
+	}
+	return rec, nil
+}
+
+// indexWriter sorts the records with sorted temp runs merged on Close since results arrive unordered
+type indexWriter struct {
+	path       string
+	runRecords int
+	pending    []manifestRecord
+	runs       []string
+}
+
+func newIndexWriter(path string) *indexWriter {
+	return &indexWriter{path: path, runRecords: defaultIndexRunRecords}
+}
+
+func (iw *indexWriter) Add(rec manifestRecord) error {
+	iw.pending = append(iw.pending, rec)
+	if len(iw.pending) >= iw.runRecords {
+		return iw.spill()
+	}
+	return nil
+}
+
+// spill writes the pending records as a sorted run next to the output, /tmp may be too small
+func (iw *indexWriter) spill() error {
+	sort.Slice(iw.pending, func(i, j int) bool { return iw.pending[i].Path < iw.pending[j].Path })
+	f, err := os.CreateTemp(filepath.Dir(iw.path), filepath.Base(iw.path)+indexRunPattern)
+	if err != nil {
+		return err
+	}
+	iw.runs = append(iw.runs, f.Name())
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for _, rec := range iw.pending {
+		buf = appendRecord(buf[:0], rec)
+		if _, err = w.Write(buf); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	iw.pending = iw.pending[:0]
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type runReader struct {
+	f   *os.File
+	r   *bufio.Reader
+	rec manifestRecord
+}
+
+type runHeap []*runReader
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].rec.Path < h[j].rec.Path }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	rr := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rr
+}
+
+func (iw *indexWriter) removeRuns() {
+	for _, run := range iw.runs {
+		os.Remove(run)
+	}
+}
+
+// Abort drops the records without writing the index, removing the runs already spilled
+func (iw *indexWriter) Abort() {
+	iw.removeRuns()
+	iw.runs = nil
+	iw.pending = nil
+}
+
+// merge calls fn for every record in path order, merging the runs, and removes them
+func (iw *indexWriter) merge(fn func(rec manifestRecord) error) (err error) {
+	defer iw.removeRuns()
+	if err = iw.spill(); err != nil {
+		return err
+	}
+
+	var h runHeap
+	defer func() {
+		for _, rr := range h {
+			rr.f.Close()
+		}
+	}()
+	for _, run := range iw.runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		rr := &runReader{f: f, r: bufio.NewReader(f)}
+		if rr.rec, err = readRecord(rr.r); err != nil {
+			f.Close()
+			if err == io.EOF {
+				continue
+			}
+			return fmt.Errorf("reading run %s: %w", run, err)
+		}
+		h = append(h, rr)
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		rr := h[0]
+		if err = fn(rr.rec); err != nil {
+			return err
+		}
+		rr.rec, err = readRecord(rr.r)
+		switch err {
+		case nil:
+			heap.Fix(&h, 0)
+		case io.EOF:
+			heap.Pop(&h)
+			rr.f.Close()
+		default:
+			return fmt.Errorf("reading run %s: %w", rr.f.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Close merges the runs into the final file and removes them
+func (iw *indexWriter) Close() (err error) {
+	out, err := os.Create(iw.path)
+	if err != nil {
+		iw.removeRuns()
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	// the offsets are spilled too, 500M records would not fit in memory
+	offsets, err := os.CreateTemp(filepath.Dir(iw.path), filepath.Base(iw.path)+indexOffsetsPattern)
+	if err != nil {
+		iw.removeRuns()
+		return err
+	}
+	defer func() {
+		offsets.Close()
+		os.Remove(offsets.Name())
+	}()
+	w := bufio.NewWriter(out)
+	ow := bufio.NewWriter(offsets)
+
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	binary.BigEndian.PutUint32(header[8:], indexVersion)
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	offset := uint64(indexHeaderSize)
+	count := uint64(0)
+	var buf []byte
+	err = iw.merge(func(rec manifestRecord) error {
+		buf = appendRecord(buf[:0], rec)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if err := binary.Write(ow, binary.BigEndian, offset); err != nil {
+			return err
+		}
+		offset += uint64(len(buf))
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = ow.Flush(); err != nil {
+		return err
+	}
+	if _, err = offsets.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, offsets); err != nil {
+		return err
+	}
+	footer := make([]byte, indexFooterSize)
+	binary.BigEndian.PutUint64(footer, offset)
+	binary.BigEndian.PutUint64(footer[8:], count)
+	copy(footer[16:], indexEndMagic)
+	if _, err = w.Write(footer); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// IndexedManifest looks records up with a binary search over the offsets table instead of streaming
+type IndexedManifest struct {
+	f            *os.File
+	offsetsStart uint64
+	count        uint64
+}
+
+func OpenIndexedManifest(path string) (*IndexedManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	im := &IndexedManifest{f: f}
+	if err = im.readBounds(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return im, nil
+}
+
+func (im *IndexedManifest) readBounds() error {
+	info, err := im.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < indexHeaderSize+indexFooterSize {
+		return errBadIndex
+	}
+	header := make([]byte, indexHeaderSize)
+	if _, err = im.f.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:8]) != indexMagic {
+		return errBadIndex
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != indexVersion {
+		return fmt.Errorf("unsupported indexed manifest version %d", version)
+	}
+	footer := make([]byte, indexFooterSize)
+	if _, err = im.f.ReadAt(footer, info.Size()-indexFooterSize); err != nil {
+		return err
+	}
+	if string(footer[16:]) != indexEndMagic {
+		return errBadIndex
+	}
+	im.offsetsStart = binary.BigEndian.Uint64(footer)
+	im.count = binary.BigEndian.Uint64(footer[8:])
+	if im.offsetsStart+im.count*8+indexFooterSize != uint64(info.Size()) {
+		return errBadIndex
+	}
+	return nil
+}
+
+func (im *IndexedManifest) Len() uint64 {
+	return im.count
+}
+
+func (im *IndexedManifest) offset(i uint64) (uint64, error) {
+	if i == im.count {
+		return im.offsetsStart, nil
+	}
+	b := make([]byte, 8)
+	if _, err := im.f.ReadAt(b, int64(im.offsetsStart+i*8)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Record returns the i-th record in path order
+func (im *IndexedManifest) Record(i uint64) (manifestRecord, error) {
+	start, err := im.offset(i)
+	if err != nil {
+		return manifestRecord{}, err
+	}
+	end, err := im.offset(i + 1)
+	if err != nil {
+		return manifestRecord{}, err
+	}
+	if end < start || end > im.offsetsStart {
+		return manifestRecord{}, errBadIndex
+	}
+	b := make([]byte, end-start)
+	if _, err = im.f.ReadAt(b, int64(start)); err != nil {
+		return manifestRecord{}, err
+	}
+	rec, err := readRecord(bufio.NewReader(bytes.NewReader(b)))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return rec, err
+}
+
+// Lookup finds the record of path
+func (im *IndexedManifest) Lookup(path string) (manifestRecord, bool, error) {
+	_, rec, found, err := im.search(path)
+	return rec, found, err
+}
+
+// search finds the record of path and its position in path order
+func (im *IndexedManifest) search(path string) (uint64, manifestRecord, bool, error) {
+	var searchErr error
+	i := sort.Search(int(im.count), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		rec, err := im.Record(uint64(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return rec.Path >= path
+	})
+	if searchErr != nil {
+		return 0, manifestRecord{}, false, searchErr
+	}
+	if uint64(i) == im.count {
+		return 0, manifestRecord{}, false, nil
+	}
+	rec, err := im.Record(uint64(i))
+	if err != nil || rec.Path != path {
+		return 0, manifestRecord{}, false, err
+	}
+	return uint64(i), rec, true, nil
+}
+
+func (im *IndexedManifest) Close() error {
+	return im.f.Close()
+}
+
+// Records returns a sequential reader of the records in path order, io.EOF after the last one
+func (im *IndexedManifest) Records() func() (manifestRecord, error) {
+	r := bufio.NewReader(io.NewSectionReader(im.f, indexHeaderSize, int64(im.offsetsStart)-indexHeaderSize))
+	i := uint64(0)
+	return func() (manifestRecord, error) {
+		if i == im.count {
+			return manifestRecord{}, io.EOF
+		}
+		rec, err := readRecord(r)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return manifestRecord{}, err
+		}
+		i++
+		return rec, nil
+	}
+}
+
+// Scan calls fn for every record in path order, reading sequentially
+func (im *IndexedManifest) Scan(fn func(rec manifestRecord) error) error {
+	next := im.Records()
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(rec); err != nil {
+			return err
+		}
+	}
+}
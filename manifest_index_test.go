@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestIndex(t testing.TB, dir string, count int, runRecords int) string {
+	path := filepath.Join(dir, "manifest.idx")
+	iw := newIndexWriter(path)
+	iw.runRecords = runRecords
+	// add in a scrambled order, results arrive unordered
+	for i := 0; i < count; i++ {
+		j := (i * 7919) % count
+		err := iw.Add(manifestRecord{Path: fmt.Sprintf("/data/%08d", j), CRC: fmt.Sprintf("crc%d", j), Size: uint64(j)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndexedManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestIndex(t, dir, 1000, 64)
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp runs left behind: %d files in output dir", len(entries))
+	}
+
+	im, err := OpenIndexedManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	if im.Len() != 1000 {
+		t.Errorf("len error, got %d, expected %d", im.Len(), 1000)
+	}
+	previous := ""
+	for i := uint64(0); i < im.Len(); i++ {
+		rec, err := im.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Path <= previous {
+			t.Errorf("records not sorted: %s after %s", rec.Path, previous)
+		}
+		previous = rec.Path
+	}
+	for _, j := range []int{0, 1, 500, 999} {
+		rec, found, err := im.Lookup(fmt.Sprintf("/data/%08d", j))
+		if err != nil || !found {
+			t.Fatalf("lookup of %d failed: found %v, err %v", j, found, err)
+		}
+		if rec.CRC != fmt.Sprintf("crc%d", j) || rec.Size != uint64(j) {
+			t.Errorf("lookup of %d got %+v", j, rec)
+		}
+	}
+	for _, missing := range []string{"", "/a", "/data/00000000x", "/z"} {
+		if _, found, err := im.Lookup(missing); found || err != nil {
+			t.Errorf("lookup of %q: found %v, err %v", missing, found, err)
+		}
+	}
+}
+
+func TestIndexedManifestEmpty(t *testing.T) {
+	path := writeTestIndex(t, t.TempDir(), 0, 64)
+	im, err := OpenIndexedManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	if _, found, err := im.Lookup("/data"); found || err != nil {
+		t.Errorf("lookup in empty index: found %v, err %v", found, err)
+	}
+}
+
+func TestIndexedManifestBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("WaIfQg== 3538 test_data.txt\n", 4)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenIndexedManifest(path); err == nil {
+		t.Errorf("expected an error opening a text manifest")
+	}
+}
+
+const benchManifestSize = 100000
+
+func BenchmarkIndexedLookup(b *testing.B) {
+	im, err := OpenIndexedManifest(writeTestIndex(b, b.TempDir(), benchManifestSize, defaultIndexRunRecords))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer im.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, found, _ := im.Lookup(fmt.Sprintf("/data/%08d", (i*7919)%benchManifestSize)); !found {
+			b.Fatal("not found")
+		}
+	}
+}
+
+func BenchmarkStreamingLookup(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "manifest.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for j := 0; j < benchManifestSize; j++ {
+		fmt.Fprintf(w, "crc%d %d /data/%08d\n", j, j, j)
+	}
+	w.Flush()
+	f.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target := fmt.Sprintf("/data/%08d", (i*7919)%benchManifestSize)
+		f, _ := os.Open(path)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.HasSuffix(scanner.Text(), " "+target) {
+				break
+			}
+		}
+		f.Close()
+	}
+}
+
+// Test an aborted index leaves no run behind
+func TestIndexWriterAbort(t *testing.T) {
+	dir := t.TempDir()
+	iw := newIndexWriter(filepath.Join(dir, "manifest.idx"))
+	iw.runRecords = 2
+	for i := 0; i < 5; i++ {
+		if err := iw.Add(manifestRecord{Path: fmt.Sprintf("/data/%d", i), CRC: "crc", Size: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(iw.runs) == 0 {
+		t.Fatal("expected runs spilled")
+	}
+	iw.Abort()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files left, expected the runs removed", len(entries))
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	manifestMaxLine      = 1024 * 1024
+	manifestQuoteLimit   = 80
+	manifestReportedErrs = 10 // malformed lines reported before staying quiet
+)
+
+var errUTF16Manifest = errors.New("UTF-16 manifests are not supported, convert to UTF-8")
+
+// manifestLineError locates a malformed manifest line, quoting its start so binary garbage stays readable
+type manifestLineError struct {
+	name string
+	line int
+	text string
+	err  error
+}
+
+func (e *manifestLineError) Error() string {
+	text := e.text
+	suffix := ""
+	if len(text) > manifestQuoteLimit {
+		text = text[:manifestQuoteLimit]
+		suffix = "..."
+	}
+	return fmt.Sprintf("%s:%d: %v in %s%s", e.name, e.line, e.err, strconv.Quote(text), suffix)
+}
+
+func (e *manifestLineError) Unwrap() error {
+	return e.err
+}
+
+// parseManifestLine splits a "crc size path" record, optionally prefixed with an ordinal
+// and followed by stat fields or bad ranges. The path is everything after the second space so it may contain spaces itself.
+// A line starting with "{" is a -format jsonl record, no text record starts so.
+func parseManifestLine(line string) (manifestRecord, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONRecord(line)
+	}
+	_, line = splitOrdinal(line)
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return manifestRecord{}, errors.New("malformed manifest line")
+	}
+	if _, err := decodeCRC(fields[0]); err != nil {
+		return manifestRecord{}, fmt.Errorf("malformed crc: %w", err)
+	}
+	size, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return manifestRecord{}, fmt.Errorf("malformed size: %w", err)
+	}
+	path, partial := cutRecordFields(fields[2])
+	if path == "" {
+		return manifestRecord{}, errors.New("empty path")
+	}
+	return manifestRecord{CRC: fields[0], Size: size, Path: path, Partial: partial}, nil
+}
+
+// manifestParser reads the records of a text manifest, gzipped or not, the single parser
+// every manifest consumer goes through. Blank and "#" comment lines are skipped, comments are
+// passed to onComment, a schema declaration maps the columns of the csv and jsonl records following it. Malformed lines are skipped and counted, or returned as errors when strict.
+type manifestParser struct {
+	name      string
+	strict    bool
+	onComment func(line string)
+	diag      io.Writer
+
+	scanner *bufio.Scanner
+	binary  *bufio.Reader // binary manifest records, instead of the scanner lines
+	gz      *gzip.Reader
+	schema  *recordSchema // of the last schema declaration, the records map their columns by it
+	line    int
+	skipped uint64
+}
+
+// newManifestParser detects gzip compression and an UTF-8 byte order mark, name is used in diagnostics
+func newManifestParser(name string, r io.Reader, strict bool, diag io.Writer) (*manifestParser, error) {
+	mp := &manifestParser{name: name, strict: strict, diag: diag}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzReader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		mp.gz = gzReader
+		br = bufio.NewReader(gzReader)
+	}
+	if magic, _ := br.Peek(len(binaryManifestMagic) + 1); len(magic) > len(binaryManifestMagic) && string(magic[:len(binaryManifestMagic)]) == binaryManifestMagic {
+		if version := magic[len(binaryManifestMagic)]; version != binaryManifestVersion {
+			mp.Close()
+			return nil, fmt.Errorf("%s: %w %d", name, errBinaryManifestVersion, version)
+		}
+		br.Discard(len(magic))
+		mp.binary = br
+		return mp, nil
+	}
+	bom, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(bom, []byte{0xef, 0xbb, 0xbf}):
+		br.Discard(3)
+	case bytes.HasPrefix(bom, []byte{0xff, 0xfe}), bytes.HasPrefix(bom, []byte{0xfe, 0xff}):
+		mp.Close()
+		return nil, fmt.Errorf("%s: %w", name, errUTF16Manifest)
+	}
+	mp.scanner = bufio.NewScanner(br)
+	mp.scanner.Buffer(make([]byte, 64*1024), manifestMaxLine)
+	return mp, nil
+}
+
+// Next returns the next record, io.EOF at the end of the manifest
+func (mp *manifestParser) Next() (manifestRecord, error) {
+	if mp.binary != nil {
+		return mp.nextBinary()
+	}
+	for mp.scanner.Scan() {
+		mp.line++
+		line := strings.TrimSuffix(mp.scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, schemaHeaderPrefix) {
+				// the following records cannot be mapped without it, even when not strict
+				schema, err := parseSchemaHeader(line)
+				if err != nil {
+					return manifestRecord{}, &manifestLineError{name: mp.name, line: mp.line, text: line, err: err}
+				}
+				mp.schema = schema
+			}
+			if mp.onComment != nil {
+				mp.onComment(line)
+			}
+			continue
+		}
+		rec, skip, err := mp.parseLine(line)
+		if skip {
+			continue
+		}
+		if err == nil {
+			return rec, nil
+		}
+		lineErr := &manifestLineError{name: mp.name, line: mp.line, text: line, err: err}
+		if mp.strict {
+			return manifestRecord{}, lineErr
+		}
+		mp.skipped++
+		if mp.skipped <= manifestReportedErrs {
+			fmt.Fprintf(mp.diag, "warning: skipping %v\n", lineErr)
+		}
+		if mp.skipped == manifestReportedErrs {
+			fmt.Fprintf(mp.diag, "warning: further malformed lines of %s are skipped silently\n", mp.name)
+		}
+	}
+	if err := mp.scanner.Err(); err != nil {
+		return manifestRecord{}, fmt.Errorf("%s:%d: %w", mp.name, mp.line+1, err)
+	}
+	return manifestRecord{}, io.EOF
+}
+
+// parseLine parses a record by the columns of the schema declared, the -header row of a csv output
+// is skipped, positionally without a declaration
+func (mp *manifestParser) parseLine(line string) (manifestRecord, bool, error) {
+	switch {
+	case mp.schema == nil:
+		rec, err := parseManifestLine(line)
+		return rec, false, err
+	case mp.schema.format == "jsonl":
+		rec, err := mp.schema.jsonRecord(line)
+		return rec, false, err
+	}
+	row, err := mp.csvRow(line)
+	if err != nil {
+		return manifestRecord{}, false, err
+	}
+	if mp.schema.headerRow(row) {
+		return manifestRecord{}, true, nil
+	}
+	rec, err := mp.schema.csvRecord(row)
+	return rec, false, err
+}
+
+// nextBinary reads a binary record, line counts the records. A record with an empty path is skipped
+// like a malformed line, a corrupted length leaves no way to find the next record so the rest is skipped.
+func (mp *manifestParser) nextBinary() (manifestRecord, error) {
+	for {
+		mp.line++
+		rec, err := readBinaryRecord(mp.binary)
+		if err == nil || err == io.EOF {
+			return rec, err
+		}
+		recErr := fmt.Errorf("%s: record %d: %w", mp.name, mp.line, err)
+		if mp.strict {
+			return manifestRecord{}, recErr
+		}
+		mp.skipped++
+		if rec.Path == "" && rec.CRC != "" { // framing intact
+			if mp.skipped <= manifestReportedErrs {
+				fmt.Fprintf(mp.diag, "warning: skipping %v\n", recErr)
+			}
+			continue
+		}
+		fmt.Fprintf(mp.diag, "warning: skipping the rest of %s: %v\n", mp.name, recErr)
+		return manifestRecord{}, io.EOF
+	}
+}
+
+// Skipped returns the number of malformed lines skipped so far
+func (mp *manifestParser) Skipped() uint64 {
+	return mp.skipped
+}
+
+func (mp *manifestParser) Close() error {
+	if mp.gz != nil {
+		return mp.gz.Close()
+	}
+	return nil
+}
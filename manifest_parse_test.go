@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func parseAll(t testing.TB, input []byte, strict bool) ([]manifestRecord, *manifestParser, string, error) {
+	diag := &bytes.Buffer{}
+	mp, err := newManifestParser("m.txt", bytes.NewReader(input), strict, diag)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer mp.Close()
+	var records []manifestRecord
+	for {
+		rec, err := mp.Next()
+		if err == io.EOF {
+			return records, mp, diag.String(), nil
+		}
+		if err != nil {
+			return records, mp, diag.String(), err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestParseManifestLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want manifestRecord
+		err  string
+	}{
+		{line: "AAAAAA== 12 a/b", want: manifestRecord{CRC: "AAAAAA==", Size: 12, Path: "a/b"}},
+		{line: "AAAAAA== 12 with  spaces ", want: manifestRecord{CRC: "AAAAAA==", Size: 12, Path: "with  spaces "}},
+		{line: "7\tAAAAAA== 0 x", want: manifestRecord{CRC: "AAAAAA==", Size: 0, Path: "x"}},
+		{line: "AAAAAA== 12", err: "malformed manifest line"},
+		{line: "AAAAAA==  12 x", err: "malformed size"},
+		{line: "AAAAAA== -1 x", err: "malformed size"},
+		{line: "AAAAAA== 12 ", err: "empty path"},
+		{line: "AAAA 12 x", err: "malformed crc"},
+		{line: "not-b64! 12 x", err: "malformed crc"},
+		{line: "x 12 AAAAAA== 12 x", err: "malformed crc"}, // two records glued together
+	}
+	for _, test := range tests {
+		rec, err := parseManifestLine(test.line)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseManifestLine(%q) error %v, want %q", test.line, err, test.err)
+			}
+			continue
+		}
+		if err != nil || rec != test.want {
+			t.Errorf("parseManifestLine(%q) = %+v, %v, want %+v", test.line, rec, err, test.want)
+		}
+	}
+}
+
+func TestManifestParser(t *testing.T) {
+	input := "\xef\xbb\xbf# mass-crc32c started=2024-01-02T03:04:05Z\r\n" +
+		"AAAAAA== 1 a\r\n" +
+		"\n" +
+		"garbage\x00\xff line\n" +
+		"AAAAAA== 2 b\n" +
+		"# trailer\n"
+
+	var comments []string
+	records, mp, diag, err := parseAll(t, []byte(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Path != "a" || records[1].Path != "b" || mp.Skipped() != 1 {
+		t.Errorf("got %+v, %d skipped", records, mp.Skipped())
+	}
+	if !strings.Contains(diag, `m.txt:4: malformed manifest line in "garbage\x00\xff line"`) {
+		t.Errorf("diagnostic must locate and escape the line, got %q", diag)
+	}
+
+	mp, err = newManifestParser("m.txt", strings.NewReader(input), false, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.onComment = func(line string) { comments = append(comments, line) }
+	for _, err = mp.Next(); err == nil; _, err = mp.Next() {
+	}
+	if len(comments) != 2 || !strings.HasPrefix(comments[0], "# mass-crc32c") {
+		t.Errorf("comments %q", comments)
+	}
+
+	_, _, _, err = parseAll(t, []byte(input), true)
+	var lineErr *manifestLineError
+	if !errors.As(err, &lineErr) || lineErr.line != 4 {
+		t.Errorf("strict mode must fail on line 4, got %v", err)
+	}
+}
+
+func TestManifestParserFormats(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	fmt.Fprint(zw, "AAAAAA== 1 a\n")
+	zw.Close()
+	records, _, _, err := parseAll(t, gz.Bytes(), true)
+	if err != nil || len(records) != 1 {
+		t.Errorf("gzip manifest: %+v, %v", records, err)
+	}
+
+	_, _, _, err = parseAll(t, []byte("\xff\xfeA\x00"), false)
+	if !errors.Is(err, errUTF16Manifest) {
+		t.Errorf("UTF-16 manifest must be rejected, got %v", err)
+	}
+
+	long := "AAAAAA== 1 " + strings.Repeat("x", manifestMaxLine)
+	_, _, _, err = parseAll(t, []byte("AAAAAA== 1 a\n"+long+"\n"), false)
+	if err == nil || !strings.Contains(err.Error(), "m.txt:2:") {
+		t.Errorf("too long line must fail with its number, got %v", err)
+	}
+
+	lineErr := &manifestLineError{name: "m", line: 1, text: strings.Repeat("y", 200), err: errors.New("bad")}
+	if msg := lineErr.Error(); len(msg) > manifestQuoteLimit+30 || !strings.HasSuffix(msg, `"...`) {
+		t.Errorf("offending bytes must be truncated, got %q", msg)
+	}
+}
+
+func TestManifestParserReportLimit(t *testing.T) {
+	records, mp, diag, err := parseAll(t, []byte(strings.Repeat("bad\n", 50)+"AAAAAA== 1 a\n"), false)
+	if err != nil || len(records) != 1 || mp.Skipped() != 50 {
+		t.Fatalf("got %+v, %d skipped, %v", records, mp.Skipped(), err)
+	}
+	if n := strings.Count(diag, "\n"); n != manifestReportedErrs+1 {
+		t.Errorf("expected %d diagnostic lines, got %d", manifestReportedErrs+1, n)
+	}
+}
+
+func FuzzParseManifestLine(f *testing.F) {
+	f.Add("AAAAAA== 12 a/b")
+	f.Add("3\tAAAAAA== 0 with spaces")
+	f.Add("AAAAAA== 12")
+	f.Add("\x00\xff 1 x")
+	f.Fuzz(func(t *testing.T, line string) {
+		rec, err := parseManifestLine(line)
+		if err != nil {
+			return
+		}
+		// a parsed record written back parses to itself
+		again, err := parseManifestLine(fmt.Sprintf("%s %d %s", rec.CRC, rec.Size, rec.Path))
+		if err != nil || again != rec {
+			t.Errorf("%q: %+v does not round trip: %+v, %v", line, rec, again, err)
+		}
+	})
+}
+
+func FuzzManifestParser(f *testing.F) {
+	f.Add([]byte("# header\nAAAAAA== 1 a\r\nbad\n\nAAAAAA== 2 b c\n"))
+	f.Add([]byte("\xef\xbb\xbfAAAAAA== 1 a"))
+	f.Add([]byte{0x1f, 0x8b, 0x08})
+	f.Fuzz(func(t *testing.T, input []byte) {
+		mp, err := newManifestParser("fuzz", bytes.NewReader(input), false, io.Discard)
+		if err != nil {
+			return
+		}
+		defer mp.Close()
+		for i := 0; ; i++ {
+			rec, err := mp.Next()
+			if err != nil {
+				return
+			}
+			if rec.Path == "" || strings.ContainsAny(rec.Path, "\n") {
+				t.Fatalf("bad record %+v", rec)
+			}
+			if i > len(input) {
+				t.Fatal("more records than input bytes")
+			}
+		}
+	})
+}
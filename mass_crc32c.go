@@ -1,71 +1,218 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// QueueItem is a path message of PathQueueG
+type QueueItem struct {
+	Path         string
+	Ordinal      string      // optional ordering key given by the input list, written in front of the record
+	Hints        Hints       // optional hints given by the input list
+	Info         fs.FileInfo // optional info captured by the walk, see cachedInfo for who may use it
+	Expected     string      // optional CRC the file must have, given by an -input json job
+	ExpectedHead string      // optional -edge-digest edges the file must have, given by an -input json job
+	ExpectedTail string
+	Label        json.RawMessage // optional label object given by an -input json job, written in the records
+	seq          uint64          // enqueue order, records are written in this order with -ordered
+	priority     bool            // injected by EnqueuePriority, its result echoed to DebugOut
+	worker       string          // id of the worker handling the item, set by queueHandler
+	stats        *workerStats    // stats of that worker
+}
+
+// ErrInterrupted is returned by the enqueue methods once the run is interrupted
+var ErrInterrupted = errors.New("interrupted")
+
 type MassCRC32C struct {
-	wg          sync.WaitGroup
-	PathQueueG  chan string
-	Interrupted bool
+	// counters are updated concurrently by the walker and the workers,
+	// atomic.Uint64 keeps them 64-bit aligned on 32-bit platforms too
+	fileCount           atomic.Uint64
+	fileErrorCount      atomic.Uint64
+	directoryErrorCount atomic.Uint64
+	ignoredFilesCount   atomic.Uint64
+	excludedCount       atomic.Uint64
+	mountsSkipped       atomic.Uint64 // directories on another device than their root not entered with -xdev
+	priorityCount       atomic.Uint64 // paths injected by EnqueuePriority and -priority-spool
+	priorityBytes       atomic.Uint64 // data computed for the injected paths
+	rejectedCount       atomic.Uint64 // stdin list entries rejected by the listGuard
+	sizeFilteredCount   atomic.Uint64 // files out of the -minsize and -maxsize range
+	mtimeSkippedCount   atomic.Uint64 // files out of the -newer-than and -older-than window
+	totalDataComputed   atomic.Uint64
+	carriedForwardCount atomic.Uint64
+	bytesRead           atomic.Uint64
+	rootsWalked         atomic.Uint64
+	listsRead           atomic.Uint64
+	verifiedCount       atomic.Uint64 // files matching the expected CRC of their -input json job
+	badBlockFiles       atomic.Uint64
+	edgeBytes           atomic.Uint64 // tail bytes read again for the -edge-digest edges
+	firstFileTime       atomic.Int64  // unix nanoseconds
+	lastFileTime        atomic.Int64
+	endTime             atomic.Int64 // TearDown completed
+	tornDown            atomic.Bool
+
+	wg              sync.WaitGroup
+	PathQueueG      chan QueueItem
+	priorityQueue   chan QueueItem // the injected urgent paths taken first, nil without EnablePriorityQueue
+	spool           *prioritySpool // -priority-spool
+	Interrupted     atomic.Bool    // set on a CTRL+C, read by the producers, workers and writer
+	ExtendedSummary bool
+
+	// DisableSignalHandling leaves the signals to the host application, set before Startup
+	DisableSignalHandling bool
+	signals               chan os.Signal // HandleSignals, nil when not handled
+	signalsDone           chan struct{}  // closed when the goroutine of HandleSignals ends
 
 	readSizeG    int
-	crc32cTableG *crc32.Table
+	crc32cTableG *crc32.Table // -chunk-manifest, only CRC-32C chunks are combined
+	crc          *crcEngine
+	algos        []string // -algo of CRCReader, the CRC of crc by default
+	encoding     string   // -enc of the CRCs, base64 by default
 
-	startTime           time.Time
-	fileCount           uint64
-	fileErrorCount      uint64
-	directoryErrorCount uint64
-	ignoredFilesCount   uint64
-	totalDataComputed   uint64
+	startTime time.Time
 
 	bufferPool  sync.Pool
-	HandlerFunc func(path string) error
+	HandlerFunc func(item QueueItem) error
+
+	enqueueSeq   atomic.Uint64
+	ordered      bool
+	orderSlots   chan struct{} // -ordered, a slot per queued result not written yet
+	shuffle      *shuffler     // -shuffle, nil when the paths are enqueued in order
+	coordinator  *coordinator  // -coordinator, nil when the paths are handled locally
+	excludes     excludePatterns
+	includes     excludePatterns
+	excludeRes   pathRegexps
+	skipHidden   bool
+	stream       *resultStream // Results and Run, nil otherwise
+	includeRes   pathRegexps
+	sizes        *sizeFilter   // -minsize and -maxsize, nil when off
+	mtimes       *mtimeFilter  // -newer-than and -older-than, nil when off
+	fifoTimeout  time.Duration // -fifo-timeout, 0 without
+	results      chan fileResult
+	writerDone   chan struct{}
+	dirEvents    *dirTracker
+	indexOut     *indexWriter
+	sqliteOut    *sqliteWriter
+	fingerprint  *fingerprinter
+	tierSlots    map[string]chan struct{} // concurrent reads allowed per tier hint
+	chunkSize    uint64
+	growingFiles growthPolicy
+	badBlocks    *badBlockConfig      // -skip-bad-blocks, nil when a failed read fails the file
+	edgeSize     int64                // -edge-digest, 0 when off
+	outSpace     *outSpace            // -min-free-space, nil when off
+	compression  *compressionEstimate // -estimate-compression, nil when off
+	chunkOut     io.Writer
+	cleanOut     *cleanOutput
+	writeRecord  recordWriter
+	nulRecords   bool                    // -z, the records end with a NUL
+	recordFormat string                  // -format of the records, text by default
+	jsonInput    bool                    // the list is read as -input json jobs, their labels are written in the records
+	writeHeader  func(w io.Writer) error // writes the header of the outputs, none when nil
+	buildHeader  bool                    // the text outputs start with the build header line
+	schemaHeader bool                    // the csv and jsonl outputs start with the schema declaration line
+	statFields   statFields
+	birthTimes   bool // -stat-fields btime and the platform reports the birth times
+	inodeBytes   *inodeBytes
+	writerStats  writerStats
+	since        *sinceManifest
+	strictParse  bool
+	strictTypes  strictTypes
+	snapshotDirs *snapshotDirs
+	deniedDirs   *deniedDirs
+	walkPacer    *walkPacer
+	ownedPaths   ownedPaths
+	recorder     *recorder
+	replay       *replayLog
+
+	lowMemory      lowMemoryConfig
+	largeFileSlots chan struct{}     // concurrent reads allowed of the large files
+	openers        map[string]Opener // by URL scheme, the paths of the other schemes are local files
+	freeOSMemory   chan struct{}     // closed by TearDown to stop the FreeOSMemory loop
+
+	workerStats  []*workerStats
+	walkerProbe  *schedProbe
+	writerProbe  *schedProbe
+	schedAdvised atomic.Bool
 
 	stdin    io.Reader
 	StdOut   io.Writer
 	ErrOut   io.Writer
 	DebugOut io.Writer
+
+	errReporter errorReporter
+	accounting  accounting
+}
+
+func (mc *MassCRC32C) printErr(scope string, worker string, path string, err error) {
+	mc.accounting.attempted[recordError].Add(1)
+	mc.recordErr(scope, worker, path, err)
+}
+
+// recordErr writes an error record already accounted as attempted, the error of a result
+func (mc *MassCRC32C) recordErr(scope string, worker string, path string, err error) {
+	if mc.errReporter.print(mc.ErrOut, scope, worker, path, err) == nil {
+		mc.accounting.recorded[recordError].Add(1)
+	}
 }
 
-func (mc *MassCRC32C) printErr(path string, err error) {
-	fmt.Fprintf(mc.ErrOut, "error: '%s': %v\n", path, err)
+// SetJSONErrors writes the error records as JSON lines
+func (mc *MassCRC32C) SetJSONErrors(enabled bool) {
+	mc.errReporter.json = enabled
 }
 
+// CRCReader returns the digest of the -algo of the run, the CRC by default, and the size of the data of reader,
+// the size is what was read before the error on error. Each buffer read updates all the digests of a multiple
+// -algo, returned separated by spaces, so the data is read and accounted once.
 func (mc *MassCRC32C) CRCReader(reader io.Reader) (string, uint64, error) {
-	checksum := crc32.Checksum([]byte(""), mc.crc32cTableG)
+	digests := mc.newDigests()
 	buf := mc.bufferPool.Get().([]byte)
 	defer func() { mc.bufferPool.Put(buf) }()
 	fileSize := uint64(0)
 	for {
 		switch n, err := reader.Read(buf); err {
 		case nil:
-			checksum = crc32.Update(checksum, mc.crc32cTableG, buf[:n])
+			for _, digest := range digests {
+				digest.Write(buf[:n])
+			}
 			fileSize += uint64(n)
 		case io.EOF:
-			b := make([]byte, 4)
-			binary.BigEndian.PutUint32(b, checksum)
-			str := base64.StdEncoding.EncodeToString(b)
-			return str, fileSize, nil
+			mc.bytesRead.Add(fileSize)
+			return mc.encodeDigests(digests), fileSize, nil
 		default:
-			return "", 0, err
+			mc.bytesRead.Add(fileSize)
+			return "", fileSize, err
 		}
 	}
 }
 
-func (mc *MassCRC32C) queueHandler(handler func(path string) error) {
+func (mc *MassCRC32C) queueHandler(stats *workerStats, handler func(item QueueItem) error) {
 	defer mc.wg.Done()
-	for path := range mc.PathQueueG { // consume the messages in the queue
-		err := handler(path)
+	worker := strconv.Itoa(stats.id)
+	waitStart := time.Now()
+	for { // consume the messages in the queue
+		item, ok := mc.nextItem()
+		if !ok {
+			break
+		}
+		handleStart := time.Now()
+		stats.idle.Add(int64(handleStart.Sub(waitStart)))
+		item.worker = worker
+		item.stats = stats
+		err := handler(item)
+		waitStart = time.Now()
+		mc.markFileTimes(handleStart, waitStart)
+		stats.busy.Add(int64(waitStart.Sub(handleStart)))
+		stats.files.Add(1)
 		if err != nil {
 			break
 		}
@@ -73,34 +220,212 @@ func (mc *MassCRC32C) queueHandler(handler func(path string) error) {
 	return
 }
 
-func (mc *MassCRC32C) fileHandler(path string) error {
-	err, fileSize, crc := mc.pathToCRC(path)
+// countComputed accounts for a file read by a worker
+func (mc *MassCRC32C) countComputed(item QueueItem, fileSize uint64) {
+	mc.fileCount.Add(1)
+	mc.totalDataComputed.Add(fileSize)
+	if item.stats != nil {
+		item.stats.bytes.Add(fileSize)
+	}
+}
+
+// wantsWalkInfo reports whether a consumer of cachedInfo is enabled, the walk captures the info of the files then
+func (mc *MassCRC32C) wantsWalkInfo() bool {
+	return mc.sqliteOut != nil || mc.statFields.enabled()
+}
+
+// cachedInfo returns the info of the item captured by the walk, or stats it when the walk did not, nil on error.
+// The info is as old as the walk so only the consumers not needing it fresh may use it: the mtime of -sqlite
+// and the -stat-fields. The size class of -low-memory and the checks of a file changing while read,
+// -growing-files and -skip-bad-blocks, use the size of the open file and -since stats the file again.
+func (mc *MassCRC32C) cachedInfo(item QueueItem) fs.FileInfo {
+	if item.Info != nil {
+		return item.Info
+	}
+	info, err := os.Stat(longPath(item.Path))
 	if err != nil {
-		mc.printErr(path, err)
-		atomic.AddUint64(&mc.fileErrorCount, 1)
 		return nil
 	}
-	fmt.Fprintf(mc.StdOut, "%s %d %s\n", crc, fileSize, path)
-	atomic.AddUint64(&mc.fileCount, 1)
-	atomic.AddUint64(&mc.totalDataComputed, fileSize)
-	return nil
+	return info
 }
 
-func (mc *MassCRC32C) pathToCRC(path string) (error, uint64, string) {
-	file, err := os.Open(path)
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			mc.printErr(path, err)
+func (mc *MassCRC32C) fileHandler(item QueueItem) error {
+	var info fs.FileInfo
+	var mtime int64
+	var stat fileStat
+	if mc.wantsWalkInfo() || mc.filtersInfo() {
+		info = mc.cachedInfo(item)
+	}
+	// the walked files were filtered already, the listed ones are stated here, a failing stat is reported by the read
+	if mc.filtersInfo() && info != nil && mc.infoFiltered(item.Path, info) {
+		if mc.ordered {
+			mc.results <- fileResult{item: item, filtered: true}
+		}
+		return nil
+	}
+	if info != nil {
+		if mc.sqliteOut != nil {
+			mtime = info.ModTime().Unix()
+		}
+		if mc.statFields.enabled() {
+			stat = fileStatOf(longPath(item.Path), info)
+			if mc.birthTimes {
+				stat.btime = birthTime(longPath(item.Path), info)
+			}
+		}
+	}
+	if mc.since != nil {
+		// a carried forward CRC not matching the expected one is read again
+		if previous, fileSize, ok := mc.since.carryForward(item.Path); ok {
+			if crc := mc.formatCRC(previous); item.verify(crc, nil) == nil {
+				mc.carriedForwardCount.Add(1)
+				mc.sendResult(fileResult{item: item, crc: crc, size: fileSize, mtime: mtime, stat: stat, carried: true})
+				return nil
+			}
 		}
-	}(file)
+	}
+	slots := mc.tierSlots[item.Hints.Tier]
+	if slots != nil {
+		slots <- struct{}{}
+	}
+	err, fileSize, crc, chunks, bad, edges := mc.pathToChunkedCRC(item.Path, item.worker, mc.chunkSize)
+	if slots != nil {
+		<-slots
+	}
+	if err == nil {
+		err = item.verify(crc, edges)
+	}
 	if err != nil {
-		return err, 0, ""
+		mc.fileErrorCount.Add(1)
+		mc.errReporter.waste(err, fileSize)
+		mc.sendResult(fileResult{item: item, err: err})
+		return nil
+	}
+	mc.countComputed(item, fileSize)
+	if mc.inodeBytes != nil {
+		mc.inodeBytes.add(stat, fileSize)
+	}
+	if bad != nil {
+		mc.badBlockFiles.Add(1)
+	}
+	if item.expects() {
+		mc.verifiedCount.Add(1)
+	}
+	mc.sendResult(fileResult{item: item, crc: crc, size: fileSize, mtime: mtime, stat: stat, chunks: chunks, bad: bad, edges: edges})
+	return nil
+}
+
+// Enqueue adds a path to checksum, blocking while the queue is full.
+// Producers must call it between Startup and TearDown, it returns ErrInterrupted after a CTRL+C.
+func (mc *MassCRC32C) Enqueue(path string) error {
+	return mc.EnqueueItem(QueueItem{Path: path})
+}
+
+// EnqueueBatch adds the paths in order with the semantics of Enqueue, stopping at the first error
+func (mc *MassCRC32C) EnqueueBatch(paths []string) error {
+	for _, path := range paths {
+		if err := mc.EnqueueItem(QueueItem{Path: path}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueItem is Enqueue for an item carrying more than a path, it is the single enqueue code path
+func (mc *MassCRC32C) EnqueueItem(item QueueItem) error {
+	if mc.Interrupted.Load() || mc.cancelled() {
+		return ErrInterrupted
+	}
+	if mc.ordered && !mc.acquireOrderSlot() {
+		return ErrInterrupted
+	}
+	item.seq = mc.enqueueSeq.Add(1) - 1
+	if mc.shuffle != nil {
+		released, ok := mc.shuffle.add(item)
+		if !ok {
+			return nil
+		}
+		item = released
+	}
+	mc.PathQueueG <- item // add a path message to the queue (blocking when queue is full)
+	return nil
+}
+
+func (mc *MassCRC32C) pathToCRC(path string, worker string) (error, uint64, string) {
+	err, fileSize, crc, _, bad, _ := mc.pathToChunkedCRC(path, worker, 0)
+	if err == nil && bad != nil {
+		err = bad // a partial checksum is never returned as the checksum of the file
 	}
-	crc, fileSize, err := mc.CRCReader(file)
 	return err, fileSize, crc
 }
 
+// pathToChunkedCRC is pathToCRC also returning the CRC of every chunkSize bytes when chunkSize is not 0,
+// the unreadable ranges stepped over with -skip-bad-blocks, nil when none, and the -edge-digest edges,
+// nil when off or the size is unknown. The path is opened by the Opener of its scheme.
+func (mc *MassCRC32C) pathToChunkedCRC(path string, worker string, chunkSize uint64) (error, uint64, string, []chunkRecord, *badBlocks, *edgeDigests) {
+	rc, size, err := mc.openerOf(path).Open(path)
+	if err != nil {
+		return err, 0, "", nil, nil, nil
+	}
+	defer func() {
+		err := rc.Close()
+		if err != nil {
+			mc.printErr(errScopeFile, worker, path, err)
+		}
+	}()
+	defer mc.acquireLargeFile(size)()
+	if file, ok := rc.(*sourceFile); ok && mc.lowMemory.dropPageCache {
+		defer dropPageCache(file.Fd())
+	}
+	var reader io.Reader = rc
+	var bbr *badBlockReader
+	var er *edgeReader
+	var tail io.ReaderAt
+	policy := growthFollow
+	var openSize uint64
+	if size >= 0 {
+		if rs, ok := rc.(io.ReadSeeker); ok && mc.badBlocks != nil {
+			bbr = newBadBlockReader(rs, size, *mc.badBlocks)
+			reader = bbr
+		}
+		if ra, ok := rc.(io.ReaderAt); ok && mc.edgeSize > 0 {
+			er = newEdgeReader(reader, mc.crc, mc.edgeSize)
+			reader = er
+			tail = ra
+		}
+		policy = mc.growingFiles
+		openSize = uint64(size)
+		if policy == growthTruncate {
+			reader = io.LimitReader(reader, size)
+		}
+	}
+	if mc.compression != nil {
+		reader = mc.compression.newReader(reader, path)
+	}
+	var crc string
+	var fileSize uint64
+	var chunks []chunkRecord
+	if chunkSize == 0 {
+		crc, fileSize, err = mc.CRCReader(reader)
+	} else {
+		crc, fileSize, chunks, err = mc.chunkedCRCReader(reader, chunkSize)
+	}
+	if bbr == nil {
+		if err == nil {
+			err = policy.check(fileSize, openSize)
+		}
+		var edges *edgeDigests
+		if err == nil && er != nil {
+			edges, err = mc.edges(er, tail, crc, fileSize)
+		}
+		return err, fileSize, crc, chunks, nil, edges
+	}
+	if err == nil {
+		err = policy.check(fileSize+bbr.skipped(), openSize)
+	}
+	return err, fileSize, crc, chunks, bbr.bad, nil
+}
+
 func InitMassCRC32C(
 	readSize int,
 	queueLength int,
@@ -108,46 +433,407 @@ func InitMassCRC32C(
 	var mc MassCRC32C
 	mc.readSizeG = readSize
 	mc.crc32cTableG = crc32.MakeTable(crc32.Castagnoli)
-	mc.PathQueueG = make(chan string, queueLength) // use a channel with a size to limit the number of list ahead path
+	mc.crc = newCRCEngine(castagnoliParams)
+	mc.algos = []string{algoCRC32C}
+	mc.PathQueueG = make(chan QueueItem, queueLength) // use a channel with a size to limit the number of list ahead path
 
 	mc.bufferPool = sync.Pool{New: func() any { return make([]byte, 1024*mc.readSizeG) }}
 
 	mc.HandlerFunc = mc.fileHandler
+	mc.writeRecord = writeTextRecord
+	mc.recordFormat = "text"
+	mc.results = make(chan fileResult, queueLength)
+	mc.snapshotDirs = newSnapshotDirs(nil)
+	mc.walkerProbe = newSchedProbe("walker")
+	mc.writerProbe = newSchedProbe("writer")
 
 	mc.stdin = os.Stdin
 	mc.StdOut = os.Stdout
 	mc.ErrOut = os.Stderr
 	mc.DebugOut = os.Stderr
-
-	// Notify walk to gracefully stop on a CTRL+C via the 'interrupted' flag
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt)
-	go func() {
-		<-interruptChan
-		mc.Interrupted = true
-	}()
+	mc.errReporter.now = time.Now
 	return &mc
 }
 
-func (mc *MassCRC32C) Startup(jobCount int) {
-	// create the coroutines
-	for i := 0; i < jobCount; i++ {
-		mc.wg.Add(1)
-		go mc.queueHandler(mc.HandlerFunc)
+// HandleSignals stops the walk gracefully on a CTRL+C via the Interrupted flag, prints the summary
+// to DebugOut on SIGUSR1 and the writer stats and goroutine counts on SIGUSR2, until TearDown. Startup calls it unless DisableSignalHandling is set, the CLI
+// calls it earlier to also stop the work done before Startup.
+func (mc *MassCRC32C) HandleSignals() {
+	if mc.signals != nil {
+		return
+	}
+	mc.signals = make(chan os.Signal, 1)
+	mc.signalsDone = make(chan struct{})
+	signal.Notify(mc.signals, append(append([]os.Signal{os.Interrupt}, summarySignals...), diagnosticSignals...)...)
+	goroutines.spawn(goroutineSignals, func() {
+		defer close(mc.signalsDone)
+		for sig := range mc.signals {
+			switch {
+			case sig == os.Interrupt:
+				mc.Interrupted.Store(true)
+			case isDiagnosticSignal(sig):
+				mc.printWriterStats(mc.Stats())
+				goroutines.print(mc.DebugOut, len(mc.workerStats))
+			default:
+				mc.PrintSummary()
+			}
+		}
+	})
+}
+
+// stopSignals gives the signals back to the host application and ends the goroutine of HandleSignals
+func (mc *MassCRC32C) stopSignals() {
+	if mc.signals == nil {
+		return
+	}
+	signal.Stop(mc.signals)
+	close(mc.signals)
+	<-mc.signalsDone
+	mc.signals = nil
+}
+
+// EnableDirEvents writes a DONE line to out when all files directly under a walked directory are written,
+// or with recursive when its whole sub tree is, must be called before Startup
+func (mc *MassCRC32C) EnableDirEvents(out io.Writer, recursive bool) {
+	mc.dirEvents = newDirTracker(out, recursive)
+}
+
+// EnableIndexedOutput also writes the results sorted by path in an indexed manifest, finalized by TearDown
+func (mc *MassCRC32C) EnableIndexedOutput(path string) {
+	mc.indexOut = newIndexWriter(path)
+}
+
+// EnableSQLiteOutput also writes the results in the files table of a SQLite database, upserting
+// the known paths, rows are committed every batchSize and by TearDown
+func (mc *MassCRC32C) EnableSQLiteOutput(path string, runID string, batchSize int) error {
+	sw, err := newSQLiteWriter(path, runID, batchSize)
+	if err != nil {
+		return err
+	}
+	mc.sqliteOut = sw
+	return nil
+}
+
+// EnableFingerprint computes a fingerprint of all the records printed by the summary after TearDown,
+// exact sorts the full paths on disk instead of keeping 32 bytes per file in memory
+func (mc *MassCRC32C) EnableFingerprint(exact bool) {
+	mc.fingerprint = newFingerprinter(exact)
+}
+
+// LimitTierJobs limits the concurrent reads of the paths of each tier hint, must be called before Startup
+func (mc *MassCRC32C) LimitTierJobs(tierJobs map[string]int) {
+	mc.tierSlots = make(map[string]chan struct{})
+	for tier, jobs := range tierJobs {
+		mc.tierSlots[tier] = make(chan struct{}, jobs)
+	}
+}
+
+// EnableChunkManifest also writes to out a "crc offset length path" record per chunkSize bytes of every file read,
+// the files carried forward by -since are not read and get none, must be called before Startup
+func (mc *MassCRC32C) EnableChunkManifest(chunkSize uint64, out io.Writer) {
+	mc.chunkSize = chunkSize
+	mc.chunkOut = out
+}
+
+// EnableLowMemory applies a lowMemoryConfig, must be called before Startup
+func (mc *MassCRC32C) EnableLowMemory(cfg lowMemoryConfig) {
+	mc.lowMemory = cfg
+	mc.readSizeG = cfg.readSize
+	if cfg.largeFileJobs > 0 {
+		mc.largeFileSlots = make(chan struct{}, cfg.largeFileJobs)
+	}
+}
+
+// EnableErrorCache prunes the directories denied in the runs using the cache at path for maxAge,
+// or walks them again with retry, the cache is saved by TearDown
+func (mc *MassCRC32C) EnableErrorCache(path string, maxAge time.Duration, retry bool) {
+	mc.deniedDirs = &deniedDirs{
+		cache: loadPersistentSet(path, maxAge, time.Now(), mc.DebugOut),
+		retry: retry,
+		now:   time.Now,
+	}
+}
+
+// EnableRecording writes the walk events and the results of the run to path, for -replay
+func (mc *MassCRC32C) EnableRecording(path string) error {
+	r, err := newRecorder(path)
+	if err != nil {
+		return err
+	}
+	mc.recorder = r
+	return nil
+}
+
+// EnableReplay loads a recording and gives its results instead of reading the files,
+// FileInput.Replay then drives the run, must be called before Startup
+func (mc *MassCRC32C) EnableReplay(path string) error {
+	log, err := loadRecording(path, mc.DebugOut)
+	if err != nil {
+		return err
+	}
+	mc.replay = log
+	mc.HandlerFunc = mc.replayHandler
+	return nil
+}
+
+// EnableCleanOutput also writes to out the records of the files read without error in this run,
+// must be called before Startup
+func (mc *MassCRC32C) EnableCleanOutput(out io.Writer) {
+	mc.cleanOut = &cleanOutput{out: out}
+}
+
+// EnableProgressMarkers writes a "# progress" comment line to the output after every n records and after the last one,
+// must be called before Startup
+func (mc *MassCRC32C) EnableProgressMarkers(n uint64) {
+	mc.writerStats.markEvery = n
+}
+
+// RouteErrors writes the errors of the scopes to w instead of ErrOut, must be called before Startup
+func (mc *MassCRC32C) RouteErrors(w io.Writer, scopes ...string) {
+	mc.errReporter.route(w, scopes...)
+}
+
+// SetGrowingFiles sets how the files whose size changes while they are read are checksummed,
+// must be called before Startup
+func (mc *MassCRC32C) SetGrowingFiles(policy growthPolicy) {
+	mc.growingFiles = policy
+}
+
+// EnableJSONInput reads the list as the JSON jobs of -input json, verifying their expected CRC and
+// writing their labels in the jsonl and csv records, must be called before Startup
+func (mc *MassCRC32C) EnableJSONInput() {
+	mc.jsonInput = true
+}
+
+// Mismatches returns the count of files not matching the expected CRC of their -input json job
+func (mc *MassCRC32C) Mismatches() uint64 {
+	return mc.errReporter.classCounts[classMismatch].Load()
+}
+
+// EnableSkipBadBlocks steps over the ranges of the files failing to read with EIO instead of failing them,
+// their records are flagged with the ranges, must be called before Startup
+func (mc *MassCRC32C) EnableSkipBadBlocks(cfg badBlockConfig) {
+	mc.badBlocks = &cfg
+	if mc.recordFormat == "text" {
+		mc.writeRecord = mc.statFields.recordWriter()
+	}
+}
+
+// SetAlgos computes the digests of algos instead of the CRC, in a single read pass, must be called before Startup
+func (mc *MassCRC32C) SetAlgos(algos ...string) {
+	mc.algos = algos
+}
+
+// SetCRCParams computes the CRC of params instead of CRC-32C, must be called before Startup
+func (mc *MassCRC32C) SetCRCParams(params crcParams) {
+	mc.crc = newCRCEngine(params)
+}
+
+// EnableEdgeDigest writes the CRC of the first and last size bytes of the regular files in their records,
+// and verifies the expected edges of the -input json jobs, must be called before Startup
+func (mc *MassCRC32C) EnableEdgeDigest(size int64) {
+	mc.edgeSize = size
+	if mc.recordFormat == "text" {
+		mc.writeRecord = mc.statFields.recordWriter()
+	}
+}
+
+// EnableBinaryOutput writes the records in the binary manifest format instead of text lines,
+// must be called before Startup
+func (mc *MassCRC32C) EnableBinaryOutput() {
+	mc.recordFormat = "binary"
+	mc.writeRecord = newBinaryRecordWriter()
+	mc.writeHeader = writeBinaryManifestHeader
+}
+
+// EnableJSONLOutput writes the records as JSON objects, one per line, must be called before Startup
+func (mc *MassCRC32C) EnableJSONLOutput() {
+	mc.recordFormat = "jsonl"
+	mc.writeRecord = mc.writeJSONRecord
+}
+
+// EnableCSVOutput writes the records as CSV rows, after a column names row when header,
+// must be called before Startup
+func (mc *MassCRC32C) EnableCSVOutput(header bool) {
+	mc.recordFormat = "csv"
+	mc.writeRecord = mc.newCSVRecordWriter()
+	if header {
+		mc.writeHeader = mc.writeCSVHeader
 	}
+}
+
+// EnableStatFields writes the stat fields after the path of the text records and accounts
+// the computed bytes unique by inode for the summary, must be called before Startup
+func (mc *MassCRC32C) EnableStatFields(sf statFields) {
+	mc.statFields = sf
+	mc.birthTimes = sf.btime && birthTimeProbe()
+	mc.inodeBytes = newInodeBytes()
+	if mc.recordFormat == "text" {
+		mc.writeRecord = sf.recordWriter()
+	}
+}
+
+// EnableOrderedOutput writes the records in the order the paths were queued, the list order for a list
+// whatever its ordinals. The writer holds at most window results waiting for a slower one, the producers
+// then block. Must be called before Startup.
+func (mc *MassCRC32C) EnableOrderedOutput(window int) {
+	mc.ordered = true
+	mc.orderSlots = make(chan struct{}, window)
+}
+
+// acquireOrderSlot blocks while the -ordered window is full, returning false when interrupted
+func (mc *MassCRC32C) acquireOrderSlot() bool {
+	for {
+		select {
+		case mc.orderSlots <- struct{}{}:
+			return true
+		case <-time.After(walkSleepInterval):
+			if mc.Interrupted.Load() || mc.cancelled() {
+				return false
+			}
+		}
+	}
+}
+
+// EnableStrictParse fails the manifest loads on a malformed line instead of skipping it,
+// must be called before loading them
+func (mc *MassCRC32C) EnableStrictParse() {
+	mc.strictParse = true
+}
+
+// LoadSinceManifest skips reading the files unchanged since the run of a previous manifest and writes
+// their previous CRC instead, runTime overrides the previous run start time when the manifest has none
+func (mc *MassCRC32C) LoadSinceManifest(path string, runTime time.Time) error {
+	sm, err := loadSinceManifest(path, runTime, mc.strictParse, mc.DebugOut)
+	if err != nil {
+		return err
+	}
+	if poly := mc.crc.params.polyName(); poly != "" && sm.poly != poly {
+		sm.Close()
+		return fmt.Errorf("%s: the CRCs use the %s polynomial, not %s", path, sm.poly, poly)
+	}
+	mc.since = sm
+	return nil
+}
+
+// EnableStrictTypes reports the non-regular files found by the walker as errors instead of ignoring them,
+// symlinks included or not
+func (mc *MassCRC32C) EnableStrictTypes(symlinks bool) {
+	mc.strictTypes.enabled = true
+	mc.strictTypes.symlinks = symlinks
+}
+
+// StrictTypeFailures returns the number of non-regular files reported by EnableStrictTypes
+func (mc *MassCRC32C) StrictTypeFailures() uint64 {
+	return mc.strictTypes.failures()
+}
+
+// EnableWalkPacing limits the walk to rate directory listings per second, unlimited when 0, and with
+// pauseOnErrors pauses it exponentially longer while the directory errors keep coming, must be called before walking
+func (mc *MassCRC32C) EnableWalkPacing(rate float64, pauseOnErrors bool) {
+	mc.walkPacer = newWalkPacer(rate, pauseOnErrors, mc.DebugOut)
+}
+
+// SkipSnapshotDirs prunes the snapshot directories found while walking, extraNames adding to the well known ones
+func (mc *MassCRC32C) SkipSnapshotDirs(extraNames []string) {
+	mc.snapshotDirs = newSnapshotDirs(extraNames)
+	mc.snapshotDirs.skip = true
+}
+
+func (mc *MassCRC32C) Startup(jobCount int) {
+	// before the writer starts, the header lines hold it
 	mc.startTime = time.Now()
+	if mc.compression != nil {
+		mc.compression.start = time.Now()
+		mc.compression.workers = jobCount
+	}
+	if mc.nulRecords {
+		mc.writeRecord = nulTerminated(mc.writeRecord)
+	}
+	mc.writerDone = make(chan struct{})
+	goroutines.spawn(goroutineWriter, mc.writeResults)
 
-	// Use SIGUSR1 to print summary to debug output
-	mc.signalToSummary()
+	// create the coroutines, the workers connecting to the coordinator in their place
+	if mc.coordinator != nil {
+		mc.coordinator.start()
+	}
+	for i := 0; i < jobCount && mc.coordinator == nil; i++ {
+		stats := &workerStats{id: i}
+		mc.workerStats = append(mc.workerStats, stats)
+		mc.wg.Add(1)
+		go mc.queueHandler(stats, mc.HandlerFunc)
+	}
+	if mc.lowMemory.freeOSMemory > 0 {
+		period, stop := mc.lowMemory.freeOSMemory, make(chan struct{})
+		mc.freeOSMemory = stop
+		goroutines.spawn(goroutineFreeMemory, func() { freeOSMemoryLoop(period, stop) })
+	}
+	if mc.spool != nil {
+		mc.startSpool()
+	}
+	if !mc.DisableSignalHandling {
+		mc.HandleSignals()
+	}
 }
 
 func (mc *MassCRC32C) TearDown() {
+	if mc.spool != nil {
+		mc.stopSpool()
+	}
+	if mc.shuffle != nil {
+		mc.releaseShuffled()
+	}
 	close(mc.PathQueueG)
 	mc.wg.Wait()
+	mc.tornDown.Store(true)
+	close(mc.results)
+	if mc.writerDone != nil {
+		<-mc.writerDone
+		mc.reconcileAccounting()
+	}
+	if mc.freeOSMemory != nil {
+		close(mc.freeOSMemory)
+		mc.freeOSMemory = nil
+	}
+	if mc.indexOut != nil {
+		if err := mc.indexOut.Close(); err != nil {
+			fmt.Fprintf(mc.DebugOut, "Error: failed to write indexed manifest: %v\n", err)
+		}
+		mc.indexOut = nil
+	}
+	if mc.fingerprint != nil {
+		if err := mc.fingerprint.finish(); err != nil {
+			fmt.Fprintf(mc.DebugOut, "Error: failed to compute the fingerprint: %v\n", err)
+			mc.fingerprint = nil
+		}
+	}
+	if mc.sqliteOut != nil {
+		if err := mc.sqliteOut.Close(); err != nil {
+			fmt.Fprintf(mc.DebugOut, "Error: failed to write sqlite database: %v\n", err)
+		}
+		mc.sqliteOut = nil
+	}
+	if mc.since != nil {
+		mc.since.Close()
+	}
+	if mc.deniedDirs != nil {
+		if err := mc.deniedDirs.Close(mc.DebugOut); err != nil {
+			fmt.Fprintf(mc.DebugOut, "Error: failed to save the error cache: %v\n", err)
+		}
+		mc.deniedDirs = nil
+	}
+	if mc.recorder != nil {
+		if err := mc.recorder.Close(); err != nil {
+			fmt.Fprintf(mc.DebugOut, "Error: failed to write recording: %v\n", err)
+		}
+		mc.recorder = nil
+	}
+	mc.stopSignals()
+	mc.endTime.Store(time.Now().UnixNano())
 }
 
 func (mc *MassCRC32C) PrintSummary() {
-	duration := time.Now().Sub(mc.startTime)
+	stats := mc.Stats()
 	_, _ = fmt.Fprintf(
 		mc.DebugOut,
 		"Summary:\n"+
@@ -158,14 +844,91 @@ func (mc *MassCRC32C) PrintSummary() {
 			"Computed data: %dB\n"+
 			"Duration: %s\n"+
 			"Avg file speed: %d/s\n"+
-			"Avg data speed: %dMB/s\n",
-		mc.fileCount,
-		mc.fileErrorCount,
-		mc.directoryErrorCount,
-		mc.ignoredFilesCount,
-		mc.totalDataComputed,
-		duration.String(),
-		int(float64(mc.fileCount)/duration.Seconds()),
-		int(float64(mc.totalDataComputed)/duration.Seconds()/1024/1024),
+			"Avg data speed: %dMB/s\n"+
+			"Active data speed: %dMB/s over %s (lead-in %s, tail %s)\n",
+		stats.Files,
+		stats.FileErrors,
+		stats.DirErrors,
+		stats.Ignored,
+		stats.BytesComputed,
+		stats.Elapsed().String(),
+		int(stats.Rate()),
+		int(stats.ByteRate()/1024/1024),
+		int(stats.ActiveByteRate()/1024/1024),
+		stats.ActiveElapsed().String(),
+		stats.LeadIn().String(),
+		stats.Tail().String(),
 	)
+	if len(mc.excludes) > 0 || len(mc.excludeRes) > 0 {
+		fmt.Fprintf(mc.DebugOut, "Excluded files and directories: %d\n", stats.Excluded)
+	}
+	if stats.Rejected > 0 {
+		fmt.Fprintf(mc.DebugOut, "Rejected list entries: %d\n", stats.Rejected)
+	}
+	if mc.sizes != nil {
+		fmt.Fprintf(mc.DebugOut, "Size filtered files: %d\n", stats.SizeFiltered)
+	}
+	if mc.mtimes != nil {
+		fmt.Fprintf(mc.DebugOut, "Skipped by modification time: %d\n", stats.MtimeSkipped)
+	}
+	if mc.inodeBytes != nil {
+		fmt.Fprintf(
+			mc.DebugOut,
+			"Computed data unique by inode: %dB, %d files linked to a computed inode\n",
+			mc.inodeBytes.unique.Load(),
+			mc.inodeBytes.linked.Load(),
+		)
+	}
+	if mc.jsonInput {
+		fmt.Fprintf(mc.DebugOut, "Checksums verified: %d, mismatched: %d\n", mc.verifiedCount.Load(), mc.Mismatches())
+	}
+	if mc.badBlocks != nil {
+		fmt.Fprintf(mc.DebugOut, "Files with bad blocks: %d (%s)\n", mc.badBlockFiles.Load(), mc.badBlocks)
+	}
+	if mc.edgeSize > 0 {
+		fmt.Fprintf(mc.DebugOut, "Edge digests: %dB edges, %dB of tails read again\n", mc.edgeSize, mc.edgeBytes.Load())
+	}
+	if mc.outSpace != nil {
+		mc.outSpace.printEpisodes(mc.DebugOut)
+	}
+	mc.errReporter.printClassCounts(mc.DebugOut)
+	mc.errReporter.printWastedBytes(mc.DebugOut)
+	if mc.strictTypes.enabled {
+		mc.strictTypes.printSummary(mc.DebugOut)
+	}
+	if mc.walkPacer != nil {
+		mc.walkPacer.printSummary(mc.DebugOut)
+	}
+	if mc.snapshotDirs.skip {
+		fmt.Fprintf(mc.DebugOut, "Snapshot dirs pruned: %d\n", mc.snapshotDirs.pruned.Load())
+	}
+	if skipped := mc.mountsSkipped.Load(); skipped > 0 {
+		fmt.Fprintf(mc.DebugOut, "Mount points not crossed: %d\n", skipped)
+	}
+	if injected := mc.priorityCount.Load(); injected > 0 {
+		fmt.Fprintf(mc.DebugOut, "Priority files: %d, %dB computed ahead of the queue\n", injected, mc.priorityBytes.Load())
+	}
+	if mc.since != nil {
+		fmt.Fprintf(mc.DebugOut, "Carried forward: %d\n", stats.CarriedForward)
+		if mc.since.skipped > 0 {
+			fmt.Fprintf(mc.DebugOut, "Malformed manifest lines skipped: %d\n", mc.since.skipped)
+		}
+	}
+	if mc.cleanOut != nil {
+		fmt.Fprintf(mc.DebugOut, "Records written: %d, clean: %d\n", mc.cleanOut.records.Load(), mc.cleanOut.clean.Load())
+	}
+	if mc.fingerprint != nil && mc.fingerprint.sum != "" {
+		fmt.Fprintf(mc.DebugOut, "Fingerprint (%s): %s\n", mc.fingerprint.mode(), mc.fingerprint.sum)
+	}
+	if mc.ExtendedSummary {
+		mc.printSchedDelays()
+		mc.printWriterStats(stats)
+		printWorkerStats(mc.DebugOut, mc.workerStats)
+		goroutines.print(mc.DebugOut, len(mc.workerStats))
+		if mc.compression != nil {
+			mc.compression.print(mc.DebugOut)
+		}
+	}
+	printRunInfo(mc.DebugOut, stats)
+	fmt.Fprintf(mc.DebugOut, "Algorithm: %s\n", mc.algoName())
 }
@@ -4,16 +4,11 @@ package main
 
 import (
 	"os"
-	"os/signal"
 	"syscall"
 )
 
-func (mc *MassCRC32C) signalToSummary() {
-	summaryChan := make(chan os.Signal, 1)
-	signal.Notify(summaryChan, syscall.SIGUSR1)
-	go func() {
-		for _ = range summaryChan {
-			mc.PrintSummary()
-		}
-	}()
-}
+// summarySignals print the summary to the debug output
+var summarySignals = []os.Signal{syscall.SIGUSR1}
+
+// diagnosticSignals print the writer stats and the goroutine counts to the debug output
+var diagnosticSignals = []os.Signal{syscall.SIGUSR2}
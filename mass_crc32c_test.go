@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 // implements `io.Reader` interface
@@ -35,14 +44,17 @@ func makeDummyFileReader(payload string) dummyFileReader {
 }
 
 func TestCRCReader(t *testing.T) {
-	mc := InitMassCRC32C(1, 1)
 	tests := []struct {
 		name    string
 		crc32c  string
+		md5     string
+		sha256  string
+		xxh64   string
+		blake3  string
 		payload string
 	}{
-		{"short", "4AmyZA==", "short test data"},
-		{"long", "pSk/Tg==", `Lorem ipsum dolor sit amet, consectetur adipiscing elit. Aliquam ut fermentum eros. Aenean mattis
+		{"short", "4AmyZA==", "Q0GDzM8C7ld9bFLzcFjSOg==", "e9adda8af4cf2bd45760f544adb6bb8971deee8c6f678d24728260aa4af49a1c", "4592f841caa18607", "cedc0222b39ccb706a677fe4fccf9fbc49cfe525fb88755dc5915aed5a6e2ad4", "short test data"},
+		{"long", "pSk/Tg==", "85DD9Hfv30eT09KWNol/Dw==", "133e81486da8f934aeb216d27810543f855ebcf70bc071570fee0b9de12b4422", "18c0a2e5722c46cc", "33cc0e04c6b2a4e1b172928751d50ba58ed111980d552893bbe17abc74eb6276", `Lorem ipsum dolor sit amet, consectetur adipiscing elit. Aliquam ut fermentum eros. Aenean mattis
 accumsan ante nec auctor. Vivamus finibus congue risus, id scelerisque massa fermentum quis. Praesent purus tortor,
 rhoncus quis rhoncus in, posuere in eros. Duis ac congue nunc, non efficitur dolor. Morbi at mauris sed erat
 consectetur blandit vitae vel eros. Curabitur sagittis convallis scelerisque. Cras tempor scelerisque velit in
@@ -76,48 +88,241 @@ fringilla diam maximus. Etiam porttitor tortor id ligula feugiat, in sodales sap
 		},
 	}
 
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			data := makeDummyFileReader(
-				test.payload,
-			)
+	for _, algo := range []string{algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3} {
+		mc := InitMassCRC32C(1, 1)
+		mc.SetAlgos(algo)
+		for _, test := range tests {
+			t.Run(algo+"/"+test.name, func(t *testing.T) {
+				data := makeDummyFileReader(
+					test.payload,
+				)
 
-			crc, dataLen, err := mc.CRCReader(data)
-			if err != nil {
-				t.Errorf("got unexpected error %v", err)
-			}
-			if crc != test.crc32c {
-				t.Errorf("crc32c value error, got %s, expected %s", crc, test.crc32c)
-			}
-			goodLen := uint64(len(test.payload))
-			if dataLen != goodLen {
-				t.Errorf("len error, got %d, expected %d", dataLen, goodLen)
-			}
-			goodReadCount := int(math.Ceil(float64(goodLen) / float64(mc.readSizeG*1024)))
-			if *data.readCount != goodReadCount {
-				t.Errorf("readCount error, got %d, expected %d\n", *data.readCount, goodReadCount)
-			}
-		},
-		)
+				digest, dataLen, err := mc.CRCReader(data)
+				if err != nil {
+					t.Errorf("got unexpected error %v", err)
+				}
+				expected := map[string]string{algoCRC32C: test.crc32c, algoMD5: test.md5, algoSHA256: test.sha256, algoXXH64: test.xxh64, algoBLAKE3: test.blake3}[algo]
+				if digest != expected {
+					t.Errorf("%s value error, got %s, expected %s", algo, digest, expected)
+				}
+				goodLen := uint64(len(test.payload))
+				if dataLen != goodLen {
+					t.Errorf("len error, got %d, expected %d", dataLen, goodLen)
+				}
+				goodReadCount := int(math.Ceil(float64(goodLen) / float64(mc.readSizeG*1024)))
+				if *data.readCount != goodReadCount {
+					t.Errorf("readCount error, got %d, expected %d\n", *data.readCount, goodReadCount)
+				}
+			},
+			)
+		}
+		mc.TearDown()
 	}
-	mc.TearDown()
 }
 
 // Test reading an actual file
 func TestPathToCRC(t *testing.T) {
+	tests := []struct {
+		algo   string
+		digest string
+	}{
+		{algoCRC32C, "WaIfQg=="},
+		{algoMD5, "f6xoF7aq1EmQwidzJUpycA=="},
+		{algoSHA256, "3a334a806d8f497165196a1d8b6b04506886575023b7a4b1b6896b4a8069d718"},
+		{algoXXH64, "1937c85d63b95d60"},
+		{algoBLAKE3, "c19812c987cb4f81a2febbcd7d00db14f38d88ed40acb76496b0a2e1f70e925d"},
+	}
+	for _, test := range tests {
+		mc := InitMassCRC32C(1, 1)
+		mc.SetAlgos(test.algo)
+		path := "test_data.txt"
+		err, fileSize, digest := mc.pathToCRC(path, "0")
+		if err != nil {
+			t.Errorf("got unexpected error %v", err)
+		}
+		if digest != test.digest {
+			t.Errorf("%s value error, got %s, expected %s", test.algo, digest, test.digest)
+		}
+		goodLen := uint64(3538)
+		if fileSize != goodLen {
+			t.Errorf("len error, got %d, expected %d", fileSize, goodLen)
+		}
+		mc.TearDown()
+	}
+}
+
+// Test the counters stay 64-bit aligned so atomic operations are safe on 32-bit platforms
+func TestCounterAlignment(t *testing.T) {
+	var mc MassCRC32C
+	counters := []struct {
+		name   string
+		offset uintptr
+	}{
+		{"fileCount", unsafe.Offsetof(mc.fileCount)},
+		{"fileErrorCount", unsafe.Offsetof(mc.fileErrorCount)},
+		{"directoryErrorCount", unsafe.Offsetof(mc.directoryErrorCount)},
+		{"ignoredFilesCount", unsafe.Offsetof(mc.ignoredFilesCount)},
+		{"totalDataComputed", unsafe.Offsetof(mc.totalDataComputed)},
+		{"carriedForwardCount", unsafe.Offsetof(mc.carriedForwardCount)},
+		{"bytesRead", unsafe.Offsetof(mc.bytesRead)},
+		{"rootsWalked", unsafe.Offsetof(mc.rootsWalked)},
+		{"listsRead", unsafe.Offsetof(mc.listsRead)},
+	}
+	for _, counter := range counters {
+		if counter.offset%8 != 0 {
+			t.Errorf("%s is not 64-bit aligned: offset %d", counter.name, counter.offset)
+		}
+	}
+}
+
+// Test concurrent counter updates while the summary reads them, meant to be run with -race
+func TestConcurrentCounters(t *testing.T) {
 	mc := InitMassCRC32C(1, 1)
-	path := "test_data.txt"
-	err, fileSize, crc := mc.pathToCRC(path)
-	if err != nil {
-		t.Errorf("got unexpected error %v", err)
+	mc.DebugOut = io.Discard
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				mc.fileCount.Add(1)
+				mc.totalDataComputed.Add(10)
+			}
+		}()
+	}
+	mc.PrintSummary()
+	wg.Wait()
+	if got := mc.fileCount.Load(); got != 8000 {
+		t.Errorf("fileCount error, got %d, expected %d", got, 8000)
 	}
-	goodCRC32C := "WaIfQg=="
-	if crc != goodCRC32C {
-		t.Errorf("crc32c value error, got %s, expected %s", crc, goodCRC32C)
+	if got := mc.totalDataComputed.Load(); got != 80000 {
+		t.Errorf("totalDataComputed error, got %d, expected %d", got, 80000)
 	}
-	goodLen := uint64(3538)
-	if fileSize != goodLen {
-		t.Errorf("len error, got %d, expected %d", fileSize, goodLen)
+	mc.TearDown()
+}
+
+// runPipeline runs a pipeline of jobCount workers with its outputs discarded, setup configures it before
+// Startup, capturing an output or enabling the feature under test, and feed queues the work. It returns
+// the pipeline torn down.
+func runPipeline(t testing.TB, jobCount int, setup func(mc *MassCRC32C), feed func(mc *MassCRC32C)) *MassCRC32C {
+	t.Helper()
+	mc := InitMassCRC32C(1, 10)
+	mc.StdOut = io.Discard
+	mc.ErrOut = io.Discard
+	mc.DebugOut = io.Discard
+	if setup != nil {
+		setup(mc)
 	}
+	mc.Startup(jobCount)
+	feed(mc)
 	mc.TearDown()
+	return mc
+}
+
+// runPaths is runPipeline fed with paths
+func runPaths(t testing.TB, jobCount int, paths []string, setup func(mc *MassCRC32C)) *MassCRC32C {
+	t.Helper()
+	return runPipeline(t, jobCount, setup, func(mc *MassCRC32C) {
+		if err := mc.EnqueueBatch(paths); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// Test a custom producer driving the pipeline through the library API
+func TestEnqueueProducers(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 40; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d", i))
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	out := &bytes.Buffer{}
+	mc := runPipeline(t, 4, func(mc *MassCRC32C) { mc.StdOut = out }, func(mc *MassCRC32C) {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for _, path := range paths[:20] {
+				if err := mc.Enqueue(path); err != nil {
+					t.Errorf("enqueue error: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := mc.EnqueueBatch(paths[20:]); err != nil {
+				t.Errorf("enqueue batch error: %v", err)
+			}
+		}()
+		wg.Wait()
+	})
+	if lines := strings.Count(out.String(), "\n"); lines != 40 || mc.fileCount.Load() != 40 {
+		t.Errorf("got %d records and %d files, expected 40", lines, mc.fileCount.Load())
+	}
+}
+
+func TestEnqueueInterrupted(t *testing.T) {
+	mc := runPipeline(t, 1, nil, func(mc *MassCRC32C) {
+		if err := mc.Enqueue("test_data.txt"); err != nil {
+			t.Errorf("enqueue error: %v", err)
+		}
+		mc.Interrupted.Store(true)
+		if err := mc.EnqueueBatch([]string{"test_data.txt"}); err != ErrInterrupted {
+			t.Errorf("got %v, expected ErrInterrupted", err)
+		}
+	})
+	if mc.fileCount.Load() != 1 {
+		t.Errorf("got %d files, expected 1", mc.fileCount.Load())
+	}
+}
+
+// goroutineIDs returns the stacks of the running goroutines by ID, the os/signal loop started once
+// per process by the first signal.Notify excluded
+func goroutineIDs() map[string]string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		id := strings.Fields(stack)[1]
+		if !strings.Contains(stack, "os/signal.signal_recv") && !strings.Contains(stack, "os/signal.loop") {
+			stacks[id] = stack
+		}
+	}
+	return stacks
+}
+
+// Test InitMassCRC32C, a run with its signal handling and TearDown leave no goroutine behind
+func TestNoGoroutineLeak(t *testing.T) {
+	before := goroutineIDs()
+	for _, disable := range []bool{false, true} {
+		setup := func(mc *MassCRC32C) {
+			mc.DisableSignalHandling = disable
+			mc.EnableLowMemory(lowMemoryPreset(1))
+		}
+		runPipeline(t, 4, setup, func(mc *MassCRC32C) {
+			if (mc.signals != nil) == disable {
+				t.Errorf("signals handled %v with DisableSignalHandling %v", mc.signals != nil, disable)
+			}
+			mc.EnqueueBatch([]string{"test_data.txt"})
+		})
+	}
+	var leaked []string
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		leaked = leaked[:0]
+		for id, stack := range goroutineIDs() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) { // the stopped loops may still be exiting
+			break
+		}
+	}
+	for _, stack := range leaked {
+		t.Errorf("leaked goroutine:\n%s", stack)
+	}
 }
@@ -2,6 +2,10 @@
 
 package main
 
-func (mc *MassCRC32C) signalToSummary() {
-	//No signal on windows
-}
+import "os"
+
+// summarySignals is empty, no SIGUSR1 on windows
+var summarySignals []os.Signal
+
+// diagnosticSignals is empty, no SIGUSR2 on windows
+var diagnosticSignals []os.Signal
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// mtimeFilter is the window of the modification times of the files computed, both bounds excluded like
+// find -newer, the files out of it are counted as skipped by modification time
+type mtimeFilter struct {
+	newerThan time.Time // no lower bound when zero
+	olderThan time.Time // no upper bound when zero
+}
+
+// parseTimeBound parses an RFC3339 timestamp, or takes the modification time of the file named
+func parseTimeBound(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	info, err := os.Stat(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a reference file: %w", s, err)
+	}
+	return info.ModTime(), nil
+}
+
+func (mf *mtimeFilter) allows(mtime time.Time) bool {
+	return (mf.newerThan.IsZero() || mtime.After(mf.newerThan)) && (mf.olderThan.IsZero() || mtime.Before(mf.olderThan))
+}
+
+// SetMtimeFilter only computes the files modified after newerThan and before olderThan, each an RFC3339
+// timestamp or a reference file whose modification time is taken, an empty bound is no bound. The walked
+// files are filtered with the info the walk listed, the listed paths are stated by the workers: a file
+// modified between the stat and the read is read as it is then. Must be called before Startup.
+func (mc *MassCRC32C) SetMtimeFilter(newerThan string, olderThan string) error {
+	if newerThan == "" && olderThan == "" {
+		return nil
+	}
+	mf := &mtimeFilter{}
+	var err error
+	if newerThan != "" {
+		if mf.newerThan, err = parseTimeBound(newerThan); err != nil {
+			return fmt.Errorf("-newer-than: %w", err)
+		}
+	}
+	if olderThan != "" {
+		if mf.olderThan, err = parseTimeBound(olderThan); err != nil {
+			return fmt.Errorf("-older-than: %w", err)
+		}
+		if !mf.newerThan.IsZero() && !mf.olderThan.After(mf.newerThan) {
+			return fmt.Errorf("-older-than %s is not after -newer-than %s", olderThan, newerThan)
+		}
+	}
+	mc.mtimes = mf
+	return nil
+}
+
+// filtersInfo tells whether the files are filtered on their info, by -minsize, -maxsize, -newer-than or -older-than
+func (mc *MassCRC32C) filtersInfo() bool {
+	return mc.sizes != nil || mc.mtimes != nil
+}
+
+// infoFiltered tells whether the file path is out of the size range or the modification time window, counting it.
+// The pipes given explicitly have neither a size nor a modification time to filter on.
+func (mc *MassCRC32C) infoFiltered(path string, info fs.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	if mc.sizeFiltered(path, info.Size()) {
+		return true
+	}
+	if mc.mtimes == nil || mc.mtimes.allows(info.ModTime()) {
+		return false
+	}
+	fmt.Fprintf(mc.DebugOut, "skipping, modified %s out of the -newer-than -older-than window: %s\n", info.ModTime().Format(time.RFC3339), path)
+	mc.mtimeSkippedCount.Add(1)
+	return true
+}
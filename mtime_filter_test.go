@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMtimeFilter(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var list string
+	for name, year := range map[string]int{"old": 2020, "mid": 2022, "new": 2024, "../reference": 2023} {
+		path := filepath.Join(root, name)
+		mtime := time.Date(year, 6, 17, 0, 0, 0, 0, time.UTC)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(name, "..") {
+			list += path + "\n"
+		}
+	}
+	run := func(newerThan string, olderThan string, list string) ([]string, Stats) {
+		out := &bytes.Buffer{}
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.stdin = strings.NewReader(list)
+			if err := mc.SetMtimeFilter(newerThan, olderThan); err != nil {
+				t.Fatal(err)
+			}
+			mc.EnableOrderedOutput(defaultOrderedWindow)
+		}
+		mc := runPipeline(t, 4, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc}
+			if list == "" {
+				fi.walkRoots([]string{root})
+			} else {
+				fi.ReadFileList()
+			}
+		})
+		var names []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			if line != "" {
+				names = append(names, filepath.Base(line[strings.LastIndexByte(line, ' ')+1:]))
+			}
+		}
+		sort.Strings(names)
+		return names, mc.Stats()
+	}
+	reference := filepath.Join(dir, "reference")
+	tests := []struct {
+		newerThan string
+		olderThan string
+		expected  string
+	}{
+		{"2021-01-01T00:00:00Z", "2023-01-01T00:00:00Z", "mid"},
+		{reference, "", "new"},
+		{"", reference, "mid old"},
+		{"2022-06-17T00:00:00Z", "", "new"}, // the bounds are excluded
+		{"2019-06-17T02:00:00+02:00", "", "mid new old"},
+	}
+	for _, test := range tests {
+		for _, input := range []string{"", list} {
+			names, stats := run(test.newerThan, test.olderThan, input)
+			if got := strings.Join(names, " "); got != test.expected || stats.MtimeSkipped != uint64(3-len(names)) {
+				t.Errorf("-newer-than %q -older-than %q listed=%t: got %q, %d skipped, expected %q",
+					test.newerThan, test.olderThan, input != "", got, stats.MtimeSkipped, test.expected)
+			}
+		}
+	}
+
+	mc := InitMassCRC32C(1, 1)
+	for _, bad := range [][2]string{{"yesterday", ""}, {"", filepath.Join(dir, "missing")}, {"2024-01-01T00:00:00Z", "2023-01-01T00:00:00Z"}} {
+		if err := mc.SetMtimeFilter(bad[0], bad[1]); err == nil {
+			t.Errorf("-newer-than %q -older-than %q: expected an error", bad[0], bad[1])
+		}
+	}
+}
+
+// Test a file modified out of the window after the walk listed it is read as it is then
+func TestMtimeFilterChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("after the stat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		if err := mc.SetMtimeFilter("2021-01-01T00:00:00Z", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		mc.EnqueueItem(QueueItem{Path: path, Info: info})
+	})
+	if !strings.HasSuffix(out.String(), " 14 "+path+"\n") || mc.Stats().MtimeSkipped != 0 {
+		t.Errorf("got %q, expected the file read with its new size", out.String())
+	}
+}
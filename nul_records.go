@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// With -z the records, their header, the progress markers and the error records end with a NUL instead
+// of a newline, for the consumers like xargs -0 of the paths with newlines. A text record is the CRC,
+// the size and the path, the path being everything after the second space, the jsonl and csv records
+// quote their fields.
+
+// EnableNULRecords ends the records and the error records with a NUL instead of a newline, not for
+// the binary records, must be called before Startup
+func (mc *MassCRC32C) EnableNULRecords() {
+	mc.nulRecords = true
+	mc.errReporter.nul = true
+}
+
+// lineEnd ends the records and the comment lines of the outputs
+func (mc *MassCRC32C) lineEnd() string {
+	if mc.nulRecords {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// nulTerminated writes the records of write with a NUL in place of their final newline, in a reused
+// buffer written whole, its records must be written by a single goroutine
+func nulTerminated(write recordWriter) recordWriter {
+	var buf bytes.Buffer
+	return func(w io.Writer, res Result) {
+		buf.Reset()
+		write(&buf, res)
+		w.Write(endWithNUL(buf.Bytes()))
+	}
+}
+
+// nulTerminatedHeader writes the header lines of writeHeader with a NUL in place of their newline
+func nulTerminatedHeader(writeHeader func(w io.Writer) error) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := writeHeader(&buf); err != nil {
+			return err
+		}
+		_, err := w.Write(bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte{0}))
+		return err
+	}
+}
+
+// endWithNUL replaces the final newline of line by a NUL
+func endWithNUL(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line[n-1] = 0
+	}
+	return line
+}
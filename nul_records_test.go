@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the paths with newlines and spaces are whole in the NUL terminated records, the error records,
+// the header and the progress markers included, through a gzip output
+func TestNULRecords(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "two\nlines and spaces")
+	if err := os.WriteFile(path, []byte("file 0"), 0644); err != nil {
+		t.Skipf("no newline in the file names here: %v", err)
+	}
+	missing := filepath.Join(dir, "missing\nfile")
+
+	outPath := filepath.Join(dir, "out.gz")
+	out, closeOut, err := openOutFile(outPath, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errOut := &bytes.Buffer{}
+	runPaths(t, 2, []string{path, "test_data.txt", missing}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.SetCRCParams(ieeeParams)
+		mc.EnableProgressMarkers(1)
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+		mc.EnableNULRecords()
+	})
+	closeOut()
+
+	f, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	if len(records) != 6 || records[0] != strings.TrimSuffix(ieeeParams.polyHeader(), "\n") ||
+		!strings.HasPrefix(records[2], "# progress files=1 ") || !strings.HasPrefix(records[5], "# progress files=2 ") {
+		t.Fatalf("got %q", data)
+	}
+	fields := strings.SplitN(records[1], " ", 3)
+	if len(fields) != 3 || fields[1] != "6" || fields[2] != path {
+		t.Errorf("got %q", records[1])
+	}
+	if !strings.HasSuffix(records[3], " 3538 test_data.txt") {
+		t.Errorf("got %q", records[3])
+	}
+	errRecords := strings.Split(errOut.String(), "\x00")
+	if len(errRecords) != 2 || errRecords[1] != "" || !strings.Contains(errRecords[0], "path='"+missing+"'") {
+		t.Errorf("got %q", errOut.String())
+	}
+}
+
+func TestNULRecordsJSONL(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	runPaths(t, 1, []string{"test_data.txt", "missing\nfile"}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.EnableJSONLOutput()
+		mc.SetJSONErrors(true)
+		mc.EnableNULRecords()
+	})
+
+	var rec jsonRecord
+	if !strings.HasSuffix(out.String(), "}\x00") || strings.Contains(out.String(), "\n") {
+		t.Fatalf("got %q", out.String())
+	}
+	if err := json.Unmarshal(bytes.TrimSuffix(out.Bytes(), []byte{0}), &rec); err != nil || rec.Path != "test_data.txt" {
+		t.Errorf("got %+v %v", rec, err)
+	}
+	var errRec errorRecord
+	if err := json.Unmarshal(bytes.TrimSuffix(errOut.Bytes(), []byte{0}), &errRec); err != nil || errRec.Path != "missing\nfile" {
+		t.Errorf("got %q %v", errOut.String(), err)
+	}
+}
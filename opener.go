@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Opener opens the paths of a storage backend for pathToCRC, the local files by default. size is the
+// size of the data, -1 when unknown. The workers call it concurrently.
+//
+// The checks needing a size, -growing-files, -skip-bad-blocks and -edge-digest, only apply to the
+// data of a known size, and -skip-bad-blocks and -edge-digest also need the reader to implement
+// io.ReadSeeker and io.ReaderAt respectively.
+type Opener interface {
+	Open(path string) (io.ReadCloser, int64, error)
+}
+
+// fileOpener is the default Opener, os.Open with the size of the regular files. The walk only queues
+// the named pipes given as roots, they are read with a fifoReader like the listed ones.
+type fileOpener struct {
+	fifoTimeout time.Duration
+	interrupted func() bool
+}
+
+func (fo fileOpener) Open(path string) (io.ReadCloser, int64, error) {
+	file, err := openSource(longPath(path))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.Mode()&fs.ModeNamedPipe != 0 {
+		fr, err := newFIFOReader(file, fo.fifoTimeout, fo.interrupted)
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		return fr, -1, nil
+	}
+	if err == nil {
+		err = clearNonblock(file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() { // the size of a pipe or a device means nothing
+		return file, -1, nil
+	}
+	return file, info.Size(), nil
+}
+
+// RegisterOpener opens the paths starting with scheme:// with opener instead of as local files,
+// must be called before Startup
+func (mc *MassCRC32C) RegisterOpener(scheme string, opener Opener) {
+	if mc.openers == nil {
+		mc.openers = make(map[string]Opener)
+	}
+	mc.openers[scheme] = opener
+}
+
+// openerOf returns the opener registered for the scheme of path, the local files when there is none
+func (mc *MassCRC32C) openerOf(path string) Opener {
+	if scheme, _, ok := strings.Cut(path, "://"); ok {
+		if opener, ok := mc.openers[scheme]; ok {
+			return opener
+		}
+	}
+	return fileOpener{fifoTimeout: mc.fifoTimeout, interrupted: mc.stopping}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/iotest"
+)
+
+// fakeOpener serves the objects of a fake store, an object of size -1 is served with an unknown size
+type fakeOpener struct {
+	objects map[string]string
+	sizes   map[string]int64 // the size reported when not the size of the data
+	opens   atomic.Uint64
+	closes  atomic.Uint64
+}
+
+type fakeObject struct {
+	io.Reader
+	opener *fakeOpener
+}
+
+func (o fakeObject) Close() error {
+	o.opener.closes.Add(1)
+	return nil
+}
+
+func (fo *fakeOpener) Open(path string) (io.ReadCloser, int64, error) {
+	fo.opens.Add(1)
+	name := strings.TrimPrefix(path, "fake://")
+	if name == "broken" {
+		reader := io.MultiReader(strings.NewReader("12345"), iotest.ErrReader(&fs.PathError{Op: "read", Path: path, Err: syscall.EIO}))
+		return fakeObject{reader, fo}, 10, nil
+	}
+	data, ok := fo.objects[name]
+	if !ok {
+		return nil, 0, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	size, ok := fo.sizes[name]
+	if !ok {
+		size = int64(len(data))
+	}
+	return fakeObject{strings.NewReader(data), fo}, size, nil
+}
+
+func TestOpener(t *testing.T) {
+	fo := &fakeOpener{
+		objects: map[string]string{"stream": "short test data", "grown": "short test data"},
+		sizes:   map[string]int64{"stream": -1, "grown": 5},
+	}
+	paths := []string{"test_data.txt", "fake://stream", "fake://grown", "fake://missing", "fake://broken", "other://stream"}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("object%d", i)
+		fo.objects[name] = strings.Repeat("x", i)
+		paths = append(paths, "fake://"+name)
+	}
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	mc := runPaths(t, 8, paths, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.RegisterOpener("fake", fo)
+		mc.SetGrowingFiles(growthError)
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+	})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 52 || lines[0] != "WaIfQg== 3538 test_data.txt" || lines[1] != "4AmyZA== 15 fake://stream" {
+		t.Fatalf("got %q", lines)
+	}
+	for i, line := range lines[2:] {
+		expected := fmt.Sprintf("%s %d fake://object%d", crcOf([]byte(strings.Repeat("x", i))), i, i)
+		if line != expected {
+			t.Errorf("got %q, expected %q", line, expected)
+		}
+	}
+	// a size differing from the data read fails with -growing-files error, unless unknown
+	reported := map[string]string{"fake://grown": "CHANGED", "fake://missing": "NOT_FOUND", "fake://broken": "IO", "other://stream": "NOT_FOUND"}
+	for _, line := range strings.Split(strings.TrimSuffix(errOut.String(), "\n"), "\n") {
+		for path, class := range reported {
+			if strings.Contains(line, "path='"+path+"'") && strings.Contains(line, "class="+class+" ") {
+				delete(reported, path)
+			}
+		}
+	}
+	if len(reported) != 0 {
+		t.Errorf("missing errors %v in %q", reported, errOut.String())
+	}
+	if mc.Stats().FileErrors != 4 || fo.opens.Load() != 54 || fo.closes.Load() != 53 {
+		t.Errorf("got %d errors, %d opens, %d closes", mc.Stats().FileErrors, fo.opens.Load(), fo.closes.Load())
+	}
+}
+
+func TestFileOpener(t *testing.T) {
+	rc, size, err := fileOpener{}.Open("test_data.txt")
+	if err != nil || size != 3538 {
+		t.Fatalf("got %d %v", size, err)
+	}
+	rc.Close()
+	if _, _, err := (fileOpener{}).Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v", err)
+	}
+	if _, size, err := (fileOpener{}).Open("."); err != nil || size != -1 {
+		t.Errorf("got %d %v, expected an unknown size", size, err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const outLockRetry = 100 * time.Millisecond
+
+var errOutLocked = errors.New("locked by another run")
+
+// outLockSuffix names the sidecar of a locked output after it
+const outLockSuffix = ".lock"
+
+// outLock is an advisory lock keeping two runs from writing the same output, the sidecar
+// <path>.lock holds the PID of the owner for the error message of the one failing to take it
+type outLock struct {
+	path    string
+	sidecar string
+	f       *os.File // holds the platform lock
+}
+
+// acquireOutLock takes the lock of path, retrying up to wait before failing with the owner PID
+func acquireOutLock(path string, wait time.Duration) (*outLock, error) {
+	l := &outLock{path: path, sidecar: path + outLockSuffix}
+	deadline := time.Now().Add(wait)
+	for {
+		f, err := lockFile(l.path, l.sidecar)
+		if err == nil {
+			l.f = f
+			if err = os.WriteFile(l.sidecar, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+				l.release()
+				return nil, err
+			}
+			return l, nil
+		}
+		if !errors.Is(err, errOutLocked) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%s: %w%s", path, errOutLocked, l.owner())
+		}
+		time.Sleep(outLockRetry)
+	}
+}
+
+// owner describes the PID found in the sidecar, the owner may not have written it yet
+func (l *outLock) owner() string {
+	b, err := os.ReadFile(l.sidecar)
+	pid := strings.TrimSpace(string(b))
+	if err != nil || pid == "" {
+		return ""
+	}
+	return " (pid " + pid + ", see " + l.sidecar + ")"
+}
+
+// release removes the sidecar before unlocking so it never deletes the one of the next owner
+func (l *outLock) release() {
+	if l.f == nil {
+		return
+	}
+	os.Remove(l.sidecar)
+	unlockFile(l.f, l.sidecar)
+	l.f = nil
+}
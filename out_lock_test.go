@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runLocked writes the CRC of test_data.txt to out like main does, holding the lock until release is closed
+func runLocked(out string, wait time.Duration, locked chan<- struct{}, release <-chan struct{}) error {
+	lock, err := acquireOutLock(out, wait)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	w, closeFunc, err := openOutFile(out, 0, io.Discard)
+	if err != nil {
+		return err
+	}
+	defer closeFunc()
+	mc := InitMassCRC32C(1, 10)
+	mc.StdOut = w
+	mc.DebugOut = io.Discard
+	mc.Startup(1)
+	mc.Enqueue("test_data.txt")
+	if locked != nil {
+		close(locked)
+	}
+	if release != nil {
+		<-release
+	}
+	mc.TearDown()
+	return nil
+}
+
+func TestOutLock(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	locked, release := make(chan struct{}), make(chan struct{})
+	first := make(chan error)
+	go func() { first <- runLocked(out, 0, locked, release) }()
+	<-locked
+
+	err := runLocked(out, 0, nil, nil)
+	if !errors.Is(err, errOutLocked) || !strings.Contains(err.Error(), fmt.Sprintf("pid %d", os.Getpid())) {
+		t.Errorf("expected a fail fast naming the owner, got %v", err)
+	}
+	err = runLocked(out, 200*time.Millisecond, nil, nil)
+	if !errors.Is(err, errOutLocked) {
+		t.Errorf("expected a failure after waiting, got %v", err)
+	}
+
+	second := make(chan error)
+	go func() { second <- runLocked(out, 5*time.Second, nil, nil) }()
+	time.Sleep(2 * outLockRetry)
+	close(release)
+	if err = <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err = <-second; err != nil {
+		t.Errorf("the waiting run must get the lock once released, got %v", err)
+	}
+	if _, err = os.Stat(out + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("the sidecar must be removed on release, got %v", err)
+	}
+	b, _ := os.ReadFile(out)
+	if strings.Count(string(b), "test_data.txt") != 1 {
+		t.Errorf("unexpected output %q", b)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile falls back to the exclusive creation of the sidecar, a run killed
+// without cleanup leaves it behind and it must be removed by hand
+func lockFile(path string, sidecar string) (*os.File, error) {
+	f, err := os.OpenFile(sidecar, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errOutLocked
+	}
+	return f, err
+}
+
+// unlockFile closes the sidecar, release removed it already while f still held it
+func unlockFile(f *os.File, sidecar string) {
+	f.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	outSpaceCheckEvery = 2 * time.Minute
+	outSpacePausePoll  = 10 * time.Second
+)
+
+// lowSpaceEpisode is a period the filesystem of -out stayed below -min-free-space
+type lowSpaceEpisode struct {
+	start   time.Time
+	end     time.Time // zero while ongoing
+	minFree uint64    // least free space seen
+}
+
+// outSpace watches the free space of the filesystem of -out from the writer goroutine, warning louder as
+// it shrinks below minFree: at minFree, half of it and a tenth of it. With pause the writer, and so the
+// workers once the results channel is full, waits for space to be freed instead of failing the output.
+type outSpace struct {
+	path     string
+	minFree  uint64
+	pause    bool
+	debugOut io.Writer
+	free     func(path string) (uint64, error) // freeSpace, replaced by the tests
+	sleep    func(time.Duration)               // time.Sleep, replaced by the tests
+
+	// writer goroutine only
+	checked time.Time
+	level   int // 0 above minFree, then 1, 2 and 3 below minFree, its half and its tenth
+
+	mu       sync.Mutex // the episodes are printed by the summary of SIGUSR1
+	episodes []lowSpaceEpisode
+}
+
+// EnableOutSpaceCheck checks the free space of the filesystem of path every few minutes while writing the
+// records, warning when it drops below minFree and with pause holding the output until space is freed,
+// must be called before Startup
+func (mc *MassCRC32C) EnableOutSpaceCheck(path string, minFree uint64, pause bool) {
+	mc.outSpace = &outSpace{path: path, minFree: minFree, pause: pause, debugOut: mc.DebugOut, free: freeSpace, sleep: time.Sleep}
+}
+
+// lowSpaceLevel is the warning level of free bytes
+func (sp *outSpace) lowSpaceLevel(free uint64) int {
+	switch {
+	case free < sp.minFree/10:
+		return 3
+	case free < sp.minFree/2:
+		return 2
+	case free < sp.minFree:
+		return 1
+	}
+	return 0
+}
+
+// check checks the free space when the last check is older than outSpaceCheckEvery, then with pause
+// waits while below minFree
+func (sp *outSpace) check(now time.Time) {
+	if now.Sub(sp.checked) < outSpaceCheckEvery {
+		return
+	}
+	sp.checked = now
+	sp.update(now)
+	if !sp.pause || sp.level == 0 {
+		return
+	}
+	fmt.Fprintf(sp.debugOut, "Warning: output paused until %s has %dB free\n", sp.path, sp.minFree)
+	for sp.level > 0 {
+		sp.sleep(outSpacePausePoll)
+		sp.checked = time.Now()
+		sp.update(sp.checked)
+	}
+	fmt.Fprintln(sp.debugOut, "Output resumed")
+}
+
+// update reads the free space and reports the level changes, a failing read keeps the level
+func (sp *outSpace) update(now time.Time) {
+	free, err := sp.free(sp.path)
+	if err != nil {
+		return
+	}
+	level := sp.lowSpaceLevel(free)
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if level > 0 {
+		if sp.level == 0 {
+			sp.episodes = append(sp.episodes, lowSpaceEpisode{start: now, minFree: free})
+		}
+		episode := &sp.episodes[len(sp.episodes)-1]
+		if free < episode.minFree {
+			episode.minFree = free
+		}
+	}
+	switch {
+	case level > sp.level && level == 3:
+		fmt.Fprintf(sp.debugOut, "Critical: %s has %dB free, below a tenth of -min-free-space %dB, the output will fail soon\n", sp.path, free, sp.minFree)
+	case level > sp.level && level == 2:
+		fmt.Fprintf(sp.debugOut, "Warning: %s has %dB free, below half of -min-free-space %dB\n", sp.path, free, sp.minFree)
+	case level > sp.level:
+		fmt.Fprintf(sp.debugOut, "Warning: %s has %dB free, below -min-free-space %dB\n", sp.path, free, sp.minFree)
+	case level == 0 && sp.level > 0:
+		sp.episodes[len(sp.episodes)-1].end = now
+		fmt.Fprintf(sp.debugOut, "Space recovered: %s has %dB free\n", sp.path, free)
+	}
+	sp.level = level
+}
+
+// printEpisodes prints the low space episodes of the run for the summary
+func (sp *outSpace) printEpisodes(w io.Writer) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if len(sp.episodes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Low space episodes on %s: %d\n", sp.path, len(sp.episodes))
+	for _, episode := range sp.episodes {
+		end := "ongoing"
+		if !episode.end.IsZero() {
+			end = episode.end.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "  %s to %s, %dB free at least\n", episode.start.UTC().Format(time.RFC3339), end, episode.minFree)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the warnings escalate as the free space shrinks and the episode ends once space is freed
+func TestOutSpaceWarnings(t *testing.T) {
+	frees := []uint64{2000, 900, 400, 50, 600, 2000}
+	reads := 0
+	out := &bytes.Buffer{}
+	sp := &outSpace{path: "out.txt", minFree: 1000, debugOut: out, free: func(string) (uint64, error) {
+		free := frees[reads]
+		reads++
+		return free, nil
+	}}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for range frees {
+		sp.check(now)
+		sp.check(now.Add(time.Second)) // too soon, not read
+		now = now.Add(outSpaceCheckEvery)
+	}
+	expected := "Warning: out.txt has 900B free, below -min-free-space 1000B\n" +
+		"Warning: out.txt has 400B free, below half of -min-free-space 1000B\n" +
+		"Critical: out.txt has 50B free, below a tenth of -min-free-space 1000B, the output will fail soon\n" +
+		"Space recovered: out.txt has 2000B free\n"
+	if reads != len(frees) || out.String() != expected {
+		t.Errorf("got %d reads, %q", reads, out.String())
+	}
+
+	out.Reset()
+	sp.printEpisodes(out)
+	if out.String() != "Low space episodes on out.txt: 1\n  2026-01-02T03:06:05Z to 2026-01-02T03:14:05Z, 50B free at least\n" {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+// Test -pause-on-low-space holds the writer until space is freed
+func TestOutSpacePause(t *testing.T) {
+	frees := []uint64{10, 10, 10, 5000}
+	reads := 0
+	var slept time.Duration
+	out := &bytes.Buffer{}
+	sp := &outSpace{path: "out.txt", minFree: 1000, pause: true, debugOut: out,
+		free: func(string) (uint64, error) {
+			free := frees[reads]
+			reads++
+			return free, nil
+		},
+		sleep: func(d time.Duration) { slept += d },
+	}
+	sp.check(time.Now())
+	if reads != 4 || slept != 3*outSpacePausePoll || sp.level != 0 {
+		t.Errorf("got %d reads, slept %s, level %d", reads, slept, sp.level)
+	}
+	if !strings.Contains(out.String(), "output paused until out.txt has 1000B free\n") || !strings.HasSuffix(out.String(), "Output resumed\n") {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+// Test a run writing to a filesystem with less free space than asked warns and lists the episode in the summary
+func TestOutSpaceRun(t *testing.T) {
+	if !freeSpaceSupported {
+		t.Skip("free space unknown on this platform")
+	}
+	path := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.DebugOut = summary
+		mc.EnableOutSpaceCheck(path, 1<<62, false)
+	})
+	mc.PrintSummary()
+	if !strings.Contains(summary.String(), "the output will fail soon\n") || !strings.Contains(summary.String(), "to ongoing, ") {
+		t.Errorf("got %q", summary.String())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ownedPath is a file or directory written by the run, with its side files: the siblings the run writes
+// named after it like the ".lock" sidecar, the "-journal" of SQLite or the temporary files of the index
+type ownedPath struct {
+	name  string       // base name
+	sides []string     // suffixes of the side files, a * standing for the digits of os.CreateTemp
+	dir   string       // resolved parent directory, compared when its identity is unknown
+	dirID fileIdentity // identity of the parent directory
+}
+
+// ownedPaths are the paths written by the run, the walk skips them rather than checksumming its own data
+type ownedPaths []ownedPath
+
+func (op *ownedPaths) add(path string, sides []string) {
+	owned := ownedPath{name: filepath.Base(path), sides: sides, dir: rootKey(filepath.Dir(path))}
+	if info, err := os.Stat(longPath(owned.dir)); err == nil {
+		owned.dirID = fileStatOf(longPath(owned.dir), info).id
+	}
+	*op = append(*op, owned)
+}
+
+// match tells whether path is an owned path or one of its side files, the names are compared first
+// so only the entries named like an owned path cost a stat of their directory
+func (op ownedPaths) match(path string) bool {
+	name := filepath.Base(path)
+	for _, owned := range op {
+		if name != owned.name && !owned.isSideFile(name) {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if owned.dirID.known() {
+			info, err := os.Stat(longPath(dir))
+			if err == nil && fileStatOf(longPath(dir), info).id.Equal(owned.dirID) {
+				return true
+			}
+		} else if rootKey(dir) == owned.dir {
+			return true
+		}
+	}
+	return false
+}
+
+// isSideFile tells whether name is one of the side files of the owned path
+func (owned ownedPath) isSideFile(name string) bool {
+	if !strings.HasPrefix(name, owned.name) {
+		return false
+	}
+	name = name[len(owned.name):]
+	for _, side := range owned.sides {
+		before, after, temp := strings.Cut(side, "*")
+		if !temp {
+			if name == side {
+				return true
+			}
+			continue
+		}
+		if len(name) > len(before)+len(after) && strings.HasPrefix(name, before) && strings.HasSuffix(name, after) &&
+			strings.Trim(name[len(before):len(name)-len(after)], "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnPath registers a file or directory the run writes so the walk and the list skip it, and the side
+// files named after it by the suffixes sides, a * standing for the random digits of os.CreateTemp. Must be
+// called before Startup.
+func (mc *MassCRC32C) OwnPath(path string, sides ...string) {
+	mc.ownedPaths.add(path, sides)
+}
+
+// skipOwned tells whether path is written by the run, with a debug note
+func (mc *MassCRC32C) skipOwned(path string) bool {
+	if len(mc.ownedPaths) == 0 || !mc.ownedPaths.match(path) {
+		return false
+	}
+	fmt.Fprintf(mc.DebugOut, "skipping own output: %s\n", path)
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOwnedPathsSkipped(t *testing.T) {
+	root := t.TempDir()
+	spool := filepath.Join(root, "spool")
+	out := filepath.Join(root, "sub", "out.txt")
+	for _, path := range []string{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "sub", "b"),
+		filepath.Join(root, "sub", "out.txt.run-123"),
+		filepath.Join(root, "sub", "out.txt-journal"),
+		filepath.Join(root, "sub", "out.txtx"),
+		filepath.Join(root, "sub", "out.txt-2025.pdf"),
+		filepath.Join(spool, "c"),
+		filepath.Join(spool, "d", "e"),
+		out,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the owned paths are compared by directory identity, not by the path text
+	walked := filepath.Join(root, "sub") + string(filepath.Separator) + ".."
+	records := &bytes.Buffer{}
+	debugOut := &bytes.Buffer{}
+	var res InputResult
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = records
+		mc.DebugOut = debugOut
+		mc.OwnPath(out, indexRunPattern, sqliteSideSuffixes[0])
+		mc.OwnPath(spool)
+		mc.stdin = strings.NewReader(filepath.Join(walked, "sub", "out.txt") + "\n" + filepath.Join(walked, "a") + "\n")
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		res = fi.Run([]string{walked}, true)
+	})
+
+	if res.Enqueued != 5 {
+		t.Errorf("got %d paths enqueued, expected a listed and a, sub/b, sub/out.txtx and sub/out.txt-2025.pdf walked: %q", res.Enqueued, records)
+	}
+	for _, name := range []string{"spool", "out.txt\n", "out.txt.run", "out.txt-journal"} {
+		if strings.Contains(records.String(), name) {
+			t.Errorf("records reference the owned %s: %q", name, records)
+		}
+	}
+	if n := strings.Count(debugOut.String(), "skipping own output: "); n != 5 {
+		t.Errorf("got %d notes, expected the listed output, spool, out.txt and its 2 side files: %q", n, debugOut)
+	}
+}
+
+func TestIsSideFile(t *testing.T) {
+	owned := ownedPath{name: "out.txt", sides: []string{outLockSuffix, "-wal", persistentSetTempPattern}}
+	tests := []struct {
+		name string
+		side bool
+	}{
+		{"out.txt.lock", true},
+		{"out.txt-wal", true},
+		{"out.txt.123.tmp", true},
+		{"out.txt", false},
+		{"out.txtx", false},
+		{"xout.txt.lock", false},
+		{"out.txt-journal", false},
+		{"out.txt.lock.bak", false},
+		{"out.txt..tmp", false},
+		{"out.txt.v2.tmp", false},
+		{"out.txt-2025.pdf", false},
+	}
+	for _, test := range tests {
+		if got := owned.isSideFile(test.name); got != test.side {
+			t.Errorf("%s: got %t", test.name, got)
+		}
+	}
+}
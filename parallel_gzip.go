@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+const parallelGzipBlockSize = 1 << 20
+
+// parallelGzipWriter compresses blocks of its input as independent gzip members on up to jobs goroutines
+// and writes them in order. The concatenated members are a multi-member gzip stream, which gzip,
+// zcat and compress/gzip decompress as a whole.
+type parallelGzipWriter struct {
+	w         io.Writer
+	blockSize int
+	buf       []byte
+	slots     chan struct{}    // compressions running
+	order     chan chan []byte // compressed blocks in input order, its capacity bounds the memory used
+	done      chan struct{}    // the ordering goroutine returned
+	blocks    sync.Pool        // input blocks
+	gzWriters sync.Pool        // *gzip.Writer reset for each block
+
+	mu  sync.Mutex
+	err error // first write error of the underlying writer
+}
+
+func newParallelGzipWriter(w io.Writer, jobs int, blockSize int) *parallelGzipWriter {
+	pw := &parallelGzipWriter{
+		w:         w,
+		blockSize: blockSize,
+		slots:     make(chan struct{}, jobs),
+		order:     make(chan chan []byte, 2*jobs),
+		done:      make(chan struct{}),
+	}
+	pw.blocks.New = func() any { return make([]byte, 0, blockSize) }
+	pw.gzWriters.New = func() any { return gzip.NewWriter(nil) }
+	pw.buf = pw.blocks.Get().([]byte)
+	goroutines.spawn(goroutineGzipWriter, pw.writeBlocks)
+	return pw
+}
+
+func (pw *parallelGzipWriter) Write(p []byte) (int, error) {
+	if err := pw.firstErr(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		room := pw.blockSize - len(pw.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		pw.buf = append(pw.buf, p[:room]...)
+		p = p[room:]
+		if len(pw.buf) == pw.blockSize {
+			pw.submit()
+		}
+	}
+	return n, nil
+}
+
+// submit queues the current block for compression, blocking while too many blocks are pending
+func (pw *parallelGzipWriter) submit() {
+	block := pw.buf
+	pw.buf = pw.blocks.Get().([]byte)[:0]
+	compressed := make(chan []byte, 1)
+	pw.order <- compressed
+	pw.slots <- struct{}{}
+	goroutines.spawn(goroutineGzipBlock, func() {
+		defer func() { <-pw.slots }()
+		var out bytes.Buffer
+		gz := pw.gzWriters.Get().(*gzip.Writer)
+		gz.Reset(&out)
+		gz.Write(block) // writes to a bytes.Buffer do not fail
+		gz.Close()
+		pw.gzWriters.Put(gz)
+		pw.blocks.Put(block[:0])
+		compressed <- out.Bytes()
+	})
+}
+
+// writeBlocks writes the compressed blocks in order, the first error is kept for Write and Close
+func (pw *parallelGzipWriter) writeBlocks() {
+	defer close(pw.done)
+	for compressed := range pw.order {
+		out := <-compressed
+		if pw.firstErr() != nil {
+			continue
+		}
+		if _, err := pw.w.Write(out); err != nil {
+			pw.mu.Lock()
+			pw.err = err
+			pw.mu.Unlock()
+		}
+	}
+}
+
+func (pw *parallelGzipWriter) firstErr() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+// Close compresses the last block and waits for all the blocks to be written, it does not close w
+func (pw *parallelGzipWriter) Close() error {
+	if len(pw.buf) > 0 {
+		pw.submit()
+	}
+	close(pw.order)
+	<-pw.done
+	return pw.firstErr()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"testing"
+)
+
+// syntheticRecords is a result stream of n text records
+func syntheticRecords(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "AAAAAA== %d /data/set%03d/dir%04d/file%08d.bin\n", i*37, i%1000, i%7919, i)
+	}
+	return buf.Bytes()
+}
+
+func TestParallelGzipWriter(t *testing.T) {
+	input := syntheticRecords(10000)
+	for _, blockSize := range []int{4096, 64 * 1024, len(input) + 1} {
+		for _, jobs := range []int{2, 5} {
+			var out bytes.Buffer
+			pw := newParallelGzipWriter(&out, jobs, blockSize)
+			// odd sized writes straddle the blocks
+			for rest := input; len(rest) > 0; {
+				n := 777
+				if n > len(rest) {
+					n = len(rest)
+				}
+				if _, err := pw.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err := pw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(gz)
+			if err != nil || !bytes.Equal(got, input) {
+				t.Errorf("block size %d, %d jobs: got %d bytes %v, expected %d", blockSize, jobs, len(got), err, len(input))
+			}
+			if path, err := exec.LookPath("gzip"); err == nil {
+				cmd := exec.Command(path, "-dc")
+				cmd.Stdin = bytes.NewReader(out.Bytes())
+				got, err := cmd.Output()
+				if err != nil || !bytes.Equal(got, input) {
+					t.Errorf("block size %d, %d jobs: gzip -dc got %d bytes %v, expected %d", blockSize, jobs, len(got), err, len(input))
+				}
+			}
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestParallelGzipWriterError(t *testing.T) {
+	pw := newParallelGzipWriter(failingWriter{}, 2, 100)
+	input := syntheticRecords(100)
+	for i := 0; i < 10; i++ {
+		pw.Write(input)
+	}
+	if err := pw.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("got %v, expected the write error", err)
+	}
+}
+
+func BenchmarkGzipOutput(b *testing.B) {
+	input := syntheticRecords(200000)
+	b.Run("gzip", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for i := 0; i < b.N; i++ {
+			gz := gzip.NewWriter(io.Discard)
+			gz.Write(input)
+			gz.Close()
+		}
+	})
+	for _, jobs := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("parallel-%d", jobs), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				pw := newParallelGzipWriter(io.Discard, jobs, parallelGzipBlockSize)
+				pw.Write(input)
+				pw.Close()
+			}
+		})
+	}
+}
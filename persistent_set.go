@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A persistent set file is a header line, a line per key with the unix time it was added
+// and the quoted key, and an end line with the key count telling a complete file from a cut one.
+const persistentSetHeader = "mass-crc32c set 1"
+
+// persistentSetTempPattern names the temporary file of Save after the set, its * replaced by os.CreateTemp
+const persistentSetTempPattern = ".*.tmp"
+
+// persistentSet is a set of keys kept across runs, each key expires maxAge after it was added
+type persistentSet struct {
+	path    string
+	entries map[string]time.Time
+}
+
+// loadPersistentSet loads the keys of path added less than maxAge before now,
+// a missing file is an empty set and a corrupted one is ignored with a warning
+func loadPersistentSet(path string, maxAge time.Duration, now time.Time, debugOut io.Writer) *persistentSet {
+	ps := &persistentSet{path: path, entries: make(map[string]time.Time)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ps
+	} else if err != nil {
+		fmt.Fprintf(debugOut, "warning: %s ignored: %v\n", path, err)
+		return ps
+	}
+	defer f.Close()
+	entries, err := readPersistentSet(f)
+	if err != nil {
+		fmt.Fprintf(debugOut, "warning: %s ignored: %v\n", path, err)
+		return ps
+	}
+	for key, added := range entries {
+		if maxAge <= 0 || now.Sub(added) < maxAge {
+			ps.entries[key] = added
+		}
+	}
+	return ps
+}
+
+func readPersistentSet(r io.Reader) (map[string]time.Time, error) {
+	entries := make(map[string]time.Time)
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != persistentSetHeader {
+		return nil, fmt.Errorf("bad header")
+	}
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "end ") {
+			if line != "end "+strconv.Itoa(len(entries)) || scanner.Scan() {
+				return nil, fmt.Errorf("line %d: bad end line", lineNumber)
+			}
+			return entries, nil
+		}
+		unixText, quoted, ok := strings.Cut(line, " ")
+		unix, err := strconv.ParseInt(unixText, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("line %d: bad time", lineNumber)
+		}
+		key, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad key", lineNumber)
+		}
+		entries[key] = time.Unix(unix, 0)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no end line, the file is incomplete")
+}
+
+func (ps *persistentSet) Contains(key string) bool {
+	_, ok := ps.entries[key]
+	return ok
+}
+
+func (ps *persistentSet) Add(key string, added time.Time) {
+	ps.entries[key] = added
+}
+
+func (ps *persistentSet) Remove(key string) {
+	delete(ps.entries, key)
+}
+
+func (ps *persistentSet) Len() int {
+	return len(ps.entries)
+}
+
+// Save writes the set to a temporary file renamed over path, a failed save leaves the previous file
+func (ps *persistentSet) Save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(ps.path), filepath.Base(ps.path)+persistentSetTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintln(w, persistentSetHeader)
+	for key, added := range ps.entries {
+		fmt.Fprintf(w, "%d %s\n", added.Unix(), strconv.Quote(key))
+	}
+	fmt.Fprintf(w, "end %d\n", len(ps.entries))
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ps.path)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPersistentSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	now := time.Unix(1700000000, 0)
+	ps := loadPersistentSet(path, time.Hour, now, io.Discard)
+	if ps.Len() != 0 {
+		t.Fatalf("got %d keys from a missing file, expected 0", ps.Len())
+	}
+	ps.Add("/fresh", now.Add(-time.Minute))
+	ps.Add("/old", now.Add(-2*time.Hour))
+	ps.Add("/with\nnewline \"quoted\"", now)
+	if err := ps.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadPersistentSet(path, time.Hour, now, io.Discard)
+	if loaded.Len() != 2 || !loaded.Contains("/fresh") || loaded.Contains("/old") || !loaded.Contains("/with\nnewline \"quoted\"") {
+		t.Errorf("got %v, expected /fresh and the quoted key, /old expired", loaded.entries)
+	}
+	if loaded := loadPersistentSet(path, 0, now, io.Discard); loaded.Len() != 3 {
+		t.Errorf("got %d keys without max age, expected 3", loaded.Len())
+	}
+}
+
+func TestPersistentSetCorrupted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"bad header", "something else\n"},
+		{"no end line", persistentSetHeader + "\n1700000000 \"/a\"\n"},
+		{"bad count", persistentSetHeader + "\n1700000000 \"/a\"\nend 2\n"},
+		{"bad time", persistentSetHeader + "\nx \"/a\"\nend 1\n"},
+		{"bad key", persistentSetHeader + "\n1700000000 /a\nend 1\n"},
+		{"after end", persistentSetHeader + "\n1700000000 \"/a\"\nend 1\n1700000000 \"/b\"\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state")
+			if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			debugOut := &bytes.Buffer{}
+			ps := loadPersistentSet(path, 0, now, debugOut)
+			if ps.Len() != 0 || !strings.Contains(debugOut.String(), "ignored") {
+				t.Errorf("got %v %q, expected an ignored file", ps.entries, debugOut.String())
+			}
+		})
+	}
+}
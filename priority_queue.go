@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	priorityQueueLength = 64          // injected paths waiting for a worker before the injection blocks
+	prioritySpoolPoll   = time.Second // interval of the -priority-spool reads
+)
+
+// EnablePriorityQueue adds the lane of the urgent paths, taken by the workers before the ones of PathQueueG.
+// Only EnqueuePriority feeds it, so the queued paths wait for the injected ones alone. Must be called before Startup.
+func (mc *MassCRC32C) EnablePriorityQueue() {
+	mc.priorityQueue = make(chan QueueItem, priorityQueueLength)
+}
+
+// EnqueuePriority adds an urgent path, handled by the next worker free ahead of the queued ones and its result
+// echoed to DebugOut as soon as computed. It blocks while the lane is full, returning ErrInterrupted after a
+// CTRL+C, and must be called between Startup and TearDown like Enqueue.
+func (mc *MassCRC32C) EnqueuePriority(path string) error {
+	if mc.Interrupted.Load() || mc.cancelled() {
+		return ErrInterrupted
+	}
+	mc.priorityCount.Add(1)
+	mc.priorityQueue <- QueueItem{Path: path, seq: mc.enqueueSeq.Add(1) - 1, priority: true}
+	return nil
+}
+
+// nextItem returns the next item for a worker, an injected one first, false once PathQueueG is closed. The
+// injected items left then are still handed out, TearDown stops the spool before closing PathQueueG.
+func (mc *MassCRC32C) nextItem() (QueueItem, bool) {
+	select {
+	case item := <-mc.priorityQueue:
+		return item, true
+	default:
+	}
+	select {
+	case item := <-mc.priorityQueue:
+		return item, true
+	case item, ok := <-mc.PathQueueG:
+		if ok {
+			return item, true
+		}
+		select {
+		case item := <-mc.priorityQueue:
+			return item, true
+		default:
+			return QueueItem{}, false
+		}
+	}
+}
+
+// echoPriority writes the result of an injected path to DebugOut, ahead of its record waiting for the writer
+func (mc *MassCRC32C) echoPriority(res fileResult) {
+	if res.err != nil {
+		fmt.Fprintf(mc.DebugOut, "priority: %s: %v\n", res.item.Path, res.err)
+		return
+	}
+	mc.priorityBytes.Add(res.size)
+	fmt.Fprintf(mc.DebugOut, "priority: %s %d %s\n", res.crc, res.size, res.item.Path)
+}
+
+// prioritySpool follows a spool file the operators append paths to, a path per line, injecting them
+// like EnqueuePriority. The lines there before Startup are left, a truncated spool is read again from its start.
+type prioritySpool struct {
+	path   string
+	poll   time.Duration
+	offset int64
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// WatchPrioritySpool injects the paths appended to the spool file path, which must exist, from Startup to
+// TearDown. Must be called before Startup.
+func (mc *MassCRC32C) WatchPrioritySpool(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	mc.EnablePriorityQueue()
+	mc.spool = &prioritySpool{path: path, poll: prioritySpoolPoll}
+	return nil
+}
+
+// startSpool starts following the spool from its end, called by Startup
+func (mc *MassCRC32C) startSpool() {
+	ps := mc.spool
+	if info, err := os.Stat(ps.path); err == nil {
+		ps.offset = info.Size()
+	}
+	ps.stop = make(chan struct{})
+	ps.done = make(chan struct{})
+	goroutines.spawn(goroutinePrioritySpool, func() {
+		defer close(ps.done)
+		ticker := time.NewTicker(ps.poll)
+		defer ticker.Stop()
+		for {
+			if err := mc.readSpool(ps); err != nil {
+				fmt.Fprintf(mc.DebugOut, "warning: reading -priority-spool %s: %v\n", ps.path, err)
+			}
+			select {
+			case <-ps.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// stopSpool stops following the spool, called by TearDown before closing PathQueueG
+func (mc *MassCRC32C) stopSpool() {
+	close(mc.spool.stop)
+	<-mc.spool.done
+}
+
+// readSpool injects the complete lines appended since the last read, an injection blocked on a full lane
+// gives up when the spool is stopped, the path is then dropped
+func (mc *MassCRC32C) readSpool(ps *prioritySpool) error {
+	f, err := os.Open(ps.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < ps.offset {
+		ps.offset = 0
+	}
+	if _, err := f.Seek(ps.offset, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil // a line being appended is read complete at the next poll
+		}
+		ps.offset += int64(len(line))
+		path := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if path == "" {
+			continue
+		}
+		if mc.Interrupted.Load() || mc.cancelled() {
+			return nil
+		}
+		item := QueueItem{Path: path, seq: mc.enqueueSeq.Add(1) - 1, priority: true}
+		select {
+		case mc.priorityQueue <- item:
+			mc.priorityCount.Add(1)
+		case <-ps.stop:
+			if mc.ordered {
+				mc.results <- fileResult{item: item, filtered: true} // for the writer to move on past its seq
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the injected paths are handled ahead of the queued ones, echoed and counted apart
+func TestPriorityQueue(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		out, debugOut := &bytes.Buffer{}, &bytes.Buffer{}
+		mc := InitMassCRC32C(1, 10)
+		mc.StdOut = out
+		mc.DebugOut = debugOut
+		mc.EnablePriorityQueue()
+		if ordered {
+			mc.EnableOrderedOutput(defaultOrderedWindow)
+		}
+		// queued before the worker starts, the injected path is the last one
+		paths := []string{"test_data.txt", "test_data.txt", "test_data.txt", "missing"}
+		mc.EnqueueBatch(paths[:3])
+		mc.EnqueuePriority(paths[3])
+		mc.Startup(1)
+		mc.TearDown()
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != 3 || mc.Stats().FileErrors != 1 {
+			t.Fatalf("ordered=%t: got %q, %d file errors", ordered, lines, mc.Stats().FileErrors)
+		}
+		// the echo of the injected path is written before the queued paths are handled
+		if !strings.HasPrefix(debugOut.String(), "priority: missing: ") {
+			t.Errorf("ordered=%t: got %q, expected the injected path first", ordered, debugOut.String())
+		}
+		mc.PrintSummary()
+		if !strings.Contains(debugOut.String(), "Priority files: 1, 0B computed ahead of the queue\n") {
+			t.Errorf("ordered=%t: got summary %q", ordered, debugOut.String())
+		}
+	}
+}
+
+// chanWriter sends what is written to it, for the lines written by the goroutines of a run
+type chanWriter chan string
+
+func (cw chanWriter) Write(p []byte) (int, error) {
+	select {
+	case cw <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+func TestPrioritySpool(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+	// the lines there before the run are left
+	if err := os.WriteFile(spool, []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	debugOut := make(chanWriter, 64)
+	setup := func(mc *MassCRC32C) {
+		mc.DebugOut = debugOut
+		if err := mc.WatchPrioritySpool(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("expected a missing spool refused")
+		}
+		if err := mc.WatchPrioritySpool(spool); err != nil {
+			t.Fatal(err)
+		}
+		mc.spool.poll = 10 * time.Millisecond
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		f, err := os.OpenFile(spool, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the partial line is injected once complete
+		f.WriteString("test_data")
+		time.Sleep(50 * time.Millisecond)
+		f.WriteString(".txt\n")
+		f.Close()
+		timeout := time.After(10 * time.Second)
+		for echoed := false; !echoed; {
+			select {
+			case line := <-debugOut:
+				echoed = strings.HasPrefix(line, "priority: ")
+				if echoed && !strings.HasSuffix(line, " 3538 test_data.txt\n") {
+					t.Errorf("got %q, expected the spooled path echoed", line)
+				}
+			case <-timeout:
+				t.Fatal("the spooled path was not injected")
+			}
+		}
+	})
+	if mc.priorityCount.Load() != 1 || mc.priorityBytes.Load() != 3538 {
+		t.Errorf("got %d injected, %dB, expected test_data.txt alone", mc.priorityCount.Load(), mc.priorityBytes.Load())
+	}
+}
+
+// Test the spool is refused with the modes handing the paths out by batch
+func TestPrioritySpoolConflicts(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+	if err := os.WriteFile(spool, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range [][]string{{"-worker", "127.0.0.1:1"}, {"-coordinator", "127.0.0.1:0"}} {
+		if code := run(append([]string{"-priority-spool", spool}, mode...)); code != 2 {
+			t.Errorf("%s: got exit code %d, expected the spool refused", mode[0], code)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exitPublishFailed is the exit code of a run whose -out was written but failed to be published
+const exitPublishFailed = 4
+
+var errPublishMismatch = errors.New("published object CRC32C mismatch")
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// summedWriter computes the CRC-32C of the bytes written to the file of -out, compressed or not,
+// to verify the published object against
+type summedWriter struct {
+	w   io.Writer
+	crc uint32
+}
+
+func (sw *summedWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.crc = crc32.Update(sw.crc, castagnoliTable, p[:n])
+	return n, err
+}
+
+// publisher uploads -out to GCS with the JSON API of endpoint, retrying the transient failures
+type publisher struct {
+	bucket   string
+	object   string
+	endpoint string // https://storage.googleapis.com, or the STORAGE_EMULATOR_HOST
+	token    func() (string, error)
+	client   *http.Client
+	attempts int
+	backoff  time.Duration // doubled after every failed attempt
+}
+
+// objectInfo is the part of the GCS object resource checked and reported
+type objectInfo struct {
+	Generation string `json:"generation"`
+	Etag       string `json:"etag"`
+	CRC32C     string `json:"crc32c"`
+}
+
+// newPublisher parses the gs://bucket/object of -publish, a trailing / names the object after the base
+// name of out
+func newPublisher(target string, out string) (*publisher, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "gs" {
+		return nil, fmt.Errorf("%q: only gs:// is supported", target)
+	}
+	object := strings.TrimPrefix(u.Path, "/")
+	if object == "" || strings.HasSuffix(object, "/") {
+		object += filepath.Base(out)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q: no bucket", target)
+	}
+	p := &publisher{bucket: u.Host, object: object, client: &http.Client{Timeout: 10 * time.Minute}, attempts: 5, backoff: time.Second}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		p.endpoint = strings.TrimSuffix(host, "/")
+		p.token = func() (string, error) { return "", nil }
+	} else {
+		p.endpoint = "https://storage.googleapis.com"
+		p.token = p.accessToken
+	}
+	return p, nil
+}
+
+func (p *publisher) String() string {
+	return "gs://" + p.bucket + "/" + p.object
+}
+
+// accessToken is the GOOGLE_OAUTH_ACCESS_TOKEN, or the token of the service account of the GCE metadata server
+func (p *publisher) accessToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN and no metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server token: %s %v", resp.Status, err)
+	}
+	return token.AccessToken, nil
+}
+
+// publish uploads path, verifying the CRC-32C GCS computed against crc, the one of the bytes written
+func (p *publisher) publish(path string, crc uint32) (objectInfo, error) {
+	var lastErr error
+	backoff := p.backoff
+	for attempt := 1; attempt <= p.attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		info, retry, err := p.upload(path)
+		if err == nil {
+			var expected [4]byte
+			binary.BigEndian.PutUint32(expected[:], crc)
+			if info.CRC32C != base64.StdEncoding.EncodeToString(expected[:]) {
+				return info, fmt.Errorf("%w: got %s, the records written have %s", errPublishMismatch, info.CRC32C, base64.StdEncoding.EncodeToString(expected[:]))
+			}
+			return info, nil
+		}
+		lastErr = fmt.Errorf("attempt %d: %w", attempt, err)
+		if !retry {
+			break
+		}
+	}
+	return objectInfo{}, lastErr
+}
+
+// upload makes one upload attempt, telling whether its failure is worth a retry
+func (p *publisher) upload(path string) (objectInfo, bool, error) {
+	token, err := p.token()
+	if err != nil {
+		return objectInfo{}, true, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return objectInfo{}, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return objectInfo{}, false, err
+	}
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", p.endpoint, url.PathEscape(p.bucket), url.QueryEscape(p.object))
+	req, err := http.NewRequest(http.MethodPost, endpoint, f)
+	if err != nil {
+		return objectInfo{}, false, err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return objectInfo{}, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return objectInfo{}, retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var obj objectInfo
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return objectInfo{}, true, err
+	}
+	return obj, false, nil
+}
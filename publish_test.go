@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeGCS serves the media uploads of the JSON API, failing the first ones with failStatus
+type fakeGCS struct {
+	failures   int32
+	failStatus int
+	corrupt    bool // the object CRC32C is not the one of the body
+	requests   atomic.Int32
+	name       atomic.Value
+}
+
+func (fg *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := fg.requests.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	if n <= fg.failures {
+		http.Error(w, "try again", fg.failStatus)
+		return
+	}
+	if r.URL.Path != "/upload/storage/v1/b/bucket/o" || r.URL.Query().Get("uploadType") != "media" {
+		http.Error(w, "bad request "+r.URL.String(), http.StatusBadRequest)
+		return
+	}
+	fg.name.Store(r.URL.Query().Get("name"))
+	crc := crc32.Checksum(body, castagnoliTable)
+	if fg.corrupt {
+		crc++
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], crc)
+	fmt.Fprintf(w, `{"generation":"1700000000000001","etag":"CIGAgICAgIAD","crc32c":%q}`, base64.StdEncoding.EncodeToString(b[:]))
+}
+
+func TestPublish(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "manifest.txt.gz")
+	sum := &summedWriter{}
+	w, closeOut, err := openSummedOutFile(out, 1, io.Discard, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(w, strings.Repeat("AAAAAA== 3 some/path\n", 100))
+	closeOut()
+	data, err := os.ReadFile(out)
+	if err != nil || crc32.Checksum(data, castagnoliTable) != sum.crc {
+		t.Fatalf("got CRC %08x of the compressed bytes, expected the one of the file %v", sum.crc, err)
+	}
+
+	tests := []struct {
+		name     string
+		gcs      *fakeGCS
+		requests int32
+		err      error
+	}{
+		{"uploaded", &fakeGCS{}, 1, nil},
+		{"retried", &fakeGCS{failures: 2, failStatus: http.StatusServiceUnavailable}, 3, nil},
+		{"not retried", &fakeGCS{failures: 1, failStatus: http.StatusForbidden}, 1, nil},
+		{"given up", &fakeGCS{failures: 10, failStatus: http.StatusTooManyRequests}, 3, nil},
+		{"corrupt", &fakeGCS{corrupt: true}, 1, errPublishMismatch},
+	}
+	for _, test := range tests {
+		srv := httptest.NewServer(test.gcs)
+		t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+		pub, err := newPublisher("gs://bucket/runs/", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub.attempts = 3
+		pub.backoff = 0
+		info, err := pub.publish(out, sum.crc)
+		srv.Close()
+		switch test.name {
+		case "uploaded", "retried":
+			if err != nil || info.Generation != "1700000000000001" || test.gcs.name.Load() != "runs/manifest.txt.gz" {
+				t.Errorf("%s: got %+v %v", test.name, info, err)
+			}
+		case "corrupt":
+			if !errors.Is(err, errPublishMismatch) {
+				t.Errorf("%s: got %v, expected a mismatch", test.name, err)
+			}
+		default:
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+		}
+		if got := test.gcs.requests.Load(); got != test.requests {
+			t.Errorf("%s: got %d requests, expected %d", test.name, got, test.requests)
+		}
+	}
+
+	for _, target := range []string{"s3://bucket/key", "gs:///object", "manifest"} {
+		if _, err := newPublisher(target, out); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+	if pub, err := newPublisher("gs://bucket/exact/name", out); err != nil || pub.String() != "gs://bucket/exact/name" {
+		t.Errorf("got %v %v", pub, err)
+	}
+}
+
+// Test compute publishes -out after the run, exiting with 4 and keeping the file when it fails
+func TestPublishCommand(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "manifest.txt")
+	for _, gcs := range []*fakeGCS{{}, {failures: 10, failStatus: http.StatusForbidden}} {
+		srv := httptest.NewServer(gcs)
+		t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+		code := run([]string{"-out", out, "-publish", "gs://bucket/manifest", root})
+		srv.Close()
+		expected := 0
+		if gcs.failures > 0 {
+			expected = exitPublishFailed
+		}
+		data, err := os.ReadFile(out)
+		if code != expected || err != nil || !strings.HasSuffix(string(data), filepath.Join(root, "file")+"\n") {
+			t.Errorf("got exit code %d, %q %v, expected %d", code, data, err, expected)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A recording is a header line followed by events framed like the coordinator/worker protocol,
+// a type byte, a big endian uint32 payload length and the payload:
+//
+//	eventRoot      root, a root walk starts
+//	eventEntry     path, uvarint 1 with a dir entry, uvarint type, error, an entry given to the walk handler
+//	eventEndWalk   empty, the root walk ended
+//	eventListLine  line of the file list
+//	eventResult    path, uvarint size, crc, uvarint mtime, error, a result written
+//
+// Errors are a uvarint class and a message, empty without error.
+const recordingHeader = "mass-crc32c recording 1\n"
+
+const (
+	eventRoot     = 'R'
+	eventEntry    = 'E'
+	eventEndWalk  = 'W'
+	eventListLine = 'L'
+	eventResult   = 'F'
+)
+
+// replayError is a recorded error or one sent by a worker, it keeps its class through the replay or the
+// coordinator
+type replayError struct {
+	msg   string
+	class errClass
+}
+
+func (e *replayError) Error() string {
+	return e.msg
+}
+
+var errNotRecorded = errors.New("no result in the recording")
+
+// recorder writes the walk events and the results of a run, from the walker and the writer
+type recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	buf []byte
+	err error
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{f: f, w: bufio.NewWriter(f)}
+	if _, err := r.w.WriteString(recordingHeader); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func appendError(buf []byte, err error) []byte {
+	if err == nil {
+		return appendString(binary.AppendUvarint(buf, uint64(classUnknown)), "")
+	}
+	return appendString(binary.AppendUvarint(buf, uint64(classify(err))), err.Error())
+}
+
+// write frames the payload built by the caller in r.buf, the first error is kept for Close
+func (r *recorder) write(eventType byte) {
+	if r.err != nil {
+		return
+	}
+	var header [5]byte
+	header[0] = eventType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(r.buf)))
+	if _, r.err = r.w.Write(header[:]); r.err == nil {
+		_, r.err = r.w.Write(r.buf)
+	}
+}
+
+func (r *recorder) root(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = appendString(r.buf[:0], path)
+	r.write(eventRoot)
+}
+
+func (r *recorder) entry(path string, dir fs.DirEntry, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = appendString(r.buf[:0], path)
+	if dir != nil {
+		r.buf = binary.AppendUvarint(r.buf, 1)
+		r.buf = binary.AppendUvarint(r.buf, uint64(dir.Type()))
+	} else {
+		r.buf = binary.AppendUvarint(r.buf, 0)
+		r.buf = binary.AppendUvarint(r.buf, 0)
+	}
+	r.buf = appendError(r.buf, err)
+	r.write(eventEntry)
+}
+
+func (r *recorder) endWalk() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = r.buf[:0]
+	r.write(eventEndWalk)
+}
+
+func (r *recorder) listLine(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = appendString(r.buf[:0], line)
+	r.write(eventListLine)
+}
+
+func (r *recorder) result(res fileResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = appendString(r.buf[:0], res.item.Path)
+	r.buf = binary.AppendUvarint(r.buf, res.size)
+	r.buf = appendString(r.buf, res.crc)
+	r.buf = binary.AppendUvarint(r.buf, uint64(res.mtime))
+	r.buf = appendError(r.buf, res.err)
+	r.write(eventResult)
+}
+
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// replayEvent is a walk event of a recording, its path is the line of the list events
+type replayEvent struct {
+	kind   byte
+	path   string
+	hasDir bool
+	typ    fs.FileMode
+	err    error
+}
+
+// replayEntry is the fs.DirEntry of a recorded walk entry
+type replayEntry struct {
+	path string
+	typ  fs.FileMode
+}
+
+func (e replayEntry) Name() string      { return filepath.Base(e.path) }
+func (e replayEntry) IsDir() bool       { return e.typ.IsDir() }
+func (e replayEntry) Type() fs.FileMode { return e.typ }
+func (e replayEntry) Info() (fs.FileInfo, error) {
+	return nil, fmt.Errorf("%s: no file info in a replay", e.path)
+}
+
+// replayResult is a recorded result, given to the queue items of its path in turn
+type replayResult struct {
+	size  uint64
+	crc   string
+	mtime int64
+	err   error
+}
+
+// replayLog is a loaded recording
+type replayLog struct {
+	events  []replayEvent
+	mu      sync.Mutex
+	results map[string][]replayResult
+}
+
+// readError reads an error written by appendError, a class unknown to this build is read as classUnknown
+func readError(fr *frameReader) error {
+	class := errClass(fr.uvarint())
+	if class >= errClassCount {
+		class = classUnknown
+	}
+	if msg := fr.string(); msg != "" {
+		return &replayError{msg: msg, class: class}
+	}
+	return nil
+}
+
+// loadRecording reads a recording, a truncated last event, as left by a killed run, is dropped with a warning
+func loadRecording(path string, debugOut io.Writer) (*replayLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, len(recordingHeader))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != recordingHeader {
+		return nil, fmt.Errorf("%s: not a recording", path)
+	}
+	log := &replayLog{results: make(map[string][]replayResult)}
+	for n := 1; ; n++ {
+		eventType, payload, err := readFrame(r)
+		if err == io.EOF {
+			return log, nil
+		} else if err == io.ErrUnexpectedEOF {
+			fmt.Fprintf(debugOut, "warning: %s: event %d truncated, replaying the previous ones\n", path, n)
+			return log, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", path, n, err)
+		}
+		if err := log.addEvent(eventType, &frameReader{buf: payload}); err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", path, n, err)
+		}
+	}
+}
+
+func (log *replayLog) addEvent(eventType byte, fr *frameReader) error {
+	switch eventType {
+	case eventRoot, eventListLine:
+		log.events = append(log.events, replayEvent{kind: eventType, path: fr.string()})
+	case eventEndWalk:
+		log.events = append(log.events, replayEvent{kind: eventType})
+	case eventEntry:
+		ev := replayEvent{kind: eventType, path: fr.string()}
+		ev.hasDir = fr.uvarint() != 0
+		ev.typ = fs.FileMode(fr.uvarint())
+		ev.err = readError(fr)
+		log.events = append(log.events, ev)
+	case eventResult:
+		path := fr.string()
+		res := replayResult{size: fr.uvarint(), crc: fr.string(), mtime: int64(fr.uvarint())}
+		res.err = readError(fr)
+		log.results[path] = append(log.results[path], res)
+	default:
+		return fmt.Errorf("unknown event type %q", eventType)
+	}
+	return fr.err
+}
+
+// result pops the next recorded result of path
+func (log *replayLog) result(path string) (replayResult, bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	results := log.results[path]
+	if len(results) == 0 {
+		return replayResult{}, false
+	}
+	log.results[path] = results[1:]
+	return results[0], true
+}
+
+// replayHandler gives the recorded result of a queue item instead of reading the file
+func (mc *MassCRC32C) replayHandler(item QueueItem) error {
+	res, ok := mc.replay.result(item.Path)
+	if !ok {
+		res.err = errNotRecorded
+	}
+	if res.err != nil {
+		mc.fileErrorCount.Add(1)
+		mc.sendResult(fileResult{item: item, err: res.err})
+		return nil
+	}
+	mc.bytesRead.Add(res.size)
+	mc.countComputed(item, res.size)
+	mc.sendResult(fileResult{item: item, crc: res.crc, size: res.size, mtime: res.mtime})
+	return nil
+}
+
+// Replay drives the walker and the list reader with the events of the replayed recording
+func (fi *FileInput) Replay() InputResult {
+	start := fi.mc.enqueueSeq.Load()
+	var res InputResult
+	var listLines []string
+	// the list of a -stdin run is read before its walks
+	readList := func() {
+		if listLines != nil {
+			separator := "\n"
+			if fi.nulSeparated {
+				separator = "\x00"
+			}
+			fi.mc.stdin = strings.NewReader(strings.Join(listLines, separator) + separator)
+			res.add(fi.ReadFileList())
+			listLines = nil
+		}
+	}
+	skipped := ""
+	for _, ev := range fi.mc.replay.events {
+		switch ev.kind {
+		case eventRoot:
+			readList()
+			fi.root = ev.path
+			skipped = ""
+		case eventEndWalk:
+			if fi.mc.dirEvents != nil {
+				fi.mc.dirEvents.endWalk(true)
+			}
+			fi.mc.rootsWalked.Add(1)
+		case eventListLine:
+			listLines = append(listLines, ev.path)
+		case eventEntry:
+			if skipped != "" && isUnder(ev.path, skipped) {
+				continue
+			}
+			var dir fs.DirEntry
+			if ev.hasDir {
+				dir = replayEntry{path: ev.path, typ: ev.typ}
+			}
+			switch fi.walkHandler(ev.path, dir, ev.err) {
+			case filepath.SkipDir:
+				skipped = ev.path
+			case io.EOF:
+				fmt.Fprintln(fi.mc.DebugOut, "directory walk interrupted")
+				res.Interrupted = true
+				res.Enqueued = fi.mc.enqueueSeq.Load() - start
+				return res
+			}
+		}
+	}
+	readList()
+	res.Enqueued = fi.mc.enqueueSeq.Load() - start
+	return res
+}
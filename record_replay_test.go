@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runRecorded runs the pipeline in order with its outputs in buffers, drive walks or reads the list
+func runRecorded(t *testing.T, setup func(mc *MassCRC32C), drive func(fi *FileInput)) (string, string, Stats) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	mc := runPipeline(t, 4, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+		setup(mc)
+	}, func(mc *MassCRC32C) {
+		drive(&FileInput{mc: mc})
+	})
+	return out.String(), errOut.String(), mc.Stats()
+}
+
+// Test a replay gives the output and the counts of the recorded walk without the files
+func TestRecordReplayWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "sub/b", "sub/c", ".snapshot/d"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(root, "missing")
+	recording := filepath.Join(t.TempDir(), "events.bin")
+	expected, expectedErrs, expectedStats := runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableRecording(recording); err != nil {
+			t.Fatal(err)
+		}
+		mc.SkipSnapshotDirs(nil)
+	}, func(fi *FileInput) {
+		fi.walkRoots([]string{root, missing})
+	})
+	if strings.Count(expected, "\n") != 3 || !strings.Contains(expectedErrs, "no such file") {
+		t.Fatalf("unexpected recorded run: %q %q", expected, expectedErrs)
+	}
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatal(err)
+	}
+
+	var classCounts [errClassCount]uint64
+	got, gotErrs, gotStats := runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableReplay(recording); err != nil {
+			t.Fatal(err)
+		}
+		mc.SkipSnapshotDirs(nil)
+	}, func(fi *FileInput) {
+		fi.Replay()
+		for c := range classCounts {
+			classCounts[c] = fi.mc.errReporter.classCounts[c].Load()
+		}
+	})
+	if got != expected || gotErrs != expectedErrs {
+		t.Errorf("got %q %q, expected %q %q", got, gotErrs, expected, expectedErrs)
+	}
+	if gotStats.Files != expectedStats.Files || gotStats.FileErrors != expectedStats.FileErrors ||
+		gotStats.BytesComputed != expectedStats.BytesComputed || gotStats.BytesRead != expectedStats.BytesRead {
+		t.Errorf("got %+v, expected %+v", gotStats, expectedStats)
+	}
+	if classCounts[classNotFound] != 1 {
+		t.Errorf("got class counts %v, expected 1 NOT_FOUND", classCounts)
+	}
+}
+
+// Test a replay of a file list, and of a recording cut short
+func TestRecordReplayList(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "events.bin")
+	expected, _, _ := runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableRecording(recording); err != nil {
+			t.Fatal(err)
+		}
+		mc.stdin = strings.NewReader("2\ttest_data.txt\n1\tmissing.txt\n")
+	}, func(fi *FileInput) {
+		fi.ReadFileList()
+	})
+	got, _, _ := runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableReplay(recording); err != nil {
+			t.Fatal(err)
+		}
+	}, func(fi *FileInput) {
+		fi.Replay()
+	})
+	if got != expected || expected != "2\tWaIfQg== 3538 test_data.txt\n" {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+
+	data, err := os.ReadFile(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recording, data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	debugOut := &bytes.Buffer{}
+	log, err := loadRecording(recording, debugOut)
+	if err != nil || !strings.Contains(debugOut.String(), "truncated") {
+		t.Fatalf("got %v %q, expected a truncation warning", err, debugOut.String())
+	}
+	if len(log.events) != 2 {
+		t.Errorf("got %d events, expected 2", len(log.events))
+	}
+	if _, err := loadRecording("test_data.txt", io.Discard); err == nil {
+		t.Errorf("expected an error loading a file that is not a recording")
+	}
+}
+
+// Test an interrupted replay stops the walk like an interrupted run
+func TestReplayInterrupted(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "events.bin")
+	runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableRecording(recording); err != nil {
+			t.Fatal(err)
+		}
+	}, func(fi *FileInput) {
+		fi.walkRoots([]string{"test_data.txt"})
+	})
+	got, _, stats := runRecorded(t, func(mc *MassCRC32C) {
+		if err := mc.EnableReplay(recording); err != nil {
+			t.Fatal(err)
+		}
+		mc.Interrupted.Store(true)
+	}, func(fi *FileInput) {
+		fi.Replay()
+	})
+	if got != "" || stats.Files != 0 {
+		t.Errorf("got %q and %d files, expected nothing", got, stats.Files)
+	}
+}
+
+// Test a class unknown to this build, from a corrupt recording or a newer one, is read as UNKNOWN
+func TestReadErrorClass(t *testing.T) {
+	buf := appendString(binary.AppendUvarint(nil, 1000), "bad class")
+	err := readError(&frameReader{buf: buf})
+	if err == nil || classify(err) != classUnknown {
+		t.Fatalf("got %v classified %s, expected UNKNOWN", err, classify(err))
+	}
+	er := errorReporter{now: time.Now}
+	out := &bytes.Buffer{}
+	er.print(out, errScopeFile, "0", "p", err)
+	if !strings.Contains(out.String(), "class=UNKNOWN") {
+		t.Errorf("got %q", out.String())
+	}
+}
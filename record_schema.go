@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// recordSchemaVersion versions the column vocabulary of the schema declarations, a column added to
+// recordSchemaVocabulary bumps it so the parsers of an older build refuse the outputs they cannot map
+const recordSchemaVersion = 1
+
+// schemaHeaderPrefix starts the schema declaration line of the -format csv and jsonl outputs
+const schemaHeaderPrefix = "# schema="
+
+// recordSchemaVocabulary are the columns a record may hold in recordSchemaVersion, in their order
+var recordSchemaVocabulary = []string{
+	"ordinal",
+	"crc32c", "crc32", algoMD5, algoSHA256, algoXXH64, algoBLAKE3,
+	"size", "path",
+	"nlink", "inode", "btime",
+	"bad_blocks",
+	"head_crc32c", "tail_crc32c",
+	"label",
+}
+
+// recordColumn is a column of the records of the run, the structure both the -format csv rows and the
+// schema declaration are generated from
+type recordColumn struct {
+	name   string // in the schema declaration, the key of the jsonl records
+	header string // in the -header row of -format csv
+	value  func(res *Result, digests []string) string
+}
+
+// recordColumns returns the columns of the records of the run: a column per digest, named by its algorithm
+// and crc32 with -poly ieee, the size and path, the stat fields enabled, bad_blocks with -skip-bad-blocks,
+// head_crc32c and tail_crc32c with -edge-digest, and label with -input json
+func (mc *MassCRC32C) recordColumns() []recordColumn {
+	var cols []recordColumn
+	for i, algo := range mc.algos {
+		i := i
+		col := recordColumn{name: algo, header: algo, value: func(_ *Result, digests []string) string { return digests[i] }}
+		if algo == algoCRC32C && mc.crc.params == ieeeParams {
+			col.name = "crc32"
+		}
+		if mc.plainCRC() {
+			col.header = "crc" // the header of the first releases
+			if mc.crc.params == ieeeParams {
+				col.header = "crc32"
+			}
+		}
+		cols = append(cols, col)
+	}
+	cols = append(cols,
+		recordColumn{name: "size", value: func(res *Result, _ []string) string { return strconv.FormatUint(res.Size, 10) }},
+		recordColumn{name: "path", value: func(res *Result, _ []string) string { return res.Path }},
+	)
+	if mc.statFields.nlink {
+		cols = append(cols, recordColumn{name: "nlink", value: func(res *Result, _ []string) string { return strconv.FormatUint(res.Nlink, 10) }})
+	}
+	if mc.statFields.inode {
+		cols = append(cols, recordColumn{name: "inode", value: func(res *Result, _ []string) string { return strconv.FormatUint(res.Inode, 10) }})
+	}
+	if mc.statFields.btime {
+		cols = append(cols, recordColumn{name: "btime", value: func(res *Result, _ []string) string { return formatBirthTime(res.Btime) }})
+	}
+	if mc.badBlocks != nil {
+		cols = append(cols, recordColumn{name: "bad_blocks", value: func(res *Result, _ []string) string {
+			if res.BadBlocks == nil {
+				return ""
+			}
+			return formatBadRanges(res.BadBlocks)
+		}})
+	}
+	if mc.edgeSize > 0 {
+		cols = append(cols,
+			recordColumn{name: "head_crc32c", value: func(res *Result, _ []string) string { return res.Head }},
+			recordColumn{name: "tail_crc32c", value: func(res *Result, _ []string) string { return res.Tail }},
+		)
+	}
+	if mc.jsonInput {
+		cols = append(cols, recordColumn{name: "label", value: func(res *Result, _ []string) string { return string(res.Label) }})
+	}
+	for i := range cols {
+		if cols[i].header == "" {
+			cols[i].header = cols[i].name
+		}
+	}
+	return cols
+}
+
+// recordSchema is a schema declaration, the columns of the records following it
+type recordSchema struct {
+	version int
+	format  string // csv or jsonl
+	cols    []string
+	index   map[string]int
+	crc     string // the column of the CRC, crc32c or crc32
+}
+
+// schema returns the schema declaration of the records of the run, the jsonl records hold the ordinal of
+// the listed paths numbering them
+func (mc *MassCRC32C) schema() recordSchema {
+	var names []string
+	if mc.recordFormat == "jsonl" {
+		names = append(names, "ordinal")
+	}
+	for _, col := range mc.recordColumns() {
+		names = append(names, col.name)
+	}
+	return recordSchema{version: recordSchemaVersion, format: mc.recordFormat, cols: names}
+}
+
+func (rs recordSchema) header() string {
+	return fmt.Sprintf("%s%d format=%s cols=%s\n", schemaHeaderPrefix, rs.version, rs.format, strings.Join(rs.cols, ","))
+}
+
+// EnableSchemaHeader starts the -format csv and jsonl outputs with the schema declaration line,
+// must be called before Startup
+func (mc *MassCRC32C) EnableSchemaHeader() {
+	mc.schemaHeader = true
+}
+
+// withSchemaHeader writes the schema declaration and the start time of the run before the header of
+// writeHeader, if any
+func (mc *MassCRC32C) withSchemaHeader(writeHeader func(w io.Writer) error) func(w io.Writer) error {
+	header := mc.schema().header() + mc.startedHeader()
+	return func(w io.Writer) error {
+		if _, err := io.WriteString(w, header); err != nil {
+			return err
+		}
+		if writeHeader == nil {
+			return nil
+		}
+		return writeHeader(w)
+	}
+}
+
+var errSchemaVersion = errors.New("schema newer than this build")
+
+// parseSchemaHeader parses a schema declaration line, a version above recordSchemaVersion is refused:
+// its columns may change the meaning of the records
+func parseSchemaHeader(line string) (*recordSchema, error) {
+	rs := &recordSchema{index: map[string]int{}}
+	for i, field := range strings.Fields(line[len("# "):]) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed schema field %q", field)
+		}
+		switch {
+		case i == 0 && key == "schema":
+			version, err := strconv.Atoi(value)
+			if err != nil || version < 1 {
+				return nil, fmt.Errorf("malformed schema version %q", value)
+			}
+			if version > recordSchemaVersion {
+				return nil, fmt.Errorf("%w: %d, this build reads up to %d", errSchemaVersion, version, recordSchemaVersion)
+			}
+			rs.version = version
+		case key == "format":
+			if value != "csv" && value != "jsonl" {
+				return nil, fmt.Errorf("unknown schema format %q", value)
+			}
+			rs.format = value
+		case key == "cols":
+			rs.cols = strings.Split(value, ",")
+		}
+	}
+	if rs.version == 0 || rs.format == "" || rs.cols == nil {
+		return nil, errors.New("incomplete schema declaration")
+	}
+	for i, col := range rs.cols {
+		if _, dup := rs.index[col]; dup {
+			return nil, fmt.Errorf("column %s declared twice", col)
+		}
+		rs.index[col] = i
+	}
+	for _, crc := range []string{"crc32c", "crc32"} {
+		if _, ok := rs.index[crc]; ok {
+			rs.crc = crc
+			break
+		}
+	}
+	for _, required := range []string{rs.crc, "size", "path"} {
+		if _, ok := rs.index[required]; !ok || required == "" {
+			return nil, errors.New("the schema declares no crc32c, crc32, size or path column")
+		}
+	}
+	return rs, nil
+}
+
+// headerRow tells whether row is the -header row of a csv output
+func (rs *recordSchema) headerRow(row []string) bool {
+	return len(row) == len(rs.cols) && row[rs.index["size"]] == "size" && row[rs.index["path"]] == "path"
+}
+
+// csvRecord maps the fields of a csv row to a record by the declared columns
+func (rs *recordSchema) csvRecord(row []string) (manifestRecord, error) {
+	if len(row) != len(rs.cols) {
+		return manifestRecord{}, fmt.Errorf("%d fields, the schema declares %d", len(row), len(rs.cols))
+	}
+	crc := row[rs.index[rs.crc]]
+	if _, err := decodeCRC(crc); err != nil {
+		return manifestRecord{}, fmt.Errorf("malformed crc: %w", err)
+	}
+	size, err := strconv.ParseUint(row[rs.index["size"]], 10, 64)
+	if err != nil {
+		return manifestRecord{}, fmt.Errorf("malformed size: %w", err)
+	}
+	path := row[rs.index["path"]]
+	if path == "" {
+		return manifestRecord{}, errors.New("empty path")
+	}
+	rec := manifestRecord{CRC: crc, Size: size, Path: path}
+	if i, ok := rs.index["bad_blocks"]; ok {
+		rec.Partial = row[i] != ""
+	}
+	return rec, nil
+}
+
+// jsonRecord maps a jsonl record to a record, its CRC taken from the declared column
+func (rs *recordSchema) jsonRecord(line string) (manifestRecord, error) {
+	var rec jsonRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return manifestRecord{}, err
+	}
+	if rs.crc == "crc32" {
+		return rec.manifestRecord(rec.CRC32)
+	}
+	return rec.manifestRecord(rec.CRC32C)
+}
+
+// csvRow reads the csv row starting with line, joining the next lines while a quoted path holding a
+// newline is open
+func (mp *manifestParser) csvRow(line string) ([]string, error) {
+	for {
+		r := csv.NewReader(strings.NewReader(line))
+		r.FieldsPerRecord = -1
+		row, err := r.Read()
+		if !errors.Is(err, csv.ErrQuote) || !mp.scanner.Scan() {
+			return row, err
+		}
+		mp.line++
+		line += "\n" + strings.TrimSuffix(mp.scanner.Text(), "\r")
+	}
+}
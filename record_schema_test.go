@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Test the columns of every configuration are in the vocabulary of the schema version, and the keys of
+// the jsonl records in their declaration
+func TestRecordSchemaVocabulary(t *testing.T) {
+	// a column added to the vocabulary bumps recordSchemaVersion, then pin the new vocabulary here
+	pinned := "ordinal,crc32c,crc32,md5,sha256,xxh64,blake3,size,path,nlink,inode,btime,bad_blocks,head_crc32c,tail_crc32c,label"
+	if recordSchemaVersion != 1 || strings.Join(recordSchemaVocabulary, ",") != pinned {
+		t.Fatalf("schema %d declares %v, expected the vocabulary of schema 1", recordSchemaVersion, recordSchemaVocabulary)
+	}
+
+	mc := InitMassCRC32C(1, 1)
+	mc.SetAlgos(algoCRC32C, algoMD5, algoSHA256, algoXXH64, algoBLAKE3)
+	mc.EnableJSONLOutput()
+	mc.EnableStatFields(statFields{nlink: true, inode: true, btime: true})
+	mc.EnableSkipBadBlocks(badBlockConfig{blockSize: 4096})
+	mc.EnableEdgeDigest(4)
+	mc.EnableJSONInput()
+	cols := mc.schema().cols
+	next := 0
+	for _, col := range cols {
+		for next < len(recordSchemaVocabulary) && recordSchemaVocabulary[next] != col {
+			next++
+		}
+		if next == len(recordSchemaVocabulary) {
+			t.Fatalf("declared %v, expected the columns in the vocabulary order", cols)
+		}
+	}
+	if len(cols) != len(recordSchemaVocabulary)-1 { // crc32 is crc32c with -poly ieee
+		t.Errorf("declared %v, expected every column but crc32", cols)
+	}
+
+	out := &bytes.Buffer{}
+	mc.writeJSONRecord(out, Result{
+		Path:      "f",
+		Ordinal:   "1",
+		Label:     json.RawMessage(`{"k":1}`),
+		CRC:       "WaIfQg== 0 1 2 3",
+		Size:      1,
+		BadBlocks: []BadRange{{0, 4096}},
+		Head:      "WaIfQg==",
+		Tail:      "WaIfQg==",
+	})
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &keys); err != nil {
+		t.Fatal(err)
+	}
+	declared := strings.Join(cols, ",")
+	for key := range keys {
+		if !strings.Contains(","+declared+",", ","+key+",") {
+			t.Errorf("jsonl key %s not declared in %s", key, declared)
+		}
+	}
+}
+
+// schemaManifest writes the records of paths in the format set by configure, returning the manifest path
+func schemaManifest(t *testing.T, paths []string, configure func(mc *MassCRC32C)) string {
+	out := &bytes.Buffer{}
+	runPaths(t, 1, paths, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+		configure(mc)
+		mc.EnableSchemaHeader()
+	})
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	if err := os.WriteFile(manifest, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+// Test the manifests of different schemas diff by their declared columns
+func TestSchemaMixedDiff(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a", "with, comma", `with "quotes"`, "c"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	csvA := schemaManifest(t, paths[:3], func(mc *MassCRC32C) { mc.EnableCSVOutput(true) })
+	// the columns added after the path of a, before those of b
+	csvB := schemaManifest(t, paths[:3], func(mc *MassCRC32C) {
+		mc.EnableCSVOutput(false)
+		mc.EnableStatFields(statFields{inode: true})
+		mc.EnableEdgeDigest(2)
+	})
+	if err := os.WriteFile(paths[0], []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsonl := schemaManifest(t, paths[1:], func(mc *MassCRC32C) {
+		mc.EnableJSONLOutput()
+		mc.EnableStatFields(statFields{nlink: true})
+	})
+
+	for _, test := range []struct {
+		a, b     string
+		expected string
+	}{
+		{csvA, csvB, ""},
+		{csvB, csvA, ""},
+		{csvA, jsonl, "only-a a\nonly-b c\n"},
+		{jsonl, csvB, "only-a c\nonly-b a\n"},
+	} {
+		out := &bytes.Buffer{}
+		mc := InitMassCRC32C(1, 1)
+		mc.StdOut = out
+		mc.DebugOut = io.Discard
+		mc.EnableStrictParse()
+		differ, err := mc.DiffManifests(test.a, test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			if line != "" {
+				fields := strings.SplitN(line, " ", 4)
+				got = append(got, fields[0]+" "+filepath.Base(fields[3]))
+			}
+		}
+		sort.Strings(got)
+		if joined := strings.Join(got, "\n"); joined != strings.TrimSuffix(test.expected, "\n") || differ != (test.expected != "") {
+			t.Errorf("%s %s: got %q, expected %q", filepath.Base(filepath.Dir(test.a)), filepath.Base(filepath.Dir(test.b)), joined, test.expected)
+		}
+	}
+}
+
+func TestSchemaParse(t *testing.T) {
+	manifest := "# schema=1 format=csv cols=size,path,crc32c,label\n" +
+		"size,path,crc,label\n" +
+		"3,\"new\nline\",WaIfQg==,\"{\"\"k\"\":1}\"\n" +
+		"# schema=1 format=jsonl cols=ordinal,crc32,size,path\n" +
+		`{"crc32":"WaIfQg==","size":4,"path":"ieee"}` + "\n" +
+		"# schema=1 format=csv cols=crc32c,size,path\n" +
+		"WaIfQg==,5\n"
+	mp, err := newManifestParser("m", strings.NewReader(manifest), false, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []manifestRecord
+	for {
+		rec, err := mp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec)
+	}
+	expected := []manifestRecord{{Path: "new\nline", CRC: "WaIfQg==", Size: 3}, {Path: "ieee", CRC: "WaIfQg==", Size: 4}}
+	if len(got) != 2 || got[0] != expected[0] || got[1] != expected[1] || mp.Skipped() != 1 {
+		t.Errorf("got %+v, %d skipped, expected %+v and the short row skipped", got, mp.Skipped(), expected)
+	}
+
+	for _, bad := range []string{
+		"# schema=2 format=csv cols=crc32c,size,path",
+		"# schema=1 format=tsv cols=crc32c,size,path",
+		"# schema=1 format=csv cols=md5,size,path",
+		"# schema=1 format=csv",
+	} {
+		mp, err := newManifestParser("m", strings.NewReader(bad+"\nWaIfQg==,5,p\n"), false, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mp.Next(); err == nil || err == io.EOF {
+			t.Errorf("%q: got %v, expected the declaration refused", bad, err)
+		} else if strings.HasPrefix(bad, "# schema=2") && !errors.Is(err, errSchemaVersion) {
+			t.Errorf("%q: got %v, expected the newer schema refused", bad, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result is the record of a file for the library users, checksummed or failing. It holds every field of
+// the records the CLI writes, those are written from it.
+type Result struct {
+	Path    string
+	Ordinal string          // the ordinal of its list line, empty when none
+	Label   json.RawMessage // the label of its -input json job
+	CRC     string          // the digests of -algo separated by spaces, empty on error
+	Size    uint64          // the bytes read before the error on error
+	Carried bool            // carried forward from the -since manifest instead of read
+	Err     error
+
+	Nlink   uint64    // with EnableStatFields, like Inode and Btime
+	Inode   uint64    // the file index on windows
+	Btime   time.Time // zero when unknown
+	ModTime int64     // unix time, only known with -sqlite
+
+	BadBlocks []BadRange // the unreadable ranges of a partial record with -skip-bad-blocks, nil when the whole file was read
+	Head      string     // the CRC of the first -edge-digest bytes, empty when off or the size is unknown
+	Tail      string     // the CRC of the last -edge-digest bytes
+	Chunks    []Chunk    // the CRC of every -chunk-size bytes
+}
+
+// Chunk is the CRC of a byte range of a file, like the components of a GCS composite object
+type Chunk struct {
+	Offset uint64
+	Length uint64
+	CRC    string
+}
+
+// result is the Result of a file result, the writer goroutine only calls it
+func (mc *MassCRC32C) result(res fileResult) Result {
+	r := Result{
+		Path:    res.item.Path,
+		Ordinal: res.item.Ordinal,
+		Label:   res.item.Label,
+		CRC:     res.crc,
+		Size:    res.size,
+		Carried: res.carried,
+		Err:     res.err,
+		Nlink:   res.stat.nlink,
+		Inode:   res.stat.id.index,
+		Btime:   res.stat.btime,
+		ModTime: res.mtime,
+	}
+	if res.bad != nil {
+		r.BadBlocks = res.bad.ranges
+	}
+	if res.edges != nil {
+		r.Head, r.Tail = res.edges.head, res.edges.tail
+	}
+	for _, chunk := range res.chunks {
+		r.Chunks = append(r.Chunks, Chunk{Offset: chunk.offset, Length: chunk.length, CRC: mc.formatCRC(chunk.crc)})
+	}
+	return r
+}
+
+// resultStream hands the results written by the writer to the sequence of Results
+type resultStream struct {
+	out       chan Result
+	stop      chan struct{} // closed when the run is cancelled, the results are then dropped
+	stopOnce  sync.Once
+	cancelled atomic.Bool
+}
+
+func (rs *resultStream) send(r Result) {
+	select {
+	case rs.out <- r:
+	case <-rs.stop:
+	}
+}
+
+func (rs *resultStream) cancel() {
+	rs.stopOnce.Do(func() {
+		rs.cancelled.Store(true)
+		close(rs.stop)
+	})
+}
+
+// Results returns the sequence of the results in the order they are written, ending once TearDown completes.
+// It has the type of the iter.Seq[Result] of Go 1.23, ranged with `for res := range mc.Results()`, and must be
+// called before Startup or Run and ranged concurrently with the run. Stopping the loop stops the draining:
+// the writer, then the workers and the producer block until the context of Run is cancelled, the remaining
+// results are then dropped. The records are written to StdOut as well.
+func (mc *MassCRC32C) Results() func(yield func(Result) bool) {
+	if mc.stream == nil {
+		mc.stream = &resultStream{out: make(chan Result), stop: make(chan struct{})}
+	}
+	out := mc.stream.out
+	return func(yield func(Result) bool) {
+		for res := range out {
+			if !yield(res) {
+				return
+			}
+		}
+	}
+}
+
+// cancelled tells whether the context of Run was cancelled, the enqueue methods then return ErrInterrupted
+func (mc *MassCRC32C) cancelled() bool {
+	return mc.stream != nil && mc.stream.cancelled.Load()
+}
+
+// Run starts jobCount workers, calls producer to enqueue the paths and tears the run down once it returns,
+// blocking until then. Cancelling ctx interrupts the run like a CTRL+C and drops the results not yet taken
+// from Results. It returns the error of producer, ctx.Err() when cancelled otherwise.
+func (mc *MassCRC32C) Run(ctx context.Context, jobCount int, producer func() error) error {
+	if mc.stream == nil {
+		mc.stream = &resultStream{stop: make(chan struct{})}
+	}
+	mc.Startup(jobCount)
+	produced := make(chan struct{})
+	goroutines.spawn(goroutineRunWatcher, func() {
+		select {
+		case <-ctx.Done():
+			mc.stream.cancel()
+		case <-produced:
+		}
+	})
+	err := producer()
+	mc.TearDown()
+	close(produced)
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
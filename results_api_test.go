@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRun returns a run over the objects of a fake store writing its records nowhere
+func fakeRun(objects map[string]string) *MassCRC32C {
+	mc := InitMassCRC32C(1, 4)
+	mc.StdOut = io.Discard
+	mc.ErrOut = io.Discard
+	mc.DebugOut = io.Discard
+	mc.DisableSignalHandling = true
+	mc.RegisterOpener("fake", &fakeOpener{objects: objects})
+	return mc
+}
+
+func ExampleMassCRC32C_Results() {
+	mc := fakeRun(map[string]string{"a": "alpha", "b": "bravo"})
+	results := mc.Results()
+	done := make(chan error)
+	go func() {
+		done <- mc.Run(context.Background(), 1, func() error {
+			return mc.EnqueueBatch([]string{"fake://a", "fake://b", "fake://c"})
+		})
+	}()
+	// for res := range results with Go 1.23
+	results(func(res Result) bool {
+		if res.Err != nil {
+			fmt.Println(res.Path, "failed")
+		} else {
+			fmt.Println(res.Path, res.CRC, res.Size)
+		}
+		return true
+	})
+	fmt.Println(<-done)
+	// Output:
+	// fake://a eNkvgQ== 5
+	// fake://b WQpsBA== 5
+	// fake://c failed
+	// <nil>
+}
+
+func TestResults(t *testing.T) {
+	objects := make(map[string]string)
+	var paths []string
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("object%d", i)
+		objects[name] = strings.Repeat("x", i)
+		paths = append(paths, "fake://"+name)
+	}
+	mc := fakeRun(objects)
+	results := mc.Results()
+	done := make(chan error)
+	go func() {
+		done <- mc.Run(context.Background(), 4, func() error {
+			return mc.EnqueueBatch(append(paths, "fake://missing"))
+		})
+	}()
+	seen := make(map[string]bool)
+	var failed []string
+	results(func(res Result) bool {
+		if res.Err != nil {
+			failed = append(failed, res.Path)
+		} else if res.Size != uint64(len(objects[strings.TrimPrefix(res.Path, "fake://")])) || res.CRC == "" {
+			t.Errorf("got %+v", res)
+		}
+		seen[res.Path] = true
+		return true
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 101 || len(failed) != 1 || failed[0] != "fake://missing" || mc.Stats().Ended.IsZero() {
+		t.Errorf("got %d results, %q failing", len(seen), failed)
+	}
+}
+
+// Test the results hold every field of the records: written again from them, the records are the same
+func TestResultsRecords(t *testing.T) {
+	out, chunkOut := &bytes.Buffer{}, &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 4)
+	mc.StdOut = out
+	mc.ErrOut = io.Discard
+	mc.DebugOut = io.Discard
+	mc.DisableSignalHandling = true
+	mc.EnableStatFields(statFields{nlink: true, inode: true})
+	mc.EnableEdgeDigest(64)
+	mc.EnableChunkManifest(1024, chunkOut)
+	results := mc.Results()
+	done := make(chan error)
+	go func() {
+		done <- mc.Run(context.Background(), 2, func() error {
+			return mc.EnqueueBatch([]string{"test_data.txt", "go.mod", "missing"})
+		})
+	}()
+	records, chunks := &bytes.Buffer{}, &bytes.Buffer{}
+	results(func(res Result) bool {
+		if res.Err == nil {
+			mc.writeRecord(records, res)
+			writeChunkRecords(chunks, res)
+		}
+		return true
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if records.String() != out.String() || chunks.String() != chunkOut.String() || !strings.Contains(out.String(), "head=") {
+		t.Errorf("got %q %q from the results, expected %q %q", records, chunks, out, chunkOut)
+	}
+}
+
+// Test a consumer stopping early blocks the producer until the context is cancelled, the run then
+// shuts down with the results left dropped
+func TestResultsEarlyExit(t *testing.T) {
+	objects := make(map[string]string)
+	var paths []string
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("object%d", i)
+		objects[name] = name
+		paths = append(paths, "fake://"+name)
+	}
+	mc := fakeRun(objects)
+	results := mc.Results()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	var produced error
+	go func() {
+		done <- mc.Run(ctx, 2, func() error {
+			produced = mc.EnqueueBatch(paths)
+			return produced
+		})
+	}()
+	taken := 0
+	results(func(res Result) bool {
+		taken++
+		return taken < 3
+	})
+
+	// the enqueued count stalls once the writer, the results, the workers and the queue are full
+	enqueued := mc.enqueueSeq.Load()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		next := mc.enqueueSeq.Load()
+		if next == enqueued {
+			break
+		}
+		enqueued = next
+	}
+	if enqueued >= 100 {
+		t.Fatalf("got %d paths enqueued after the consumer stopped, expected the producer to block", enqueued)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("run ended with %v while blocked", err)
+	default:
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrInterrupted) || !errors.Is(produced, ErrInterrupted) {
+			t.Errorf("got %v, expected the producer interrupted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run not shut down after the cancel")
+	}
+	if stats := mc.Stats(); stats.Running || stats.Ended.IsZero() || stats.Files >= 100 {
+		t.Errorf("got %+v, expected a torn down run", stats)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// printRunInfo prints when, where and by which version the run happened, and its input sources
+func printRunInfo(w io.Writer, stats Stats) {
+	ended := "still running"
+	if !stats.Ended.IsZero() {
+		ended = stats.Ended.UTC().Format(time.RFC3339)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	fmt.Fprintf(
+		w,
+		"Started: %s\n"+
+			"Ended: %s\n"+
+			"Host: %s %s/%s\n"+
+			"Version: %s\n"+
+			"Input sources: %d roots walked, %d lists read\n",
+		stats.Started.UTC().Format(time.RFC3339),
+		ended,
+		hostname,
+		runtime.GOOS,
+		runtime.GOARCH,
+		toolBuild(),
+		stats.Roots,
+		stats.Lists,
+	)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	schedProbeInterval  = 100 * time.Millisecond
+	schedDelayThreshold = 20 * time.Millisecond
+	schedSlowSamples    = 10 // consecutive slow samples making a sustained delay
+)
+
+// schedProbe measures the scheduling delay of a goroutine: at checkpoints it yields and times
+// how long it waits to run again. The walker and writer starving behind the readers (-p too low)
+// shows up as storage slowness otherwise. Checkpoints must be called from a single goroutine.
+type schedProbe struct {
+	name      string
+	interval  time.Duration
+	threshold time.Duration
+	last      time.Time
+	slow      int
+
+	samples atomic.Uint64
+	total   atomic.Int64
+	max     atomic.Int64
+}
+
+func newSchedProbe(name string) *schedProbe {
+	return &schedProbe{name: name, interval: schedProbeInterval, threshold: schedDelayThreshold}
+}
+
+// checkpoint returns the delay when it is sustained above the threshold, 0 otherwise
+func (sp *schedProbe) checkpoint() time.Duration {
+	now := time.Now()
+	if now.Sub(sp.last) < sp.interval {
+		return 0
+	}
+	runtime.Gosched()
+	sp.last = time.Now()
+	delay := sp.last.Sub(now)
+	sp.samples.Add(1)
+	sp.total.Add(int64(delay))
+	if int64(delay) > sp.max.Load() {
+		sp.max.Store(int64(delay))
+	}
+	if delay < sp.threshold {
+		sp.slow = 0
+		return 0
+	}
+	sp.slow++
+	if sp.slow < schedSlowSamples {
+		return 0
+	}
+	return delay
+}
+
+func (sp *schedProbe) average() time.Duration {
+	samples := sp.samples.Load()
+	if samples == 0 {
+		return 0
+	}
+	return time.Duration(sp.total.Load() / int64(samples))
+}
+
+// schedCheckpoint samples probe and prints a one time advisory on a sustained delay
+func (mc *MassCRC32C) schedCheckpoint(sp *schedProbe) {
+	delay := sp.checkpoint()
+	if delay == 0 || !mc.schedAdvised.CompareAndSwap(false, true) {
+		return
+	}
+	fmt.Fprintf(
+		mc.DebugOut,
+		"advisory: the %s waits %s to be scheduled, the %d CPU set with -p may be too low for the parallel reads\n",
+		sp.name,
+		delay.Round(time.Millisecond),
+		runtime.GOMAXPROCS(0),
+	)
+}
+
+func (mc *MassCRC32C) printSchedDelays() {
+	for _, sp := range []*schedProbe{mc.walkerProbe, mc.writerProbe} {
+		fmt.Fprintf(
+			mc.DebugOut,
+			"%s scheduling delay: avg %s, max %s\n",
+			strings.ToUpper(sp.name[:1])+sp.name[1:],
+			sp.average().Round(time.Microsecond),
+			time.Duration(sp.max.Load()).Round(time.Microsecond),
+		)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test the probe detects the starvation of a single CPU shared with busy goroutines
+func TestSchedProbeStarved(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					for j := 0; j < 1000000; j++ {
+					}
+				}
+			}
+		}()
+	}
+
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.DebugOut = out
+	sp := newSchedProbe("walker")
+	sp.interval = 0
+	sp.threshold = time.Millisecond
+	for i := 0; i < 2*schedSlowSamples; i++ {
+		mc.schedCheckpoint(sp)
+	}
+	close(stop)
+	wg.Wait()
+
+	if sp.samples.Load() != 2*schedSlowSamples {
+		t.Errorf("samples error, got %d, expected %d", sp.samples.Load(), 2*schedSlowSamples)
+	}
+	if time.Duration(sp.max.Load()) < time.Millisecond {
+		t.Errorf("max delay too low for a starved goroutine: %s", time.Duration(sp.max.Load()))
+	}
+	if strings.Count(out.String(), "advisory") != 1 {
+		t.Errorf("expected a single advisory, got %q", out.String())
+	}
+}
+
+func TestSchedProbeIdle(t *testing.T) {
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.DebugOut = out
+	sp := newSchedProbe("writer")
+	sp.interval = 0
+	for i := 0; i < 2*schedSlowSamples; i++ {
+		mc.schedCheckpoint(sp)
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected advisory without contention: %q", out.String())
+	}
+	// samples are throttled by the interval
+	sp.interval = time.Hour
+	mc.schedCheckpoint(sp)
+	if sp.samples.Load() != 2*schedSlowSamples {
+		t.Errorf("sample taken before the interval elapsed")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// -format sfv writes the Simple File Verification layout of cksfv and the other SFV tools: a "path CRC"
+// line per file, the CRC being the IEEE CRC-32 in uppercase hex, after "; " comment lines naming the
+// generator and the generation time. The tools take the CRC after the last space of a line, so the paths
+// with spaces are written as they are, the size and the list ordinals are not written.
+
+// EnableSFVOutput writes the records in the SFV layout, computing the IEEE CRC-32 in hex it needs,
+// must be called before Startup
+func (mc *MassCRC32C) EnableSFVOutput() {
+	mc.recordFormat = "sfv"
+	mc.writeRecord = writeSFVRecord
+	mc.writeHeader = writeSFVHeader
+	mc.SetCRCParams(ieeeParams)
+	mc.SetEncoding(encHex)
+}
+
+func writeSFVHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "; Generated by mass-crc32c %s on %s\n", toolBuild(), time.Now().Format("2006-01-02 at 15:04.05"))
+	return err
+}
+
+func writeSFVRecord(w io.Writer, res Result) {
+	fmt.Fprintf(w, "%s %s\n", res.Path, strings.ToUpper(res.CRC))
+}
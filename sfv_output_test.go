@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the SFV records are the uppercase hex IEEE CRC-32 after the path, spaces in the path included,
+// parsed back the way the SFV tools do from the last space of the lines
+func TestSFVOutput(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"plain.txt": "short test data", "with spaces.bin": "data of a file with spaces"}
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	out := &bytes.Buffer{}
+	mc := runPaths(t, 2, append(paths, "test_data.txt"), func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableSFVOutput()
+	})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "; Generated by mass-crc32c ") {
+		t.Fatalf("got %q", out.String())
+	}
+	got := make(map[string]string)
+	for _, line := range lines[1:] {
+		i := strings.LastIndexByte(line, ' ')
+		got[line[:i]] = line[i+1:]
+	}
+	if got["test_data.txt"] != "018B8057" {
+		t.Errorf("got %q", got)
+	}
+	for name, data := range files {
+		if crc := got[filepath.Join(dir, name)]; crc != fmt.Sprintf("%08X", crc32.ChecksumIEEE([]byte(data))) {
+			t.Errorf("%s: got %s", name, crc)
+		}
+	}
+	if mc.algoName() != "CRC-32 (IEEE)" {
+		t.Errorf("got %s", mc.algoName())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// outFiles opens the output files of a run once per file, the outputs naming the same file by path or
+// through another link share a single stream, compressed as one gzip stream with -c, instead of two writers
+// clobbering each other
+type outFiles struct {
+	compressJobs int
+	debugOut     io.Writer
+	files        []*sharedOutFile
+}
+
+// sharedOutFile is a file opened by outFiles, its writes are serialized: the records and error records
+// are each a single Write so they are interleaved whole
+type sharedOutFile struct {
+	path   string // cleaned absolute path
+	id     fileIdentity
+	flags  []string // the flags naming it, in the order opened
+	mu     sync.Mutex
+	w      io.Writer
+	close  func()
+	refs   int
+	summed bool // its CRC-32C is computed for -publish, it cannot be shared
+}
+
+func (sf *sharedOutFile) Write(p []byte) (int, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.w.Write(p)
+}
+
+// lookup returns the file already opened as path, nil when none
+func (of *outFiles) lookup(path string) *sharedOutFile {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	var id fileIdentity
+	if info, err := os.Stat(path); err == nil {
+		id = fileStatOf(path, info).id
+	}
+	for _, sf := range of.files {
+		if sf.path == abs || (id.known() && id.Equal(sf.id)) {
+			return sf
+		}
+	}
+	return nil
+}
+
+// sameFile tells whether the paths name the same file, by their absolute path or the identity of the file
+// when it exists
+func sameFile(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	idA := fileStatOf(a, infoA).id
+	return idA.known() && idA.Equal(fileStatOf(b, infoB).id)
+}
+
+// open opens path for the output of flag like openSummedOutFile, or shares the stream of the file
+// already opened by another flag, the file is closed by the last returned close function
+func (of *outFiles) open(flag string, path string, sum *summedWriter) (io.Writer, func(), error) {
+	if sf := of.lookup(path); sf != nil {
+		if sum != nil || sf.summed {
+			return nil, nil, fmt.Errorf("-%s is the same file as -%s, not with -publish", flag, sf.flags[0])
+		}
+		fmt.Fprintf(of.debugOut, "warning: -%s is the same file as -%s, both are written as one stream\n", flag, sf.flags[0])
+		sf.flags = append(sf.flags, flag)
+		sf.refs++
+		return sf, of.release(sf), nil
+	}
+	w, closeFunc, err := openSummedOutFile(path, of.compressJobs, of.debugOut, sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	sf := &sharedOutFile{flags: []string{flag}, w: w, close: closeFunc, refs: 1, summed: sum != nil}
+	sf.path, err = filepath.Abs(path)
+	if err != nil {
+		sf.path = filepath.Clean(path)
+	}
+	if info, err := os.Stat(path); err == nil {
+		sf.id = fileStatOf(path, info).id
+	}
+	of.files = append(of.files, sf)
+	return sf, of.release(sf), nil
+}
+
+func (of *outFiles) release(sf *sharedOutFile) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sf.refs--
+			if sf.refs == 0 {
+				sf.close()
+			}
+		})
+	}
+}
+
+// CommentErrors starts the text error records with "# " for the manifest readers to skip them as comments,
+// when they are written to the file of the records
+func (mc *MassCRC32C) CommentErrors() {
+	mc.errReporter.prefix = "# "
+}
+
+// shared tells whether the outputs of the flags were opened as the same file
+func (of *outFiles) shared(flagA string, flagB string) bool {
+	for _, sf := range of.files {
+		a, b := false, false
+		for _, flag := range sf.flags {
+			a = a || flag == flagA
+			b = b || flag == flagB
+		}
+		if a && b {
+			return true
+		}
+	}
+	return false
+}
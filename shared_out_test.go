@@ -0,0 +1,145 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var recordLine = regexp.MustCompile(`^[A-Za-z0-9+/]{6}== \d+ fake://object\d+$`)
+
+// Test the records and the error records written concurrently to -out and -errout naming the same gzip file
+// make one stream decompressing cleanly, the error records read as comments by the manifest parser
+func TestSharedOutFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, compressJobs := range []int{1, 3} {
+		out := filepath.Join(dir, fmt.Sprintf("combined%d.gz", compressJobs))
+		fo := &fakeOpener{objects: make(map[string]string)}
+		var paths []string
+		for i := 0; i < 2000; i++ {
+			name := fmt.Sprintf("object%d", i)
+			if i%5 != 0 {
+				fo.objects[name] = strings.Repeat(name, i%50)
+			}
+			paths = append(paths, "fake://"+name)
+		}
+		outs := &outFiles{compressJobs: compressJobs, debugOut: io.Discard}
+		w, closeOut, err := outs.open("out", out, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same file by another path
+		errW, closeErrOut, err := outs.open("errout", filepath.Join(dir, ".", filepath.Base(out)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !outs.shared("out", "errout") || len(outs.files) != 1 {
+			t.Fatal("expected a single shared file")
+		}
+		runPaths(t, 8, paths, func(mc *MassCRC32C) {
+			mc.StdOut = w
+			mc.ErrOut = errW
+			mc.RegisterOpener("fake", fo)
+			mc.CommentErrors()
+		})
+		closeOut()
+		closeErrOut()
+
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%d jobs: %v", compressJobs, err)
+		}
+		records, errs := 0, 0
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "# ") && strings.Contains(line, " error scope=file "):
+				errs++
+			case recordLine.MatchString(line):
+				records++
+			default:
+				t.Errorf("%d jobs: mangled line %q", compressJobs, line)
+			}
+		}
+		if records != 1600 || errs != 400 {
+			t.Errorf("%d jobs: got %d records and %d errors, expected 1600 and 400", compressJobs, records, errs)
+		}
+		mp, err := newManifestParser(out, strings.NewReader(string(data)), true, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := 0
+		for {
+			_, err := mp.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d jobs: %v", compressJobs, err)
+			}
+			parsed++
+		}
+		if parsed != 1600 {
+			t.Errorf("%d jobs: parsed %d records, expected 1600", compressJobs, parsed)
+		}
+	}
+}
+
+func TestSharedOutFileIdentity(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	outs := &outFiles{debugOut: io.Discard}
+	w, closeOut, err := outs.open("out", out, &summedWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(out, filepath.Join(dir, "link.txt")); err != nil {
+		t.Skipf("no hard links: %v", err)
+	}
+	if _, _, err := outs.open("errout", filepath.Join(dir, "link.txt"), nil); err == nil || !strings.Contains(err.Error(), "-errout is the same file as -out") {
+		t.Errorf("got %v, expected the file of -publish refused", err)
+	}
+	other, closeOther, err := outs.open("out-clean", filepath.Join(dir, "other.txt"), nil)
+	if err != nil || other == w || outs.shared("out", "out-clean") {
+		t.Errorf("got %v, expected another file", err)
+	}
+	closeOther()
+	closeOut()
+}
+
+// Test an existing -out longer than the new manifest keeps none of its old tail, and -since naming it is refused
+func TestOutFileTruncated(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(out, []byte(strings.Repeat("garbage\n", 625)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"-out", out, "test_data.txt"}); code != 0 {
+		t.Fatalf("got exit code %d", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "garbage") {
+		t.Errorf("got the old tail in %q", data)
+	}
+	if code := run([]string{"-out", out, "-since", out, "test_data.txt"}); code != 2 {
+		t.Errorf("got exit code %d, expected -since naming -out refused", code)
+	}
+	if after, _ := os.ReadFile(out); string(after) != string(data) {
+		t.Errorf("got %q, expected the refused run to leave -out alone", after)
+	}
+}
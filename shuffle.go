@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// shuffler is the reservoir of -shuffle between the producers and the queue: once full, each item added
+// releases a random one of the reservoir or the item itself, so the paths of a directory are spread over
+// the time it takes to enqueue the next reservoir size paths. The items left are released in a random
+// order by TearDown, or discarded when the run is interrupted.
+type shuffler struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	items []QueueItem
+	size  int
+}
+
+func newShuffler(size int, seed int64) *shuffler {
+	return &shuffler{rng: rand.New(rand.NewSource(seed)), items: make([]QueueItem, 0, size), size: size}
+}
+
+// add holds item and returns the item to enqueue in its place, if any
+func (sh *shuffler) add(item QueueItem) (QueueItem, bool) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if len(sh.items) < sh.size {
+		sh.items = append(sh.items, item)
+		return QueueItem{}, false
+	}
+	i := sh.rng.Intn(len(sh.items) + 1)
+	if i == len(sh.items) {
+		return item, true
+	}
+	released := sh.items[i]
+	sh.items[i] = item
+	return released, true
+}
+
+// drain empties the reservoir, returning its items in a random order
+func (sh *shuffler) drain() []QueueItem {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	items := sh.items
+	sh.rng.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	sh.items = nil
+	return items
+}
+
+// EnableShuffle enqueues the paths in a random order within a window of the queue length, the same
+// for a seed and the same paths listed or walked, must be called before Startup
+func (mc *MassCRC32C) EnableShuffle(seed int64) {
+	size := cap(mc.PathQueueG)
+	if size < 1 {
+		size = 1
+	}
+	mc.shuffle = newShuffler(size, seed)
+}
+
+// releaseShuffled enqueues the items left in the -shuffle reservoir once the producers are done,
+// or discards them when interrupted, they were never started
+func (mc *MassCRC32C) releaseShuffled() {
+	items := mc.shuffle.drain()
+	if mc.Interrupted.Load() {
+		return
+	}
+	for _, item := range items {
+		mc.PathQueueG <- item
+	}
+}
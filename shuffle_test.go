@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// shuffledRun returns the records of a run over paths, shuffled with seed unless 0
+func shuffledRun(t *testing.T, paths []string, seed int64, interrupt bool) []string {
+	fo := &fakeOpener{objects: make(map[string]string)}
+	for _, path := range paths {
+		fo.objects[strings.TrimPrefix(path, "fake://")] = path
+	}
+	out := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.RegisterOpener("fake", fo)
+		if seed != 0 {
+			mc.EnableShuffle(seed)
+		}
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		if err := mc.EnqueueBatch(paths); err != nil {
+			t.Fatal(err)
+		}
+		mc.Interrupted.Store(interrupt)
+	})
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestShuffle(t *testing.T) {
+	var paths []string
+	for i := 0; i < 200; i++ {
+		paths = append(paths, fmt.Sprintf("fake://object%03d", i))
+	}
+	plain := shuffledRun(t, paths, 0, false)
+	first := shuffledRun(t, paths, 1, false)
+	again := shuffledRun(t, paths, 1, false)
+	second := shuffledRun(t, paths, 2, false)
+	if strings.Join(first, "\n") != strings.Join(again, "\n") {
+		t.Error("got different orders with the same seed")
+	}
+	if strings.Join(first, "\n") == strings.Join(second, "\n") || strings.Join(first, "\n") == strings.Join(plain, "\n") {
+		t.Error("got the same order with different seeds")
+	}
+	sorted := func(records []string) string {
+		records = append([]string(nil), records...)
+		sort.Strings(records)
+		return strings.Join(records, "\n")
+	}
+	if len(plain) != 200 || sorted(first) != sorted(plain) || sorted(second) != sorted(plain) {
+		t.Errorf("got %d, %d and %d records, expected the same 200", len(plain), len(first), len(second))
+	}
+	// a path is released at most a window of 10 paths before its turn
+	for i, record := range first {
+		var n int
+		if _, err := fmt.Sscanf(record[strings.LastIndexByte(record, ' ')+1:], "fake://object%d", &n); err != nil || n > i+10 {
+			t.Errorf("record %d: got %q", i, record)
+		}
+	}
+
+	// the reservoir held when interrupted is discarded
+	interrupted := shuffledRun(t, paths, 1, true)
+	if len(interrupted) != 190 {
+		t.Errorf("got %d records when interrupted, expected the 190 released", len(interrupted))
+	}
+}
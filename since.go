@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// sinceRecord is the compact form of a previous manifest record kept in memory.
+// A loaded record costs about 70 bytes plus the path length (map slot, string header, value),
+// measured by BenchmarkSinceMemory, a 100M files manifest with 80 bytes paths needs ~15GB:
+// use an indexed manifest (-out-indexed) for such sizes, nothing is loaded then, every path is looked up in its index.
+type sinceRecord struct {
+	size uint64
+	crc  uint32
+}
+
+// sinceManifest holds the records of a previous run to carry forward the CRC of unchanged files
+type sinceManifest struct {
+	runTime time.Time
+	records map[string]sinceRecord // text manifests
+	index   *IndexedManifest       // indexed manifests
+	skipped uint64                 // malformed text lines
+	poly    string                 // -poly of the CRCs, from the poly header line, castagnoli without
+}
+
+// decodeCRC decodes a CRC of the records in any -enc encoding
+func decodeCRC(crc string) (uint32, error) {
+	var b []byte
+	var err error
+	switch crcEncodingOf(crc) {
+	case encHex:
+		b, err = hex.DecodeString(crc)
+	case encBase64URL:
+		b, err = base64.RawURLEncoding.DecodeString(crc)
+	default:
+		b, err = base64.StdEncoding.DecodeString(crc)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 4 {
+		return 0, fmt.Errorf("bad crc length %d", len(b))
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func encodeCRC(crc uint32) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// loadSinceManifest loads a text manifest, gzipped or not, or opens an indexed one.
+// Malformed text lines are skipped and counted, or fail the load when strict.
+// The previous run start comes from its "# mass-crc32c started=<RFC3339>" header line, runTime when not zero,
+// or the manifest modification time as a last resort. The polynomial comes from the poly header line.
+func loadSinceManifest(path string, runTime time.Time, strict bool, debugOut io.Writer) (*sinceManifest, error) {
+	if im, err := OpenIndexedManifest(path); err == nil {
+		sm := &sinceManifest{index: im, poly: polyCastagnoli}
+		return sm, sm.setRunTime(path, runTime, time.Time{}, debugOut)
+	} else if !errors.Is(err, errBadIndex) {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	parser, err := newManifestParser(path, f, strict, debugOut)
+	if err != nil {
+		return nil, err
+	}
+	defer parser.Close()
+
+	sm := &sinceManifest{records: make(map[string]sinceRecord), poly: polyCastagnoli}
+	var headerTime time.Time
+	parser.onComment = func(line string) {
+		if strings.HasPrefix(line, polyHeaderPrefix) {
+			sm.poly = strings.TrimSpace(line[len(polyHeaderPrefix):])
+		}
+		if strings.HasPrefix(line, startedHeaderPrefix) && headerTime.IsZero() {
+			value, _, _ := strings.Cut(line[len(startedHeaderPrefix):], " ")
+			headerTime, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	for {
+		rec, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Partial {
+			continue // its CRC is not the one of the file, read it again
+		}
+		crc, _ := decodeCRC(rec.CRC) // validated by the parser
+		sm.records[rec.Path] = sinceRecord{size: rec.Size, crc: crc}
+	}
+	sm.skipped = parser.Skipped()
+	return sm, sm.setRunTime(path, runTime, headerTime, debugOut)
+}
+
+func (sm *sinceManifest) setRunTime(path string, runTime time.Time, headerTime time.Time, debugOut io.Writer) error {
+	switch {
+	case !headerTime.IsZero():
+		sm.runTime = headerTime
+	case !runTime.IsZero():
+		sm.runTime = runTime
+	default:
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		sm.runTime = info.ModTime()
+		fmt.Fprintf(
+			debugOut,
+			"warning: no start time in %s, using its modification time, files changed during that run may be missed\n",
+			path,
+		)
+	}
+	return nil
+}
+
+// lookup returns the previous record of path
+func (sm *sinceManifest) lookup(path string) (sinceRecord, bool) {
+	if sm.records != nil {
+		rec, ok := sm.records[path]
+		return rec, ok
+	}
+	rec, found, err := sm.index.Lookup(path)
+	if err != nil || !found {
+		return sinceRecord{}, false
+	}
+	crc, err := decodeCRC(rec.CRC)
+	if err != nil {
+		return sinceRecord{}, false
+	}
+	return sinceRecord{size: rec.Size, crc: crc}, true
+}
+
+// carryForward returns the previous CRC of path when its size is unchanged and it was not modified since the previous run
+func (sm *sinceManifest) carryForward(path string) (uint32, uint64, bool) {
+	rec, ok := sm.lookup(path)
+	if !ok {
+		return 0, 0, false
+	}
+	info, err := os.Stat(longPath(path))
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, 0, false // let the normal read report the error
+	}
+	if uint64(info.Size()) != rec.size || !info.ModTime().Before(sm.runTime) {
+		return 0, 0, false
+	}
+	return rec.crc, rec.size, true
+}
+
+func (sm *sinceManifest) Close() error {
+	if sm.index != nil {
+		return sm.index.Close()
+	}
+	return nil
+}
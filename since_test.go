@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sinceFixture writes files and a previous manifest of them with a stale crc,
+// carried forward records keep the stale crc while recomputed ones get the real one
+func sinceFixture(t *testing.T) (string, []string) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"unchanged", "resized", "touched"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	for _, path := range paths[:2] {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(paths[1], []byte("resized!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(paths[1], past, past); err != nil {
+		t.Fatal(err)
+	}
+	return dir, paths
+}
+
+func runSince(t *testing.T, manifest string, paths []string, runTime time.Time) (string, *MassCRC32C) {
+	out := &bytes.Buffer{}
+	mc := runPaths(t, 1, paths, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		if err := mc.LoadSinceManifest(manifest, runTime); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return out.String(), mc
+}
+
+func TestSinceTextManifest(t *testing.T) {
+	dir, paths := sinceFixture(t)
+	manifest := &bytes.Buffer{}
+	fmt.Fprintf(manifest, "# mass-crc32c started=%s\n", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	for _, path := range paths {
+		fmt.Fprintf(manifest, "AAAAAA== %d %s\n", len(filepath.Base(path)), path)
+	}
+	gzPath := filepath.Join(dir, "old.txt.gz")
+	f, _ := os.Create(gzPath)
+	gzWriter := gzip.NewWriter(f)
+	gzWriter.Write(manifest.Bytes())
+	gzWriter.Close()
+	f.Close()
+
+	out, mc := runSince(t, gzPath, paths, time.Time{})
+	if !strings.Contains(out, "AAAAAA== 9 "+paths[0]+"\n") {
+		t.Errorf("unchanged file not carried forward: %q", out)
+	}
+	if strings.Contains(out, "AAAAAA== 8") || strings.Contains(out, "AAAAAA== 7") {
+		t.Errorf("changed files carried forward: %q", out)
+	}
+	if mc.carriedForwardCount.Load() != 1 || mc.fileCount.Load() != 2 {
+		t.Errorf("counters error, got %d carried forward %d computed", mc.carriedForwardCount.Load(), mc.fileCount.Load())
+	}
+}
+
+func TestSinceIndexedManifest(t *testing.T) {
+	dir, paths := sinceFixture(t)
+	indexPath := filepath.Join(dir, "old.idx")
+	iw := newIndexWriter(indexPath)
+	for i, path := range paths {
+		iw.Add(manifestRecord{Path: path, CRC: "AAAAAA==", Size: uint64(len(filepath.Base(path)))})
+		iw.Add(manifestRecord{Path: fmt.Sprintf("%s/other%d", dir, i), CRC: "AAAAAA==", Size: 1})
+	}
+	if err := iw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, mc := runSince(t, indexPath, paths, time.Now().Add(-time.Hour))
+	if !strings.Contains(out, "AAAAAA== 9 "+paths[0]+"\n") || mc.carriedForwardCount.Load() != 1 {
+		t.Errorf("unchanged file not carried forward: %q", out)
+	}
+}
+
+// BenchmarkSinceMemory reports the heap used per loaded record beyond the path bytes
+func BenchmarkSinceMemory(b *testing.B) {
+	const count = 200000
+	path := filepath.Join(b.TempDir(), "old.txt")
+	manifest := &bytes.Buffer{}
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(manifest, "AAAAAA== %d /data/%074d\n", i, i) // 80 bytes paths
+	}
+	os.WriteFile(path, manifest.Bytes(), 0644)
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		sm, err := loadSinceManifest(path, time.Now(), false, io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/count-80, "overhead-B/record")
+		runtime.KeepAlive(sm)
+	}
+}
+
+// Test the manifests written with their header hold the start time of their run, for -since not to trust
+// the records of the files changed during it
+func TestSinceStartedHeader(t *testing.T) {
+	for _, format := range []string{"text", "jsonl"} {
+		out := &bytes.Buffer{}
+		mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+			mc.StdOut = out
+			if format == "text" {
+				mc.EnableBuildHeader()
+			} else {
+				mc.EnableJSONLOutput()
+				mc.EnableSchemaHeader()
+			}
+		})
+		manifest := filepath.Join(t.TempDir(), "manifest")
+		if err := os.WriteFile(manifest, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		debugOut := &bytes.Buffer{}
+		sm, err := loadSinceManifest(manifest, time.Time{}, true, debugOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sm.runTime.Equal(mc.startTime.Truncate(time.Second)) || debugOut.Len() > 0 {
+			t.Errorf("%s: got start %s %q, expected %s", format, sm.runTime, debugOut.String(), mc.startTime)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import "fmt"
+
+// sizeFilter is the range of the sizes of the files computed, -minsize and -maxsize included, the files out
+// of it are counted as size filtered
+type sizeFilter struct {
+	min       uint64
+	max       uint64 // no maximum when hasMax is false
+	hasMax    bool
+	keepEmpty bool // the empty files are computed whatever the range
+}
+
+// parseSizeBound is parseByteSize accepting 0, for -maxsize 0 to keep the empty files only
+func parseSizeBound(s string) (uint64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	return parseByteSize(s)
+}
+
+func (sf *sizeFilter) allows(size int64) bool {
+	if size == 0 && sf.keepEmpty {
+		return true
+	}
+	return uint64(size) >= sf.min && (!sf.hasMax || uint64(size) <= sf.max)
+}
+
+func (sf *sizeFilter) String() string {
+	if !sf.hasMax {
+		return fmt.Sprintf("-minsize %d", sf.min)
+	}
+	return fmt.Sprintf("-minsize %d -maxsize %d", sf.min, sf.max)
+}
+
+// SetSizeFilter only computes the files whose size is between minSize and maxSize, with the unit suffixes
+// of parseByteSize, an empty bound is no bound. The empty files are computed with keepEmpty whatever the
+// range, -minsize 1 leaves them out. The walked files are filtered with the size the walk listed, the listed
+// paths are stated by the workers. Must be called before Startup.
+func (mc *MassCRC32C) SetSizeFilter(minSize string, maxSize string, keepEmpty bool) error {
+	if minSize == "" && maxSize == "" {
+		if keepEmpty {
+			return fmt.Errorf("-keep-empty needs -minsize or -maxsize")
+		}
+		return nil
+	}
+	sf := &sizeFilter{keepEmpty: keepEmpty}
+	var err error
+	if minSize != "" {
+		if sf.min, err = parseSizeBound(minSize); err != nil {
+			return fmt.Errorf("-minsize: %w", err)
+		}
+	}
+	if maxSize != "" {
+		if sf.max, err = parseSizeBound(maxSize); err != nil {
+			return fmt.Errorf("-maxsize: %w", err)
+		}
+		sf.hasMax = true
+		if sf.max < sf.min {
+			return fmt.Errorf("-maxsize %s is below -minsize %s", maxSize, minSize)
+		}
+	}
+	mc.sizes = sf
+	return nil
+}
+
+// sizeFiltered tells whether the file path of size is out of the -minsize and -maxsize range, counting it
+func (mc *MassCRC32C) sizeFiltered(path string, size int64) bool {
+	if mc.sizes == nil || mc.sizes.allows(size) {
+		return false
+	}
+	fmt.Fprintf(mc.DebugOut, "ignoring, size %d out of %s: %s\n", size, mc.sizes, path)
+	mc.sizeFilteredCount.Add(1)
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSizeFilter(t *testing.T) {
+	root := t.TempDir()
+	var list string
+	for name, size := range map[string]int{"empty": 0, "small": 100, "middle": 2048, "big": 8192} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		list += path + "\n"
+	}
+	run := func(minSize string, maxSize string, keepEmpty bool, list string) ([]string, Stats) {
+		out := &bytes.Buffer{}
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.stdin = strings.NewReader(list)
+			if err := mc.SetSizeFilter(minSize, maxSize, keepEmpty); err != nil {
+				t.Fatal(err)
+			}
+			// the list paths filtered by the workers must not hold back the records after them
+			mc.EnableOrderedOutput(defaultOrderedWindow)
+		}
+		mc := runPipeline(t, 4, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc}
+			if list == "" {
+				fi.walkRoots([]string{root})
+			} else {
+				fi.ReadFileList()
+			}
+		})
+		var names []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			if line != "" {
+				names = append(names, filepath.Base(line[strings.LastIndexByte(line, ' ')+1:]))
+			}
+		}
+		sort.Strings(names)
+		return names, mc.Stats()
+	}
+	tests := []struct {
+		minSize   string
+		maxSize   string
+		keepEmpty bool
+		expected  string
+	}{
+		{"1K", "4K", false, "middle"},
+		{"1K", "4K", true, "empty middle"},
+		{"1k", "", false, "big middle"},
+		{"1", "", false, "big middle small"},
+		{"", "0", false, "empty"},
+		{"", "2K", false, "empty middle small"},
+	}
+	for _, test := range tests {
+		for _, input := range []string{"", list} {
+			names, stats := run(test.minSize, test.maxSize, test.keepEmpty, input)
+			if got := strings.Join(names, " "); got != test.expected || stats.SizeFiltered != uint64(4-len(names)) || stats.Ignored != 0 {
+				t.Errorf("-minsize %q -maxsize %q -keep-empty=%t listed=%t: got %q, %d filtered, %d ignored, expected %q",
+					test.minSize, test.maxSize, test.keepEmpty, input != "", got, stats.SizeFiltered, stats.Ignored, test.expected)
+			}
+		}
+	}
+
+	mc := InitMassCRC32C(1, 1)
+	for _, bad := range [][2]string{{"-1", ""}, {"", "1X"}, {"2G", "1G"}} {
+		if err := mc.SetSizeFilter(bad[0], bad[1], false); err == nil {
+			t.Errorf("-minsize %q -maxsize %q: expected an error", bad[0], bad[1])
+		}
+	}
+	if err := mc.SetSizeFilter("", "", true); err == nil {
+		t.Error("-keep-empty alone: expected an error")
+	}
+}
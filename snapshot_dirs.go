@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// NetApp, ZFS and SMB expose read-only snapshots of the tree inside the tree itself
+var defaultSnapshotDirNames = []string{".snapshot", ".zfs/snapshot", "~snapshot"}
+
+// snapshotDirs recognizes snapshot directories by exact match of their trailing path components,
+// a directory merely containing a name like "my.snapshot" never matches
+type snapshotDirs struct {
+	skip   bool
+	names  [][]string
+	warned map[string]bool // walker only
+	pruned atomic.Uint64
+}
+
+func newSnapshotDirs(extraNames []string) *snapshotDirs {
+	sd := &snapshotDirs{warned: make(map[string]bool)}
+	for _, name := range append(defaultSnapshotDirNames, extraNames...) {
+		name = strings.Trim(filepath.ToSlash(name), "/")
+		if name != "" {
+			sd.names = append(sd.names, strings.Split(name, "/"))
+		}
+	}
+	return sd
+}
+
+// match returns the snapshot name path ends with, "" otherwise
+func (sd *snapshotDirs) match(path string) string {
+	path = filepath.Clean(path)
+	for _, components := range sd.names {
+		p := path
+		matched := true
+		for i := len(components) - 1; i >= 0; i-- {
+			if filepath.Base(p) != components[i] {
+				matched = false
+				break
+			}
+			p = filepath.Dir(p)
+		}
+		if matched {
+			return strings.Join(components, "/")
+		}
+	}
+	return ""
+}
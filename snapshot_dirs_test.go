@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotDirsMatch(t *testing.T) {
+	sd := newSnapshotDirs([]string{"backup/snap"})
+	for path, want := range map[string]string{
+		"data/.snapshot":         ".snapshot",
+		"data/.snapshot/":        ".snapshot",
+		"data/.zfs/snapshot":     ".zfs/snapshot",
+		"data/snapshot":          "",
+		"data/.zfs":              "",
+		"data/~snapshot":         "~snapshot",
+		"data/my.snapshot":       "",
+		"data/backup/snap":       "backup/snap",
+		"data/other/snap":        "",
+		filepath.Join("a", "b"):  "",
+		".snapshot":              ".snapshot",
+		"data/.snapshot/daily.0": "",
+	} {
+		if got := sd.match(filepath.FromSlash(path)); got != want {
+			t.Errorf("match(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestSkipSnapshotDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{
+		"a",
+		".snapshot/daily.0/a",
+		"sub/.zfs/snapshot/hourly/b",
+		"sub/.zfs/shares/c",
+		"sub/~snapshot/d",
+		"sub/my.snapshot/e",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(root string, skip bool) (*MassCRC32C, string, string) {
+		out, debugOut := &bytes.Buffer{}, &bytes.Buffer{}
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.DebugOut = debugOut
+			if skip {
+				mc.SkipSnapshotDirs(nil)
+			}
+		}
+		mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc, root: root}
+			if err := filepath.WalkDir(root, fi.walkHandler); err != nil {
+				t.Fatal(err)
+			}
+		})
+		return mc, out.String(), debugOut.String()
+	}
+
+	mc, out, debugOut := walk(dir, false)
+	if mc.fileCount.Load() != 6 {
+		t.Errorf("default mode must walk snapshot dirs, got %d files", mc.fileCount.Load())
+	}
+	if strings.Count(debugOut, "warning: walking") != 3 {
+		t.Errorf("expected one warning per snapshot dir name, got:\n%s", debugOut)
+	}
+
+	mc, out, debugOut = walk(dir, true)
+	if mc.fileCount.Load() != 3 || mc.snapshotDirs.pruned.Load() != 3 {
+		t.Errorf("expected 3 files and 3 pruned dirs, got %d and %d", mc.fileCount.Load(), mc.snapshotDirs.pruned.Load())
+	}
+	for _, kept := range []string{"/a\n", "/sub/.zfs/shares/c\n", "/sub/my.snapshot/e\n"} {
+		if !strings.Contains(filepath.ToSlash(out), kept) {
+			t.Errorf("missing %q in output:\n%s", kept, out)
+		}
+	}
+	if strings.Contains(debugOut, "warning: walking") {
+		t.Errorf("no warning expected when skipping, got:\n%s", debugOut)
+	}
+
+	// a snapshot dir given as root is walked as asked
+	mc, _, _ = walk(filepath.Join(dir, ".snapshot"), true)
+	if mc.fileCount.Load() != 1 || mc.snapshotDirs.pruned.Load() != 0 {
+		t.Errorf("root snapshot dir must be walked, got %d files, %d pruned", mc.fileCount.Load(), mc.snapshotDirs.pruned.Load())
+	}
+}
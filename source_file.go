@@ -0,0 +1,12 @@
+//go:build !chaos
+
+package main
+
+import "os"
+
+// sourceFile is the file pathToCRC reads, an os.File unless built with the chaos tag
+type sourceFile = os.File
+
+func openSource(path string) (*sourceFile, error) {
+	return os.OpenFile(path, os.O_RDONLY|openFlags, 0)
+}
@@ -0,0 +1,120 @@
+//go:build chaos
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// injector makes the file reads fail for the robustness tests and the soak runs of the chaos builds
+type injector struct {
+	failOpen      uint64 // the Nth open fails with openErr, none when 0
+	openErr       syscall.Errno
+	failReadEvery uint64 // every Nth read fails with readErr, none when 0
+	readErr       syscall.Errno
+	closeDelay    time.Duration
+
+	opens atomic.Uint64
+	reads atomic.Uint64
+}
+
+var chaos atomic.Pointer[injector]
+
+var chaosErrnos = map[string]syscall.Errno{
+	"EACCES":    syscall.EACCES,
+	"ENOENT":    syscall.ENOENT,
+	"EIO":       syscall.EIO,
+	"ESTALE":    syscall.ESTALE,
+	"ETIMEDOUT": syscall.ETIMEDOUT,
+	"EMFILE":    syscall.EMFILE,
+}
+
+func init() {
+	buildFlags = append(buildFlags, registerChaosFlag)
+}
+
+func registerChaosFlag(fs *flag.FlagSet) {
+	fs.Func("chaos", "inject failures in the file reads, comma separated open=N:ERRNO failing the Nth open, read=N:ERRNO failing every Nth read, closedelay=DURATION", func(spec string) error {
+		inj, err := parseChaosSpec(spec)
+		if err != nil {
+			return err
+		}
+		chaos.Store(inj)
+		return nil
+	})
+}
+
+func parseChaosErrno(n string, name string) (uint64, syscall.Errno, error) {
+	count, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || count == 0 {
+		return 0, 0, fmt.Errorf("bad count %q", n)
+	}
+	errno, ok := chaosErrnos[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown errno %q", name)
+	}
+	return count, errno, nil
+}
+
+func parseChaosSpec(spec string) (*injector, error) {
+	inj := &injector{}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		n, name, _ := strings.Cut(value, ":")
+		var err error
+		switch key {
+		case "open":
+			inj.failOpen, inj.openErr, err = parseChaosErrno(n, name)
+		case "read":
+			inj.failReadEvery, inj.readErr, err = parseChaosErrno(n, name)
+		case "closedelay":
+			inj.closeDelay, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown failure %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", part, err)
+		}
+	}
+	return inj, nil
+}
+
+// sourceFile is the file pathToCRC reads, failing as told by the injector set when opened
+type sourceFile struct {
+	*os.File
+	inj *injector
+}
+
+func openSource(path string) (*sourceFile, error) {
+	inj := chaos.Load()
+	if inj != nil && inj.failOpen > 0 && inj.opens.Add(1) == inj.failOpen {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: inj.openErr}
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|openFlags, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceFile{File: f, inj: inj}, nil
+}
+
+func (f *sourceFile) Read(p []byte) (int, error) {
+	if f.inj != nil && f.inj.failReadEvery > 0 && f.inj.reads.Add(1)%f.inj.failReadEvery == 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.Name(), Err: f.inj.readErr}
+	}
+	return f.File.Read(p)
+}
+
+func (f *sourceFile) Close() error {
+	if f.inj != nil && f.inj.closeDelay > 0 {
+		time.Sleep(f.inj.closeDelay)
+	}
+	return f.File.Close()
+}
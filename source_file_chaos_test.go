@@ -0,0 +1,125 @@
+//go:build chaos
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runChaos checksums test_data.txt count times with the failures of spec, 1KB reads
+func runChaos(t *testing.T, spec string, count int) (*MassCRC32C, string, string) {
+	inj, err := parseChaosSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chaos.Store(inj)
+	defer chaos.Store(nil)
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = "test_data.txt"
+	}
+	mc := runPaths(t, 1, paths, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+	})
+	return mc, out.String(), errOut.String()
+}
+
+func TestParseChaosSpec(t *testing.T) {
+	inj, err := parseChaosSpec("open=3:EACCES, read=1000:EIO,closedelay=2s")
+	if err != nil || inj.failOpen != 3 || inj.failReadEvery != 1000 || inj.closeDelay != 2*time.Second {
+		t.Errorf("got %+v %v", inj, err)
+	}
+	for _, spec := range []string{"open=0:EACCES", "read=10:EWHAT", "closedelay=soon", "unlink=1:EIO"} {
+		if _, err := parseChaosSpec(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+// Test the injected errors are counted and classified like real ones
+func TestChaosErrorClasses(t *testing.T) {
+	tests := []struct {
+		spec    string
+		records int
+		errors  uint64
+		class   errClass
+	}{
+		{"open=2:EACCES", 2, 1, classPermission},
+		{"open=1:ESTALE", 2, 1, classStale},
+		{"read=6:EIO", 2, 1, classIO}, // 4 reads and EOF per file, the counter is shared so the first read of the second file fails
+		{"read=6:ETIMEDOUT", 2, 1, classTimeout},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			mc, out, errOut := runChaos(t, test.spec, 3)
+			if records := strings.Count(out, "\n"); records != test.records || mc.Stats().FileErrors != test.errors {
+				t.Errorf("got %d records %d errors, expected %d and %d: %s", records, mc.Stats().FileErrors, test.records, test.errors, errOut)
+			}
+			if got := mc.errReporter.classCounts[test.class].Load(); got != test.errors {
+				t.Errorf("got %d %s errors, expected %d: %s", got, test.class, test.errors, errOut)
+			}
+		})
+	}
+}
+
+// Test a CTRL+C while files are being closed slowly lets the files in flight finish
+func TestChaosInterruptSlowClose(t *testing.T) {
+	chaos.Store(&injector{closeDelay: 50 * time.Millisecond})
+	defer chaos.Store(nil)
+	out := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.StdOut = out
+	mc.DebugOut = io.Discard
+	mc.Startup(2)
+	for i := 0; i < 3; i++ {
+		if err := mc.Enqueue("test_data.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mc.Interrupted.Store(true)
+	if err := mc.Enqueue("test_data.txt"); err != ErrInterrupted {
+		t.Errorf("got %v, expected ErrInterrupted", err)
+	}
+	start := time.Now()
+	mc.TearDown()
+	stats := mc.Stats()
+	if stats.Files != 3 || stats.FileErrors != 0 || strings.Count(out.String(), "\n") != 3 {
+		t.Errorf("got %d files, %d errors, %q, expected the 3 files in flight", stats.Files, stats.FileErrors, out.String())
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("TearDown returned before the slow closes")
+	}
+}
+
+// Test the injected EIO are stepped over with -skip-bad-blocks, the record flagged and the file counted
+func TestChaosSkipBadBlocks(t *testing.T) {
+	chaos.Store(&injector{failReadEvery: 2, readErr: syscall.EIO})
+	defer chaos.Store(nil)
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{"test_data.txt"}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.ErrOut = errOut
+		mc.EnableSkipBadBlocks(badBlockConfig{blockSize: 1024})
+	})
+	info, err := os.Stat("test_data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), fmt.Sprintf(" %d test_data.txt\tbadblocks=", info.Size())) {
+		t.Errorf("record not flagged: %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "partial checksum") || mc.badBlockFiles.Load() != 1 || mc.Stats().FileErrors != 0 {
+		t.Errorf("got %d files with bad blocks, %d errors: %s", mc.badBlockFiles.Load(), mc.Stats().FileErrors, errOut.String())
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+const defaultSQLiteBatch = 1000
+
+// sqliteSideSuffixes name the rollback journal and the WAL files SQLite writes next to the database
+var sqliteSideSuffixes = []string{"-journal", "-wal", "-shm"}
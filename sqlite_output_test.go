@@ -0,0 +1,104 @@
+//go:build !(windows && 386)
+
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runSQLite(t *testing.T, db string, runID string, paths []string, interrupt bool) {
+	setup := func(mc *MassCRC32C) {
+		if err := mc.EnableSQLiteOutput(db, runID, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runPipeline(t, 2, setup, func(mc *MassCRC32C) {
+		if err := mc.EnqueueBatch(paths); err != nil {
+			t.Fatal(err)
+		}
+		mc.Interrupted.Store(interrupt)
+	})
+}
+
+type sqliteRow struct {
+	crc   string
+	size  int64
+	mtime sql.NullInt64
+	runID string
+}
+
+func readSQLite(t *testing.T, db string) map[string]sqliteRow {
+	conn, err := sql.Open("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rows, err := conn.Query("SELECT path, crc32c, size, mtime, run_id FROM files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	result := make(map[string]sqliteRow)
+	for rows.Next() {
+		var path string
+		var row sqliteRow
+		if err = rows.Scan(&path, &row.crc, &row.size, &row.mtime, &row.runID); err != nil {
+			t.Fatal(err)
+		}
+		result[path] = row
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSQLiteOutput(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "out.db")
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// 3 rows with batches of 2, the last one is committed by TearDown
+	runSQLite(t, db, "run1", append(paths, filepath.Join(dir, "missing")), false)
+	rows := readSQLite(t, db)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %v", rows)
+	}
+	info, _ := os.Stat(paths[0])
+	if row := rows[paths[0]]; row.size != 1 || row.runID != "run1" || row.mtime.Int64 != info.ModTime().Unix() || row.crc == "" {
+		t.Errorf("unexpected row %+v", row)
+	}
+
+	// a re-run updates the known paths
+	if err := os.WriteFile(paths[0], []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runSQLite(t, db, "run2", paths[:1], true)
+	rows = readSQLite(t, db)
+	if len(rows) != 3 || rows[paths[0]].size != 7 || rows[paths[0]].runID != "run2" || rows[paths[1]].runID != "run1" {
+		t.Errorf("expected an upsert, got %v", rows)
+	}
+
+	var mode string
+	conn, _ := sql.Open("sqlite", db)
+	defer conn.Close()
+	if err := conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("expected WAL mode, got %q, %v", mode, err)
+	}
+}
+
+func TestSQLiteBadBatch(t *testing.T) {
+	if _, err := newSQLiteWriter(filepath.Join(t.TempDir(), "out.db"), "run", 0); err == nil {
+		t.Error("a 0 batch size must be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+//go:build !(windows && 386)
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite" // pure Go, no cgo
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS files (
+	path TEXT PRIMARY KEY,
+	crc32c TEXT,
+	size INTEGER,
+	mtime INTEGER,
+	run_id TEXT
+)`
+
+// re-runs update the rows of the paths already known
+const sqliteUpsert = `INSERT INTO files (path, crc32c, size, mtime, run_id) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (path) DO UPDATE SET
+		crc32c = excluded.crc32c, size = excluded.size, mtime = excluded.mtime, run_id = excluded.run_id`
+
+// sqliteWriter mirrors the results in a SQLite database, used by the writer goroutine only.
+// Rows are inserted in transactions of batchSize, Close commits the last one.
+type sqliteWriter struct {
+	db        *sql.DB
+	runID     string
+	batchSize int
+	tx        *sql.Tx
+	stmt      *sql.Stmt
+	rows      int
+}
+
+func newSQLiteWriter(path string, runID string, batchSize int) (*sqliteWriter, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("bad sqlite batch size %d", batchSize)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1) // a single connection keeps the pragmas
+	for _, query := range []string{"PRAGMA journal_mode=WAL", "PRAGMA synchronous=NORMAL", sqliteSchema} {
+		if _, err = db.Exec(query); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &sqliteWriter{db: db, runID: runID, batchSize: batchSize}, nil
+}
+
+// Add inserts a record, mtime is the unix time of the file, 0 when unknown
+func (sw *sqliteWriter) Add(rec manifestRecord, mtime int64) error {
+	if sw.tx == nil {
+		tx, err := sw.db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(sqliteUpsert)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		sw.tx, sw.stmt = tx, stmt
+	}
+	var mtimeValue sql.NullInt64
+	if mtime != 0 {
+		mtimeValue = sql.NullInt64{Int64: mtime, Valid: true}
+	}
+	if _, err := sw.stmt.Exec(rec.Path, rec.CRC, int64(rec.Size), mtimeValue, sw.runID); err != nil {
+		return err
+	}
+	sw.rows++
+	if sw.rows >= sw.batchSize {
+		return sw.commit()
+	}
+	return nil
+}
+
+func (sw *sqliteWriter) commit() error {
+	if sw.tx == nil {
+		return nil
+	}
+	sw.stmt.Close()
+	err := sw.tx.Commit()
+	sw.tx, sw.stmt, sw.rows = nil, nil, 0
+	return err
+}
+
+func (sw *sqliteWriter) Close() error {
+	err := sw.commit()
+	if cerr := sw.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build windows && 386
+
+package main
+
+import "errors"
+
+// sqliteWriter stands in for the SQLite sink where modernc.org/sqlite does not build
+type sqliteWriter struct{}
+
+func newSQLiteWriter(path string, runID string, batchSize int) (*sqliteWriter, error) {
+	return nil, errors.New("-sqlite not supported on this platform")
+}
+
+func (sw *sqliteWriter) Add(rec manifestRecord, mtime int64) error {
+	return nil
+}
+
+func (sw *sqliteWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The stat fields of -stat-fields follow the path of a text record after a tab, like the list hints:
+//
+//	record = [ordinal TAB] crc " " size " " path [TAB field *(" " field)]
+//	field  = key "=" value
+//
+// The keys are nlink, the link count, and inode, the index of the file identity on its volume,
+// both 0 where the platform does not report them, and btime, the birth time in RFC3339 UTC with the
+// fraction of a second, empty where the platform or the filesystem does not record it. The badblocks
+// field of -skip-bad-blocks follows them, then the head and tail fields of -edge-digest.
+
+// fileStat is the identity, link count and birth time of a file, zero when unknown
+type fileStat struct {
+	id    fileIdentity
+	nlink uint64
+	btime time.Time // only read with -stat-fields btime
+}
+
+// statFields are the stat fields written in the records
+type statFields struct {
+	nlink bool
+	inode bool
+	btime bool
+}
+
+func parseStatFields(spec string) (statFields, error) {
+	var sf statFields
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "nlink":
+			sf.nlink = true
+		case "inode":
+			sf.inode = true
+		case "btime":
+			sf.btime = true
+		default:
+			return statFields{}, fmt.Errorf("unknown stat field %q, expected nlink, inode or btime", name)
+		}
+	}
+	return sf, nil
+}
+
+func (sf statFields) enabled() bool {
+	return sf.nlink || sf.inode || sf.btime
+}
+
+// formatBirthTime is the btime field value, empty when unknown
+func formatBirthTime(btime time.Time) string {
+	if btime.IsZero() {
+		return ""
+	}
+	return btime.UTC().Format(time.RFC3339Nano)
+}
+
+func (sf statFields) format(res Result) string {
+	var fields []string
+	if sf.nlink {
+		fields = append(fields, "nlink="+strconv.FormatUint(res.Nlink, 10))
+	}
+	if sf.inode {
+		fields = append(fields, "inode="+strconv.FormatUint(res.Inode, 10))
+	}
+	if sf.btime {
+		fields = append(fields, "btime="+formatBirthTime(res.Btime))
+	}
+	return strings.Join(fields, " ")
+}
+
+// recordWriter writes the text records followed by the stat fields, the bad ranges of a partial record
+// and the edge digests
+func (sf statFields) recordWriter() recordWriter {
+	return func(w io.Writer, res Result) {
+		fields := sf.format(res)
+		if res.BadBlocks != nil {
+			if fields != "" {
+				fields += " "
+			}
+			fields += "badblocks=" + formatBadRanges(res.BadBlocks)
+		}
+		if res.Head != "" {
+			if fields != "" {
+				fields += " "
+			}
+			fields += "head=" + res.Head + " tail=" + res.Tail
+		}
+		if fields == "" {
+			writeTextRecord(w, res)
+		} else if res.Ordinal != "" {
+			fmt.Fprintf(w, "%s\t%s %d %s\t%s\n", res.Ordinal, res.CRC, res.Size, res.Path, fields)
+		} else {
+			fmt.Fprintf(w, "%s %d %s\t%s\n", res.CRC, res.Size, res.Path, fields)
+		}
+	}
+}
+
+// cutRecordFields drops the stat fields, the bad ranges and the edges following the path of a record, reporting
+// whether the record is partial, a path whose last tab is not followed by such fields only is left untouched
+func cutRecordFields(path string) (string, bool) {
+	i := strings.LastIndexByte(path, '\t')
+	if i < 0 {
+		return path, false
+	}
+	fields := strings.Fields(path[i+1:])
+	if len(fields) == 0 {
+		return path, false
+	}
+	partial := false
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "nlink", "inode":
+			if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+				return path, false
+			}
+		case "btime":
+			if _, err := time.Parse(time.RFC3339Nano, value); value != "" && err != nil {
+				return path, false
+			}
+		case "badblocks":
+			if !validBadBlocks(value) {
+				return path, false
+			}
+			partial = true
+		case "head", "tail":
+			if _, err := decodeCRC(value); err != nil {
+				return path, false
+			}
+		default:
+			return path, false
+		}
+	}
+	return path[:i], partial
+}
+
+// inodeBytes accounts the computed bytes once per file identity, every hard link of a file is still read
+type inodeBytes struct {
+	mu     sync.Mutex
+	seen   map[fileIdentity]struct{}
+	unique atomic.Uint64
+	linked atomic.Uint64 // files whose inode was computed already
+}
+
+func newInodeBytes() *inodeBytes {
+	return &inodeBytes{seen: make(map[fileIdentity]struct{})}
+}
+
+// add accounts a computed file, a file without a known identity is unique
+func (ib *inodeBytes) add(st fileStat, size uint64) {
+	if st.id.known() {
+		ib.mu.Lock()
+		_, seen := ib.seen[st.id]
+		ib.seen[st.id] = struct{}{}
+		ib.mu.Unlock()
+		if seen {
+			ib.linked.Add(1)
+			return
+		}
+	}
+	ib.unique.Add(size)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatFields(t *testing.T) {
+	tests := []struct {
+		spec string
+		sf   statFields
+		ok   bool
+	}{
+		{"nlink", statFields{nlink: true}, true},
+		{"inode", statFields{inode: true}, true},
+		{"nlink, inode", statFields{nlink: true, inode: true}, true},
+		{"btime", statFields{btime: true}, true},
+		{"size", statFields{}, false},
+		{"nlink,", statFields{}, false},
+	}
+	for _, test := range tests {
+		sf, err := parseStatFields(test.spec)
+		if (err == nil) != test.ok || sf != test.sf {
+			t.Errorf("%q: got %+v %v, expected %+v ok %t", test.spec, sf, err, test.sf, test.ok)
+		}
+	}
+}
+
+func TestStatFieldsRecord(t *testing.T) {
+	sf := statFields{nlink: true, inode: true}
+	if got := sf.format(Result{Inode: 42, Nlink: 2}); got != "nlink=2 inode=42" {
+		t.Errorf("got %q", got)
+	}
+	sf.btime = true
+	btime := time.Date(2024, 2, 29, 12, 30, 0, 5000, time.FixedZone("CET", 3600))
+	if got := sf.format(Result{Nlink: 1, Btime: btime}); got != "nlink=1 inode=0 btime=2024-02-29T11:30:00.000005Z" {
+		t.Errorf("got %q", got)
+	}
+	if got := sf.format(Result{Nlink: 1}); got != "nlink=1 inode=0 btime=" {
+		t.Errorf("got %q", got)
+	}
+	tests := []struct {
+		line string
+		path string
+	}{
+		{"AAAAAA== 3 a b\tnlink=2 inode=42", "a b"},
+		{"1\tAAAAAA== 3 a\tnlink=1", "a"},
+		{"AAAAAA== 3 a\tb", "a\tb"},
+		{"AAAAAA== 3 a\tnlink=x", "a\tnlink=x"},
+		{"AAAAAA== 3 a\tsize=3", "a\tsize=3"},
+		{"AAAAAA== 3 a\t", "a\t"},
+		{"AAAAAA== 3 a\tnlink=1 btime=2024-02-29T11:30:00Z", "a"},
+		{"AAAAAA== 3 a\tbtime=", "a"},
+		{"AAAAAA== 3 a\tbtime=yesterday", "a\tbtime=yesterday"},
+	}
+	for _, test := range tests {
+		record, err := parseManifestLine(test.line)
+		if err != nil || record.Path != test.path || record.Size != 3 {
+			t.Errorf("%q: got %+v %v, expected path %q", test.line, record, err, test.path)
+		}
+	}
+	if _, err := parseManifestLine("AAAAAA== 3 \tinode=1"); err == nil {
+		t.Error("expected an empty path error")
+	}
+}
+
+func TestInodeBytes(t *testing.T) {
+	ib := newInodeBytes()
+	ib.add(fileStat{id: fileIdentity{volume: 1, index: 7}, nlink: 2}, 10)
+	ib.add(fileStat{id: fileIdentity{volume: 1, index: 7}, nlink: 2}, 10)
+	ib.add(fileStat{id: fileIdentity{volume: 2, index: 7}, nlink: 1}, 5)
+	ib.add(fileStat{}, 3)
+	ib.add(fileStat{}, 3)
+	if ib.unique.Load() != 21 || ib.linked.Load() != 1 {
+		t.Errorf("got %d unique bytes and %d linked files, expected 21 and 1", ib.unique.Load(), ib.linked.Load())
+	}
+}
+
+func TestStatFieldsHardLinks(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a")
+	if err := os.WriteFile(a, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "c"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(a, filepath.Join(root, "b")); err != nil {
+		t.Skipf("no hard links here: %v", err)
+	}
+	out := &bytes.Buffer{}
+	debugOut := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.DebugOut = debugOut
+		mc.EnableStatFields(statFields{nlink: true, inode: true})
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.walkRoots([]string{root})
+	})
+	mc.PrintSummary()
+
+	links := 0
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		record, err := parseManifestLine(line)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		_, fields, _ := strings.Cut(line, "\t")
+		if strings.HasPrefix(fields, "nlink=2 inode=") {
+			links++
+		} else if !strings.HasPrefix(fields, "nlink=1 inode=") || filepath.Base(record.Path) != "c" {
+			t.Errorf("unexpected stat fields in %q", line)
+		}
+	}
+	if links != 2 {
+		t.Errorf("got %d records of the hard links, expected 2: %q", links, out.String())
+	}
+	if mc.Stats().BytesComputed != 13 {
+		t.Errorf("got %d bytes computed, expected 13", mc.Stats().BytesComputed)
+	}
+	if want := "Computed data unique by inode: 8B, 1 files linked to a computed inode\n"; !strings.Contains(debugOut.String(), want) {
+		t.Errorf("%q missing from the summary %q", want, debugOut.String())
+	}
+}
+
+// Test the btime field is the birth time of the file where the platform and the filesystem record it,
+// and empty otherwise, always on macOS
+func TestStatFieldsBirthTime(t *testing.T) {
+	before := time.Now().Add(-time.Second) // the filesystem clock may lag a bit behind
+	path := filepath.Join(t.TempDir(), "born")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(time.Second)
+	out := &bytes.Buffer{}
+	mc := runPaths(t, 1, []string{path}, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableJSONLOutput()
+		mc.EnableStatFields(statFields{btime: true})
+	})
+
+	var rec jsonRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil || rec.Btime == nil {
+		t.Fatalf("got %q %v", out.String(), err)
+	}
+	if *rec.Btime == "" {
+		if runtime.GOOS == "darwin" {
+			t.Error("expected a birth time on macOS")
+		}
+		t.Logf("no birth time here, probe %t", mc.birthTimes)
+		return
+	}
+	btime, err := time.Parse(time.RFC3339Nano, *rec.Btime)
+	if err != nil || !strings.HasSuffix(*rec.Btime, "Z") || btime.Before(before) || btime.After(after) {
+		t.Errorf("got btime %q %v, expected between %s and %s", *rec.Btime, err, before, after)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import "time"
+
+// Stats is a snapshot of the run counters for the summary and library users.
+// Each counter is loaded atomically but not all at once: a file finishing during
+// the snapshot may be missing from one counter and present in another.
+type Stats struct {
+	Files          uint64 // files computed
+	FileErrors     uint64 // files failing to be listed, read or with -strict-types an unexpected type
+	DirErrors      uint64 // directories failing to be listed
+	Ignored        uint64 // non-regular, hidden with -skip-hidden or not matching -include or -include-re files skipped
+	Excluded       uint64 // files and directories matching an -exclude pattern or -exclude-re expression
+	Rejected       uint64 // stdin list entries rejected as too long or holding a NUL or newline
+	SizeFiltered   uint64 // files out of the -minsize and -maxsize range
+	MtimeSkipped   uint64 // files out of the -newer-than and -older-than window
+	CarriedForward uint64 // files whose CRC comes from the -since manifest
+	BytesComputed  uint64 // size of the files computed
+	BytesRead      uint64 // bytes read by this process, the reads of failed files included
+	Started        time.Time
+	Taken          time.Time
+	FirstFile      time.Time // a worker took the first path, zero before
+	LastFile       time.Time // a worker finished the last path so far
+	Running        bool      // taken before TearDown, the active period then ends at Taken
+	Ended          time.Time // TearDown completed, zero before
+	Roots          uint64    // roots walked
+	Lists          uint64    // file lists read
+}
+
+// Stats snapshots the counters, safe to call concurrently with the run
+func (mc *MassCRC32C) Stats() Stats {
+	return Stats{
+		Files:          mc.fileCount.Load(),
+		FileErrors:     mc.fileErrorCount.Load(),
+		DirErrors:      mc.directoryErrorCount.Load(),
+		Ignored:        mc.ignoredFilesCount.Load(),
+		Excluded:       mc.excludedCount.Load(),
+		Rejected:       mc.rejectedCount.Load(),
+		SizeFiltered:   mc.sizeFilteredCount.Load(),
+		MtimeSkipped:   mc.mtimeSkippedCount.Load(),
+		CarriedForward: mc.carriedForwardCount.Load(),
+		BytesComputed:  mc.totalDataComputed.Load(),
+		BytesRead:      mc.bytesRead.Load(),
+		Started:        mc.startTime,
+		Taken:          time.Now(),
+		FirstFile:      unixNanoTime(mc.firstFileTime.Load()),
+		LastFile:       unixNanoTime(mc.lastFileTime.Load()),
+		Running:        !mc.tornDown.Load(),
+		Ended:          unixNanoTime(mc.endTime.Load()),
+		Roots:          mc.rootsWalked.Load(),
+		Lists:          mc.listsRead.Load(),
+	}
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// markFileTimes records when the workers take their first path and finish their last one
+func (mc *MassCRC32C) markFileTimes(start time.Time, end time.Time) {
+	mc.firstFileTime.CompareAndSwap(0, start.UnixNano())
+	for {
+		last := mc.lastFileTime.Load()
+		if end.UnixNano() <= last || mc.lastFileTime.CompareAndSwap(last, end.UnixNano()) {
+			return
+		}
+	}
+}
+
+// Elapsed is the duration of the run when the snapshot was taken
+func (s Stats) Elapsed() time.Duration {
+	return s.Taken.Sub(s.Started)
+}
+
+// Rate is the number of files computed per second
+func (s Stats) Rate() float64 {
+	return perSecond(float64(s.Files), s.Elapsed())
+}
+
+// ByteRate is the number of bytes computed per second
+func (s Stats) ByteRate() float64 {
+	return perSecond(float64(s.BytesComputed), s.Elapsed())
+}
+
+// ActiveElapsed is the duration the workers had files, from the first one taken to the last one finished,
+// or to the snapshot while running
+func (s Stats) ActiveElapsed() time.Duration {
+	if s.FirstFile.IsZero() {
+		return 0
+	}
+	if s.Running {
+		return s.Taken.Sub(s.FirstFile)
+	}
+	return s.LastFile.Sub(s.FirstFile)
+}
+
+// LeadIn is the duration before the first file was taken, e.g. loading a huge list or mounting the first root
+func (s Stats) LeadIn() time.Duration {
+	if s.FirstFile.IsZero() {
+		return s.Elapsed()
+	}
+	return s.FirstFile.Sub(s.Started)
+}
+
+// Tail is the duration after the last file finished, zero while running
+func (s Stats) Tail() time.Duration {
+	if s.Running || s.LastFile.IsZero() {
+		return 0
+	}
+	return s.Taken.Sub(s.LastFile)
+}
+
+// ActiveByteRate is the number of bytes computed per second of ActiveElapsed
+func (s Stats) ActiveByteRate() float64 {
+	return perSecond(float64(s.BytesComputed), s.ActiveElapsed())
+}
+
+func perSecond(n float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return n / elapsed.Seconds()
+}
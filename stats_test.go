@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// Test snapshots taken while the counters move, meant to be run with -race
+func TestStatsConcurrent(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	mc.startTime = time.Now()
+	counters := []func(){
+		func() { mc.fileCount.Add(1) },
+		func() { mc.fileErrorCount.Add(1) },
+		func() { mc.directoryErrorCount.Add(1) },
+		func() { mc.ignoredFilesCount.Add(1) },
+		func() { mc.carriedForwardCount.Add(1) },
+		func() { mc.totalDataComputed.Add(10) },
+		func() { mc.bytesRead.Add(10) },
+	}
+	var wg sync.WaitGroup
+	for _, add := range counters {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(add func()) {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					add()
+				}
+			}(add)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var previous Stats
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		stats := mc.Stats()
+		if stats.Files < previous.Files || stats.BytesRead < previous.BytesRead || stats.Taken.Before(previous.Taken) {
+			t.Fatalf("snapshot went backwards: %+v after %+v", stats, previous)
+		}
+		previous = stats
+	}
+
+	stats := mc.Stats()
+	expected := Stats{4000, 4000, 4000, 4000, 0, 0, 0, 0, 4000, 40000, 40000, stats.Started, stats.Taken, time.Time{}, time.Time{}, true, time.Time{}, 0, 0}
+	if stats != expected {
+		t.Errorf("got %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestStatsRates(t *testing.T) {
+	start := time.Now()
+	stats := Stats{Files: 30, BytesComputed: 3000, Started: start, Taken: start.Add(3 * time.Second)}
+	if stats.Elapsed() != 3*time.Second || stats.Rate() != 10 || stats.ByteRate() != 1000 {
+		t.Errorf("got %s, %f files/s, %f B/s", stats.Elapsed(), stats.Rate(), stats.ByteRate())
+	}
+	if (Stats{Files: 1, Started: start, Taken: start}).Rate() != 0 {
+		t.Error("no rate expected without elapsed time")
+	}
+}
+
+func TestStatsBytesRead(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	if _, _, err := mc.CRCReader(strings.NewReader("12345")); err != nil {
+		t.Fatal(err)
+	}
+	failing := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errors.New("read failure")))
+	if _, size, err := mc.CRCReader(failing); err == nil || size != 3 {
+		t.Fatalf("expected the read failure after 3 bytes, got %d %v", size, err)
+	}
+	if stats := mc.Stats(); stats.BytesRead != 8 {
+		t.Errorf("failed reads must count in BytesRead, got %d", stats.BytesRead)
+	}
+}
+
+func TestStatsActivePeriod(t *testing.T) {
+	started := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+	stats := Stats{
+		BytesComputed: 100 << 20,
+		Started:       started,
+		FirstFile:     started.Add(60 * time.Second),
+		LastFile:      started.Add(70 * time.Second),
+		Taken:         started.Add(80 * time.Second),
+	}
+	if stats.ActiveElapsed() != 10*time.Second || stats.LeadIn() != time.Minute || stats.Tail() != 10*time.Second {
+		t.Errorf("got active %s lead-in %s tail %s", stats.ActiveElapsed(), stats.LeadIn(), stats.Tail())
+	}
+	if rate, wall := stats.ActiveByteRate(), stats.ByteRate(); rate != 10<<20 || wall != 100<<20/80 {
+		t.Errorf("got active rate %f wall rate %f", rate, wall)
+	}
+
+	// a mid-run snapshot ends the active period now
+	stats.Running = true
+	if stats.ActiveElapsed() != 20*time.Second || stats.Tail() != 0 {
+		t.Errorf("got active %s tail %s while running", stats.ActiveElapsed(), stats.Tail())
+	}
+
+	// no file yet, all lead-in
+	stats = Stats{Started: started, Taken: started.Add(time.Minute), Running: true}
+	if stats.ActiveElapsed() != 0 || stats.LeadIn() != time.Minute || stats.ActiveByteRate() != 0 {
+		t.Errorf("got active %s lead-in %s before the first file", stats.ActiveElapsed(), stats.LeadIn())
+	}
+}
+
+// Test the first and last file times of concurrent workers, meant to be run with -race
+func TestMarkFileTimes(t *testing.T) {
+	mc := InitMassCRC32C(1, 1)
+	base := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				start := base.Add(time.Duration(i*100+j) * time.Millisecond)
+				mc.markFileTimes(start, start.Add(time.Second))
+			}
+		}(i)
+	}
+	wg.Wait()
+	mc.TearDown()
+	stats := mc.Stats()
+	if stats.Running || !stats.LastFile.Equal(base.Add(time.Second+799*time.Millisecond)) {
+		t.Errorf("got running %t last file %s, expected %s", stats.Running, stats.LastFile, base.Add(time.Second+799*time.Millisecond))
+	}
+	if stats.FirstFile.IsZero() || stats.FirstFile.After(base.Add(700*time.Millisecond)) {
+		t.Errorf("got first file %s", stats.FirstFile)
+	}
+}
+
+func TestRunInfo(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setup := func(mc *MassCRC32C) {
+		mc.stdin = strings.NewReader(filepath.Join(root, "a") + "\n")
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, allowOverlap: true}
+		fi.Run([]string{root, root}, true)
+
+		running := &bytes.Buffer{}
+		printRunInfo(running, mc.Stats())
+		if !strings.Contains(running.String(), "Ended: still running\n") {
+			t.Errorf("a summary before TearDown must tell the run is still going: %q", running)
+		}
+	})
+	time.Sleep(10 * time.Millisecond)
+	stats := mc.Stats()
+	if stats.Ended.IsZero() || stats.Ended.Before(stats.Started) || !stats.Ended.Before(stats.Taken.Add(-5*time.Millisecond)) {
+		t.Errorf("the end must be captured by TearDown, not when printing: started %s ended %s taken %s", stats.Started, stats.Ended, stats.Taken)
+	}
+	out := &bytes.Buffer{}
+	printRunInfo(out, stats)
+	hostname, _ := os.Hostname()
+	for _, line := range []string{
+		"Started: " + stats.Started.UTC().Format(time.RFC3339) + "\n",
+		"Ended: " + stats.Ended.UTC().Format(time.RFC3339) + "\n",
+		"Host: " + hostname + " " + runtime.GOOS + "/" + runtime.GOARCH + "\n",
+		"Version: ",
+		"Input sources: 2 roots walked, 1 lists read\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("%q missing from %q", line, out)
+		}
+	}
+}
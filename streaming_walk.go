@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const streamingWalkBatch = 10000
+
+// streamingWalkDir returns a filepath.WalkDir reading the directories batch entries at a time.
+// A directory holding less than a batch is walked in lexical order as filepath.WalkDir does,
+// a larger one in the order of the file system, so the memory of a walk stays bounded by the batch
+// whatever the size of the directories. The callback semantics are the ones of filepath.WalkDir,
+// except that a directory failing after some batches is reported after their entries.
+func streamingWalkDir(batch int) func(root string, fn fs.WalkDirFunc) error {
+	return func(root string, fn fs.WalkDirFunc) error {
+		info, err := os.Lstat(root)
+		if err != nil {
+			err = fn(root, nil, err)
+		} else {
+			err = streamDir(root, fs.FileInfoToDirEntry(info), fn, batch)
+		}
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+}
+
+func streamDir(path string, d fs.DirEntry, fn fs.WalkDirFunc, batch int) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return skipDirErr(fn(path, d, err))
+	}
+	defer dir.Close()
+	for first := true; ; first = false {
+		entries, err := dir.ReadDir(batch)
+		if first && len(entries) < batch {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		}
+		for _, entry := range entries {
+			if err := streamDir(filepath.Join(path, entry.Name()), entry, fn, batch); err != nil {
+				if err == filepath.SkipDir {
+					return nil
+				}
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return skipDirErr(fn(path, d, err))
+		}
+	}
+}
+
+// skipDirErr is the error of a directory whose listing failed, SkipDir only skips the rest of it
+func skipDirErr(err error) error {
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
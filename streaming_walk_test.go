@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func walkTreeFixture(t testing.TB) string {
+	root := t.TempDir()
+	for _, path := range []string{"a/1", "a/2", "a/3", "a/4", "a/5", "b/c/6", "b/7", "d", "e/8"} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// walkedPaths walks root, skipping the directories named skipDir and the rest of the ones holding a file named skipRest
+func walkedPaths(walkDir func(string, fs.WalkDirFunc) error, root string, skipDir string, skipRest string) ([]string, error) {
+	var paths []string
+	err := walkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		switch d.Name() {
+		case skipDir, skipRest:
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func TestStreamingWalkDir(t *testing.T) {
+	root := walkTreeFixture(t)
+	tests := []struct {
+		name     string
+		skipDir  string
+		skipRest string
+	}{
+		{"all", "", ""},
+		{"skip dir", "a", ""},
+		{"skip rest of dir", "", "7"},
+	}
+	for _, test := range tests {
+		expected, err := walkedPaths(filepath.WalkDir, root, test.skipDir, test.skipRest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a batch holding every directory walks in the same order
+		got, err := walkedPaths(streamingWalkDir(100), root, test.skipDir, test.skipRest)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: got %v %v, expected %v", test.name, got, err, expected)
+		}
+		if test.skipRest != "" {
+			continue // the rest of a dir read by batches depends on the order of the file system
+		}
+		got, err = walkedPaths(streamingWalkDir(2), root, test.skipDir, test.skipRest)
+		sort.Strings(got)
+		sort.Strings(expected)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s by batches of 2: got %v %v, expected %v", test.name, got, err, expected)
+		}
+	}
+}
+
+func TestStreamingWalkDirErrors(t *testing.T) {
+	root := walkTreeFixture(t)
+	missing := filepath.Join(root, "missing")
+	calls := 0
+	err := streamingWalkDir(2)(missing, func(path string, d fs.DirEntry, err error) error {
+		calls++
+		if path != missing || d != nil || !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %s %v %v, expected the missing root error", path, d, err)
+		}
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+	stop := errors.New("stop")
+	visited := 0
+	err = streamingWalkDir(2)(root, func(path string, d fs.DirEntry, err error) error {
+		visited++
+		if visited == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 3 {
+		t.Errorf("got %v after %d entries, expected the callback error after 3", err, visited)
+	}
+}
+
+// Test the walk of a flat directory, the streaming walk reports a lower peak heap
+func BenchmarkWalkFlatDir(b *testing.B) {
+	root := b.TempDir()
+	for i := 0; i < 100000; i++ {
+		f, err := os.Create(filepath.Join(root, fmt.Sprintf("file%08d", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+	walkers := []struct {
+		name    string
+		walkDir func(string, fs.WalkDirFunc) error
+	}{
+		{"WalkDir", filepath.WalkDir},
+		{"streaming", streamingWalkDir(streamingWalkBatch)},
+	}
+	for _, walker := range walkers {
+		b.Run(walker.name, func(b *testing.B) {
+			var peak uint64
+			var stats runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				n := 0
+				walker.walkDir(root, func(path string, d fs.DirEntry, err error) error {
+					if n++; n%1000 == 0 {
+						runtime.ReadMemStats(&stats)
+						if stats.HeapInuse > peak {
+							peak = stats.HeapInuse
+						}
+					}
+					return err
+				})
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+		})
+	}
+}
+
+func TestStreamingWalkCounters(t *testing.T) {
+	root := walkTreeFixture(t)
+	if err := os.Symlink("d", filepath.Join(root, "link")); err != nil {
+		t.Skipf("no symlinks here: %v", err)
+	}
+	out := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.SkipSnapshotDirs([]string{"c"})
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc, walkDir: streamingWalkDir(2)}
+		fi.walkRoots([]string{root})
+	})
+	stats := mc.Stats()
+	if stats.Files != 8 || stats.Ignored != 1 || mc.snapshotDirs.pruned.Load() != 1 || strings.Count(out.String(), "\n") != 8 {
+		t.Errorf("got %+v and %d pruned dirs, expected 8 files, 1 ignored and 1 pruned: %q", stats, mc.snapshotDirs.pruned.Load(), out.String())
+	}
+}
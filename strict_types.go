@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sync/atomic"
+)
+
+var strictTypeNames = []string{"symlink", "socket", "fifo", "device", "chardevice", "irregular"}
+
+func fileTypeName(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeCharDevice != 0:
+		return "chardevice"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	default:
+		return "irregular"
+	}
+}
+
+// strictTypes turns the non-regular files found by the walker into errors, counted by type
+type strictTypes struct {
+	enabled  bool
+	symlinks bool
+	counts   [6]atomic.Uint64 // indexed like strictTypeNames
+}
+
+// check counts and reports whether a non-regular file is a strict failure
+func (st *strictTypes) check(mode fs.FileMode) bool {
+	if !st.enabled || (mode&fs.ModeSymlink != 0 && !st.symlinks) {
+		return false
+	}
+	name := fileTypeName(mode)
+	for i, typeName := range strictTypeNames {
+		if typeName == name {
+			st.counts[i].Add(1)
+		}
+	}
+	return true
+}
+
+func (st *strictTypes) failures() uint64 {
+	total := uint64(0)
+	for i := range st.counts {
+		total += st.counts[i].Load()
+	}
+	return total
+}
+
+func (st *strictTypes) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "Strict type failures: %d", st.failures())
+	for i, typeName := range strictTypeNames {
+		if count := st.counts[i].Load(); count > 0 {
+			fmt.Fprintf(w, " %s=%d", typeName, count)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,76 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func strictTypesFixture(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "regular"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("regular", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Skipf("no fifo support: %v", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "socket"))
+	if err != nil {
+		t.Skipf("no unix socket support: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return dir
+}
+
+func walkStrict(t *testing.T, dir string, enabled bool, symlinks bool) (*MassCRC32C, string) {
+	errOut := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.ErrOut = errOut
+		if enabled {
+			mc.EnableStrictTypes(symlinks)
+		}
+	}
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		if err := filepath.WalkDir(dir, fi.walkHandler); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return mc, errOut.String()
+}
+
+func TestStrictTypes(t *testing.T) {
+	dir := strictTypesFixture(t)
+
+	mc, errOut := walkStrict(t, dir, false, false)
+	if mc.ignoredFilesCount.Load() != 3 || errOut != "" || mc.StrictTypeFailures() != 0 {
+		t.Errorf("default mode must ignore non-regular files, got %d ignored, errors %q", mc.ignoredFilesCount.Load(), errOut)
+	}
+
+	mc, errOut = walkStrict(t, dir, true, false)
+	if mc.ignoredFilesCount.Load() != 1 || mc.StrictTypeFailures() != 2 || mc.fileErrorCount.Load() != 2 {
+		t.Errorf("got %d ignored, %d strict failures", mc.ignoredFilesCount.Load(), mc.StrictTypeFailures())
+	}
+	if !strings.Contains(errOut, "class=TYPE") || !strings.Contains(errOut, "unexpected file type: fifo") {
+		t.Errorf("missing type in errors: %q", errOut)
+	}
+	summary := &bytes.Buffer{}
+	mc.strictTypes.printSummary(summary)
+	if summary.String() != "Strict type failures: 2 socket=1 fifo=1\n" {
+		t.Errorf("summary error, got %q", summary.String())
+	}
+
+	mc, _ = walkStrict(t, dir, true, true)
+	if mc.ignoredFilesCount.Load() != 0 || mc.StrictTypeFailures() != 3 {
+		t.Errorf("symlinks not strict, got %d strict failures", mc.StrictTypeFailures())
+	}
+}
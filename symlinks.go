@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errSymlinkLoop = errors.New("symlink loop, directory already walked")
+
+// followLink queues the regular file the symlink path points to, or walks the directory, with -L.
+// A dangling symlink is a file error.
+func (fi *FileInput) followLink(path string) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		fi.mc.printErr(errScopeFile, "walker", path, err)
+		fi.mc.fileErrorCount.Add(1)
+		return nil
+	}
+	info, err := os.Stat(longPath(target))
+	if err != nil {
+		fi.mc.printErr(errScopeFile, "walker", path, err)
+		fi.mc.fileErrorCount.Add(1)
+		return nil
+	}
+	switch {
+	case info.IsDir():
+		return fi.walkLinkedDir(path)
+	case !info.Mode().IsRegular():
+		fmt.Fprintf(fi.mc.DebugOut, "ignoring: %s\n", path)
+		fi.mc.ignoredFilesCount.Add(1)
+		return nil
+	}
+	return fi.enqueueFile(path, func() (fs.FileInfo, error) { return info, nil })
+}
+
+// walkLinkedDir walks the directory the symlink path points to, reporting the paths under path:
+// the trailing separator makes the walk follow the link
+func (fi *FileInput) walkLinkedDir(path string) error {
+	linked := path + string(filepath.Separator)
+	walkDir := fi.walkDir
+	if walkDir == nil {
+		walkDir = filepath.WalkDir
+	}
+	return walkDir(linked, func(p string, dir fs.DirEntry, err error) error {
+		return fi.walkHandler(filepath.Join(path, strings.TrimPrefix(p, linked)), dir, err)
+	})
+}
+
+// visitDir marks the directory path as walked by its device and inode, false when it already was: reached
+// again through a symlink, reported once to ErrOut without counting a directory error
+func (fi *FileInput) visitDir(path string, dir fs.DirEntry) bool {
+	info, err := dir.Info()
+	if err != nil {
+		return true
+	}
+	id := fileStatOf(longPath(path), info).id
+	if !id.known() {
+		return true
+	}
+	if fi.visited == nil {
+		fi.visited = make(map[fileIdentity]string)
+		fi.loops = make(map[fileIdentity]bool)
+	}
+	first, ok := fi.visited[id]
+	if !ok {
+		fi.visited[id] = path
+		return true
+	}
+	if !fi.loops[id] {
+		fi.loops[id] = true
+		fi.mc.printErr(errScopeDir, "walker", path, fmt.Errorf("%w as %s", errSymlinkLoop, first))
+	}
+	fmt.Fprintf(fi.mc.DebugOut, "not entering dir walked already: %s\n", path)
+	return false
+}
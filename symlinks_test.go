@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Test -L queues the linked files, walks the linked directories with the paths under the links, reports
+// a directory reached again once and counts the dangling symlinks as file errors
+func TestFollowLinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	for _, name := range []string{"root/real/f1", "outside/ext/f2", "outside/file"} {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"real/loop":  "..",
+		"real/loop2": filepath.Join("..", "..", "root"),
+		"ext":        filepath.Join(base, "outside", "ext"),
+		"flink":      filepath.Join("..", "outside", "file"),
+		"dangling":   "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skipf("no symlinks: %v", err)
+		}
+	}
+	run := func(follow bool) ([]string, string, Stats) {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		var res InputResult
+		setup := func(mc *MassCRC32C) {
+			mc.StdOut = out
+			mc.ErrOut = errOut
+		}
+		mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc, followLinks: follow}
+			res = fi.walkRoots([]string{root})
+		})
+		if res.Err != nil || res.Interrupted {
+			t.Fatalf("got %+v", res)
+		}
+		var paths []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			rel, _ := filepath.Rel(root, line[strings.LastIndexByte(line, ' ')+1:])
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		sort.Strings(paths)
+		return paths, errOut.String(), mc.Stats()
+	}
+
+	paths, errs, stats := run(false)
+	if strings.Join(paths, " ") != "real/f1" || errs != "" || stats.Ignored != 5 {
+		t.Errorf("got %q, %q, %d ignored without -L", paths, errs, stats.Ignored)
+	}
+
+	paths, errs, stats = run(true)
+	if got := strings.Join(paths, " "); got != "ext/f2 flink real/f1" {
+		t.Errorf("got %s with -L", got)
+	}
+	if strings.Count(errs, errSymlinkLoop.Error()) != 1 || !strings.Contains(errs, "as "+root) {
+		t.Errorf("got %q, expected the loop reported once", errs)
+	}
+	if !strings.Contains(errs, filepath.Join(root, "dangling")) || stats.FileErrors != 1 || stats.DirErrors != 0 {
+		t.Errorf("got %q, %d file and %d dir errors, expected the dangling symlink only", errs, stats.FileErrors, stats.DirErrors)
+	}
+}
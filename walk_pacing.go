@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	walkPauseErrors   = 3                      // consecutive directory errors before pausing the walk
+	walkPauseBase     = 500 * time.Millisecond // first pause, doubled by every further error
+	walkPauseMax      = 30 * time.Second
+	walkSleepInterval = 50 * time.Millisecond // interrupt check period of the waits
+)
+
+// walkPacer paces the directory listings of the walk for the metadata servers: at most rate listings
+// per second, and with pauseOnErrors exponentially longer pauses while the directory errors keep coming.
+// The walker goroutine only calls it, the counters are read by the summary.
+type walkPacer struct {
+	rate          float64 // listings per second, unlimited when 0
+	pauseOnErrors bool
+	out           io.Writer
+	now           func() time.Time
+	sleep         func(time.Duration)
+
+	next      time.Time // earliest start of the next listing
+	errors    int       // consecutive directory errors, reset by a listed file
+	pause     time.Duration
+	announced bool
+
+	delayed atomic.Uint64 // listings delayed by the rate
+	paced   atomic.Int64  // time waited for the rate
+	pauses  atomic.Uint64 // pauses after directory errors
+	paused  atomic.Int64  // time paused after directory errors
+}
+
+func newWalkPacer(rate float64, pauseOnErrors bool, out io.Writer) *walkPacer {
+	return &walkPacer{rate: rate, pauseOnErrors: pauseOnErrors, out: out, now: time.Now, sleep: time.Sleep}
+}
+
+// wait blocks before a directory listing for the pending error pause and the rate,
+// it returns false as soon as interrupted returns true
+func (wp *walkPacer) wait(interrupted func() bool) bool {
+	if wp.pause > 0 {
+		pause := wp.pause
+		wp.pause = 0
+		fmt.Fprintf(wp.out, "walk paused %s after %d consecutive directory errors\n", pause, wp.errors)
+		wp.pauses.Add(1)
+		wp.paused.Add(int64(pause))
+		if !wp.sleepFor(pause, interrupted) {
+			return false
+		}
+	}
+	if wp.rate <= 0 {
+		return true
+	}
+	now := wp.now()
+	if delay := wp.next.Sub(now); delay > 0 {
+		if !wp.announced {
+			wp.announced = true
+			fmt.Fprintf(wp.out, "walk paced at %g directory listings/s\n", wp.rate)
+		}
+		wp.delayed.Add(1)
+		wp.paced.Add(int64(delay))
+		if !wp.sleepFor(delay, interrupted) {
+			return false
+		}
+		now = wp.next
+	}
+	wp.next = now.Add(time.Duration(float64(time.Second) / wp.rate))
+	return true
+}
+
+// sleepFor sleeps d by walkSleepInterval steps, returning false when interrupted
+func (wp *walkPacer) sleepFor(d time.Duration, interrupted func() bool) bool {
+	for d > 0 {
+		if interrupted() {
+			return false
+		}
+		step := d
+		if step > walkSleepInterval {
+			step = walkSleepInterval
+		}
+		wp.sleep(step)
+		d -= step
+	}
+	return !interrupted()
+}
+
+// dirError accounts a directory error, scheduling a pause before the next listing once they spike
+func (wp *walkPacer) dirError() {
+	if !wp.pauseOnErrors {
+		return
+	}
+	wp.errors++
+	if wp.errors < walkPauseErrors {
+		return
+	}
+	wp.pause = walkPauseBase << (wp.errors - walkPauseErrors)
+	if wp.pause > walkPauseMax || wp.pause <= 0 {
+		wp.pause = walkPauseMax
+	}
+}
+
+// listed accounts a file found by a listing, the directories are readable again
+func (wp *walkPacer) listed() {
+	wp.errors = 0
+	wp.pause = 0
+}
+
+func (wp *walkPacer) printSummary(w io.Writer) {
+	fmt.Fprintf(
+		w,
+		"Walk pacing: %d listings delayed %s by the rate, %d pauses of %s after directory errors\n",
+		wp.delayed.Load(),
+		time.Duration(wp.paced.Load()).Round(time.Millisecond),
+		wp.pauses.Load(),
+		time.Duration(wp.paused.Load()).Round(time.Millisecond),
+	)
+}
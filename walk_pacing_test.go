@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock advances when slept on
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) pacer(rate float64, pauseOnErrors bool, out io.Writer) *walkPacer {
+	wp := newWalkPacer(rate, pauseOnErrors, out)
+	wp.now = func() time.Time { return c.now }
+	wp.sleep = func(d time.Duration) {
+		c.slept = append(c.slept, d)
+		c.now = c.now.Add(d)
+	}
+	return wp
+}
+
+func TestWalkPacerRate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	out := &bytes.Buffer{}
+	wp := clock.pacer(10, false, out)
+	never := func() bool { return false }
+	for i := 0; i < 3; i++ {
+		if !wp.wait(never) {
+			t.Fatal("interrupted")
+		}
+	}
+	// 100ms between listings, slept in 50ms steps
+	if clock.now != time.Unix(0, 0).Add(200*time.Millisecond) || len(clock.slept) != 4 {
+		t.Errorf("got %s after %v", clock.now.Sub(time.Unix(0, 0)), clock.slept)
+	}
+	clock.now = clock.now.Add(time.Second) // idle time does not build up a burst
+	wp.wait(never)
+	wp.wait(never)
+	if wp.delayed.Load() != 3 || time.Duration(wp.paced.Load()) != 300*time.Millisecond {
+		t.Errorf("got %d delayed %s", wp.delayed.Load(), time.Duration(wp.paced.Load()))
+	}
+	if strings.Count(out.String(), "walk paced at 10 directory listings/s\n") != 1 {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestWalkPacerErrors(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	out := &bytes.Buffer{}
+	wp := clock.pacer(0, true, out)
+	never := func() bool { return false }
+	var pauses []time.Duration
+	for i := 0; i < 5; i++ {
+		wp.dirError()
+		start := clock.now
+		wp.wait(never)
+		pauses = append(pauses, clock.now.Sub(start))
+	}
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second, 2 * time.Second}
+	for i := range expected {
+		if pauses[i] != expected[i] {
+			t.Errorf("got pauses %v, expected %v", pauses, expected)
+			break
+		}
+	}
+	wp.listed()
+	wp.dirError()
+	start := clock.now
+	wp.wait(never)
+	if clock.now != start || wp.pauses.Load() != 3 {
+		t.Errorf("the pause was not reset by a listed file: %s, %d pauses", clock.now.Sub(start), wp.pauses.Load())
+	}
+	for i := 0; i < 20; i++ {
+		wp.dirError()
+	}
+	if wp.pause != walkPauseMax {
+		t.Errorf("got pause %s, expected the %s cap", wp.pause, walkPauseMax)
+	}
+	if !strings.Contains(out.String(), "walk paused 2s after 5 consecutive directory errors\n") {
+		t.Errorf("got %q", out.String())
+	}
+
+	// an interrupt stops the pause at the next step
+	steps := 0
+	if wp.wait(func() bool { steps++; return steps > 3 }) {
+		t.Error("the pause was not interrupted")
+	}
+	if clock.now.Sub(start) != 3*walkSleepInterval {
+		t.Errorf("slept %s after the interrupt", clock.now.Sub(start))
+	}
+}
+
+func TestWalkPacing(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "f"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	debug := &bytes.Buffer{}
+	setup := func(mc *MassCRC32C) {
+		mc.DebugOut = debug
+		mc.EnableWalkPacing(50, false)
+	}
+	start := time.Now()
+	mc := runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		fi := FileInput{mc: mc}
+		fi.Run([]string{root}, false)
+	})
+	mc.PrintSummary()
+	// 4 listings, the 3 last ones 20ms apart
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond || mc.Stats().Files != 3 {
+		t.Errorf("walked %d files in %s", mc.Stats().Files, elapsed)
+	}
+	if !strings.Contains(debug.String(), "Walk pacing: 3 listings delayed") {
+		t.Errorf("got %q", debug.String())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// workerStats accumulates what a worker did, written by its own goroutine and
+// read concurrently by the summary on SIGUSR1
+type workerStats struct {
+	id    int
+	files atomic.Uint64
+	bytes atomic.Uint64
+	busy  atomic.Int64 // handling items
+	idle  atomic.Int64 // waiting on the queue
+}
+
+// printWorkerStats prints a table sorted by bytes and the ratio of the busiest worker bytes
+// to the mean, 1 when the work is evenly spread
+func printWorkerStats(w io.Writer, stats []*workerStats) {
+	if len(stats) == 0 {
+		return
+	}
+	sorted := append([]*workerStats(nil), stats...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].bytes.Load() > sorted[j].bytes.Load() })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Worker\tFiles\tBytes\tBusy\tIdle\t")
+	total := uint64(0)
+	for _, ws := range sorted {
+		total += ws.bytes.Load()
+		fmt.Fprintf(
+			tw,
+			"%d\t%d\t%d\t%s\t%s\t\n",
+			ws.id,
+			ws.files.Load(),
+			ws.bytes.Load(),
+			time.Duration(ws.busy.Load()).Round(time.Millisecond),
+			time.Duration(ws.idle.Load()).Round(time.Millisecond),
+		)
+	}
+	tw.Flush()
+	imbalance := 1.0
+	if total > 0 {
+		imbalance = float64(sorted[0].bytes.Load()) / (float64(total) / float64(len(sorted)))
+	}
+	fmt.Fprintf(w, "Worker imbalance (max/mean bytes): %.2f\n", imbalance)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkerStats(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, size := range []int{10, 1000, 100000} {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	debugOut := &bytes.Buffer{}
+	mc := runPaths(t, 3, append(paths, filepath.Join(dir, "missing")), func(mc *MassCRC32C) {
+		mc.readSizeG = 4096
+		mc.DebugOut = debugOut
+		mc.ExtendedSummary = true
+	})
+
+	files, bytesRead := uint64(0), uint64(0)
+	for _, ws := range mc.workerStats {
+		files += ws.files.Load()
+		bytesRead += ws.bytes.Load()
+	}
+	if len(mc.workerStats) != 3 || files != 4 || bytesRead != 101010 {
+		t.Errorf("got %d workers, %d files, %d bytes", len(mc.workerStats), files, bytesRead)
+	}
+
+	mc.PrintSummary()
+	summary := debugOut.String()
+	if !strings.Contains(summary, "Worker  Files") || !strings.Contains(summary, "Worker imbalance (max/mean bytes): ") {
+		t.Errorf("missing worker table in:\n%s", summary)
+	}
+}
+
+func TestPrintWorkerStats(t *testing.T) {
+	var stats []*workerStats
+	for i, n := range []uint64{100, 700, 200} {
+		ws := &workerStats{id: i}
+		ws.files.Add(1)
+		ws.bytes.Add(n)
+		stats = append(stats, ws)
+	}
+	out := &bytes.Buffer{}
+	printWorkerStats(out, stats)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+	for i, id := range []string{"1", "2", "0"} {
+		if fields := strings.Fields(lines[i+1]); fields[0] != id {
+			t.Errorf("row %d is worker %s, want %s sorted by bytes", i, fields[0], id)
+		}
+	}
+	if lines[4] != "Worker imbalance (max/mean bytes): 2.10" {
+		t.Errorf("got %q", lines[4])
+	}
+
+	out.Reset()
+	printWorkerStats(out, nil)
+	if out.Len() != 0 {
+		t.Errorf("no table expected without local workers, got %q", out)
+	}
+}
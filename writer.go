@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	writerBusyHint       = 0.5 // fraction of the wall time spent writing making the output the bottleneck
+	writerBusyMinWall    = 10 * time.Second
+	writerBusyCheckEvery = 4096  // records
+	defaultOrderedWindow = 10000 // -ordered results held waiting for a slower one
+)
+
+// fileResult is produced by the workers and consumed by the single writer goroutine
+type fileResult struct {
+	item     QueueItem
+	crc      string
+	size     uint64
+	mtime    int64    // unix time, only known with -sqlite
+	stat     fileStat // only known with -stat-fields
+	chunks   []chunkRecord
+	err      error
+	carried  bool         // carried forward by -since instead of read
+	bad      *badBlocks   // the unreadable ranges of a partial record, nil when the whole file was read
+	edges    *edgeDigests // the -edge-digest edges, nil when off
+	filtered bool         // out of the size range or modification time window, only sent with -ordered for the writer to move on
+}
+
+// timedWriter accumulates the time spent blocked in the Write calls of the output,
+// time.Now is read from the vDSO so no syscall nor allocation is added per record
+type timedWriter struct {
+	w      io.Writer
+	busy   atomic.Int64
+	failed uint64 // Write calls returning an error, writer goroutine only
+}
+
+func (tw *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := tw.w.Write(p)
+	tw.busy.Add(int64(time.Since(start)))
+	if err != nil {
+		tw.failed++
+	}
+	return n, err
+}
+
+// writerStats tracks the output of the writer goroutine
+type writerStats struct {
+	out      timedWriter
+	maxQueue atomic.Int64
+
+	// writer goroutine only
+	start   time.Time
+	records uint64
+	hinted  bool
+
+	markEvery   uint64 // records between two progress markers, none when 0
+	markedFiles uint64
+	markedBytes uint64
+}
+
+// observeWriter samples the pending results depth and checks once in a while if the output is the bottleneck
+func (mc *MassCRC32C) observeWriter() {
+	ws := &mc.writerStats
+	if depth := int64(len(mc.results)); depth > ws.maxQueue.Load() {
+		ws.maxQueue.Store(depth)
+	}
+	ws.records++
+	if ws.hinted || ws.records%writerBusyCheckEvery != 0 {
+		return
+	}
+	wall := time.Since(ws.start)
+	if wall < writerBusyMinWall || mc.writerBusyFraction(wall) < writerBusyHint {
+		return
+	}
+	ws.hinted = true
+	fmt.Fprintf(
+		mc.DebugOut,
+		"hint: the writer is busy %.0f%% of the wall time writing the output, the readers wait for it: "+
+			"use -c, a faster destination or shard the output\n",
+		mc.writerBusyFraction(wall)*100,
+	)
+}
+
+// markProgress counts a written record and writes a progress marker after every markEvery records,
+// between two records since the writer goroutine writes both
+func (mc *MassCRC32C) markProgress(size uint64) {
+	ws := &mc.writerStats
+	ws.markedFiles++
+	ws.markedBytes += size
+	if ws.markedFiles%ws.markEvery == 0 {
+		mc.writeProgressMarker()
+	}
+}
+
+// writeProgressMarker writes a comment line skipped by the manifest parsers
+func (mc *MassCRC32C) writeProgressMarker() {
+	ws := &mc.writerStats
+	fmt.Fprintf(&ws.out, "# progress files=%d bytes=%d ts=%s%s", ws.markedFiles, ws.markedBytes, time.Now().UTC().Format(time.RFC3339), mc.lineEnd())
+}
+
+func (mc *MassCRC32C) writerBusyFraction(wall time.Duration) float64 {
+	if wall <= 0 {
+		return 0
+	}
+	return float64(mc.writerStats.out.busy.Load()) / float64(wall)
+}
+
+func (mc *MassCRC32C) printWriterStats(stats Stats) {
+	fmt.Fprintf(
+		mc.DebugOut,
+		"Writer busy %.0f%% of wall time, %d results queued (max %d)\n",
+		mc.writerBusyFraction(stats.Elapsed())*100,
+		len(mc.results),
+		mc.writerStats.maxQueue.Load(),
+	)
+}
+
+// writeResults is the only goroutine writing records, so outputs never interleave
+func (mc *MassCRC32C) writeResults() {
+	defer close(mc.writerDone)
+	if mc.stream != nil && mc.stream.out != nil {
+		defer close(mc.stream.out)
+	}
+	if mc.writerStats.markEvery > 0 {
+		defer mc.writeProgressMarker()
+	}
+	mc.writerStats.out.w = mc.StdOut
+	mc.writerStats.start = time.Now()
+	writeHeader := mc.writeHeader
+	if writeHeader == nil && mc.recordFormat == "text" && (mc.buildHeader || mc.crc.params.polyHeader() != "") {
+		writeHeader = mc.writeTextHeader
+	}
+	if mc.schemaHeader && (mc.recordFormat == "csv" || mc.recordFormat == "jsonl") {
+		writeHeader = mc.withSchemaHeader(writeHeader)
+	}
+	if writeHeader != nil && mc.nulRecords {
+		writeHeader = nulTerminatedHeader(writeHeader)
+	}
+	if writeHeader != nil {
+		writeHeader(&mc.writerStats.out)
+		if mc.cleanOut != nil {
+			writeHeader(mc.cleanOut.out)
+		}
+	}
+	if !mc.ordered {
+		for res := range mc.results {
+			mc.schedCheckpoint(mc.writerProbe)
+			mc.observeWriter()
+			mc.writeResult(res)
+		}
+		return
+	}
+	// results complete out of order, hold them until the previous ones are written, at most the
+	// window of EnableOrderedOutput as every written result frees the slot of a producer
+	pending := make(map[uint64]fileResult)
+	next := uint64(0)
+	for res := range mc.results {
+		mc.schedCheckpoint(mc.writerProbe)
+		mc.observeWriter()
+		pending[res.item.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			mc.writeResult(res)
+			if !res.item.priority {
+				<-mc.orderSlots // the injected paths take no slot
+			}
+			next++
+		}
+	}
+}
+
+// writeResult writes the records of a result, all of them from its Result as the library users get it
+func (mc *MassCRC32C) writeResult(res fileResult) {
+	if res.filtered {
+		return
+	}
+	if mc.outSpace != nil {
+		mc.outSpace.check(time.Now())
+	}
+	if mc.recorder != nil {
+		mc.recorder.result(res)
+	}
+	r := mc.result(res)
+	if r.Err != nil {
+		mc.recordErr(errScopeFile, res.item.worker, r.Path, r.Err)
+	} else {
+		if res.bad != nil {
+			mc.printErr(errScopeFile, res.item.worker, r.Path, res.bad)
+		}
+		failed := mc.writerStats.out.failed
+		mc.writeRecord(&mc.writerStats.out, r)
+		if mc.writerStats.out.failed == failed {
+			mc.accounting.recorded[recordResult].Add(1)
+		}
+		if mc.writerStats.markEvery > 0 {
+			mc.markProgress(r.Size)
+		}
+		if mc.cleanOut != nil {
+			mc.cleanOut.add(r, mc.writeRecord)
+		}
+		if mc.chunkOut != nil {
+			writeChunkRecords(mc.chunkOut, r)
+		}
+		rec := manifestRecord{Path: r.Path, CRC: r.CRC, Size: r.Size}
+		if mc.indexOut != nil {
+			err := mc.indexOut.Add(rec)
+			if err != nil {
+				fmt.Fprintf(mc.DebugOut, "Error: failed to write indexed manifest: %v\n", err)
+				mc.indexOut.Abort()
+				mc.indexOut = nil
+			}
+		}
+		if mc.fingerprint != nil {
+			err := mc.fingerprint.Add(rec)
+			if err != nil {
+				fmt.Fprintf(mc.DebugOut, "Error: failed to compute the fingerprint: %v\n", err)
+				mc.fingerprint = nil
+			}
+		}
+		if mc.sqliteOut != nil {
+			err := mc.sqliteOut.Add(rec, r.ModTime)
+			if err != nil {
+				fmt.Fprintf(mc.DebugOut, "Error: failed to write sqlite database: %v\n", err)
+				mc.sqliteOut.Close()
+				mc.sqliteOut = nil
+			}
+		}
+	}
+	if mc.dirEvents != nil {
+		mc.dirEvents.fileDone(r.Path, r.Size, r.Err == nil)
+	}
+	if mc.stream != nil && mc.stream.out != nil {
+		mc.stream.send(r)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type slowWriter struct {
+	delay time.Duration
+}
+
+func (sw slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(sw.delay)
+	return len(p), nil
+}
+
+func TestWriterStats(t *testing.T) {
+	debugOut := &bytes.Buffer{}
+	paths := make([]string, 40)
+	for i := range paths {
+		paths[i] = "test_data.txt"
+	}
+	mc := runPaths(t, 4, paths, func(mc *MassCRC32C) {
+		mc.StdOut = slowWriter{delay: 5 * time.Millisecond}
+		mc.DebugOut = debugOut
+		mc.ExtendedSummary = true
+	})
+
+	if busy := time.Duration(mc.writerStats.out.busy.Load()); busy < 40*5*time.Millisecond {
+		t.Errorf("expected at least 200ms blocked writing, got %s", busy)
+	}
+	if mc.writerStats.maxQueue.Load() == 0 {
+		t.Error("results must have queued behind the slow writer")
+	}
+	mc.PrintSummary()
+	if !strings.Contains(debugOut.String(), "Writer busy ") || !strings.Contains(debugOut.String(), " results queued (max ") {
+		t.Errorf("missing writer stats in:\n%s", debugOut)
+	}
+}
+
+// Test the diagnostic signal prints the writer stats along the goroutine counts
+func TestWriterStatsSignal(t *testing.T) {
+	if len(diagnosticSignals) == 0 {
+		t.Skip("no diagnostic signal on this platform")
+	}
+	debugOut, written := &bytes.Buffer{}, make(chan struct{})
+	setup := func(mc *MassCRC32C) {
+		mc.DebugOut = signalledWriter{debugOut, written}
+	}
+	runPipeline(t, 1, setup, func(mc *MassCRC32C) {
+		process, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := process.Signal(diagnosticSignals[0]); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-written:
+		case <-time.After(5 * time.Second):
+			t.Error("no diagnostics printed")
+		}
+	})
+	if !strings.Contains(debugOut.String(), "Writer busy ") {
+		t.Errorf("missing writer stats in:\n%s", debugOut)
+	}
+}
+
+// signalledWriter closes written once the writer stats are written to w
+type signalledWriter struct {
+	w       *bytes.Buffer
+	written chan struct{}
+}
+
+func (sw signalledWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	if bytes.HasPrefix(p, []byte("Writer busy ")) {
+		close(sw.written)
+	}
+	return n, err
+}
+
+func TestWriterBusyHint(t *testing.T) {
+	debugOut := &bytes.Buffer{}
+	mc := InitMassCRC32C(1, 1)
+	mc.DebugOut = debugOut
+	ws := &mc.writerStats
+	ws.start = time.Now().Add(-20 * time.Second)
+	ws.out.busy.Store(int64(5 * time.Second))
+	for i := 0; i < writerBusyCheckEvery; i++ {
+		mc.observeWriter()
+	}
+	if debugOut.Len() != 0 {
+		t.Fatalf("no hint expected at 25%% busy, got %q", debugOut)
+	}
+	ws.out.busy.Store(int64(15 * time.Second))
+	for i := 0; i < 3*writerBusyCheckEvery; i++ {
+		mc.observeWriter()
+	}
+	if strings.Count(debugOut.String(), "hint: the writer is busy 75%") != 1 {
+		t.Errorf("expected a single hint, got %q", debugOut)
+	}
+}
+
+// Test the progress markers fall between records and are skipped by the manifest parser
+func TestProgressMarkers(t *testing.T) {
+	out := &bytes.Buffer{}
+	paths := make([]string, 5)
+	for i := range paths {
+		paths[i] = "test_data.txt"
+	}
+	runPaths(t, 3, paths, func(mc *MassCRC32C) {
+		mc.StdOut = out
+		mc.EnableOrderedOutput(defaultOrderedWindow)
+		mc.EnableProgressMarkers(2)
+	})
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if fields := strings.Fields(line); fields[0] == "#" {
+			got = append(got, fields[2]+" "+fields[3])
+		} else {
+			got = append(got, "record")
+		}
+	}
+	expected := []string{
+		"record", "record", "files=2 bytes=7076",
+		"record", "record", "files=4 bytes=14152",
+		"record", "files=5 bytes=17690",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+
+	mp, err := newManifestParser("out", out, true, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := 0
+	for {
+		_, err := mp.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+	if records != 5 {
+		t.Errorf("got %d records, expected 5", records)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// setRootDevice records the device of the root walked with -xdev, the walk then stays on it
+func (fi *FileInput) setRootDevice(root string) {
+	fi.rootDevice, fi.rootDeviceKnown = 0, false
+	if info, err := os.Stat(longPath(root)); err == nil {
+		fi.rootDevice, fi.rootDeviceKnown = deviceOf(info)
+	}
+}
+
+// crossesDevice tells whether the directory path is on another device than its root, a mount point
+// not to enter with -xdev, counting it. A directory failing to be stated is left to the walk to report.
+func (fi *FileInput) crossesDevice(path string, dir fs.DirEntry) bool {
+	if !fi.rootDeviceKnown || path == fi.root {
+		return false
+	}
+	info, err := dir.Info()
+	if err != nil {
+		return false
+	}
+	if device, ok := deviceOf(info); !ok || device == fi.rootDevice {
+		return false
+	}
+	fmt.Fprintf(fi.mc.DebugOut, "not crossing into mount: %s\n", path)
+	fi.mc.mountsSkipped.Add(1)
+	return true
+}
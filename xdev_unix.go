@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// xdevSupported tells whether the files carry the ID of their device for -xdev
+const xdevSupported = true
+
+// deviceOf is the ID of the device of the file of info
+func deviceOf(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
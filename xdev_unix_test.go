@@ -0,0 +1,87 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// mountedEntry is a directory entry reporting another device, like a mount point
+type mountedEntry struct {
+	fs.DirEntry
+}
+
+type mountedInfo struct {
+	fs.FileInfo
+	st syscall.Stat_t
+}
+
+func (me mountedEntry) Info() (fs.FileInfo, error) {
+	info, err := me.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	mi := mountedInfo{FileInfo: info, st: *info.Sys().(*syscall.Stat_t)}
+	mi.st.Dev++
+	return mi, nil
+}
+
+func (mi mountedInfo) Sys() any {
+	return &mi.st
+}
+
+// mountWalkDir walks like filepath.WalkDir with the directories named mount on another device
+func mountWalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if d != nil && d.IsDir() && d.Name() == "mount" {
+			d = mountedEntry{d}
+		}
+		return fn(path, d, err)
+	})
+}
+
+func TestXdev(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"f", "dir/f", "mount/f", "dir/mount/sub/f"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, xdev := range []bool{false, true} {
+		out, debugOut := &bytes.Buffer{}, &bytes.Buffer{}
+		mc := runPipeline(t, 1, func(mc *MassCRC32C) { mc.StdOut = out }, func(mc *MassCRC32C) {
+			fi := FileInput{mc: mc, xdev: xdev, walkDir: mountWalkDir}
+			fi.walkRoots([]string{root, filepath.Join(root, "mount")})
+		})
+		var paths []string
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			rel, _ := filepath.Rel(root, line[strings.LastIndexByte(line, ' ')+1:])
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		sort.Strings(paths)
+		// a root on another device is walked
+		expected, skipped := "dir/f dir/mount/sub/f f mount/f mount/f", uint64(0)
+		if xdev {
+			expected, skipped = "dir/f f mount/f", 2
+		}
+		if got := strings.Join(paths, " "); got != expected || mc.mountsSkipped.Load() != skipped {
+			t.Errorf("-xdev=%t: got %s, %d mounts skipped, expected %s", xdev, got, mc.mountsSkipped.Load(), expected)
+		}
+		mc.DebugOut = debugOut
+		mc.PrintSummary()
+		if strings.Contains(debugOut.String(), "Mount points not crossed: 2\n") != xdev {
+			t.Errorf("-xdev=%t: got summary %q", xdev, debugOut.String())
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "io/fs"
+
+// xdevSupported is false, the info of the walk carries no volume on windows
+const xdevSupported = false
+
+func deviceOf(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
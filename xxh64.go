@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxh64 is the seed 0 xxHash64 of -algo xxh64, for the local duplicate scans not needing GCS compatible
+// checksums. It hashes the 32 byte stripes of 4 lanes, buffering the bytes of a stripe split by the reads.
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int // bytes buffered in mem
+}
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+func newXXH64() *xxh64 {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	prime1, prime2 := xxhPrime1, xxhPrime2 // wrapping, unlike the constant expressions
+	h.v = [4]uint64{prime1 + prime2, prime2, 0, -prime1}
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxhPrime2, 31) * xxhPrime1
+}
+
+func xxhMergeRound(acc, val uint64) uint64 {
+	return (acc^xxhRound(0, val))*xxhPrime1 + xxhPrime4
+}
+
+func (h *xxh64) stripes(p []byte) []byte {
+	v1, v2, v3, v4 := h.v[0], h.v[1], h.v[2], h.v[3]
+	for ; len(p) >= 32; p = p[32:] {
+		stripe := p[:32:len(p)]
+		v1 = xxhRound(v1, binary.LittleEndian.Uint64(stripe[0:8]))
+		v2 = xxhRound(v2, binary.LittleEndian.Uint64(stripe[8:16]))
+		v3 = xxhRound(v3, binary.LittleEndian.Uint64(stripe[16:24]))
+		v4 = xxhRound(v4, binary.LittleEndian.Uint64(stripe[24:32]))
+	}
+	h.v = [4]uint64{v1, v2, v3, v4}
+	return p
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(written)
+	if h.n > 0 {
+		copied := copy(h.mem[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < 32 {
+			return written, nil
+		}
+		h.stripes(h.mem[:])
+		h.n = 0
+	}
+	h.n = copy(h.mem[:], h.stripes(p))
+	return written, nil
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = xxhMergeRound(acc, v)
+		}
+	} else {
+		acc = h.v[2] + xxhPrime5
+	}
+	acc += h.total
+	p := h.mem[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxhPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxhPrime1
+	}
+	acc ^= acc >> 33
+	acc *= xxhPrime2
+	acc ^= acc >> 29
+	acc *= xxhPrime3
+	acc ^= acc >> 32
+	return acc
+}
+
+// Sum appends the big endian hash, the canonical byte order of the xxhsum hex digests
+func (h *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		data string
+		sum  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, test := range tests {
+		h := newXXH64()
+		h.Write([]byte(test.data))
+		if h.Sum64() != test.sum {
+			t.Errorf("%q: got %016x, expected %016x", test.data, h.Sum64(), test.sum)
+		}
+		if got := fmt.Sprintf("%x", h.Sum(nil)); got != fmt.Sprintf("%016x", test.sum) {
+			t.Errorf("%q: got digest %s", test.data, got)
+		}
+	}
+}
+
+// Test the stripes split by the reads are hashed like the whole data
+func TestXXH64Split(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 30)
+	whole := newXXH64()
+	whole.Write(data)
+	for _, size := range []int{1, 7, 31, 32, 33, 100} {
+		h := newXXH64()
+		h.Write([]byte("garbage"))
+		h.Reset()
+		for p := data; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if h.Sum64() != whole.Sum64() {
+			t.Errorf("writes of %d: got %016x, expected %016x", size, h.Sum64(), whole.Sum64())
+		}
+	}
+}